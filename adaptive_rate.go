@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Fraction of the rate range added every interval that the p99 is
+	// below target.
+	adaptiveRateIncrease = 0.05
+	// Factor the rate is multiplied by every interval that the p99 is
+	// above target.
+	adaptiveRateDecrease = 0.75
+)
+
+/*
+ * A point in the rate timeline of an adaptive rate job.
+ */
+type RateChange struct {
+	Time time.Duration `json:"time"`
+	Rate float64       `json:"rate"`
+	P99  time.Duration `json:"p99"`
+}
+
+/*
+ * An AIMD controller that adjusts the rate of a job to keep its p99 latency
+ * under a target: every interval, the rate is increased additively if the
+ * p99 latency observed during the interval is under the target and
+ * decreased multiplicatively otherwise.
+ */
+type AdaptiveRate struct {
+	TargetP99 time.Duration
+	MinRate   float64
+	MaxRate   float64
+	Interval  time.Duration
+
+	m         sync.Mutex
+	rate      float64
+	latencies []time.Duration
+	timeline  []RateChange
+}
+
+func (ar *AdaptiveRate) Start(rate float64, now time.Duration) {
+	ar.m.Lock()
+	defer ar.m.Unlock()
+
+	ar.rate = rate
+	ar.timeline = append(ar.timeline, RateChange{now, rate, 0})
+}
+
+func (ar *AdaptiveRate) Record(elapsed time.Duration) {
+	ar.m.Lock()
+	defer ar.m.Unlock()
+
+	ar.latencies = append(ar.latencies, elapsed)
+}
+
+/*
+ * Computes the rate for the next interval from the latencies recorded
+ * during the last one. Returns the new rate and whether it changed.
+ */
+func (ar *AdaptiveRate) Adjust(now time.Duration) (float64, bool) {
+	ar.m.Lock()
+	defer ar.m.Unlock()
+
+	if len(ar.latencies) == 0 {
+		return ar.rate, false
+	}
+	p99 := durationPercentile(ar.latencies, 0.99)
+	ar.latencies = ar.latencies[:0]
+
+	rate := ar.rate
+	if p99 <= ar.TargetP99 {
+		rate = math.Min(ar.MaxRate, rate+adaptiveRateIncrease*(ar.MaxRate-ar.MinRate))
+	} else {
+		rate = math.Max(ar.MinRate, rate*adaptiveRateDecrease)
+	}
+	if rate == ar.rate {
+		return rate, false
+	}
+
+	ar.rate = rate
+	ar.timeline = append(ar.timeline, RateChange{now, rate, p99})
+	return rate, true
+}
+
+func (ar *AdaptiveRate) Timeline() []RateChange {
+	ar.m.Lock()
+	defer ar.m.Unlock()
+
+	return append([]RateChange(nil), ar.timeline...)
+}
+
+func rateTimelineString(timeline []RateChange) string {
+	var str strings.Builder
+	for _, rc := range timeline {
+		str.WriteString(fmt.Sprintf("%12v: %.3f (p99 %v)\n", rc.Time, rc.Rate, rc.P99))
+	}
+	return str.String()
+}
+
+/*
+ * Returns the p-th percentile (0 <= p <= 1) of the given latencies using
+ * the nearest rank method. Sorts the latencies in place.
+ */
+func durationPercentile(latencies []time.Duration, p float64) time.Duration {
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	rank := int(math.Ceil(p*float64(len(latencies)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return latencies[rank]
+}
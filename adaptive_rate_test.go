@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveRate(t *testing.T) {
+	ar := &AdaptiveRate{TargetP99: 10 * time.Millisecond, MinRate: 10, MaxRate: 110}
+	ar.Start(10, 0)
+
+	if _, changed := ar.Adjust(time.Second); changed {
+		t.Errorf("Unexpected rate change with no latencies recorded")
+	}
+
+	ar.Record(time.Millisecond)
+	if rate, _ := ar.Adjust(2 * time.Second); rate != 15 {
+		t.Errorf("Expected additive increase to 15 but got %v", rate)
+	}
+
+	for i := 0; i < 100; i++ {
+		ar.Record(time.Millisecond)
+	}
+	ar.Record(time.Second)
+	if rate, _ := ar.Adjust(3 * time.Second); rate != 20 {
+		t.Errorf("Expected a single outlier to be ignored but got %v", rate)
+	}
+
+	for i := 0; i < 10; i++ {
+		ar.Record(time.Second)
+	}
+	if rate, _ := ar.Adjust(4 * time.Second); rate != 15 {
+		t.Errorf("Expected multiplicative decrease to 15 but got %v", rate)
+	}
+
+	if timeline := ar.Timeline(); len(timeline) != 4 {
+		t.Errorf("Expected 4 rate changes but got %v", timeline)
+	}
+}
+
+func TestDurationPercentile(t *testing.T) {
+	latencies := []time.Duration{5, 1, 4, 2, 3}
+	for _, c := range []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, 1}, {0.5, 3}, {0.99, 5}, {1, 5},
+	} {
+		if actual := durationPercentile(latencies, c.p); actual != c.expected {
+			t.Errorf("For p%v expected %v but got %v", c.p*100, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * The latencies of the baseline of a job, subtracted from its latencies in
+ * the summary.
+ */
+type BaselineSummary struct {
+	TransactionLatency time.Duration            `json:"transactionLatency"`
+	Percentiles        map[string]time.Duration `json:"percentiles,omitempty"`
+}
+
+// Made absolute when the flags are parsed, before we change directory.
+var baselineFile string
+
+// The summary read from -baseline, see loadBaseline.
+var baselineSummary map[string]*JobStatsSummary
+
+func init() {
+	flag.Func("baseline", "Subtract the latencies of the jobs in this JSON "+
+		"output file of an earlier (e.g. idle) run from the latencies of the "+
+		"jobs with the same name, clamped at zero.",
+		func(name string) (err error) {
+			baselineFile, err = filepath.Abs(name)
+			return err
+		})
+}
+
+/*
+ * Reads the summary of a single iteration from a JSON output file, e.g. a
+ * -baseline or a file to -compare.
+ */
+func readSummaryFile(name string) (map[string]*JobStatsSummary, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		return nil, fmt.Errorf("%s must be the output of a single iteration, not of -repeat", name)
+	}
+	var summary map[string]*JobStatsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("invalid JSON output %s: %v", name, err)
+	}
+	return summary, nil
+}
+
+func subtractLatency(d, baseline time.Duration) time.Duration {
+	if d < baseline {
+		return 0
+	}
+	return d - baseline
+}
+
+/*
+ * Subtracts the latencies of the baseline from those of the jobs with the
+ * same name, recording what was subtracted. Returns the names of the jobs
+ * that had a baseline.
+ */
+func applyBaseline(summary map[string]*JobStatsSummary, baseline map[string]*JobStatsSummary) []string {
+	var names []string
+	for name, s := range summary {
+		b, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		names = append(names, name)
+		s.Baseline = &BaselineSummary{TransactionLatency: b.TransactionLatency}
+		s.TransactionLatency = subtractLatency(s.TransactionLatency, b.TransactionLatency)
+		for p, latency := range s.Percentiles {
+			if bl, ok := b.Percentiles[p]; ok {
+				if s.Baseline.Percentiles == nil {
+					s.Baseline.Percentiles = make(map[string]time.Duration)
+				}
+				s.Baseline.Percentiles[p] = bl
+				s.Percentiles[p] = subtractLatency(latency, bl)
+			}
+		}
+		for p, latency := range s.MergedPercentiles {
+			if bl, ok := b.Percentiles[p]; ok {
+				s.MergedPercentiles[p] = subtractLatency(latency, bl)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+ * Reads the -baseline, if any, before the test runs.
+ */
+func loadBaseline() (err error) {
+	if baselineFile != "" {
+		baselineSummary, err = readSummaryFile(baselineFile)
+	}
+	return err
+}
+
+/*
+ * Applies the -baseline, if any, to the summaries of each iteration.
+ */
+func applyBaselineFile(summaries []map[string]*JobStatsSummary) {
+	if baselineSummary == nil {
+		return
+	}
+	var names []string
+	for _, summary := range summaries {
+		names = applyBaseline(summary, baselineSummary)
+	}
+	if len(names) == 0 {
+		log.Printf("no job has a baseline in %s, the results are not adjusted", baselineFile)
+		return
+	}
+	log.Printf("the latencies of %s in the results are net of the baseline in %s. "+
+		"This is only an approximation: the latency of a job under load is not "+
+		"its idle latency plus a constant, so percentiles (unlike means) do not "+
+		"subtract, and a latency clamped at zero only means the job was no "+
+		"slower than its baseline.", strings.Join(names, ", "), baselineFile)
+}
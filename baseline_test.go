@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyBaseline(t *testing.T) {
+	summary := map[string]*JobStatsSummary{
+		"reads": &JobStatsSummary{
+			TransactionLatency: 5 * time.Millisecond,
+			Percentiles:        map[string]time.Duration{"p50": 4 * time.Millisecond, "p99": time.Millisecond},
+			MergedPercentiles:  map[string]time.Duration{"p50": 4 * time.Millisecond, "p99": time.Millisecond},
+		},
+		"writes": &JobStatsSummary{TransactionLatency: 7 * time.Millisecond},
+	}
+	baseline := map[string]*JobStatsSummary{
+		"reads": &JobStatsSummary{
+			TransactionLatency: 2 * time.Millisecond,
+			Percentiles:        map[string]time.Duration{"p50": time.Millisecond, "p99": 3 * time.Millisecond},
+		},
+	}
+
+	if names := applyBaseline(summary, baseline); !reflect.DeepEqual(names, []string{"reads"}) {
+		t.Errorf("Expected only reads to have a baseline but got %v", names)
+	}
+	reads := summary["reads"]
+	expected := map[string]time.Duration{"p50": 3 * time.Millisecond, "p99": 0}
+	if reads.TransactionLatency != 3*time.Millisecond || !reflect.DeepEqual(reads.Percentiles, expected) {
+		t.Errorf("Expected latency 3ms and percentiles %v but got %v and %v",
+			expected, reads.TransactionLatency, reads.Percentiles)
+	}
+	if !reflect.DeepEqual(reads.MergedPercentiles, expected) {
+		t.Errorf("Expected the percentiles across all iterations %v but got %v", expected, reads.MergedPercentiles)
+	}
+	if reads.Baseline == nil || reads.Baseline.TransactionLatency != 2*time.Millisecond {
+		t.Errorf("Expected the subtracted baseline to be reported but got %+v", reads.Baseline)
+	}
+	if writes := summary["writes"]; writes.TransactionLatency != 7*time.Millisecond || writes.Baseline != nil {
+		t.Errorf("Expected writes to be unmodified but got %+v", writes)
+	}
+}
+
+func TestReadSummaryFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing baseline: %v", err)
+		}
+		return path
+	}
+
+	baseline, err := readSummaryFile(write("single.json", `{"reads": {"transactionLatency": 2000000}}`))
+	if err != nil || baseline["reads"].TransactionLatency != 2*time.Millisecond {
+		t.Errorf("Expected a baseline of 2ms for reads but got %v, %v", baseline, err)
+	}
+	if _, err := readSummaryFile(write("repeat.json", `[{}, {}]`)); err == nil {
+		t.Errorf("Expected an error for the output of several iterations")
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+var compareRuns = flag.Bool("compare", false,
+	"Compare the JSON output files of two runs, given as arguments instead of "+
+		"a config file (dbbench -compare baseline.json current.json), and exit "+
+		"with 5 if the QPS or p99 latency of a job regressed by more than -threshold.")
+var regressionThreshold = flag.Float64("threshold", 10,
+	"The regression in percent above which -compare fails.")
+
+/*
+ * The QPS and p99 latency of a job in the baseline and current runs, and
+ * their change in percent (NaN if the baseline is zero).
+ */
+type jobComparison struct {
+	name                      string
+	baselineQPS, currentQPS   float64
+	baselineP99, currentP99   time.Duration
+	qpsChange, p99Change      float64
+	baselineOnly, currentOnly bool
+}
+
+func percentChange(baseline, current float64) float64 {
+	if baseline == 0 {
+		return math.NaN()
+	}
+	return (current - baseline) / baseline * 100
+}
+
+/*
+ * Whether the job regressed by more than threshold percent: its QPS
+ * dropped or its p99 latency rose. Jobs missing from either run, or with a
+ * zero baseline, cannot regress.
+ */
+func (c *jobComparison) regressed(threshold float64) bool {
+	return -c.qpsChange > threshold || c.p99Change > threshold
+}
+
+/*
+ * Compares the jobs of the two summaries with the same name, sorted by name.
+ */
+func compareSummaries(baseline, current map[string]*JobStatsSummary) []*jobComparison {
+	names := make(map[string]bool)
+	for name := range baseline {
+		names[name] = true
+	}
+	for name := range current {
+		names[name] = true
+	}
+	comparisons := make([]*jobComparison, 0, len(names))
+	for name := range names {
+		b, c := baseline[name], current[name]
+		cmp := &jobComparison{name: name, baselineOnly: c == nil, currentOnly: b == nil}
+		if b != nil && c != nil {
+			cmp.baselineQPS, cmp.currentQPS = b.QPS, c.QPS
+			cmp.baselineP99, cmp.currentP99 = b.Percentiles["p99"], c.Percentiles["p99"]
+			cmp.qpsChange = percentChange(cmp.baselineQPS, cmp.currentQPS)
+			cmp.p99Change = percentChange(float64(cmp.baselineP99), float64(cmp.currentP99))
+		}
+		comparisons = append(comparisons, cmp)
+	}
+	sort.Slice(comparisons, func(i, j int) bool {
+		return comparisons[i].name < comparisons[j].name
+	})
+	return comparisons
+}
+
+func formatChange(change float64) string {
+	if math.IsNaN(change) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.2f%%", change)
+}
+
+/*
+ * Writes a line per job with its QPS and p99 latency in both runs, and
+ * returns the names of the jobs that regressed by more than threshold.
+ */
+func writeComparison(w io.Writer, comparisons []*jobComparison, threshold float64) ([]string, error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprint(tw, "job\tbaseline QPS\tcurrent QPS\tchange\tbaseline p99\tcurrent p99\tchange\n")
+	var regressions []string
+	for _, c := range comparisons {
+		switch {
+		case c.baselineOnly:
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t-\tonly in the baseline\n", c.name)
+		case c.currentOnly:
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t-\tonly in the current run\n", c.name)
+		default:
+			fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%s\t%v\t%v\t%s", c.name,
+				c.baselineQPS, c.currentQPS, formatChange(c.qpsChange),
+				c.baselineP99, c.currentP99, formatChange(c.p99Change))
+			if c.regressed(threshold) {
+				fmt.Fprint(tw, "\tREGRESSION")
+				regressions = append(regressions, c.name)
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	return regressions, tw.Flush()
+}
+
+/*
+ * Compares the JSON output files of two runs (of a single iteration each),
+ * writing the comparison to w. Returns the names of the jobs that regressed.
+ */
+func compareOutputFiles(w io.Writer, baselineFile, currentFile string, threshold float64) ([]string, error) {
+	baseline, err := readSummaryFile(baselineFile)
+	if err != nil {
+		return nil, err
+	}
+	current, err := readSummaryFile(currentFile)
+	if err != nil {
+		return nil, err
+	}
+	return writeComparison(w, compareSummaries(baseline, current), threshold)
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompareSummaries(t *testing.T) {
+	baseline := map[string]*JobStatsSummary{
+		"reads":   {QPS: 1000, Percentiles: map[string]time.Duration{"p99": 2 * time.Millisecond}},
+		"writes":  {QPS: 100, Percentiles: map[string]time.Duration{"p99": 10 * time.Millisecond}},
+		"scans":   {QPS: 10, Percentiles: map[string]time.Duration{"p99": time.Second}},
+		"dropped": {QPS: 1},
+	}
+	current := map[string]*JobStatsSummary{
+		"reads":  {QPS: 850, Percentiles: map[string]time.Duration{"p99": 2 * time.Millisecond}},
+		"writes": {QPS: 105, Percentiles: map[string]time.Duration{"p99": 12 * time.Millisecond}},
+		"scans":  {QPS: 11, Percentiles: map[string]time.Duration{"p99": 1050 * time.Millisecond}},
+		"added":  {QPS: 1},
+	}
+
+	var buf bytes.Buffer
+	regressions, err := writeComparison(&buf, compareSummaries(baseline, current), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reads lost 15% of its QPS and the p99 of writes rose by 20%, while
+	// scans is within the threshold.
+	if expected := []string{"reads", "writes"}; !reflect.DeepEqual(regressions, expected) {
+		t.Errorf("Expected the regressions %v but got %v", expected, regressions)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("Expected a header and 5 jobs but got:\n%s", buf.String())
+	}
+	for i, expected := range []string{"job", "added", "dropped", "reads", "scans", "writes"} {
+		if !strings.HasPrefix(lines[i], expected+" ") {
+			t.Errorf("Expected line %d to be for %s but got %q", i, expected, lines[i])
+		}
+	}
+	if !strings.Contains(lines[3], "-15.00%") || !strings.HasSuffix(lines[3], "REGRESSION") {
+		t.Errorf("Expected reads to regress by 15%% but got %q", lines[3])
+	}
+	if !strings.HasSuffix(lines[4], "+5.00%") {
+		t.Errorf("Expected scans not to regress but got %q", lines[4])
+	}
+	if !strings.HasSuffix(lines[2], "only in the baseline") {
+		t.Errorf("Expected dropped to be only in the baseline but got %q", lines[2])
+	}
+
+	if regressions, _ := writeComparison(&buf, compareSummaries(baseline, current), 25); len(regressions) != 0 {
+		t.Errorf("Expected no regressions over 25%% but got %v", regressions)
+	}
+}
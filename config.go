@@ -17,13 +17,19 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -33,18 +39,82 @@ import (
 )
 
 type Config struct {
-	Flavor         DatabaseFlavor
-	Duration       time.Duration
-	Setup          []string
-	Teardown       []string
+	Flavor   DatabaseFlavor
+	Duration time.Duration
+	Setup    []string
+	Teardown []string
+	// Setup queries run before every iteration of the test (see -repeat),
+	// rather than once.
+	SetupEachIteration []string
+	// Queries run before each iteration of the test (see -repeat).
+	BetweenIterations []string
+	// Loaded after the setup, before the jobs run.
+	SeedData       *SeedData
 	Jobs           map[string]*Job
 	AcceptedErrors Set
+	// Errors that do not stop the test, but are reported separately from
+	// the accepted (ignored) errors.
+	ToleratedErrors Set
+	// Stop the test once all jobs have written an estimated this many
+	// bytes.
+	MaxWriteBytes int64
+	// The most queries in flight at once across all jobs.
+	MaxTotalConcurrency int
+	// Count the transactions that failed with only accepted errors in the
+	// goodput of the jobs.
+	AcceptedErrorsAreGoodput bool
+	// The most rows written to the query-results-file of each job that
+	// does not set its own.
+	ResultsMaxRows int64
+	// The most retries of the jobs with retries, as a fraction of their
+	// invocations.
+	RetryBudget float64
+
+	// With -run-until-stable, stops the test once the latencies are
+	// stable; only set while the test runs.
+	stability *stabilityTracker
 }
 
 func (c *Config) String() string {
 	return quotedStruct(c)
 }
 
+/*
+ * Resolves the variables of the expressions in config values: NCPU is the
+ * number of CPUs of this machine and $NAME the value of the environment
+ * variable NAME.
+ */
+func configExprVars(name string) (interface{}, bool) {
+	if name == "NCPU" {
+		return float64(runtime.NumCPU()), true
+	} else if strings.HasPrefix(name, "$") {
+		v, ok := os.LookupEnv(name[1:])
+		return v, ok
+	}
+	return nil, false
+}
+
+/*
+ * Parses a number, or evaluates an expression of configExprVars (e.g.
+ * "100 * NCPU") to a finite number.
+ */
+func parseNumberExpr(v string) (float64, error) {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, nil
+	}
+	expr, err := ParseExpr(v)
+	if err != nil {
+		return 0, err
+	}
+	f, err := expr.EvalNumber(configExprVars)
+	if err != nil {
+		return 0, err
+	} else if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("expression %s is not a finite number", strconv.Quote(v))
+	}
+	return f, nil
+}
+
 func readQueriesFromReader(df DatabaseFlavor, r io.Reader) ([]string, error) {
 	queries := make([]string, 0, 1)
 	if contents, err := ioutil.ReadAll(r); err != nil {
@@ -63,13 +133,142 @@ func readQueriesFromReader(df DatabaseFlavor, r io.Reader) ([]string, error) {
 }
 
 func readQueriesFromFile(df DatabaseFlavor, queryFile string) ([]string, error) {
-	file, err := os.Open(queryFile)
+	file, err := openQueryFile(queryFile)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	return readQueriesFromReader(df, file)
 }
 
+/*
+ * Parses a think time, either a duration or a duration plus or minus a
+ * jitter (e.g. 100ms±50ms).
+ */
+func parseThinkTime(v string) (time.Duration, time.Duration, error) {
+	base, jitter, hasJitter := v, "", false
+	for _, sep := range []string{"±", "+-"} {
+		if i := strings.Index(v, sep); i >= 0 {
+			base, jitter, hasJitter = v[:i], v[i+len(sep):], true
+			break
+		}
+	}
+	thinkTime, err := time.ParseDuration(strings.TrimSpace(base))
+	if err != nil {
+		return 0, 0, err
+	}
+	var thinkTimeJitter time.Duration
+	if hasJitter {
+		if thinkTimeJitter, err = time.ParseDuration(strings.TrimSpace(jitter)); err != nil {
+			return 0, 0, err
+		}
+	}
+	if thinkTime <= 0 || thinkTimeJitter < 0 {
+		return 0, 0, errors.New("think-time must be positive")
+	} else if thinkTimeJitter > thinkTime {
+		return 0, 0, errors.New("the jitter of think-time cannot be greater than the think time")
+	}
+	return thinkTime, thinkTimeJitter, nil
+}
+
+/*
+ * Reads think time samples, one duration per line. Blank lines and lines
+ * starting with # are ignored.
+ */
+func readThinkTimesFromFile(thinkTimeFile string) ([]time.Duration, error) {
+	file, err := openQueryFile(thinkTimeFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var thinkTimes []time.Duration
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", thinkTimeFile, line, err)
+		} else if d < 0 {
+			return nil, fmt.Errorf("%s:%d: negative think time", thinkTimeFile, line)
+		}
+		thinkTimes = append(thinkTimes, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(thinkTimes) == 0 {
+		return nil, fmt.Errorf("no think times in %s", thinkTimeFile)
+	}
+	return thinkTimes, nil
+}
+
+var fetchTimeout = flag.Duration("fetch-timeout", 30*time.Second,
+	"Timeout for fetching a query-file or query-log-file from an http(s) URL.")
+
+func isURL(v string) bool {
+	return strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")
+}
+
+/*
+ * Returns the path of a query file or query log, relative to the base
+ * directory unless it is absolute or an http(s) URL.
+ */
+func resolveQueryFilePath(basedir, v string) string {
+	if isURL(v) || filepath.IsAbs(v) {
+		return v
+	}
+	return filepath.Join(basedir, v)
+}
+
+/*
+ * Opens a query file or query log, which may be a local path or an http(s)
+ * URL. URLs are fetched entirely when the config is parsed.
+ */
+func openQueryFile(v string) (io.ReadCloser, error) {
+	if !isURL(v) {
+		return os.Open(v)
+	}
+
+	client := http.Client{Timeout: *fetchTimeout}
+	resp, err := client.Get(v)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", v, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", v, resp.Status)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %v", v, err)
+	}
+	return fetchedQueryFile{bytes.NewReader(contents)}, nil
+}
+
+/*
+ * A query file fetched from a URL, which can be read again from the start
+ * like a local file.
+ */
+type fetchedQueryFile struct {
+	*bytes.Reader
+}
+
+func (fetchedQueryFile) Close() error {
+	return nil
+}
+
+func parseResultsMaxRows(v string) (int64, error) {
+	rows, err := strconv.ParseInt(v, 10, 64)
+	if err == nil && rows <= 0 {
+		return 0, errors.New("results-max-rows must be positive")
+	}
+	return rows, err
+}
+
 type globalSectionParser struct {
 	config *Config
 	flavor DatabaseFlavor
@@ -84,8 +283,19 @@ var globalOptions = goini.DecodeOptionSet{
 			return e
 		},
 	},
+	"accepted-errors-are-goodput": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, transactions that failed only with accepted " +
+			"errors count towards the goodput of the jobs (default " +
+			"false: only successful transactions do).",
+		Parse: func(v string, gsp interface{}) (e error) {
+			gsp.(*globalSectionParser).config.AcceptedErrorsAreGoodput, e = strconv.ParseBool(v)
+			return e
+		},
+	},
 	"error": &goini.DecodeOption{Kind: goini.MultiOption,
-		Usage: "Globally accepted errors.",
+		Usage: "Globally accepted errors, by the error code of the " +
+			"driver or by SQLSTATE prefixed with sqlstate: (e.g. " +
+			"sqlstate:40001).",
 		Parse: func(v string, gspi interface{}) error {
 			gsp := gspi.(*globalSectionParser)
 			if gsp.config.AcceptedErrors == nil {
@@ -95,16 +305,115 @@ var globalOptions = goini.DecodeOptionSet{
 			return nil
 		},
 	},
+	"max-write-bytes": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Stop the test once the jobs have written an estimated this " +
+			"many bytes (e.g. 10GB), counting the text of write queries and " +
+			"their args.",
+		Parse: func(v string, gsp interface{}) (e error) {
+			gsp.(*globalSectionParser).config.MaxWriteBytes, e = parseByteSize(v)
+			return e
+		},
+	},
+	"retry-budget": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Cap the retries of the jobs with retries to this fraction " +
+			"of their invocations (e.g. 0.1), so that an outage does not " +
+			"make every invocation retry.",
+		Parse: func(v string, gspi interface{}) (e error) {
+			gsp := gspi.(*globalSectionParser)
+			gsp.config.RetryBudget, e = strconv.ParseFloat(v, 64)
+			if e == nil && !(gsp.config.RetryBudget > 0) {
+				return errors.New("retry-budget must be positive")
+			}
+			return e
+		},
+	},
+	"max-total-concurrency": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The most queries in flight at once across all jobs " +
+			"(whatever their queue-depth).",
+		Parse: func(v string, gspi interface{}) (e error) {
+			gsp := gspi.(*globalSectionParser)
+			gsp.config.MaxTotalConcurrency, e = strconv.Atoi(v)
+			if e == nil && gsp.config.MaxTotalConcurrency <= 0 {
+				return errors.New("max-total-concurrency must be positive")
+			}
+			return e
+		},
+	},
+	"results-max-rows": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The most rows written to the query-results-file of each " +
+			"job over the whole test, unless the job sets its own.",
+		Parse: func(v string, gspi interface{}) (e error) {
+			gsp := gspi.(*globalSectionParser)
+			gsp.config.ResultsMaxRows, e = parseResultsMaxRows(v)
+			return e
+		},
+	},
+	"tolerated-error": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "Globally tolerated errors. Unlike accepted errors, these " +
+			"are counted separately in the summary.",
+		Parse: func(v string, gspi interface{}) error {
+			gsp := gspi.(*globalSectionParser)
+			if gsp.config.ToleratedErrors == nil {
+				gsp.config.ToleratedErrors = make(Set)
+			}
+			gsp.config.ToleratedErrors.Add(v)
+			return nil
+		},
+	},
 }
 
 func decodeGlobalSection(df DatabaseFlavor, s goini.RawSection, c *Config) error {
-	return globalOptions.Decode(s, &globalSectionParser{c, df})
+	if err := decodeOptions(globalOptions, s, &globalSectionParser{c, df}); err != nil {
+		return err
+	}
+	for code := range c.ToleratedErrors {
+		if c.AcceptedErrors.Contains(code) {
+			return fmt.Errorf("error %v cannot be both accepted and tolerated", code)
+		}
+	}
+	for _, errors := range []Set{c.AcceptedErrors, c.ToleratedErrors} {
+		for code := range errors {
+			if code := code.(string); strings.HasPrefix(code, sqlStatePrefix) {
+				if err := checkSQLStateError(df, code); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
 }
 
 type setupSectionParser struct {
 	queries []string
-	df      DatabaseFlavor
-	basedir string
+	// Set by each-iteration-query, which is only allowed in the setup
+	// section.
+	eachIteration []string
+	df            DatabaseFlavor
+	basedir       string
+	// Allow a trailing query separator on queries, since hook queries are
+	// often copied verbatim from a console (e.g. "RESET QUERY CACHE;").
+	relaxed bool
+}
+
+func (ssp *setupSectionParser) addQuery(queries *[]string, v string) error {
+	if ssp.relaxed {
+		v = strings.TrimSuffix(strings.TrimSpace(v), ssp.df.QuerySeparator())
+	}
+	if e := ssp.df.CheckQuery(v); e != nil {
+		return e
+	}
+	*queries = append(*queries, v)
+	return nil
+}
+
+func (ssp *setupSectionParser) addQueryFile(queries *[]string, v string) error {
+	v = resolveQueryFilePath(ssp.basedir, v)
+	if qs, err := readQueriesFromFile(ssp.df, v); err != nil {
+		return err
+	} else {
+		*queries = append(*queries, qs...)
+		return nil
+	}
 }
 
 var setupOptions = goini.DecodeOptionSet{
@@ -114,11 +423,7 @@ var setupOptions = goini.DecodeOptionSet{
 			"connection (e.g USE or BEGIN).",
 		Parse: func(v string, sspi interface{}) error {
 			ssp := sspi.(*setupSectionParser)
-			if e := ssp.df.CheckQuery(v); e != nil {
-				return e
-			}
-			ssp.queries = append(ssp.queries, v)
-			return nil
+			return ssp.addQuery(&ssp.queries, v)
 		},
 	},
 	"query-file": &goini.DecodeOption{Kind: goini.MultiOption,
@@ -127,35 +432,85 @@ var setupOptions = goini.DecodeOptionSet{
 			"connection (e.g USE or BEGIN).",
 		Parse: func(v string, sspi interface{}) error {
 			ssp := sspi.(*setupSectionParser)
-			if !filepath.IsAbs(v) {
-				v = filepath.Join(ssp.basedir, v)
-			}
-			if qs, err := readQueriesFromFile(ssp.df, v); err != nil {
-				return err
-			} else {
-				ssp.queries = append(ssp.queries, qs...)
-				return nil
-			}
+			return ssp.addQueryFile(&ssp.queries, v)
+		},
+	},
+	"each-iteration-query": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "Setup query to be executed before every iteration of the " +
+			"test (see -repeat), after the other setup queries. Only " +
+			"allowed in the setup section.",
+		Parse: func(v string, sspi interface{}) error {
+			ssp := sspi.(*setupSectionParser)
+			return ssp.addQuery(&ssp.eachIteration, v)
+		},
+	},
+	"each-iteration-query-file": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "File of setup queries to be executed before every iteration " +
+			"of the test, after the other setup queries. Only allowed in " +
+			"the setup section.",
+		Parse: func(v string, sspi interface{}) error {
+			ssp := sspi.(*setupSectionParser)
+			return ssp.addQueryFile(&ssp.eachIteration, v)
 		},
 	},
 }
 
-func decodeSetupSection(df DatabaseFlavor, s goini.RawSection, basedir string, ss *[]string) error {
-	parser := setupSectionParser{df: df, basedir: basedir}
-	err := setupOptions.Decode(s, &parser)
-	if err == nil {
-		*ss = parser.queries
+/*
+ * Decodes the queries of a hook section into ss and, for the setup section,
+ * the queries to run before every iteration into eachIteration (nil for
+ * the other sections).
+ */
+func decodeHookSection(df DatabaseFlavor, s goini.RawSection, basedir string, relaxed bool, ss *[]string, eachIteration *[]string) error {
+	parser := setupSectionParser{df: df, basedir: basedir, relaxed: relaxed}
+	if err := decodeOptions(setupOptions, s, &parser); err != nil {
+		return err
 	}
-	return err
+	if len(parser.eachIteration) > 0 && eachIteration == nil {
+		return errors.New("each-iteration-query can only be used in the setup section")
+	}
+	*ss = parser.queries
+	if eachIteration != nil {
+		*eachIteration = parser.eachIteration
+	}
+	return nil
 }
 
 type jobParser struct {
 	j                 *Job
 	df                DatabaseFlavor
 	basedir           string
-	queryArgsFile     io.Reader
+	queryArgsFile     io.ReadSeeker
+	queryArgsRows     []string
 	queryArgsDelim    rune
+	queryArgsHeader   bool
 	multiQueryAllowed bool
+	// Set by shard-key-column, and resolved to the ShardKeyColumn of the
+	// job once the query args are known.
+	shardKeyColumn string
+	// The columns of the query args header, by name.
+	queryArgsColumns map[string]int
+	// Set by interval, and turned into the rate of the job.
+	interval time.Duration
+	// Set by null-marker, for the query-results-file.
+	nullMarker *string
+	// Set by latency-log-sampling, for the latency-log-file.
+	latencyLogSampling float64
+	// Set by results-max-rows, for the query-results-file.
+	resultsMaxRows int64
+	// Set by results-flush-rows and results-flush-interval, for the
+	// query-results-file and latency-log-file.
+	resultsFlushRows     int64
+	resultsFlushInterval *time.Duration
+	// Set by iteration-query, and turned into the IterationQueries of
+	// the job.
+	iterationQueries []string
+}
+
+func (jp *jobParser) adaptiveRate() *AdaptiveRate {
+	if jp.j.AdaptiveRate == nil {
+		jp.j.AdaptiveRate = new(AdaptiveRate)
+	}
+	return jp.j.AdaptiveRate
 }
 
 var jobOptions = goini.DecodeOptionSet{
@@ -173,6 +528,28 @@ var jobOptions = goini.DecodeOptionSet{
 			return e
 		},
 	},
+	"timeout": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Stop this job once it has run for this long (after its " +
+			"start), even if it has not reached its count.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Timeout, e = time.ParseDuration(v)
+			if e == nil && jp.(*jobParser).j.Timeout <= 0 {
+				return errors.New("timeout must be positive")
+			}
+			return e
+		},
+	},
+	"query-timeout": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Abandon each query that runs for longer than this, and " +
+			"count it as a timeout error.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.QueryTimeout, e = time.ParseDuration(v)
+			if e == nil && jp.(*jobParser).j.QueryTimeout <= 0 {
+				return errors.New("query-timeout must be positive")
+			}
+			return e
+		},
+	},
 	"query": &goini.DecodeOption{Kind: goini.MultiOption,
 		Usage: "Query to execute for the job. " +
 			"Must be a single query and cannot have any effect on the " +
@@ -188,14 +565,12 @@ var jobOptions = goini.DecodeOptionSet{
 		},
 	},
 	"query-file": &goini.DecodeOption{Kind: goini.MultiOption,
-		Usage: "File containing queries to execute for the job. " +
-			"Queries are separated by the query-separator and cannot have any " +
-			"effect on the connection (e.g USE or BEGIN).",
+		Usage: "File (or http(s) URL) containing queries to execute for " +
+			"the job. Queries are separated by the query-separator and cannot " +
+			"have any effect on the connection (e.g USE or BEGIN).",
 		Parse: func(v string, jpi interface{}) error {
 			jp := jpi.(*jobParser)
-			if !filepath.IsAbs(v) {
-				v = filepath.Join(jp.basedir, v)
-			}
+			v = resolveQueryFilePath(jp.basedir, v)
 			if qs, err := readQueriesFromFile(jp.df, v); err != nil {
 				return err
 			} else {
@@ -204,6 +579,20 @@ var jobOptions = goini.DecodeOptionSet{
 			}
 		},
 	},
+	"iteration-query": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "A variant of the query of the job, given once per variant. " +
+			"Iteration N of the test (see -repeat) runs variant N, " +
+			"cycling through them if there are fewer variants than " +
+			"iterations.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			if e := jp.df.CheckQuery(v); e != nil {
+				return e
+			}
+			jp.iterationQueries = append(jp.iterationQueries, v)
+			return nil
+		},
+	},
 	"query-args-file": &goini.DecodeOption{Kind: goini.UniqueOption,
 		Usage: "File containing csv delimited query args, one line per " +
 			"query.",
@@ -216,6 +605,16 @@ var jobOptions = goini.DecodeOptionSet{
 			return err
 		},
 	},
+	"query-args": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "A row of csv delimited query args, used instead of a " +
+			"query-args-file for small sets of args. May be given multiple " +
+			"times, one row per query.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			jp.queryArgsRows = append(jp.queryArgsRows, v)
+			return nil
+		},
+	},
 	"query-args-delim": &goini.DecodeOption{Kind: goini.UniqueOption,
 		Usage: "Field separator for csv delimited query args.",
 		Parse: func(v string, jpi interface{}) error {
@@ -230,6 +629,49 @@ var jobOptions = goini.DecodeOptionSet{
 			}
 		},
 	},
+	"query-args-header": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, the first row of the query args is a header naming " +
+			"each column. Each named placeholder (e.g. :id) in the queries is " +
+			"bound to the column with the same name.",
+		Parse: func(v string, jpi interface{}) (err error) {
+			jpi.(*jobParser).queryArgsHeader, err = strconv.ParseBool(v)
+			return err
+		},
+	},
+	"shard-key-column": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The column of the query args (a 0-based index, or a name " +
+			"with query-args-header) whose hash modulo shards buckets the " +
+			"latency of each invocation. The key is read from the args of " +
+			"the first query of the invocation.",
+		Parse: func(v string, jpi interface{}) error {
+			jpi.(*jobParser).shardKeyColumn = strings.TrimSpace(v)
+			return nil
+		},
+	},
+	"shards": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The number of shards by which shard-key-column buckets the " +
+			"latency of the job.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Shards, e = strconv.Atoi(v)
+			if e == nil && jp.(*jobParser).j.Shards <= 0 {
+				return errors.New("shards must be positive")
+			}
+			return e
+		},
+	},
+	"null-marker": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Written in the query-results-file in place of NULL values " +
+			"(default \\N). It cannot contain the delimiter, quotes or " +
+			"line breaks.",
+		Parse: func(v string, jpi interface{}) error {
+			if strings.ContainsAny(v, ",\"\r\n") {
+				return fmt.Errorf("null-marker %s cannot contain the delimiter, quotes or line breaks",
+					strconv.Quote(v))
+			}
+			jpi.(*jobParser).nullMarker = &v
+			return nil
+		},
+	},
 	"query-results-file": &goini.DecodeOption{Kind: goini.UniqueOption,
 		Usage: "Results from executed queries will be written to this file " +
 			"as comma separated values. If the file already exists, it " +
@@ -243,94 +685,889 @@ var jobOptions = goini.DecodeOptionSet{
 			return err
 		},
 	},
-	"rate": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "The number of batches executed per second (default 0.0).",
+	"latency-log-file": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The start time (in Unix nanoseconds), latency (in " +
+			"nanoseconds) and whether it failed of each execution will " +
+			"be written to this file as comma separated values. If the " +
+			"file already exists, it will be truncated",
+		Parse: func(v string, jpi interface{}) (err error) {
+			jp := jpi.(*jobParser)
+			if !filepath.IsAbs(v) {
+				v = filepath.Join(jp.basedir, v)
+			}
+			jp.j.LatencyLog, err = NewSafeCSVWriter(v)
+			return err
+		},
+	},
+	"latency-log-sampling": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The fraction (greater than 0, up to 1) of the executions " +
+			"written to the latency-log-file (default 1).",
 		Parse: func(v string, jpi interface{}) (e error) {
 			jp := jpi.(*jobParser)
-			jp.j.Rate, e = strconv.ParseFloat(v, 64)
-			if e == nil && jp.j.Rate < 0 {
-				return errors.New("invalid negative value for rate")
+			jp.latencyLogSampling, e = strconv.ParseFloat(v, 64)
+			if e == nil && (jp.latencyLogSampling <= 0 || jp.latencyLogSampling > 1) {
+				return errors.New("latency-log-sampling must be greater than 0 and at most 1")
 			}
 			return e
 		},
 	},
-	"batch-size": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "Number of jobs started during one batch (default 1).",
-		Parse: func(v string, jp interface{}) (e error) {
-			jp.(*jobParser).j.BatchSize, e = strconv.ParseUint(v, 10, 0)
+	"results-max-rows": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The most rows written to the query-results-file over the " +
+			"whole test; later rows are not written, but the queries are " +
+			"still timed.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.resultsMaxRows, e = parseResultsMaxRows(v)
 			return e
 		},
 	},
-	"queue-depth": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "Number of simultaneous executions of the job allowed.",
-		Parse: func(v string, jp interface{}) (e error) {
-			// Is there a way to make go respect numeric prefixes (e.g. 0x0)?
-			jp.(*jobParser).j.QueueDepth, e = strconv.ParseUint(v, 10, 0)
+	"results-flush-rows": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Flush the query-results-file and latency-log-file of the " +
+			"job every this many rows, instead of every second.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.resultsFlushRows, e = strconv.ParseInt(v, 10, 64)
+			if e == nil && jp.resultsFlushRows <= 0 {
+				return errors.New("results-flush-rows must be positive")
+			}
 			return e
 		},
 	},
-	"concurrency": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "Number of simultaneous executions of the job allowed.",
-		Parse: func(v string, jp interface{}) (e error) {
-			// Is there a way to make go respect numeric prefixes (e.g. 0x0)?
-			jp.(*jobParser).j.QueueDepth, e = strconv.ParseUint(v, 10, 0)
+	"results-flush-interval": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Flush the query-results-file and latency-log-file of the " +
+			"job when writing a row at least this long after the last " +
+			"flush (default 1s). If 0 (and with no results-flush-rows), " +
+			"they are only flushed when their buffer is full and when " +
+			"they are closed.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			d, e := time.ParseDuration(v)
+			if e == nil && d < 0 {
+				return errors.New("invalid negative value for results-flush-interval")
+			}
+			jp.resultsFlushInterval = &d
 			return e
 		},
 	},
-	"count": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "Number of time job is executed before stopping.",
-		Parse: func(v string, jp interface{}) (e error) {
-			jp.(*jobParser).j.Count, e = strconv.ParseUint(v, 10, 0)
+	"rate": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The number of batches executed per second (default 0.0). " +
+			"May be an expression of NCPU (the number of CPUs) and " +
+			"environment variables (e.g. '100 * NCPU' or '$RATE / 2').",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.j.Rate, e = parseNumberExpr(v)
+			if e == nil && jp.j.Rate < 0 {
+				return errors.New("invalid negative value for rate")
+			}
 			return e
 		},
 	},
-	"multi-query-mode": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "Set to 'multi-connection' to signal that the job will execute " +
-			"multiple queries, but it is safe for them to be on different " +
-			"connections.",
-		Parse: func(v string, jp interface{}) error {
-			if v == "multi-connection" {
-				jp.(*jobParser).multiQueryAllowed = true
-				return nil
-			} else {
-				return fmt.Errorf("invalid value for multi-query-mode: %s",
-					strconv.Quote(v))
+	"interval": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The time between batches (e.g. 90s), as an alternative to " +
+			"rate.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.interval, e = time.ParseDuration(v)
+			if e == nil && jp.interval <= 0 {
+				return errors.New("interval must be positive")
 			}
+			return e
 		},
 	},
-	"query-log-file": &goini.DecodeOption{Kind: goini.UniqueOption,
-		Usage: "A flat text file containing a log file to replay instead of a " +
-			"normal job. The query log format is a series of newline " +
-			"delimited records containing a time in microseconds and a query " +
-			"separated by a comma. For example, '8644882534,select 1'.",
+	"adaptive-rate-p99": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Adapt the rate of the job to keep the p99 latency under this " +
+			"duration, between adaptive-rate-min and adaptive-rate-max. The " +
+			"rate starts at rate (or adaptive-rate-min) and is increased " +
+			"additively while the p99 is under target and decreased " +
+			"multiplicatively while it is over target.",
 		Parse: func(v string, jpi interface{}) (e error) {
 			jp := jpi.(*jobParser)
-			if !filepath.IsAbs(v) {
-				v = filepath.Join(jp.basedir, v)
-			}
-			jp.j.QueryLog, e = os.Open(v)
+			jp.adaptiveRate().TargetP99, e = time.ParseDuration(v)
 			return e
 		},
 	},
-}
-
-func decodeJobSection(df DatabaseFlavor, section goini.RawSection, basedir string, job *Job) error {
-	jp := jobParser{j: job, df: df, basedir: basedir}
-
-	if err := jobOptions.Decode(section, &jp); err != nil {
-		return err
-	} else if len(job.Queries) == 0 && job.QueryLog == nil {
+	"adaptive-rate-min": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The minimum rate of an adaptive rate job.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.adaptiveRate().MinRate, e = strconv.ParseFloat(v, 64)
+			return e
+		},
+	},
+	"adaptive-rate-max": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The maximum rate of an adaptive rate job.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.adaptiveRate().MaxRate, e = strconv.ParseFloat(v, 64)
+			return e
+		},
+	},
+	"adaptive-rate-interval": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "How often the rate of an adaptive rate job is adjusted " +
+			"(default 1s).",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.adaptiveRate().Interval, e = time.ParseDuration(v)
+			return e
+		},
+	},
+	"max-write-bytes": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Stop the job once it has written an estimated this many " +
+			"bytes (e.g. 10GB), counting the text of write queries and " +
+			"their args.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.MaxWriteBytes, e = parseByteSize(v)
+			return e
+		},
+	},
+	"retries": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Run a failed invocation of the job again, up to this many " +
+			"times (within the retry-budget, if any).",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Retries, e = strconv.Atoi(v)
+			if e == nil && jp.(*jobParser).j.Retries < 0 {
+				return errors.New("retries cannot be negative")
+			}
+			return e
+		},
+	},
+	"warmup-rate": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The rate of the job during warmup-duration, after which it " +
+			"runs at rate. Results during the warmup are not counted.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.WarmupRate, e = strconv.ParseFloat(v, 64)
+			return e
+		},
+	},
+	"warmup-duration": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "How long the job runs at warmup-rate.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.WarmupDuration, e = time.ParseDuration(v)
+			return e
+		},
+	},
+	"ramp": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Linearly increase the rate of the job from zero to rate " +
+			"over this long after it starts, then hold it. If the job " +
+			"stops (or the test ends) before the ramp is over, it never " +
+			"reaches the full rate.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.RampUp, e = time.ParseDuration(v)
+			return e
+		},
+	},
+	"ramp-down": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Linearly reduce the rate of the job to zero over this long " +
+			"before it stops (at stop, or the end of the test).",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.RampDown, e = time.ParseDuration(v)
+			return e
+		},
+	},
+	"batch-size": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Number of jobs started during one batch (default 1), or a " +
+			"range (e.g. 1-10) from which the size of each batch is drawn " +
+			"at random.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			i := strings.Index(v, "-")
+			if i < 0 {
+				jp.j.BatchSize, e = strconv.ParseUint(v, 10, 0)
+				return e
+			}
+			if jp.j.BatchSize, e = strconv.ParseUint(strings.TrimSpace(v[:i]), 10, 0); e != nil {
+				return e
+			} else if jp.j.MaxBatchSize, e = strconv.ParseUint(strings.TrimSpace(v[i+1:]), 10, 0); e != nil {
+				return e
+			} else if jp.j.BatchSize == 0 {
+				return errors.New("batch-size range must be positive")
+			} else if jp.j.BatchSize > jp.j.MaxBatchSize {
+				return errors.New("batch-size range minimum cannot be greater than its maximum")
+			}
+			return nil
+		},
+	},
+	"queue-depth": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Number of simultaneous executions of the job allowed.",
+		Parse: func(v string, jp interface{}) (e error) {
+			// Is there a way to make go respect numeric prefixes (e.g. 0x0)?
+			jp.(*jobParser).j.QueueDepth, e = strconv.ParseUint(v, 10, 0)
+			return e
+		},
+	},
+	"concurrency": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Number of simultaneous executions of the job allowed.",
+		Parse: func(v string, jp interface{}) (e error) {
+			// Is there a way to make go respect numeric prefixes (e.g. 0x0)?
+			jp.(*jobParser).j.QueueDepth, e = strconv.ParseUint(v, 10, 0)
+			return e
+		},
+	},
+	"count": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Number of time job is executed before stopping.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Count, e = strconv.ParseUint(v, 10, 0)
+			return e
+		},
+	},
+	"phase": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "A window of time (since setup) and the weight of each " +
+			"query of the job during it, as '<start>-[<end>] <weight>...' " +
+			"(e.g. '0s-1h 9 1'). With phases, each execution runs one " +
+			"query, picked by weight. Phases must follow each other from " +
+			"the start of the job until it stops (or the last has no end).",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			phase, err := parsePhase(v)
+			if err == nil {
+				jp.j.Phases = append(jp.j.Phases, phase)
+			}
+			return err
+		},
+	},
+	"query-weights": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Comma separated weights, one per query of the job in " +
+			"order (e.g. 0.9,0.1). With weights, each execution runs one " +
+			"query, picked by weight, instead of all of them.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			var total float64
+			for _, field := range strings.Split(v, ",") {
+				weight, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+				if err != nil || weight < 0 {
+					return fmt.Errorf("invalid weight %s", strconv.Quote(field))
+				}
+				total += weight
+				jp.j.QueryWeights = append(jp.j.QueryWeights, weight)
+			}
+			if total == 0 {
+				return errors.New("query-weights must have a positive weight")
+			}
+			return nil
+		},
+	},
+	"row-count-buckets": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Comma separated, increasing row counts (e.g. 0,10,100). The " +
+			"latency of the job is also reported for the transactions that " +
+			"returned (or affected) up to each row count, and above the last.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			for _, field := range strings.Split(v, ",") {
+				bound, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid row count %s", strconv.Quote(field))
+				}
+				if n := len(jp.j.RowCountBuckets); bound < 0 || (n > 0 && bound <= jp.j.RowCountBuckets[n-1]) {
+					return errors.New("row counts must be non-negative and increasing")
+				}
+				jp.j.RowCountBuckets = append(jp.j.RowCountBuckets, bound)
+			}
+			return nil
+		},
+	},
+	"min-utilization": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Warn when less than this percentage (e.g. 80%) of the " +
+			"workers of a queue-depth job are busy during an " +
+			"update-interval, i.e. the job is limited by latency.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.j.MinUtilization, e = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			if e == nil && (jp.j.MinUtilization <= 0 || jp.j.MinUtilization > 100) {
+				return errors.New("min-utilization must be a percentage between 0 and 100")
+			}
+			return e
+		},
+	},
+	"think-time-file": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "File (or http(s) URL) with one duration (e.g. 150ms) per " +
+			"line. After each execution of a queue-depth job, the worker " +
+			"waits for a duration drawn at random from the file.",
+		Parse: func(v string, jpi interface{}) (err error) {
+			jp := jpi.(*jobParser)
+			jp.j.ThinkTimes, err = readThinkTimesFromFile(resolveQueryFilePath(jp.basedir, v))
+			return err
+		},
+	},
+	"think-time": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "After each execution of a queue-depth job, the worker " +
+			"waits this long (e.g. 100ms), or a time drawn uniformly from " +
+			"a range (e.g. 100ms±50ms, or 100ms+-50ms).",
+		Parse: func(v string, jpi interface{}) (err error) {
+			jp := jpi.(*jobParser)
+			jp.j.ThinkTime, jp.j.ThinkTimeJitter, err = parseThinkTime(v)
+			return err
+		},
+	},
+	"verify-idempotent": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, run each query twice and count the executions " +
+			"where the second result differs from the first as assertion " +
+			"errors. Only for queries that return rows.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.VerifyIdempotent, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"connect-only": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, each execution opens a new connection, pings it " +
+			"and closes it instead of running a query, to measure the " +
+			"time to establish connections.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ConnectOnly, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"connection-per-query": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, each execution opens a new connection (outside " +
+			"of the pool), runs its queries on it and closes it, to " +
+			"measure the cost of connection churn.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ConnectionPerQuery, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"seed": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The seed of the randomness of the job (e.g. of its " +
+			"query-template), instead of one derived from -seed and the " +
+			"name of the job.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Seed, e = strconv.ParseInt(v, 10, 64)
+			if e == nil && jp.(*jobParser).j.Seed == 0 {
+				return errors.New("seed must not be 0")
+			}
+			return e
+		},
+	},
+	"query-template": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, expand each query as a text/template before each " +
+			"execution, with the helpers randInt, randString, uuid, now " +
+			"and zipf (e.g. {{randInt 1 1000}}).",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.QueryTemplate, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"prepared": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, prepare each query once (on each connection it " +
+			"runs on) and execute the prepared statement with the args " +
+			"of each execution.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Prepared, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"explain-analyze": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, run each query under EXPLAIN ANALYZE (which " +
+			"executes it) and report a sample of the returned plans.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ExplainAnalyze, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"server-exec-time": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, also measure how long the server spent executing " +
+			"the queries (currently only with mysql), to tell the network " +
+			"and client overhead apart from the work of the server.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ServerExecTime, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"priority": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Advisory scheduling priority of the job (default 0). When " +
+			"the harness is busy, invocations of jobs with a higher " +
+			"priority are dispatched first. Not a hard guarantee.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.Priority, e = strconv.Atoi(v)
+			return e
+		},
+	},
+	"probe": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The name of a job that must stop, with a p99 of at most " +
+			"probe-max-p99, before this job starts. Otherwise this job is " +
+			"skipped.",
+		Parse: func(v string, jp interface{}) error {
+			jp.(*jobParser).j.Probe = v
+			return nil
+		},
+	},
+	"depends-on": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "A comma separated list of the names of jobs that must " +
+			"stop before this job starts.",
+		Parse: func(v string, jp interface{}) error {
+			for _, name := range strings.Split(v, ",") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					return fmt.Errorf("invalid value for depends-on: %s", strconv.Quote(v))
+				}
+				jp.(*jobParser).j.DependsOn = append(jp.(*jobParser).j.DependsOn, name)
+			}
+			return nil
+		},
+	},
+	"probe-max-p99": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The highest p99 latency of the probe for this job to start.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ProbeMaxP99, e = time.ParseDuration(v)
+			if e == nil && jp.(*jobParser).j.ProbeMaxP99 <= 0 {
+				return errors.New("probe-max-p99 must be positive")
+			}
+			return e
+		},
+	},
+	"shuffle-queries": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, run the queries of a multi-query job in a random " +
+			"order (determined by -seed) every time the job is executed.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.ShuffleQueries, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"multi-query-mode": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "Set to 'multi-connection' to signal that the job will execute " +
+			"multiple queries, but it is safe for them to be on different " +
+			"connections, or to 'transaction' to run them in order in a " +
+			"transaction on one connection.",
+		Parse: func(v string, jp interface{}) error {
+			if v == "multi-connection" {
+				jp.(*jobParser).multiQueryAllowed = true
+				return nil
+			} else if v == "transaction" {
+				jp.(*jobParser).multiQueryAllowed = true
+				jp.(*jobParser).j.Transaction = true
+				return nil
+			} else {
+				return fmt.Errorf("invalid value for multi-query-mode: %s",
+					strconv.Quote(v))
+			}
+		},
+	},
+	"query-log-file": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "A flat text file containing a log file to replay instead of a " +
+			"normal job. The query log format is a series of newline " +
+			"delimited records containing a time in microseconds and a query " +
+			"separated by a comma. For example, '8644882534,select 1'.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.j.QueryLog, e = openQueryFile(resolveQueryFilePath(jp.basedir, v))
+			return e
+		},
+	},
+	"fail-zero-rows-affected": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, a write (e.g. an update) that affects no rows " +
+			"counts as an assertion error.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.FailZeroRowsAffected, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"warn-empty-results": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "If true, warn about and count the executions of queries " +
+			"that return rows (e.g. a select) that returned none, which " +
+			"often means the expected data was not loaded.",
+		Parse: func(v string, jp interface{}) (e error) {
+			jp.(*jobParser).j.WarnEmptyResults, e = strconv.ParseBool(v)
+			return e
+		},
+	},
+	"fail-fraction": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "For resilience testing, the fraction (between 0 and 1) of " +
+			"executions that report an injected error instead of running " +
+			"the query. Injected errors are reported apart from the " +
+			"errors of the database.",
+		Parse: func(v string, jpi interface{}) (e error) {
+			jp := jpi.(*jobParser)
+			jp.j.FailFraction, e = strconv.ParseFloat(v, 64)
+			if e == nil && (jp.j.FailFraction < 0 || jp.j.FailFraction > 1) {
+				return errors.New("fail-fraction must be between 0 and 1")
+			}
+			return e
+		},
+	},
+	"success-expr": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "An expression evaluated after each query; if it is false the " +
+			"query counts as an assertion error. The expression may " +
+			"reference rows (the number of rows returned or affected) and " +
+			"col0, col1, ... (the values of the first row), e.g. " +
+			"'rows > 0 && col0 == col1'.",
+		Parse: func(v string, jpi interface{}) error {
+			jp := jpi.(*jobParser)
+			e, err := ParseExpr(v)
+			if err != nil {
+				return err
+			} else if err = validateSuccessExpr(e); err != nil {
+				return err
+			}
+			jp.j.SuccessExpr = e
+			return nil
+		},
+	},
+	"query-log-format": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The format of the query-log-file: 'csv' (default), " +
+			"'mysql-general' or 'mysql-slow'. Lines of a MySQL log that " +
+			"cannot be parsed are skipped.",
+		Parse: func(v string, jpi interface{}) error {
+			if _, ok := queryLogFormats[v]; !ok {
+				return fmt.Errorf("invalid value for query-log-format: %s",
+					strconv.Quote(v))
+			}
+			jpi.(*jobParser).j.QueryLogFormat = v
+			return nil
+		},
+	},
+}
+
+/*
+ * Checks that every inline query-args row has as many values as the query
+ * that will consume it has placeholders, when that can be determined.
+ */
+func (jp *jobParser) validateQueryArgsRows() error {
+	r := csv.NewReader(strings.NewReader(strings.Join(jp.queryArgsRows, "\n")))
+	if jp.queryArgsDelim != 0 {
+		r.Comma = jp.queryArgsDelim
+	}
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("invalid query-args: %v", err)
+	}
+	if jp.queryArgsHeader {
+		// Args are bound by name, see bindQueryArgsHeader.
+		return nil
+	}
+
+	// Each invocation of the job consumes one row per query, in order.
+	for i, row := range rows {
+		query := jp.j.Queries[i%len(jp.j.Queries)]
+		if n, ok := countSQLPlaceholders(query); ok && n != len(row) {
+			return fmt.Errorf("query-args row %d has %d values but query %s has %d placeholders",
+				i+1, len(row), strconv.Quote(query), n)
+		}
+	}
+	return nil
+}
+
+/*
+ * Reads the header row of the query args and rewrites the named
+ * placeholders of each query for the database flavor, recording which
+ * column of the args is bound to each placeholder.
+ */
+func (jp *jobParser) bindQueryArgsHeader() error {
+	header, err := jp.j.QueryArgs.Read()
+	if err == io.EOF {
+		return errors.New("query-args-header requires a header row")
+	} else if err != nil {
+		return fmt.Errorf("invalid query args header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := columns[name]; ok {
+			return fmt.Errorf("duplicate column %s in query args header", strconv.Quote(name))
+		}
+		columns[name] = i
+	}
+	jp.queryArgsColumns = columns
+
+	jp.j.QueryArgColumns = make([][]int, len(jp.j.Queries))
+	for qi, query := range jp.j.Queries {
+		bound, names := jp.df.BindNamed(query)
+		for _, name := range names {
+			column, ok := columns[name]
+			if !ok {
+				return fmt.Errorf("placeholder :%s in query %s has no matching column in the query args header",
+					name, strconv.Quote(query))
+			}
+			jp.j.QueryArgColumns[qi] = append(jp.j.QueryArgColumns[qi], column)
+		}
+		jp.j.Queries[qi] = bound
+	}
+	return nil
+}
+
+/*
+ * Resolves shard-key-column to a column of the query args, checking it
+ * against the header or the placeholders of the queries whose args hold
+ * the key.
+ */
+func (jp *jobParser) bindShardKeyColumn() error {
+	if jp.queryArgsHeader {
+		column, ok := jp.queryArgsColumns[jp.shardKeyColumn]
+		if !ok {
+			return fmt.Errorf("shard-key-column %s has no matching column in the query args header",
+				strconv.Quote(jp.shardKeyColumn))
+		}
+		jp.j.ShardKeyColumn = column
+		return nil
+	}
+
+	column, err := strconv.Atoi(jp.shardKeyColumn)
+	if err != nil || column < 0 {
+		return fmt.Errorf("shard-key-column %s must be a column index, or a column name with query-args-header",
+			strconv.Quote(jp.shardKeyColumn))
+	}
+	keyed := jp.j.Queries[:1]
+	if len(jp.j.Phases) > 0 || len(jp.j.QueryWeights) > 0 {
+		// Each invocation of a job with weights runs any one of its queries.
+		keyed = jp.j.Queries
+	}
+	for _, query := range keyed {
+		if n, ok := countSQLPlaceholders(query); ok && column >= n {
+			return fmt.Errorf("shard-key-column %d is out of range for query %s with %d placeholders",
+				column, strconv.Quote(query), n)
+		}
+	}
+	jp.j.ShardKeyColumn = column
+	return nil
+}
+
+/*
+ * Makes the first variant of iteration-query the query of the job, once
+ * checked that the variants can share the options of the job (e.g. its
+ * query args).
+ */
+func (jp *jobParser) bindIterationQueries() error {
+	variants := jp.iterationQueries
+	if len(jp.j.Queries) > 0 || jp.j.QueryLog != nil {
+		return errors.New("cannot use iteration-query with query, query-file or query-log-file")
+	} else if len(variants) < 2 {
+		return errors.New("iteration-query must be given once for each variant, at least twice")
+	} else if jp.multiQueryAllowed {
+		return errors.New("cannot use iteration-query with multi-query-mode")
+	} else if jp.queryArgsHeader {
+		return errors.New("cannot use iteration-query with query-args-header")
+	}
+	// The variants share the query args, so must have as many placeholders.
+	n, _ := countSQLPlaceholders(variants[0])
+	for _, v := range variants[1:] {
+		if m, _ := countSQLPlaceholders(v); m != n {
+			return fmt.Errorf("iteration-query %s has %d placeholders but %s has %d",
+				strconv.Quote(v), m, strconv.Quote(variants[0]), n)
+		}
+	}
+	jp.j.IterationQueries = variants
+	jp.j.Queries = []string{variants[0]}
+	return nil
+}
+
+func decodeJobSection(df DatabaseFlavor, section goini.RawSection, basedir string, job *Job) error {
+	jp := jobParser{j: job, df: df, basedir: basedir}
+
+	if err := decodeOptions(jobOptions, section, &jp); err != nil {
+		return err
+	}
+
+	if len(jp.iterationQueries) > 0 {
+		if err := jp.bindIterationQueries(); err != nil {
+			return err
+		}
+	}
+
+	if jp.interval > 0 {
+		if job.Rate != 0 {
+			return errors.New("cannot have both rate and interval")
+		}
+		job.Rate = 1 / jp.interval.Seconds()
+	}
+
+	if (job.Probe == "") != (job.ProbeMaxP99 == 0) {
+		return errors.New("probe and probe-max-p99 must be used together")
+	}
+	if (jp.shardKeyColumn == "") != (job.Shards == 0) {
+		return errors.New("shard-key-column and shards must be used together")
+	} else if job.Shards > 0 && jp.queryArgsFile == nil && len(jp.queryArgsRows) == 0 {
+		return errors.New("can only use shard-key-column with query-args-file or query-args")
+	}
+
+	if job.ConnectionPerQuery && job.ConnectOnly {
+		return errors.New("cannot use connection-per-query with connect-only, which runs no query")
+	} else if job.ConnectionPerQuery && job.ServerExecTime {
+		return errors.New("cannot use connection-per-query with server-exec-time")
+	}
+	if job.Transaction {
+		if job.ConnectionPerQuery || job.ServerExecTime || job.ConnectOnly {
+			return errors.New("cannot use multi-query-mode=transaction with connection-per-query, server-exec-time or connect-only")
+		} else if job.QueryLog != nil {
+			return errors.New("cannot use multi-query-mode=transaction with query-log-file")
+		} else if job.ShuffleQueries || len(job.QueryWeights) > 0 || len(job.Phases) > 0 {
+			return errors.New("multi-query-mode=transaction runs all the queries in order")
+		}
+	}
+
+	if job.QueryTimeout > 0 && (job.Prepared || job.ServerExecTime) {
+		return errors.New("cannot use query-timeout with prepared or server-exec-time")
+	}
+	if job.QueryTemplate && job.QueryLog != nil {
+		return errors.New("cannot use query-template with query-log-file")
+	}
+	if job.Prepared {
+		if job.QueryTemplate {
+			return errors.New("cannot use prepared with query-template, whose queries vary")
+		} else if job.QueryLog != nil {
+			return errors.New("cannot use prepared with query-log-file, whose queries vary")
+		} else if job.ConnectionPerQuery || job.Transaction || job.ServerExecTime {
+			return errors.New("cannot use prepared with connection-per-query, multi-query-mode=transaction or server-exec-time")
+		}
+	}
+
+	if job.ConnectOnly {
+		if len(job.Queries) > 0 || job.QueryLog != nil {
+			return errors.New("cannot have queries with connect-only")
+		} else if jp.queryArgsFile != nil || len(jp.queryArgsRows) > 0 || job.QueryResults != nil {
+			return errors.New("cannot use query args or results with connect-only")
+		} else if job.SuccessExpr != nil || job.VerifyIdempotent || job.ExplainAnalyze ||
+			job.ServerExecTime || job.Prepared || job.QueryTimeout > 0 || job.QueryTemplate ||
+			len(job.Phases) > 0 || len(job.QueryWeights) > 0 {
+			return errors.New("connect-only cannot be used with options of queries")
+		}
+	} else if len(job.Queries) == 0 && job.QueryLog == nil {
 		return errors.New("no query provided")
 	} else if len(job.Queries) > 0 && job.QueryLog != nil {
 		return errors.New("cannot have both queries and a query log")
 	} else if len(job.Queries) > 1 && !jp.multiQueryAllowed {
 		return fmt.Errorf("must have only one query")
+	} else if job.ShuffleQueries && !jp.multiQueryAllowed {
+		return errors.New("can only use shuffle-queries with multi-query-mode")
 	} else if job.Rate == 0 && job.BatchSize > 0 {
 		return errors.New("can only specify batch-size with rate")
-	} else if jp.queryArgsDelim != 0 && jp.queryArgsFile == nil {
-		return errors.New("Cannot set query-args-delim with no query-args-file")
-	} else if jp.queryArgsFile != nil && job.QueryLog != nil {
-		return errors.New("Cannot use query-args-file with query-log-file")
+	} else if jp.queryArgsFile != nil && len(jp.queryArgsRows) > 0 {
+		return errors.New("Cannot use both query-args and query-args-file")
+	} else if jp.queryArgsDelim != 0 && jp.queryArgsFile == nil && len(jp.queryArgsRows) == 0 {
+		return errors.New("Cannot set query-args-delim with no query-args-file or query-args")
+	} else if jp.queryArgsHeader && jp.queryArgsFile == nil && len(jp.queryArgsRows) == 0 {
+		return errors.New("Cannot set query-args-header with no query-args-file or query-args")
+	} else if (jp.queryArgsFile != nil || len(jp.queryArgsRows) > 0) && job.QueryLog != nil {
+		return errors.New("Cannot use query-args-file or query-args with query-log-file")
+	} else if job.QueryLogFormat != "" && job.QueryLog == nil {
+		return errors.New("Cannot set query-log-format with no query-log-file")
+	}
+
+	if len(job.Phases) > 0 {
+		if err := validatePhases(job); err != nil {
+			return err
+		}
+	}
+	if len(job.QueryWeights) > 0 {
+		if len(job.Phases) > 0 {
+			return errors.New("cannot use both query-weights and phase")
+		} else if job.ShuffleQueries {
+			return errors.New("cannot use query-weights with shuffle-queries")
+		} else if len(job.QueryWeights) != len(job.Queries) {
+			return fmt.Errorf("query-weights has %d weights for %d queries",
+				len(job.QueryWeights), len(job.Queries))
+		}
+	}
+
+	if job.ExplainAnalyze {
+		if eaf, ok := df.(ExplainAnalyzeFlavor); !ok {
+			return errors.New("the database flavor does not support explain-analyze")
+		} else if _, ok := eaf.ExplainAnalyze("select 1"); !ok {
+			return errors.New("the database flavor does not support explain-analyze")
+		} else if job.SuccessExpr != nil || job.VerifyIdempotent {
+			return errors.New("cannot use explain-analyze with success-expr or verify-idempotent")
+		}
+	}
+
+	if jp.latencyLogSampling != 0 && job.LatencyLog == nil {
+		return errors.New("cannot set latency-log-sampling with no latency-log-file")
+	} else if job.LatencyLog != nil {
+		job.LatencyLogSampling = firstFloat64(jp.latencyLogSampling, 1)
+	}
+
+	if jp.resultsMaxRows != 0 {
+		if job.QueryResults == nil {
+			return errors.New("cannot set results-max-rows with no query-results-file")
+		}
+		job.QueryResults.maxRows = jp.resultsMaxRows
+	}
+
+	if jp.resultsFlushRows > 0 || jp.resultsFlushInterval != nil {
+		if job.QueryResults == nil && job.LatencyLog == nil {
+			return errors.New("cannot set results-flush-rows or results-flush-interval with no query-results-file or latency-log-file")
+		}
+		// Setting either replaces the default policy.
+		var interval time.Duration
+		if jp.resultsFlushInterval != nil {
+			interval = *jp.resultsFlushInterval
+		}
+		for _, w := range []*SafeCSVWriter{job.QueryResults, job.LatencyLog} {
+			if w != nil {
+				w.SetFlushPolicy(jp.resultsFlushRows, interval)
+			}
+		}
+	}
+
+	if jp.nullMarker != nil {
+		if job.QueryResults == nil {
+			return errors.New("cannot set null-marker with no query-results-file")
+		}
+		job.QueryResults.nullMarker = *jp.nullMarker
+	}
+
+	if job.WarnEmptyResults && job.QueryLog == nil {
+		readsRows := false
+		for _, query := range job.Queries {
+			readsRows = readsRows || returnsRows(query)
+		}
+		if !readsRows {
+			return errors.New("cannot use warn-empty-results with no query that returns rows")
+		}
+	}
+
+	if job.VerifyIdempotent {
+		if job.QueryLog != nil {
+			return errors.New("cannot use verify-idempotent with query-log-file")
+		}
+		for _, query := range job.Queries {
+			if !returnsRows(query) {
+				return fmt.Errorf("cannot use verify-idempotent with query %s, which does not return rows",
+					strconv.Quote(query))
+			}
+		}
+	}
+
+	if job.WarmupRate != 0 || job.WarmupDuration != 0 {
+		if job.WarmupRate <= 0 || job.WarmupDuration <= 0 {
+			return errors.New("warmup requires a positive warmup-rate and warmup-duration")
+		} else if job.Rate == 0 || job.AdaptiveRate != nil {
+			return errors.New("warmup-rate can only be used with a fixed rate")
+		} else if job.WarmupRate > job.Rate {
+			return errors.New("warmup-rate cannot be greater than rate")
+		} else if job.Stop > 0 && job.Start+job.WarmupDuration >= job.Stop {
+			return errors.New("warmup-duration must end before the job stops")
+		}
+	}
+
+	if job.RampUp < 0 {
+		return errors.New("invalid negative value for ramp")
+	} else if job.RampUp > 0 && (job.Rate == 0 || job.AdaptiveRate != nil) {
+		return errors.New("ramp can only be used with a fixed rate")
+	} else if job.RampUp > 0 && job.WarmupDuration > 0 {
+		return errors.New("cannot use ramp with warmup-rate")
+	}
+
+	if job.RampDown < 0 {
+		return errors.New("invalid negative value for ramp-down")
+	} else if job.RampDown > 0 && (job.Rate == 0 || job.AdaptiveRate != nil) {
+		return errors.New("ramp-down can only be used with a fixed rate")
+	}
+
+	if ar := job.AdaptiveRate; ar != nil {
+		if ar.TargetP99 <= 0 || ar.MinRate <= 0 || ar.MaxRate <= 0 {
+			return errors.New("adaptive rate requires a positive adaptive-rate-p99, adaptive-rate-min and adaptive-rate-max")
+		} else if ar.MinRate > ar.MaxRate {
+			return errors.New("adaptive-rate-min cannot be greater than adaptive-rate-max")
+		} else if ar.Interval < 0 {
+			return errors.New("invalid negative value for adaptive-rate-interval")
+		} else if job.Rate != 0 && (job.Rate < ar.MinRate || job.Rate > ar.MaxRate) {
+			return errors.New("rate must be between adaptive-rate-min and adaptive-rate-max")
+		}
+		if ar.Interval == 0 {
+			ar.Interval = time.Second
+		}
+		if job.Rate == 0 {
+			job.Rate = ar.MinRate
+		}
 	}
 
 	differentJobTypes := 0
@@ -352,59 +1589,141 @@ func decodeJobSection(df DatabaseFlavor, section goini.RawSection, basedir strin
 		return errors.New("Can only specify one of rate, queue-depth, or query-log-file")
 	}
 
+	if job.ThinkTime > 0 && len(job.ThinkTimes) > 0 {
+		return errors.New("cannot use both think-time and think-time-file")
+	} else if job.ThinkTime > 0 && job.Rate > 0 {
+		return errors.New("cannot use think-time with rate")
+	} else if job.ThinkTime > 0 && job.QueryLog != nil {
+		return errors.New("cannot use think-time with query-log-file")
+	}
+	if len(job.ThinkTimes) > 0 && job.QueueDepth == 0 {
+		return errors.New("can only use think-time-file with queue-depth")
+	}
+	if job.MinUtilization > 0 && job.QueueDepth == 0 {
+		return errors.New("can only use min-utilization with queue-depth")
+	}
+
 	if job.Rate > 0 && job.BatchSize == 0 {
 		job.BatchSize = 1
 	}
 
+	if len(jp.queryArgsRows) > 0 {
+		if err := jp.validateQueryArgsRows(); err != nil {
+			return err
+		}
+		jp.queryArgsFile = strings.NewReader(strings.Join(jp.queryArgsRows, "\n"))
+	}
+
 	if jp.queryArgsFile != nil {
 		job.QueryArgs = csv.NewReader(jp.queryArgsFile)
+		job.queryArgsSource, job.queryArgsHeader = jp.queryArgsFile, jp.queryArgsHeader
 		if jp.queryArgsDelim != 0 {
 			job.QueryArgs.Comma = jp.queryArgsDelim
 		}
+		if jp.queryArgsHeader {
+			if err := jp.bindQueryArgsHeader(); err != nil {
+				return err
+			}
+		}
+		if job.Shards > 0 {
+			if err := jp.bindShardKeyColumn(); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func decodeConfigJobs(df DatabaseFlavor, iniConfig *goini.RawConfig, basedir string, config *Config) error {
+func isReservedSection(name string) bool {
+	switch name {
+	case "setup", "teardown", "global", "between-iterations", "seed":
+		return true
+	}
+	return false
+}
+
+func decodeConfigJobs(df DatabaseFlavor, iniConfig *goini.RawConfig, positions *configPositions, basedir string, config *Config) error {
 	config.Jobs = make(map[string]*Job)
+	// goini rejects duplicate sections, but not sections whose names only
+	// differ by surrounding whitespace (e.g. "[job]" and "[job ]").
+	trimmedNames := make(map[string]string)
 	for _, name := range iniConfig.Sections() {
 		// Don't try to parse a reserved section as a job.
-		if name == "setup" || name == "teardown" || name == "global" {
+		if isReservedSection(name) {
 			continue
 		}
+		trimmed := strings.TrimSpace(name)
+		if other, ok := trimmedNames[trimmed]; ok {
+			return fmt.Errorf("Duplicate job %s%s: already defined as %s%s",
+				strconv.Quote(name), positions.locate(name, nil),
+				strconv.Quote(other), positions.locate(other, nil))
+		} else if trimmed == "" || isReservedSection(trimmed) {
+			return fmt.Errorf("Invalid job name %s%s", strconv.Quote(name), positions.locate(name, nil))
+		}
+		trimmedNames[trimmed] = name
 		section := iniConfig.Section(name)
 
 		job := new(Job)
 		job.Name = name
 		if err := decodeJobSection(df, section, basedir, job); err != nil {
-			return fmt.Errorf("Error parsing job %s: %v",
-				strconv.Quote(name), err)
+			return fmt.Errorf("Error parsing job %s%s: %v",
+				strconv.Quote(name), positions.locate(name, err), err)
 		}
 		config.Jobs[name] = job
 	}
 	return nil
 }
 
-func parseIniConfig(df DatabaseFlavor, iniConfig *goini.RawConfig, basedir string) (*Config, error) {
+/*
+ * Parses the config, using the positions (if not nil) to report where in the
+ * config file any error is.
+ */
+func parseIniConfig(df DatabaseFlavor, iniConfig *goini.RawConfig, positions *configPositions, basedir string) (*Config, error) {
 	var config = new(Config)
 
 	config.Flavor = df
 
 	if err := decodeGlobalSection(df, iniConfig.GlobalSection, config); err != nil {
-		return nil, fmt.Errorf("Error parsing global section: %v", err)
+		return nil, fmt.Errorf("Error parsing global section%s: %v", positions.locate("", err), err)
+	}
+	for _, hook := range []struct {
+		name          string
+		relaxed       bool
+		queries       *[]string
+		eachIteration *[]string
+	}{
+		{"setup", false, &config.Setup, &config.SetupEachIteration},
+		{"teardown", false, &config.Teardown, nil},
+		{"between-iterations", true, &config.BetweenIterations, nil},
+	} {
+		if err := decodeHookSection(df, iniConfig.Section(hook.name), basedir, hook.relaxed,
+			hook.queries, hook.eachIteration); err != nil {
+			return nil, fmt.Errorf("Error parsing %s section%s: %v",
+				hook.name, positions.locate(hook.name, err), err)
+		}
 	}
-	if err := decodeSetupSection(df, iniConfig.Section("setup"), basedir, &config.Setup); err != nil {
-		return nil, fmt.Errorf("Error parsing setup section: %v", err)
+	seedData, err := decodeSeedSection(iniConfig.Section("seed"))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing seed section%s: %v", positions.locate("seed", err), err)
+	}
+	config.SeedData = seedData
+	if err := decodeConfigJobs(df, iniConfig, positions, basedir, config); err != nil {
+		return nil, err
 	}
-	if err := decodeSetupSection(df, iniConfig.Section("teardown"), basedir, &config.Teardown); err != nil {
-		return nil, fmt.Errorf("Error parsing teardown section: %v", err)
+	if err := expandJobTemplates(config); err != nil {
+		return nil, err
 	}
-	if err := decodeConfigJobs(df, iniConfig, basedir, config); err != nil {
+	if err := validateQueryTemplates(config.Jobs); err != nil {
 		return nil, err
 	}
 
+	retries := false
 	for name, job := range config.Jobs {
+		retries = retries || job.Retries > 0
+		if job.QueryResults != nil && job.QueryResults.maxRows == 0 {
+			job.QueryResults.maxRows = config.ResultsMaxRows
+		}
 		if config.Duration > 0 && job.Start > config.Duration {
 			return nil, fmt.Errorf("job %s starts after test finishes.",
 				strconv.Quote(name))
@@ -412,18 +1731,74 @@ func parseIniConfig(df DatabaseFlavor, iniConfig *goini.RawConfig, basedir strin
 			return nil, fmt.Errorf("job %s stops after test finishes.",
 				strconv.Quote(name))
 		}
+
+		if job.RampDown > 0 {
+			if job.Stop == 0 {
+				job.Stop = config.Duration
+			}
+			if job.Stop == 0 {
+				return nil, fmt.Errorf("job %s has a ramp-down but no stop or duration",
+					strconv.Quote(name))
+			} else if job.Stop-job.RampDown < job.Start+job.WarmupDuration+job.RampUp {
+				return nil, fmt.Errorf("ramp-down of job %s starts before the job (or its warmup or ramp)",
+					strconv.Quote(name))
+			}
+		}
+	}
+	if err := validateProbes(config.Jobs); err != nil {
+		return nil, err
+	}
+	if err := validateDependencies(config.Jobs); err != nil {
+		return nil, err
+	}
+	if config.RetryBudget > 0 && !retries {
+		return nil, errors.New("retry-budget requires a job with retries")
 	}
 
 	return config, nil
 }
 
 func parseConfig(df DatabaseFlavor, configFile string, baseDir string) (*Config, error) {
-	cp := goini.NewRawConfigParser()
-	cp.ParseFile(configFile)
-	iniConfig, err := cp.Finish()
+	iniConfig, positions, err := readRawConfig(configFile)
 	if err != nil {
 		return nil, err
 	}
+	return parseIniConfig(df, iniConfig, positions, baseDir)
+}
+
+/*
+ * Reads the sections of the config file, INI or YAML, with its
+ * environment variables expanded. The positions are nil for YAML, as there
+ * are no INI lines to point errors at.
+ */
+func readRawConfig(configFile string) (*goini.RawConfig, *configPositions, error) {
+	contents, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contents, err = expandConfigEnv(contents, os.LookupEnv); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", configFile, err)
+	}
+
+	if isYAMLFile(configFile) {
+		iniConfig, err := parseYAMLConfig(contents)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", configFile, err)
+		}
+		return iniConfig, nil, nil
+	}
 
-	return parseIniConfig(df, iniConfig, baseDir)
+	cp := goini.NewRawConfigParser()
+	if err = cp.Parse(bytes.NewReader(contents)); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", configFile, err)
+	}
+	iniConfig, err := cp.Finish()
+	if err != nil {
+		return nil, nil, err
+	}
+	positions, err := scanConfigPositions(bytes.NewReader(contents))
+	if err != nil {
+		return nil, nil, err
+	}
+	return iniConfig, positions, nil
 }
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+/*
+ * Like the query-stats-file, the echo file is opened when we first parse the
+ * flags (i.e. before we change our base directory).
+ */
+var echoConfigFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&echoConfigFile, "echo-config",
+		"Write the effective config, with all defaults and derived values "+
+			"resolved, to this file as JSON.")
+}
+
+/*
+ * The effective config of a test, as written by -echo-config. Durations are
+ * normalized strings (e.g. "1m30s"). Files are described rather than
+ * included.
+ */
+type ConfigEcho struct {
+	Flavor                   string              `json:"flavor"`
+	Duration                 string              `json:"duration,omitempty"`
+	Setup                    []string            `json:"setup,omitempty"`
+	SetupEachIteration       []string            `json:"setupEachIteration,omitempty"`
+	Teardown                 []string            `json:"teardown,omitempty"`
+	BetweenIterations        []string            `json:"betweenIterations,omitempty"`
+	SeedData                 *SeedData           `json:"seed,omitempty"`
+	AcceptedErrors           []string            `json:"acceptedErrors,omitempty"`
+	ToleratedErrors          []string            `json:"toleratedErrors,omitempty"`
+	MaxWriteBytes            int64               `json:"maxWriteBytes,omitempty"`
+	MaxTotalConcurrency      int                 `json:"maxTotalConcurrency,omitempty"`
+	AcceptedErrorsAreGoodput bool                `json:"acceptedErrorsAreGoodput,omitempty"`
+	ResultsMaxRows           int64               `json:"resultsMaxRows,omitempty"`
+	RetryBudget              float64             `json:"retryBudget,omitempty"`
+	DisableStatementCache    bool                `json:"disableStatementCache,omitempty"`
+	Jobs                     map[string]*JobEcho `json:"jobs"`
+}
+
+type JobEcho struct {
+	Queries              []string          `json:"queries,omitempty"`
+	QueryLogFormat       string            `json:"queryLogFormat,omitempty"`
+	QueryArgs            bool              `json:"queryArgs,omitempty"`
+	QueryArgColumns      [][]int           `json:"queryArgColumns,omitempty"`
+	ShardKeyColumn       *int              `json:"shardKeyColumn,omitempty"`
+	Shards               int               `json:"shards,omitempty"`
+	QueryResultsFile     string            `json:"queryResultsFile,omitempty"`
+	LatencyLogFile       string            `json:"latencyLogFile,omitempty"`
+	LatencyLogSampling   float64           `json:"latencyLogSampling,omitempty"`
+	Start                string            `json:"start,omitempty"`
+	Stop                 string            `json:"stop,omitempty"`
+	QueueDepth           uint64            `json:"queueDepth,omitempty"`
+	Rate                 float64           `json:"rate,omitempty"`
+	Interval             string            `json:"interval,omitempty"`
+	Count                uint64            `json:"count,omitempty"`
+	BatchSize            uint64            `json:"batchSize,omitempty"`
+	MaxBatchSize         uint64            `json:"maxBatchSize,omitempty"`
+	AdaptiveRate         *AdaptiveRateEcho `json:"adaptiveRate,omitempty"`
+	WarmupRate           float64           `json:"warmupRate,omitempty"`
+	WarmupDuration       string            `json:"warmupDuration,omitempty"`
+	RampUp               string            `json:"ramp,omitempty"`
+	RampDown             string            `json:"rampDown,omitempty"`
+	Timeout              string            `json:"timeout,omitempty"`
+	QueryTimeout         string            `json:"queryTimeout,omitempty"`
+	MaxWriteBytes        int64             `json:"maxWriteBytes,omitempty"`
+	RowCountBuckets      []int64           `json:"rowCountBuckets,omitempty"`
+	ThinkTimes           []string          `json:"thinkTimes,omitempty"`
+	ThinkTime            string            `json:"thinkTime,omitempty"`
+	QueryWeights         []float64         `json:"queryWeights,omitempty"`
+	MinUtilization       float64           `json:"minUtilization,omitempty"`
+	ShuffleQueries       bool              `json:"shuffleQueries,omitempty"`
+	ConnectOnly          bool              `json:"connectOnly,omitempty"`
+	ConnectionPerQuery   bool              `json:"connectionPerQuery,omitempty"`
+	Transaction          bool              `json:"transaction,omitempty"`
+	Prepared             bool              `json:"prepared,omitempty"`
+	QueryTemplate        bool              `json:"queryTemplate,omitempty"`
+	Seed                 int64             `json:"seed,omitempty"`
+	IterationQueries     []string          `json:"iterationQueries,omitempty"`
+	Phases               []string          `json:"phases,omitempty"`
+	VerifyIdempotent     bool              `json:"verifyIdempotent,omitempty"`
+	ExplainAnalyze       bool              `json:"explainAnalyze,omitempty"`
+	ServerExecTime       bool              `json:"serverExecTime,omitempty"`
+	Priority             int               `json:"priority,omitempty"`
+	SuccessExpr          string            `json:"successExpr,omitempty"`
+	FailZeroRowsAffected bool              `json:"failZeroRowsAffected,omitempty"`
+	WarnEmptyResults     bool              `json:"warnEmptyResults,omitempty"`
+	FailFraction         float64           `json:"failFraction,omitempty"`
+	Retries              int               `json:"retries,omitempty"`
+	Probe                string            `json:"probe,omitempty"`
+	DependsOn            []string          `json:"dependsOn,omitempty"`
+	ProbeMaxP99          string            `json:"probeMaxP99,omitempty"`
+}
+
+type AdaptiveRateEcho struct {
+	TargetP99 string  `json:"targetP99"`
+	MinRate   float64 `json:"minRate"`
+	MaxRate   float64 `json:"maxRate"`
+	Interval  string  `json:"interval"`
+}
+
+func echoDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func echoSet(s Set) []string {
+	var values []string
+	for v := range s {
+		values = append(values, fmt.Sprint(v))
+	}
+	sort.Strings(values)
+	return values
+}
+
+func flavorName(df DatabaseFlavor) string {
+	if sq, ok := df.(*sqlDatabaseFlavor); ok {
+		return sq.name
+	} else if _, ok := df.(mockDatabaseFlavor); ok {
+		return "mock"
+	}
+	return fmt.Sprintf("%T", df)
+}
+
+func echoJob(job *Job) *JobEcho {
+	je := &JobEcho{
+		Queries:              job.Queries,
+		QueryArgs:            job.QueryArgs != nil,
+		QueryArgColumns:      job.QueryArgColumns,
+		Shards:               job.Shards,
+		Start:                echoDuration(job.Start),
+		Stop:                 echoDuration(job.Stop),
+		QueueDepth:           job.QueueDepth,
+		Rate:                 job.Rate,
+		Count:                job.Count,
+		BatchSize:            job.BatchSize,
+		MaxBatchSize:         job.MaxBatchSize,
+		WarmupRate:           job.WarmupRate,
+		WarmupDuration:       echoDuration(job.WarmupDuration),
+		RampUp:               echoDuration(job.RampUp),
+		RampDown:             echoDuration(job.RampDown),
+		Timeout:              echoDuration(job.Timeout),
+		QueryTimeout:         echoDuration(job.QueryTimeout),
+		MaxWriteBytes:        job.MaxWriteBytes,
+		RowCountBuckets:      job.RowCountBuckets,
+		MinUtilization:       job.MinUtilization,
+		QueryWeights:         job.QueryWeights,
+		ShuffleQueries:       job.ShuffleQueries,
+		ConnectOnly:          job.ConnectOnly,
+		ConnectionPerQuery:   job.ConnectionPerQuery,
+		Transaction:          job.Transaction,
+		Prepared:             job.Prepared,
+		QueryTemplate:        job.QueryTemplate,
+		Seed:                 job.Seed,
+		IterationQueries:     job.IterationQueries,
+		VerifyIdempotent:     job.VerifyIdempotent,
+		ExplainAnalyze:       job.ExplainAnalyze,
+		ServerExecTime:       job.ServerExecTime,
+		Priority:             job.Priority,
+		FailZeroRowsAffected: job.FailZeroRowsAffected,
+		WarnEmptyResults:     job.WarnEmptyResults,
+		FailFraction:         job.FailFraction,
+		Retries:              job.Retries,
+		Probe:                job.Probe,
+		DependsOn:            job.DependsOn,
+		ProbeMaxP99:          echoDuration(job.ProbeMaxP99),
+		LatencyLogSampling:   job.LatencyLogSampling,
+	}
+	if job.Shards > 0 {
+		column := job.ShardKeyColumn
+		je.ShardKeyColumn = &column
+	}
+	if job.QueryLog != nil {
+		je.QueryLogFormat = firstString(job.QueryLogFormat, defaultQueryLogFormat)
+	}
+	if job.QueryResults != nil {
+		je.QueryResultsFile = job.QueryResults.name
+	}
+	if job.LatencyLog != nil {
+		je.LatencyLogFile = job.LatencyLog.name
+	}
+	if job.Rate > 0 {
+		je.Interval = rateInterval(job.Rate).String()
+	}
+	if ar := job.AdaptiveRate; ar != nil {
+		je.AdaptiveRate = &AdaptiveRateEcho{ar.TargetP99.String(), ar.MinRate, ar.MaxRate, ar.Interval.String()}
+	}
+	for _, thinkTime := range job.ThinkTimes {
+		je.ThinkTimes = append(je.ThinkTimes, thinkTime.String())
+	}
+	if job.ThinkTimeJitter > 0 {
+		je.ThinkTime = fmt.Sprintf("%v±%v", job.ThinkTime, job.ThinkTimeJitter)
+	} else if job.ThinkTime > 0 {
+		je.ThinkTime = job.ThinkTime.String()
+	}
+	for _, phase := range job.Phases {
+		je.Phases = append(je.Phases, fmt.Sprintf("%v %v", phase, phase.Weights))
+	}
+	if job.SuccessExpr != nil {
+		je.SuccessExpr = job.SuccessExpr.String()
+	}
+	return je
+}
+
+func echoConfig(config *Config) *ConfigEcho {
+	ce := &ConfigEcho{
+		Flavor:                   flavorName(config.Flavor),
+		Duration:                 echoDuration(config.Duration),
+		Setup:                    config.Setup,
+		SetupEachIteration:       config.SetupEachIteration,
+		Teardown:                 config.Teardown,
+		BetweenIterations:        config.BetweenIterations,
+		SeedData:                 config.SeedData,
+		AcceptedErrors:           echoSet(config.AcceptedErrors),
+		ToleratedErrors:          echoSet(config.ToleratedErrors),
+		MaxWriteBytes:            config.MaxWriteBytes,
+		MaxTotalConcurrency:      config.MaxTotalConcurrency,
+		AcceptedErrorsAreGoodput: config.AcceptedErrorsAreGoodput,
+		ResultsMaxRows:           config.ResultsMaxRows,
+		RetryBudget:              config.RetryBudget,
+		DisableStatementCache:    *disableStatementCache,
+		Jobs:                     make(map[string]*JobEcho, len(config.Jobs)),
+	}
+	for name, job := range config.Jobs {
+		ce.Jobs[name] = echoJob(job)
+	}
+	return ce
+}
+
+func writeConfigEcho(w io.Writer, config *Config) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(echoConfig(config))
+}
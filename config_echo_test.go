@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/awreece/goini"
+)
+
+func TestConfigEchoRoundTrip(t *testing.T) {
+	cp := goini.NewRawConfigParser()
+	cp.Parse(strings.NewReader(`duration=1m
+error=1205
+[setup]
+query=create table t (a int)
+[fixed]
+query=select :a
+query-args=1
+interval=250ms
+stop=30s
+success-expr=rows > 0
+[adaptive]
+query=select 1
+query=select 2
+multi-query-mode=multi-connection
+adaptive-rate-p99=10ms
+adaptive-rate-min=10
+adaptive-rate-max=100
+phase=0s-10s 1 0
+phase=10s- 1 1`))
+	iniConfig, err := cp.Finish()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config, err := parseIniConfig(testFlavor(t, "mysql"), iniConfig, nil, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeConfigEcho(&buf, config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var echo ConfigEcho
+	if err := json.Unmarshal(buf.Bytes(), &echo); err != nil {
+		t.Fatalf("Error parsing echo %s: %v", buf.String(), err)
+	}
+	if expected := echoConfig(config); !reflect.DeepEqual(&echo, expected) {
+		t.Errorf("Round trip changed the echo:\ngot\t\t%+v\nbut expected\t%+v", &echo, expected)
+	}
+
+	if echo.Flavor != "mysql" || echo.Duration != "1m0s" ||
+		!reflect.DeepEqual(echo.AcceptedErrors, []string{"1205"}) {
+		t.Errorf("Unexpected global config %+v", echo)
+	}
+	fixed := echo.Jobs["fixed"]
+	if fixed == nil || fixed.Rate != 4 || fixed.Interval != "250ms" ||
+		fixed.Stop != "30s" || fixed.BatchSize != 1 || !fixed.QueryArgs ||
+		fixed.SuccessExpr == "" {
+		t.Errorf("Unexpected echo of fixed %+v", fixed)
+	}
+	adaptive := echo.Jobs["adaptive"]
+	if adaptive == nil || adaptive.AdaptiveRate == nil ||
+		adaptive.AdaptiveRate.TargetP99 != "10ms" || len(adaptive.Phases) != 2 {
+		t.Errorf("Unexpected echo of adaptive %+v", adaptive)
+	}
+}
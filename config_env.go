@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A ${VAR} or ${VAR:-default} reference.
+var bracedEnvVarRef = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// A $VAR reference, or the $tag$ of a dollar quote if followed by a $.
+var envVarName = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+/*
+ * The quoted SQL literal a line ends in: none, a string in single quotes or
+ * a dollar quoted string ($$ or $tag$).
+ */
+type envQuote struct {
+	single bool
+	dollar string
+}
+
+func (q envQuote) quoted() bool {
+	return q.single || q.dollar != ""
+}
+
+/*
+ * Expands the environment variables in the config: ${VAR}, or
+ * ${VAR:-default} for a default used if the variable is unset or empty, and
+ * $VAR outside of quoted SQL literals. A variable that is unset without a
+ * default is an error. A $VAR in a string in single quotes or in a dollar
+ * quoted string is kept as is (unlike ${VAR}), as are the $1 placeholders
+ * and the dollar quotes ($$ or $tag$) of Postgres. Comment lines are not expanded, and the
+ * lines stay the same so that errors point at the right one.
+ */
+func expandConfigEnv(contents []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	lines := bytes.Split(contents, []byte("\n"))
+	var quote envQuote
+	for i, line := range lines {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) > 0 && (trimmed[0] == ';' || trimmed[0] == '#') {
+			continue
+		}
+		expanded, lineQuote, err := expandEnvLine(string(line), quote, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		lines[i] = []byte(expanded)
+		// Only a value continued on the next line (see goini) can have a
+		// literal spanning lines.
+		quote = envQuote{}
+		if bytes.HasSuffix(bytes.TrimRight(line, "\r"), []byte("\\")) {
+			quote = lineQuote
+		}
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+/*
+ * Expands the variables of a line starting in the given quoted literal,
+ * returning the literal it ends in.
+ */
+func expandEnvLine(line string, quote envQuote, lookup func(string) (string, bool)) (string, envQuote, error) {
+	var str strings.Builder
+	for i := 0; i < len(line); {
+		rest := line[i:]
+		switch {
+		case strings.HasPrefix(rest, "${") && bracedEnvVarRef.MatchString(rest):
+			m := bracedEnvVarRef.FindStringSubmatch(rest)
+			hasDefault := strings.Contains(m[0], ":-")
+			value, err := lookupEnvVar(lookup, m[1], hasDefault, m[2])
+			if err != nil {
+				return "", quote, err
+			}
+			str.WriteString(value)
+			i += len(m[0])
+			continue
+		case quote.dollar != "":
+			if strings.HasPrefix(rest, quote.dollar) {
+				str.WriteString(quote.dollar)
+				i += len(quote.dollar)
+				quote.dollar = ""
+				continue
+			}
+		case rest[0] == '\'':
+			quote.single = !quote.single
+		case rest[0] != '$' || quote.single:
+		case strings.HasPrefix(rest, "$$"):
+			quote.dollar = "$$"
+			str.WriteString(quote.dollar)
+			i += len(quote.dollar)
+			continue
+		case envVarName.MatchString(rest):
+			name := envVarName.FindStringSubmatch(rest)[1]
+			if strings.HasPrefix(rest[len(name)+1:], "$") {
+				quote.dollar = "$" + name + "$"
+				str.WriteString(quote.dollar)
+				i += len(quote.dollar)
+				continue
+			}
+			value, err := lookupEnvVar(lookup, name, false, "")
+			if err != nil {
+				return "", quote, err
+			}
+			str.WriteString(value)
+			i += len(name) + 1
+			continue
+		}
+		str.WriteByte(line[i])
+		i++
+	}
+	return str.String(), quote, nil
+}
+
+/*
+ * Returns the value of the variable, or the default if it is unset or
+ * empty and there is one.
+ */
+func lookupEnvVar(lookup func(string) (string, bool), name string, hasDefault bool, def string) (string, error) {
+	value, ok := lookup(name)
+	if hasDefault && value == "" {
+		return def, nil
+	} else if !ok {
+		return "", fmt.Errorf("environment variable %s is not set (use ${%s:-default} for a default)", name, name)
+	}
+	return value, nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandConfigEnv(t *testing.T) {
+	env := map[string]string{"HOST": "db1", "TABLE": "t", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	for _, c := range []struct {
+		in, out string
+	}{
+		{"query=select * from ${TABLE}", "query=select * from t"},
+		{"query=select * from ${TABLE}_1", "query=select * from t_1"},
+		{"query-file=${DIR:-queries}/a.sql", "query-file=queries/a.sql"},
+		{"query-file=${EMPTY:-queries}/a.sql", "query-file=queries/a.sql"},
+		{"query-file=${HOST:-x}", "query-file=db1"},
+		{"query=select * from $TABLE where host = '${HOST}'", "query=select * from t where host = 'db1'"},
+		{"query-file=$EMPTY/a.sql", "query-file=/a.sql"},
+		// A $VAR in a quoted literal, Postgres placeholders and dollar
+		// quotes are kept as is.
+		{"query=select $1, '$UNSET', 'it''s $UNSET', cost$", "query=select $1, '$UNSET', 'it''s $UNSET', cost$"},
+		{"query=select $body$x$body$", "query=select $body$x$body$"},
+		{"query=select $q$ $UNSET ${TABLE} $q$, $TABLE", "query=select $q$ $UNSET t $q$, t"},
+		{"query=do $$a; $UNSET$$ || $TABLE", "query=do $$a; $UNSET$$ || t"},
+		{"query=select $${TABLE}$$", "query=select $${TABLE}$$"},
+		{`query=select $${"a": 1}$$::jsonb`, `query=select $${"a": 1}$$::jsonb`},
+		// A literal only continues on the next line of a continued value.
+		{"query=select 'a \\\n$UNSET', $TABLE", "query=select 'a \\\n$UNSET', t"},
+		{"name=it's\nquery=$TABLE", "name=it's\nquery=t"},
+		{"query=select ${1x}, ${HOST", "query=select ${1x}, ${HOST"},
+		{"; comment with ${UNSET}\nquery=${HOST}", "; comment with ${UNSET}\nquery=db1"},
+		{"  # comment with ${UNSET}", "  # comment with ${UNSET}"},
+	} {
+		out, err := expandConfigEnv([]byte(c.in), lookup)
+		if err != nil {
+			t.Errorf("Unexpected error expanding %q: %v", c.in, err)
+		} else if string(out) != c.out {
+			t.Errorf("Expected %q to expand to %q but got %q", c.in, c.out, out)
+		}
+	}
+
+	for _, c := range []struct {
+		in, err string
+	}{
+		{"[job]\nquery=select ${UNSET}", "line 2: environment variable UNSET is not set"},
+		{"query=${UNSET:-x} ${UNSET}", "environment variable UNSET is not set"},
+		{"query=select * from $UNSET", "environment variable UNSET is not set"},
+		{"query=select '$TABLE' from $UNSET", "environment variable UNSET is not set"},
+	} {
+		if _, err := expandConfigEnv([]byte(c.in), lookup); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("Expected expanding %q to fail with %q but got %v", c.in, c.err, err)
+		}
+	}
+}
+
+func TestParseConfigExpandsEnv(t *testing.T) {
+	os.Setenv("DBBENCH_TEST_TABLE", "t")
+	defer os.Unsetenv("DBBENCH_TEST_TABLE")
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "env.ini")
+	if err := ioutil.WriteFile(configFile,
+		[]byte("[test]\nquery=select * from ${DBBENCH_TEST_TABLE}, $DBBENCH_TEST_TABLE\n"+
+			"[quoted]\nquery=select $body$x$body$, $$a; b$$\n"), 0644); err != nil {
+		t.Fatalf("Error writing config: %v", err)
+	}
+	config, err := parseConfig(testFlavor(t, "postgres"), configFile, dir)
+	if err != nil {
+		t.Fatalf("Error parsing config: %v", err)
+	}
+	if q := config.Jobs["test"].Queries; len(q) != 1 || q[0] != "select * from t, t" {
+		t.Errorf("Expected the table to be expanded but got %q", q)
+	}
+	if q := config.Jobs["quoted"].Queries; len(q) != 1 || q[0] != "select $body$x$body$, $$a; b$$" {
+		t.Errorf("Expected the dollar quotes to be kept but got %q", q)
+	}
+}
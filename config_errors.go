@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awreece/goini"
+)
+
+/*
+ * The line of each section header and property value in an INI config file,
+ * since goini does not keep track of them. The global section is "".
+ */
+type configPositions struct {
+	sections   map[string]int
+	properties map[string]map[string][]int
+}
+
+/*
+ * Scans the config for the positions of its sections and properties,
+ * following the syntax goini accepts (in particular, line continuations).
+ * Syntax errors are left to goini.
+ */
+func scanConfigPositions(r io.Reader) (*configPositions, error) {
+	cp := &configPositions{
+		sections:   map[string]int{"": 0},
+		properties: map[string]map[string][]int{"": {}},
+	}
+
+	section := ""
+	var continued string
+	var start int
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if continued == "" {
+			start = line
+		}
+		if len(text) > 0 && (text[0] == ';' || text[0] == '#') {
+			continue
+		}
+		if len(text) > 0 && text[len(text)-1] == '\\' {
+			continued += text[:len(text)-1]
+			continue
+		}
+		text = strings.TrimSpace(continued + text)
+		continued = ""
+
+		if strings.HasPrefix(text, "[") {
+			if end := strings.Index(text, "]"); end > 0 {
+				section = text[1:end]
+				cp.sections[section] = start
+				cp.properties[section] = map[string][]int{}
+			}
+		} else if parts := strings.SplitN(text, "=", 2); len(parts) == 2 {
+			property := strings.TrimSpace(parts[0])
+			cp.properties[section][property] = append(cp.properties[section][property], start)
+		}
+	}
+	return cp, scanner.Err()
+}
+
+/*
+ * An error decoding a value of a property. The index is that of the value
+ * among the values of the property.
+ */
+type optionError struct {
+	property string
+	index    int
+	value    string
+	err      error
+}
+
+func (oe *optionError) Error() string {
+	return oe.err.Error()
+}
+
+/*
+ * Like goini.DecodeOptionSet.Decode, but returns an *optionError so that the
+ * offending property can be located. Properties are decoded in sorted order
+ * so that the first error is deterministic.
+ */
+func decodeOptions(dos goini.DecodeOptionSet, section goini.RawSection, dest interface{}) error {
+	properties := section.Properties()
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		values := section.GetPropertyValues(property)
+		option, ok := dos[property]
+		if !ok {
+			return &optionError{property, 0, values[0],
+				fmt.Errorf("unexpected property %s", strconv.Quote(property))}
+		}
+		if option.Kind == goini.UniqueOption && len(values) != 1 {
+			return &optionError{property, 1, values[1],
+				fmt.Errorf("property %s cannot be repeated", strconv.Quote(property))}
+		}
+		for i, value := range values {
+			if e := option.Parse(value, dest); e != nil {
+				return &optionError{property, i, value,
+					fmt.Errorf("error parsing %s: %s", strconv.Quote(property), e)}
+			}
+		}
+	}
+	return nil
+}
+
+// Values longer than this are elided in error locations.
+const maxLocatedValueLength = 40
+
+/*
+ * Describes where in the config the error decoding the section occurred,
+ * e.g. " (line 12: rate=abc)": the offending property if known, and the
+ * line of that property (or of the section) if we know the positions.
+ */
+func (cp *configPositions) locate(section string, err error) string {
+	var parts []string
+
+	oe, isOptionError := err.(*optionError)
+	if cp != nil {
+		line, ok := cp.sections[section]
+		if isOptionError {
+			if lines := cp.properties[section][oe.property]; oe.index < len(lines) {
+				line, ok = lines[oe.index], true
+			}
+		}
+		if ok && line > 0 {
+			parts = append(parts, fmt.Sprintf("line %d", line))
+		}
+	}
+	if isOptionError {
+		value := oe.value
+		if len(value) > maxLocatedValueLength {
+			value = value[:maxLocatedValueLength] + "..."
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", oe.property, value))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ": ") + ")"
+}
@@ -17,8 +17,14 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -32,9 +38,14 @@ func TestExamplesParse(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error finding example files: %v", err)
 	}
+	yamlExamples, err := filepath.Glob("examples/*.yaml")
+	if err != nil {
+		t.Fatalf("Error finding example files: %v", err)
+	}
+	examples = append(examples, yamlExamples...)
 
 	for _, example := range examples {
-		if _, e := parseConfig(supportedDatabaseFlavors["mysql"], example, "examples/"); e != nil {
+		if _, e := parseConfig(testFlavor(t, "mysql"), example, "examples/"); e != nil {
 			t.Errorf("Error parsing %s: %v", example, e)
 		}
 	}
@@ -54,7 +65,7 @@ func TestReadQueries(t *testing.T) {
 		{";;;;", []string{}},
 	}
 
-	df := supportedDatabaseFlavors["mysql"]
+	df := testFlavor(t, "mysql")
 	for _, c := range cases {
 		qs, err := readQueriesFromReader(df, strings.NewReader(c.in))
 		if err != nil {
@@ -67,13 +78,16 @@ func TestReadQueries(t *testing.T) {
 }
 
 func TestParseIniConfig(t *testing.T) {
+	t.Setenv("DBBENCH_TEST_RATE", "10")
+	os.Unsetenv("DBBENCH_TEST_UNSET")
+
 	var goodCases = []struct {
 		in  string
 		out *Config
 	}{
 		{"[test]\nquery=select 1",
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"test": &Job{
 						Name: "test", QueueDepth: 1,
@@ -84,7 +98,7 @@ func TestParseIniConfig(t *testing.T) {
 		},
 		{"[test1]\nquery=select 1\n[test2]\nquery=select 2",
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"test1": &Job{
 						Name: "test1", QueueDepth: 1,
@@ -103,7 +117,7 @@ func TestParseIniConfig(t *testing.T) {
 			rate=1
 			`,
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"test1": &Job{
 						Name: "test1", Rate: 1.0,
@@ -119,7 +133,7 @@ func TestParseIniConfig(t *testing.T) {
 			count=1
 			`,
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"test job": &Job{
 						Name: "test job", QueueDepth: 1, Count: 1,
@@ -142,7 +156,7 @@ func TestParseIniConfig(t *testing.T) {
 			count=30
 			`,
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Setup: []string{
 					"insert into t select RAND(), RAND()",
 					"insert into t select RAND(), RAND() from t",
@@ -168,7 +182,7 @@ func TestParseIniConfig(t *testing.T) {
 			stop=15s
 			`,
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"run 2 queries at a time for 10 seconds, starting at 5s": &Job{
 						Name:       "run 2 queries at a time for 10 seconds, starting at 5s",
@@ -186,7 +200,7 @@ func TestParseIniConfig(t *testing.T) {
 			query=select 1+1
 			`,
 			&Config{
-				Flavor:   supportedDatabaseFlavors["mysql"],
+				Flavor:   testFlavor(t, "mysql"),
 				Duration: 10 * time.Second,
 				Jobs: map[string]*Job{
 					"test job": &Job{
@@ -210,7 +224,7 @@ func TestParseIniConfig(t *testing.T) {
 			query=select 1+1
 			`,
 			&Config{
-				Flavor: supportedDatabaseFlavors["mysql"],
+				Flavor: testFlavor(t, "mysql"),
 				Jobs: map[string]*Job{
 					"test job": &Job{
 						Name: "test job", QueueDepth: 1,
@@ -223,13 +237,738 @@ func TestParseIniConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			`
+			error=1205
+			tolerated-error=1213
+
+			[test job]
+			query=select 1+1
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"test job": &Job{
+						Name: "test job", QueueDepth: 1,
+						Queries: []string{"select 1+1"},
+					},
+				},
+				AcceptedErrors: Set{
+					"1205": struct{}{},
+				},
+				ToleratedErrors: Set{
+					"1213": struct{}{},
+				},
+			},
+		},
+		{
+			`
+			[adaptive]
+			query=select 1
+			adaptive-rate-p99=10ms
+			adaptive-rate-min=10
+			adaptive-rate-max=100
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"adaptive": &Job{
+						Name: "adaptive", Rate: 10, BatchSize: 1,
+						Queries: []string{"select 1"},
+						AdaptiveRate: &AdaptiveRate{
+							TargetP99: 10 * time.Millisecond,
+							MinRate:   10, MaxRate: 100,
+							Interval: time.Second,
+						},
+					},
+				},
+			},
+		},
+		{
+			`
+			max-write-bytes=1GB
+
+			[load]
+			query=insert into t values (1)
+			max-write-bytes=10MB
+			`,
+			&Config{
+				Flavor:        testFlavor(t, "mysql"),
+				MaxWriteBytes: 1 << 30,
+				Jobs: map[string]*Job{
+					"load": &Job{
+						Name: "load", QueueDepth: 1, MaxWriteBytes: 10 << 20,
+						Queries: []string{"insert into t values (1)"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[mix]
+			query=select 1
+			query=update t set a = a + 1
+			multi-query-mode=multi-connection
+			stop=2h
+			phase=0s-1h 9 1
+			phase=1h-2h 1 9
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"mix": &Job{
+						Name: "mix", QueueDepth: 1, Stop: 2 * time.Hour,
+						Queries: []string{"select 1", "update t set a = a + 1"},
+						Phases: []Phase{
+							{0, time.Hour, []float64{9, 1}},
+							{time.Hour, 2 * time.Hour, []float64{1, 9}},
+						},
+					},
+				},
+			},
+		},
+		{
+			`
+			[transfer]
+			query=update accounts set balance = balance - 1 where id = 1
+			query=update accounts set balance = balance + 1 where id = 2
+			multi-query-mode=transaction
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"transfer": &Job{
+						Name: "transfer", QueueDepth: 1,
+						Queries: []string{
+							"update accounts set balance = balance - 1 where id = 1",
+							"update accounts set balance = balance + 1 where id = 2",
+						},
+						Transaction: true,
+					},
+				},
+			},
+		},
+		{
+			`
+			[random lookup]
+			query=select * from t where id = {{randInt 1 1000000}}
+			query-template=true
+			[hot lookup]
+			query=select * from t where id = {{zipf 1 1000000 2}}
+			query-template=true
+			seed=42
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"random lookup": &Job{
+						Name: "random lookup", QueueDepth: 1,
+						Queries:       []string{"select * from t where id = {{randInt 1 1000000}}"},
+						QueryTemplate: true,
+					},
+					"hot lookup": &Job{
+						Name: "hot lookup", QueueDepth: 1,
+						Queries:       []string{"select * from t where id = {{zipf 1 1000000 2}}"},
+						QueryTemplate: true,
+						Seed:          42,
+					},
+				},
+			},
+		},
+		{
+			`
+			[slow]
+			query=select sleep(10)
+			query-timeout=500ms
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"slow": &Job{
+						Name: "slow", QueueDepth: 1,
+						Queries:      []string{"select sleep(10)"},
+						QueryTimeout: 500 * time.Millisecond,
+					},
+				},
+			},
+		},
+		{
+			`
+			[lookup]
+			query=select * from t where id = 1
+			prepared=true
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"lookup": &Job{
+						Name: "lookup", QueueDepth: 1,
+						Queries:  []string{"select * from t where id = 1"},
+						Prepared: true,
+					},
+				},
+			},
+		},
+		{
+			`
+			[weighted]
+			query=select 1
+			query=update t set a = a + 1
+			multi-query-mode=multi-connection
+			query-weights=0.9, 0.1
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"weighted": &Job{
+						Name: "weighted", QueueDepth: 1,
+						Queries:      []string{"select 1", "update t set a = a + 1"},
+						QueryWeights: []float64{0.9, 0.1},
+					},
+				},
+			},
+		},
+		{
+			`
+			[connect]
+			connect-only=true
+			rate=10
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"connect": &Job{
+						Name: "connect", ConnectOnly: true, Rate: 10, BatchSize: 1,
+					},
+				},
+			},
+		},
+		{
+			`
+			max-total-concurrency=16
+
+			[test]
+			query=select 1
+			queue-depth=100
+			`,
+			&Config{
+				Flavor:              testFlavor(t, "mysql"),
+				MaxTotalConcurrency: 16,
+				Jobs: map[string]*Job{
+					"test": &Job{
+						Name: "test", QueueDepth: 100,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[seed]
+			table=users
+			column=id serial
+			column=name STRING(8)
+			rows=10
+			batch-size=3
+
+			[test]
+			query=select 1
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				SeedData: &SeedData{
+					Table: "users", Rows: 10, BatchSize: 3,
+					Columns: []SeedColumn{{"id", "serial", 0}, {"name", "string", 8}},
+				},
+				Jobs: map[string]*Job{
+					"test": &Job{
+						Name: "test", QueueDepth: 1,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[busy]
+			query=select 1
+			queue-depth=4
+			min-utilization=80%
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"busy": &Job{
+						Name: "busy", QueueDepth: 4, MinUtilization: 80,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[slow]
+			query=select 1
+			interval=90s
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"slow": &Job{
+						Name: "slow", Rate: 1 / 90.0, BatchSize: 1,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[measured]
+			query=select 1
+			priority=10
+
+			[noise]
+			query=select 2
+			priority=-1
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"measured": &Job{
+						Name: "measured", QueueDepth: 1, Priority: 10,
+						Queries: []string{"select 1"},
+					},
+					"noise": &Job{
+						Name: "noise", QueueDepth: 1, Priority: -1,
+						Queries: []string{"select 2"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[shuffle]
+			query=select 1
+			query=select 2
+			multi-query-mode=multi-connection
+			shuffle-queries=true
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"shuffle": &Job{
+						Name: "shuffle", QueueDepth: 1, ShuffleQueries: true,
+						Queries: []string{"select 1", "select 2"},
+					},
+				},
+			},
+		},
+		{
+			`
+			duration=1m
+
+			[ramp]
+			query=select 1
+			rate=100
+			ramp=5s
+			ramp-down=10s
+			`,
+			&Config{
+				Flavor:   testFlavor(t, "mysql"),
+				Duration: time.Minute,
+				Jobs: map[string]*Job{
+					"ramp": &Job{
+						Name: "ramp", Rate: 100, BatchSize: 1, RampUp: 5 * time.Second,
+						RampDown: 10 * time.Second, Stop: time.Minute,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[scan]
+			query=select * from t where a < ?
+			row-count-buckets=0, 10,100
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"scan": &Job{
+						Name: "scan", QueueDepth: 1,
+						RowCountBuckets: []int64{0, 10, 100},
+						Queries:         []string{"select * from t where a < ?"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[batches]
+			query=select 1
+			rate=10
+			batch-size=1-10
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"batches": &Job{
+						Name: "batches", Rate: 10, BatchSize: 1, MaxBatchSize: 10,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[load]
+			query=insert into t values (1)
+			count=100
+			[index]
+			query=create index a on t (a)
+			count=1
+			[read]
+			query=select * from t where a = 1
+			depends-on=load, index
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"load": &Job{
+						Name: "load", QueueDepth: 1, Count: 100,
+						Queries: []string{"insert into t values (1)"},
+					},
+					"index": &Job{
+						Name: "index", QueueDepth: 1, Count: 1,
+						Queries: []string{"create index a on t (a)"},
+					},
+					"read": &Job{
+						Name: "read", QueueDepth: 1,
+						Queries:   []string{"select * from t where a = 1"},
+						DependsOn: []string{"load", "index"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[health]
+			query=select 1
+			rate=10
+			count=50
+			[load]
+			query=select 1
+			queue-depth=64
+			probe=health
+			probe-max-p99=5ms
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"health": &Job{
+						Name: "health", Rate: 10, BatchSize: 1, Count: 50,
+						Queries: []string{"select 1"},
+					},
+					"load": &Job{
+						Name: "load", QueueDepth: 64,
+						Probe: "health", ProbeMaxP99: 5 * time.Millisecond,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			retry-budget=0.1
+			[retried]
+			query=select 1
+			retries=3
+			`,
+			&Config{
+				Flavor:      testFlavor(t, "mysql"),
+				RetryBudget: 0.1,
+				Jobs: map[string]*Job{
+					"retried": &Job{
+						Name: "retried", QueueDepth: 1, Retries: 3,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[per-cpu]
+			query=select 1
+			rate=100 * NCPU
+			[from-env]
+			query=select 1
+			rate=$DBBENCH_TEST_RATE / 2
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"per-cpu": &Job{
+						Name: "per-cpu", Rate: 100 * float64(runtime.NumCPU()), BatchSize: 1,
+						Queries: []string{"select 1"},
+					},
+					"from-env": &Job{
+						Name: "from-env", Rate: 5, BatchSize: 1,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[warmup]
+			query=select 1
+			rate=100
+			warmup-rate=10
+			warmup-duration=30s
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Jobs: map[string]*Job{
+					"warmup": &Job{
+						Name: "warmup", Rate: 100, BatchSize: 1,
+						WarmupRate: 10, WarmupDuration: 30 * time.Second,
+						Queries: []string{"select 1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[setup]
+			query=create table t (a int)
+			each-iteration-query=truncate table t
+
+			[test job]
+			query=select 1+1
+			`,
+			&Config{
+				Flavor:             testFlavor(t, "mysql"),
+				Setup:              []string{"create table t (a int)"},
+				SetupEachIteration: []string{"truncate table t"},
+				Jobs: map[string]*Job{
+					"test job": &Job{
+						Name: "test job", QueueDepth: 1,
+						Queries: []string{"select 1+1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[between-iterations]
+			query=reset query cache;
+
+			[test job]
+			query=select 1+1
+			`,
+			&Config{
+				Flavor:            testFlavor(t, "mysql"),
+				BetweenIterations: []string{"reset query cache"},
+				Jobs: map[string]*Job{
+					"test job": &Job{
+						Name: "test job", QueueDepth: 1,
+						Queries: []string{"select 1+1"},
+					},
+				},
+			},
+		},
+		{
+			`
+			[setup]
+			query=create table t_{job_index} (a int)
+			query=insert into totals values ('{job_name}')
+
+			[teardown]
+			query=drop table t_{job_index}
+
+			[a]
+			query=select * from t_{job_index}
+
+			[b]
+			query=select * from t_{job_index} where '{job_name}' = 'b'
+			`,
+			&Config{
+				Flavor: testFlavor(t, "mysql"),
+				Setup: []string{
+					"create table t_0 (a int)",
+					"create table t_1 (a int)",
+					"insert into totals values ('a')",
+					"insert into totals values ('b')",
+				},
+				Teardown: []string{
+					"drop table t_0",
+					"drop table t_1",
+				},
+				Jobs: map[string]*Job{
+					"a": &Job{
+						Name: "a", QueueDepth: 1,
+						Queries: []string{"select * from t_0"},
+					},
+					"b": &Job{
+						Name: "b", QueueDepth: 1,
+						Queries: []string{"select * from t_1 where 'b' = 'b'"},
+					},
+				},
+			},
+		},
 	}
 
 	var badCases = []string{
 		"[test]\nrate=1",
+		"[test]\nquery=select 1\nadaptive-rate-p99=10ms",
+		"[test]\nquery=select 1\nsuccess-expr=rows >",
+		"[test]\nquery=select * from t_{job_idx}",
+		"[setup]\nquery=create table t_{job_id} (a int)\n[test]\nquery=select 1",
+		"[test]\nquery=select ?\nquery-args=1\nquery-args-file=examples/hello.tsv",
+		"[test]\nquery=select ?, ?\nquery-args=1,2\nquery-args=3",
+		"[test]\nquery=select 1\nsuccess-expr=foo > 0",
+		"[test]\nquery=select 1\nadaptive-rate-p99=10ms\nadaptive-rate-min=100\nadaptive-rate-max=10",
+		"[test]\nquery=select 1\nadaptive-rate-p99=10ms\nadaptive-rate-min=10\nadaptive-rate-max=100\nrate=1",
+		"[test]\nquery=select 1\nadaptive-rate-p99=10ms\nadaptive-rate-min=10\nadaptive-rate-max=100\nqueue-depth=1",
+		"error=1205\ntolerated-error=1205\n[test]\nquery=select 1",
+		"[test]\nquery=select :a\nquery-args-header=true",
+		"[test]\nquery=select 1\nrate=10\nwarmup-rate=10",
+		"[test]\nquery=select 1\nrate=10\nbatch-size=0-10",
+		"[test]\nquery=select 1\nrate=10\nbatch-size=10-1",
+		"[test]\nquery=select 1\nbatch-size=1-10",
+		"[test]\nquery=select 1\nrow-count-buckets=10,10",
+		"[test]\nquery=select 1\nrow-count-buckets=-1,10",
+		"[test]\nquery=select 1\nrow-count-buckets=a",
+		"[test]\nquery=select 1\nrate=10\nramp-down=1s",
+		"[test]\nquery=select 1\nramp-down=1s\nstop=10s",
+		"[test]\nquery=select 1\nrate=10\nramp-down=10s\nstart=5s\nstop=10s",
+		"[test]\nquery=select 1\nramp=1s",
+		"[test]\nquery=select 1\nrate=10\nramp=-1s",
+		"[test]\nquery=select 1\nrate=10\nramp=1s\nwarmup-rate=5\nwarmup-duration=1s",
+		"[test]\nquery=select 1\nrate=10\nramp=5s\nramp-down=6s\nstop=10s",
+		"[test]\nquery=select 1\nquery=select 2\nshuffle-queries=true",
+		"[test]\nquery=select 1\nshuffle-queries=true",
+		"[test]\nquery=select 1\npriority=high",
+		"max-total-concurrency=0\n[test]\nquery=select 1",
+		"[test]\nquery=select 1\nnull-marker=NULL",
+		"[test]\nquery=select 1\nfail-fraction=1.5",
+		"[test]\nquery=select 1\nrate=10\nthink-time=10ms",
+		"[test]\nquery-log-file=query.log\nthink-time=10ms",
+		"[test]\nquery=select 1\nthink-time=10ms±20ms",
+		"[test]\nquery=select 1\nresults-flush-rows=10",
+		"[test]\nquery=select 1\nquery-results-file=/dev/null\nresults-flush-rows=0",
+		"[test]\nquery=insert into t values (1)\nwarn-empty-results=true",
+		"[test]\nquery=select 1\niteration-query=select 2\niteration-query=select 3",
+		"[test]\niteration-query=select 2",
+		"[test]\niteration-query=select ?\niteration-query=select 3\nquery-args=1",
+		"error=sqlstate:4000\n[test]\nquery=select 1",
+		"tolerated-error=sqlstate:4000a\n[test]\nquery=select 1",
+		"[test]\nquery=select 1\ntimeout=0s",
+		"[test]\nquery=select 1\ntimeout=-1s",
+		"[test]\nquery=select 1\ntimeout=10",
+		"[teardown]\neach-iteration-query=truncate table t\n[test]\nquery=select 1",
+		"[between-iterations]\neach-iteration-query=truncate table t\n[test]\nquery=select 1",
+		"[test]\nquery=select ?\nquery-args=1\nshards=4",
+		"[test]\nquery=select ?\nquery-args=1\nshard-key-column=0",
+		"[test]\nquery=select 1\nshard-key-column=0\nshards=4",
+		"[test]\nquery=select ?\nquery-args=1\nshard-key-column=0\nshards=0",
+		"[test]\nquery=select ?\nquery-args=1\nshard-key-column=1\nshards=4",
+		"[test]\nquery=select ?\nquery-args=1\nshard-key-column=id\nshards=4",
+		"[test]\nquery=select :a\nquery-args=a\nquery-args=1\nquery-args-header=true\nshard-key-column=b\nshards=4",
+		"[test]\nquery=select 1\nprobe=other",
+		"[test]\nquery=select 1\nprobe-max-p99=10ms",
+		"[test]\nquery=select 1\nprobe=missing\nprobe-max-p99=10ms",
+		"[test]\nquery=select 1\nprobe=test\nprobe-max-p99=10ms",
+		"[p]\nquery=select 1\n[test]\nquery=select 1\nprobe=p\nprobe-max-p99=10ms",
+		"[p]\nquery=select 1\ncount=1\nprobe=test\nprobe-max-p99=1s\n[test]\nquery=select 1\nprobe=p\nprobe-max-p99=10ms",
+		"[p]\nquery=select 1\ncount=1\n[test]\nquery=select 1\nprobe=p\nprobe-max-p99=0s",
+		"[test]\nquery=select 1\ndepends-on=missing",
+		"[test]\nquery=select 1\ncount=1\ndepends-on=test",
+		"[a]\nquery=select 1\n[test]\nquery=select 1\ndepends-on=a",
+		"[a]\nquery=select 1\ncount=1\n[test]\nquery=select 1\ndepends-on=a,",
+		"[a]\nquery=select 1\ncount=1\ndepends-on=b\n[b]\nquery=select 1\ncount=1\ndepends-on=c\n[c]\nquery=select 1\ncount=1\ndepends-on=a",
+		"retry-budget=0.1\n[test]\nquery=select 1",
+		"retry-budget=0\n[test]\nquery=select 1\nretries=1",
+		"[test]\nquery=select 1\nretries=-1",
+		"[test]\nquery=select 1\nrate=-NCPU",
+		"[test]\nquery=select 1\nrate=NCPUS",
+		"[test]\nquery=select 1\nrate=$DBBENCH_TEST_UNSET",
+		"[test]\nquery=select 1\nrate=NCPU / 0",
+		"[test]\nquery=select 1\nrate=NCPU > 1",
+		"[test]\nquery=select 1\nrate=10 *",
+		"[test]\nquery=select 1\nconnect-only=true",
+		"[test]\nconnect-only=true\nquery-args=1",
+		"[test]\nconnect-only=false",
+		"[test]\nconnect-only=true\nconnection-per-query=true",
+		"[test]\nquery=select 1\nconnection-per-query=true\nserver-exec-time=true",
+		"[test]\nquery=select 1\nresults-max-rows=10",
+		"results-max-rows=0\n[test]\nquery=select 1",
+		"[test]\nquery=select 1\nphase=0s- 1 1",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=multi-connection\nquery-weights=1",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=multi-connection\nquery-weights=0,0",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=multi-connection\nquery-weights=1,x",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=multi-connection\nquery-weights=1,1\nphase=0s- 1 1",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=multi-connection\nquery-weights=1,1\nshuffle-queries=true",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=transaction\nshuffle-queries=true",
+		"[test]\nquery=select 1\nquery=select 2\nmulti-query-mode=transaction\nconnection-per-query=true",
+		"[test]\nquery=select 1\nmulti-query-mode=transaction\nserver-exec-time=true",
+		"[test]\nquery=select 1\nmulti-query-mode=transaction\nquery-weights=1",
+		"[test]\nquery=select 1\nmulti-query-mode=transactions",
+		"[test]\nquery-log-file=examples/query.log\nprepared=true",
+		"[test]\nquery=select 1\nprepared=true\nconnection-per-query=true",
+		"[test]\nquery=select 1\nprepared=true\nserver-exec-time=true",
+		"[test]\nconnect-only=true\nprepared=true",
+		"[test]\nquery=select 1\nprepared=yes",
+		"[test]\nquery=select 1\nquery-timeout=0s",
+		"[test]\nquery=select 1\nquery-timeout=1",
+		"[test]\nquery=select 1\nquery-timeout=1s\nprepared=true",
+		"[test]\nquery=select 1\nquery-timeout=1s\nserver-exec-time=true",
+		"[test]\nconnect-only=true\nquery-timeout=1s",
+		"[test]\nquery=select {{randInt 1}}\nquery-template=true",
+		"[test]\nquery=select {{randInt 10 1}}\nquery-template=true",
+		"[test]\nquery=select {{rand}}\nquery-template=true",
+		"[test]\nquery=select {{uuid\nquery-template=true",
+		"[test]\nquery=select {{uuid}}\nquery-template=true\nprepared=true",
+		"[test]\nquery-log-file=examples/query.log\nquery-template=true",
+		"[test]\nquery=select {{zipf 1 100 1}}\nquery-template=true",
+		"[test]\nquery=select {{zipf 100 1 1.1}}\nquery-template=true",
+		"[test]\nquery=select 1\nseed=0",
+		"[test]\nquery=select 1\nseed=x",
+		"[test]\nquery=select 1\nstart=1m\nphase=0s- 1",
+		"[test]\nquery=select 1\nphase=0s-1m 1\nphase=2m- 1",
+		"[test]\nquery=select 1\nphase=0s-1m 1",
+		"[test]\nquery=select 1\nstop=1m\nphase=0s-2m 1",
+		"[test]\nquery=select 1\nlatency-log-sampling=0.5",
+		"[test]\nquery=select 1\nlatency-log-file=/dev/null\nlatency-log-sampling=0",
+		"[test]\nquery=select 1\nexplain-analyze=true\nverify-idempotent=true",
+		"[test]\nquery=select 1\nquery-results-file=/dev/null\nnull-marker=a,b",
+		"[test]\nquery=select 1\nquery-results-file=/dev/null\nnull-marker=\"\"",
+		"max-total-concurrency=many\n[test]\nquery=select 1",
+		"[seed]\ncolumn=a int\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t\ncolumn=a int\n[test]\nquery=select 1",
+		"[seed]\ntable=t\ncolumn=a blob\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t\ncolumn=a int(3)\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t\ncolumn=a\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t; drop table u\ncolumn=a int\nrows=1\n[test]\nquery=select 1",
+		"[seed]\ntable=t\ncolumn=a int\nrows=0\n[test]\nquery=select 1",
+		"[test]\nquery=select 1\nrate=10\nmin-utilization=80",
+		"[test]\nquery=select 1\nmin-utilization=0",
+		"[test]\nquery=select 1\nmin-utilization=101%",
+		"[test]\nquery=select 1\nrate=1\ninterval=1s",
+		"[test]\nquery=select 1\ninterval=0s",
+		"[test]\nquery=select 1\ninterval=-1s",
+		"[test]\nquery=select 1\ninterval=1s\nqueue-depth=1",
+		"[test]\nquery=insert into t values (1)\nverify-idempotent=true",
+		"[test]\nquery-log-file=examples/query.log\nverify-idempotent=true",
+		"[test]\nquery=insert into t values (1)\nmax-write-bytes=0",
+		"[test]\nquery=select 1\nrate=10\nwarmup-rate=100\nwarmup-duration=1s",
+		"[test]\nquery=select 1\nwarmup-rate=1\nwarmup-duration=1s",
+		"[test]\nquery=select 1\nrate=10\nwarmup-rate=1\nwarmup-duration=10s\nstop=5s",
+		"[test]\nquery=select :a, :b\nquery-args=a,c\nquery-args=1,2\nquery-args-header=true",
 	}
 
-	df := supportedDatabaseFlavors["mysql"]
+	df := testFlavor(t, "mysql")
 	for _, c := range goodCases {
 		cp := goini.NewRawConfigParser()
 		cp.Parse(strings.NewReader(c.in))
@@ -239,7 +978,7 @@ func TestParseIniConfig(t *testing.T) {
 			continue
 		}
 
-		config, err := parseIniConfig(df, iniConfig, ".")
+		config, err := parseIniConfig(df, iniConfig, nil, ".")
 		if err != nil {
 			t.Errorf("Error parsing ini config %s: %v", strconv.Quote(c.in), err)
 			continue
@@ -260,9 +999,212 @@ func TestParseIniConfig(t *testing.T) {
 			continue
 		}
 
-		_, err = parseIniConfig(df, iniConfig, ".")
+		_, err = parseIniConfig(df, iniConfig, nil, ".")
 		if err == nil {
 			t.Errorf("Unexpected succesful parse of iniConfig for %s", strconv.Quote(c))
 		}
 	}
 }
+
+func TestInlineQueryArgs(t *testing.T) {
+	cp := goini.NewRawConfigParser()
+	cp.Parse(strings.NewReader("[test]\nquery=select ?, ?\nquery-args=1|a\nquery-args=2|b\nquery-args-delim=\"|\""))
+	iniConfig, err := cp.Finish()
+	if err != nil {
+		t.Fatalf("Error parsing config: %v", err)
+	}
+	config, err := parseIniConfig(testFlavor(t, "mysql"), iniConfig, nil, ".")
+	if err != nil {
+		t.Fatalf("Error parsing ini config: %v", err)
+	}
+
+	rows, err := config.Jobs["test"].QueryArgs.ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading query args: %v", err)
+	}
+	if expected := [][]string{{"1", "a"}, {"2", "b"}}; !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Expected query args %v but got %v", expected, rows)
+	}
+}
+
+func TestQueryArgsHeader(t *testing.T) {
+	cp := goini.NewRawConfigParser()
+	cp.Parse(strings.NewReader("[test]\nquery=select :b, :a, :b\nquery-args=a,b\nquery-args=1,2\nquery-args-header=true"))
+	iniConfig, err := cp.Finish()
+	if err != nil {
+		t.Fatalf("Error parsing config: %v", err)
+	}
+	config, err := parseIniConfig(testFlavor(t, "postgres"), iniConfig, nil, ".")
+	if err != nil {
+		t.Fatalf("Error parsing ini config: %v", err)
+	}
+
+	job := config.Jobs["test"]
+	if expected := []string{"select $1, $2, $3"}; !reflect.DeepEqual(job.Queries, expected) {
+		t.Errorf("Expected queries %v but got %v", expected, job.Queries)
+	}
+	args, err := job.getNextQueryArgs(0)
+	if err != nil {
+		t.Fatalf("Error reading query args: %v", err)
+	}
+	if expected := []interface{}{"2", "1", "2"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected query args %v but got %v", expected, args)
+	}
+}
+
+func TestShardKeyColumn(t *testing.T) {
+	for _, c := range []struct {
+		config string
+		column int
+	}{
+		{"[test]\nquery=select ?, ?\nquery-args=1,a\nshard-key-column=1\nshards=4", 1},
+		{"[test]\nquery=select :a, :b\nquery-args=b,a\nquery-args=1,2\nquery-args-header=true\nshard-key-column=a\nshards=4", 1},
+	} {
+		cp := goini.NewRawConfigParser()
+		cp.Parse(strings.NewReader(c.config))
+		iniConfig, err := cp.Finish()
+		if err != nil {
+			t.Fatalf("Error parsing config: %v", err)
+		}
+		config, err := parseIniConfig(testFlavor(t, "mysql"), iniConfig, nil, ".")
+		if err != nil {
+			t.Fatalf("Error parsing ini config %s: %v", strconv.Quote(c.config), err)
+		}
+		if job := config.Jobs["test"]; job.ShardKeyColumn != c.column || job.Shards != 4 {
+			t.Errorf("Expected shard key column %d of 4 shards for %s but got %d of %d",
+				c.column, strconv.Quote(c.config), job.ShardKeyColumn, job.Shards)
+		}
+	}
+}
+
+func TestReadQueriesFromURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/queries.sql" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "select 1; select 2")
+	}))
+	defer server.Close()
+
+	df := testFlavor(t, "mysql")
+	qs, err := readQueriesFromFile(df, server.URL+"/queries.sql")
+	if err != nil {
+		t.Fatalf("Error reading queries from URL: %v", err)
+	}
+	if expected := []string{"select 1", " select 2"}; !reflect.DeepEqual(qs, expected) {
+		t.Errorf("Expected queries %v but got %v", quotedValue(expected), quotedValue(qs))
+	}
+
+	if _, err := readQueriesFromFile(df, server.URL+"/missing.sql"); err == nil {
+		t.Errorf("Unexpected success reading queries from a missing URL")
+	}
+
+	if path := resolveQueryFilePath("base", server.URL+"/queries.sql"); path != server.URL+"/queries.sql" {
+		t.Errorf("Unexpected path %s for URL", path)
+	}
+	if path := resolveQueryFilePath("base", "queries.sql"); path != filepath.Join("base", "queries.sql") {
+		t.Errorf("Unexpected path %s for relative file", path)
+	}
+}
+
+func TestThinkTimeFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+	if err := ioutil.WriteFile(good, []byte("# ms\n10ms\n\n1s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(bad, []byte("10ms\nsoon\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(ini string) (*Config, error) {
+		cp := goini.NewRawConfigParser()
+		cp.Parse(strings.NewReader(ini))
+		iniConfig, err := cp.Finish()
+		if err != nil {
+			t.Fatalf("Error parsing config: %v", err)
+		}
+		return parseIniConfig(testFlavor(t, "mysql"), iniConfig, nil, dir)
+	}
+
+	config, err := parse("[test]\nquery=select 1\nconcurrency=2\nthink-time-file=good.txt")
+	if err != nil {
+		t.Fatalf("Error parsing ini config: %v", err)
+	}
+	expected := []time.Duration{10 * time.Millisecond, time.Second}
+	if tt := config.Jobs["test"].ThinkTimes; !reflect.DeepEqual(tt, expected) {
+		t.Errorf("Expected think times %v but got %v", expected, tt)
+	}
+
+	for _, ini := range []string{
+		"[test]\nquery=select 1\nthink-time-file=bad.txt",
+		"[test]\nquery=select 1\nthink-time-file=missing.txt",
+		"[test]\nquery=select 1\nrate=10\nthink-time-file=good.txt",
+	} {
+		if _, err := parse(ini); err == nil {
+			t.Errorf("Expected error parsing %q", ini)
+		}
+	}
+}
+
+func TestThinkTime(t *testing.T) {
+	for _, c := range []struct {
+		in           string
+		base, jitter time.Duration
+	}{
+		{"100ms", 100 * time.Millisecond, 0},
+		{"100ms±50ms", 100 * time.Millisecond, 50 * time.Millisecond},
+		{"1s +- 1s", time.Second, time.Second},
+	} {
+		base, jitter, err := parseThinkTime(c.in)
+		if err != nil || base != c.base || jitter != c.jitter {
+			t.Errorf("Expected %q to be %v±%v but got %v±%v (%v)", c.in, c.base, c.jitter, base, jitter, err)
+		}
+	}
+	for _, bad := range []string{"soon", "0s", "10ms±", "10ms±20ms", "-1s"} {
+		if _, _, err := parseThinkTime(bad); err == nil {
+			t.Errorf("Expected error parsing think-time %q", bad)
+		}
+	}
+
+	job := &Job{ThinkTime: 100 * time.Millisecond, ThinkTimeJitter: 50 * time.Millisecond,
+		Rand: newJobRand("test")}
+	for i := 0; i < 100; i++ {
+		if tt := job.nextThinkTime(); tt < 50*time.Millisecond || tt > 150*time.Millisecond {
+			t.Fatalf("Expected a think time within 100ms±50ms but got %v", tt)
+		}
+	}
+}
+
+func TestConfigErrorLocation(t *testing.T) {
+	var cases = []struct {
+		config   string
+		location string
+	}{
+		{"[a]\nquery=select 1\n\n[b]\nquery=select 1\nrate=abc", `job "b" (line 6: rate=abc)`},
+		{"[a]\nquery=select 1\nrate=1\nrate=2", `job "a" (line 4: rate=2)`},
+		{"[a]\nquery=select \\\n  1\nfoo=bar", `job "a" (line 4: foo=bar)`},
+		{"# comment\n[a]\nrate=1", `job "a" (line 2)`},
+		{"duration=soon\n[a]\nquery=select 1", `global section (line 1: duration=soon)`},
+		{"[setup]\nquery=select 1\nquery=use db\n[a]\nquery=select 1", `setup section (line 3: query=use db)`},
+		{"[a]\nquery=select 1\n[b]\nquery=select 2\n[a]\nquery=select 3", `Duplicate section name "a" on line 5`},
+		{"[a]\nquery=select 1\n[a ]\nquery=select 2", `Duplicate job "a " (line 3): already defined as "a" (line 1)`},
+		{"[ setup]\nquery=select 1", `Invalid job name " setup" (line 1)`},
+	}
+
+	dir := t.TempDir()
+	for i, c := range cases {
+		configFile := filepath.Join(dir, strconv.Itoa(i)+".ini")
+		if err := ioutil.WriteFile(configFile, []byte(c.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := parseConfig(testFlavor(t, "mysql"), configFile, dir)
+		if err == nil {
+			t.Errorf("Expected error parsing %q", c.config)
+		} else if !strings.Contains(err.Error(), c.location) {
+			t.Errorf("Expected error parsing %q to mention %s but got: %v", c.config, c.location, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/awreece/goini"
+)
+
+var watchConfig = flag.Bool("watch-config", false,
+	"Watch the config file while the test runs and apply changes to the "+
+		"rate (or interval) of running jobs. Other changes are ignored.")
+
+// How often the config file is checked for changes.
+const configWatchInterval = time.Second
+
+// The properties of a job that may be changed while it runs.
+var liveJobProperties = []string{"rate", "interval"}
+
+func parseRawConfig(configFile string) (*goini.RawConfig, error) {
+	config, _, err := readRawConfig(configFile)
+	return config, err
+}
+
+/*
+ * Returns a copy of the section without the properties that may be changed
+ * while a job runs.
+ */
+func structuralProperties(s goini.RawSection) goini.RawSection {
+	structural := make(goini.RawSection, len(s))
+	for property, values := range s {
+		structural[property] = values
+	}
+	for _, property := range liveJobProperties {
+		delete(structural, property)
+	}
+	return structural
+}
+
+/*
+ * The rate of a job given by its rate or interval, parsed as the config
+ * loader does (so a rate may be an expression such as "100 * NCPU").
+ */
+func liveRate(s goini.RawSection) (float64, error) {
+	rates, intervals := s.GetPropertyValues("rate"), s.GetPropertyValues("interval")
+	switch {
+	case len(rates) == 1 && len(intervals) == 0:
+		rate, err := parseNumberExpr(rates[0])
+		if err != nil {
+			return 0, err
+		} else if rate <= 0 {
+			return 0, errors.New("rate must be positive")
+		}
+		return rate, nil
+	case len(intervals) == 1 && len(rates) == 0:
+		interval, err := time.ParseDuration(intervals[0])
+		if err != nil {
+			return 0, err
+		} else if interval <= 0 {
+			return 0, errors.New("interval must be positive")
+		}
+		return 1 / interval.Seconds(), nil
+	}
+	return 0, errors.New("must have exactly one of rate or interval")
+}
+
+/*
+ * Returns the names of the jobs with a fixed rate, the only jobs whose rate
+ * can be changed while they run.
+ */
+func fixedRateJobs(config *Config) map[string]bool {
+	fixed := make(map[string]bool)
+	for name, job := range config.Jobs {
+		if job.Rate > 0 && job.AdaptiveRate == nil {
+			fixed[name] = true
+		}
+	}
+	return fixed
+}
+
+/*
+ * Compares two versions of a config, returning the new rate of each job
+ * whose rate changed and the reasons any other change was ignored. Only
+ * the fixed rate jobs (see fixedRateJobs) can change their rate.
+ */
+func configRateChanges(fixed map[string]bool, old, new *goini.RawConfig) (map[string]float64, []string) {
+	var ignored []string
+	if !reflect.DeepEqual(old.GlobalSection, new.GlobalSection) {
+		ignored = append(ignored, "the global section changed")
+	}
+	if !reflect.DeepEqual(old.Sections(), new.Sections()) {
+		ignored = append(ignored, "sections were added, removed or reordered")
+	}
+
+	changes := make(map[string]float64)
+	for _, name := range new.Sections() {
+		oldSection, newSection := old.Section(name), new.Section(name)
+		if oldSection == nil || reflect.DeepEqual(oldSection, newSection) {
+			continue
+		}
+		if !reflect.DeepEqual(structuralProperties(oldSection), structuralProperties(newSection)) {
+			ignored = append(ignored, fmt.Sprintf("[%s] changed more than its rate", name))
+			continue
+		}
+		if !fixed[name] {
+			ignored = append(ignored, fmt.Sprintf("[%s] is not a job with a fixed rate", name))
+			continue
+		}
+		rate, err := liveRate(newSection)
+		if err != nil {
+			ignored = append(ignored, fmt.Sprintf("[%s]: %v", name, err))
+			continue
+		}
+		changes[name] = rate
+	}
+	return changes, ignored
+}
+
+/*
+ * Watches the config file until the context is done, sending the new rate
+ * of a job to the job whenever it changes. The jobs must not be running yet.
+ */
+func watchConfigFile(ctx context.Context, configFile string, config *Config) error {
+	// We change to the base directory before running the jobs.
+	configFile, err := filepath.Abs(configFile)
+	if err != nil {
+		return err
+	}
+	last, err := parseRawConfig(configFile)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return err
+	}
+	modified := info.ModTime()
+
+	// The rates of running jobs are changed by their own goroutines, so
+	// decide which jobs may change their rate before they start.
+	fixed := fixedRateJobs(config)
+	for name := range fixed {
+		config.Jobs[name].RateChanges = make(chan float64, 1)
+	}
+
+	go func() {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(configFile)
+			if err != nil || !info.ModTime().After(modified) {
+				continue
+			}
+			modified = info.ModTime()
+
+			current, err := parseRawConfig(configFile)
+			if err != nil {
+				log.Printf("ignoring change to %s: %v", configFile, err)
+				continue
+			}
+			changes, ignored := configRateChanges(fixed, last, current)
+			for _, reason := range ignored {
+				log.Printf("ignoring change to %s: %s", configFile, reason)
+			}
+
+			names := make([]string, 0, len(changes))
+			for name := range changes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				log.Printf("%s: changing rate to %.3f", name, changes[name])
+				sendRateChange(config.Jobs[name].RateChanges, changes[name])
+			}
+			// Compare later changes to what we applied (or ignored).
+			last = current
+		}
+	}()
+	return nil
+}
+
+/*
+ * Sends the rate, replacing any rate the job has yet to apply.
+ */
+func sendRateChange(ch chan float64, rate float64) {
+	for {
+		select {
+		case ch <- rate:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
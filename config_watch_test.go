@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awreece/goini"
+)
+
+func TestConfigRateChanges(t *testing.T) {
+	parse := func(ini string) *goini.RawConfig {
+		cp := goini.NewRawConfigParser()
+		cp.Parse(strings.NewReader(ini))
+		rc, err := cp.Finish()
+		if err != nil {
+			t.Fatalf("Error parsing config: %v", err)
+		}
+		return rc
+	}
+
+	old := "duration=1m\n[a]\nquery=select 1\nrate=10\n[b]\nquery=select 2\nrate=1\n[c]\nquery=select 3\n"
+	config, err := parseIniConfig(testFlavor(t, "mysql"), parse(old), nil, ".")
+	if err != nil {
+		t.Fatalf("Error parsing ini config: %v", err)
+	}
+	fixed := fixedRateJobs(config)
+	// Whether a job may change its rate is decided when the config is
+	// loaded, not by the rate of the running job.
+	config.Jobs["a"].Rate = 0
+
+	os.Setenv("DBBENCH_TEST_RATE", "8")
+	defer os.Unsetenv("DBBENCH_TEST_RATE")
+	ncpu := float64(runtime.NumCPU())
+
+	var cases = []struct {
+		new      string
+		changes  map[string]float64
+		warnings int
+	}{
+		{old, map[string]float64{}, 0},
+		{"duration=1m\n[a]\nquery=select 1\nrate=20\n[b]\nquery=select 2\ninterval=2s\n[c]\nquery=select 3\n",
+			map[string]float64{"a": 20, "b": 0.5}, 0},
+		{"duration=1m\n[a]\nquery=select 9\nrate=20\n[b]\nquery=select 2\nrate=1\n[c]\nquery=select 3\n",
+			map[string]float64{}, 1},
+		{"duration=1m\n[a]\nquery=select 1\nrate=-1\n[b]\nquery=select 2\nrate=1\n[c]\nquery=select 3\nrate=1\n",
+			map[string]float64{}, 2},
+		{"duration=2m\n[a]\nquery=select 1\nrate=20\n[b]\nquery=select 2\nrate=1\n[c]\nquery=select 3\n",
+			map[string]float64{"a": 20}, 1},
+		{"duration=1m\n[a]\nquery=select 1\nrate=2 * NCPU\n[b]\nquery=select 2\nrate=$DBBENCH_TEST_RATE / 2\n[c]\nquery=select 3\n",
+			map[string]float64{"a": 2 * ncpu, "b": 4}, 0},
+		{"duration=1m\n[a]\nquery=select 1\nrate=2 * NCPUS\n[b]\nquery=select 2\nrate=1\n[c]\nquery=select 3\n",
+			map[string]float64{}, 1},
+	}
+	for _, c := range cases {
+		changes, ignored := configRateChanges(fixed, parse(old), parse(c.new))
+		if !reflect.DeepEqual(changes, c.changes) {
+			t.Errorf("Expected changes %v for %q but got %v", c.changes, c.new, changes)
+		}
+		if len(ignored) != c.warnings {
+			t.Errorf("Expected %d ignored changes for %q but got %v", c.warnings, c.new, ignored)
+		}
+	}
+}
+
+func TestRateChange(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", Rate: 0.1, BatchSize: 1, Count: 3,
+				Queries:     []string{"select 1"},
+				RateChanges: make(chan float64, 1),
+			},
+		},
+	}
+
+	// At a rate of 0.1, the job would take 30s.
+	sendRateChange(config.Jobs["counter"].RateChanges, 1000)
+	start := time.Now()
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the rate change to speed up the job, but it took %v", elapsed)
+	}
+	if n := stats.jobStats.Transactions.Count(); n != 3 {
+		t.Errorf("Expected 3 transactions but got %d", n)
+	}
+	if rate := config.Jobs["counter"].Rate; rate != 1000 {
+		t.Errorf("Expected the rate to be changed to 1000 but got %v", rate)
+	}
+}
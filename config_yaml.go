@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/awreece/goini"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * Whether the config file is YAML rather than INI, by its extension.
+ */
+func isYAMLFile(configFile string) bool {
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+/*
+ * Translates a YAML config into the sections of the INI config it stands
+ * for, so that it is decoded and validated the same way. The top level
+ * maps the options of the global section and the sections (as mappings);
+ * a list sets an option once per item, as repeating it in the INI file.
+ */
+func parseYAMLConfig(contents []byte) (*goini.RawConfig, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(contents, &doc); err != nil {
+		return nil, err
+	}
+
+	var global, sections bytes.Buffer
+	for _, item := range doc {
+		name := fmt.Sprint(item.Key)
+		switch value := item.Value.(type) {
+		case yaml.MapSlice:
+			if err := writeYAMLSection(&sections, name, value); err != nil {
+				return nil, err
+			}
+		case nil:
+			if err := writeYAMLSection(&sections, name, nil); err != nil {
+				return nil, err
+			}
+		default:
+			if err := writeYAMLOption(&global, name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cp := goini.NewRawConfigParser()
+	if err := cp.Parse(strings.NewReader(global.String() + sections.String())); err != nil {
+		return nil, err
+	}
+	return cp.Finish()
+}
+
+func writeYAMLSection(b *bytes.Buffer, name string, options yaml.MapSlice) error {
+	if name == "" || strings.ContainsAny(name, "[]\n") {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	fmt.Fprintf(b, "[%s]\n", name)
+	for _, item := range options {
+		if err := writeYAMLOption(b, fmt.Sprint(item.Key), item.Value); err != nil {
+			return fmt.Errorf("section %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func writeYAMLOption(b *bytes.Buffer, name string, value interface{}) error {
+	if name == "" || strings.ContainsAny(name, "=[\n") || strings.HasPrefix(name, ";") ||
+		strings.HasPrefix(name, "#") {
+		return fmt.Errorf("invalid option name %q", name)
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		s, err := yamlScalar(v)
+		if err != nil {
+			return fmt.Errorf("option %s: %v", name, err)
+		}
+		fmt.Fprintf(b, "%s=%s\n", name, s)
+	}
+	return nil
+}
+
+/*
+ * Formats a scalar as an INI value. The lines of multi-line strings (e.g.
+ * queries in block scalars) are joined with spaces, so they cannot have --
+ * comments but on their last line, as these would comment out the lines
+ * after them.
+ */
+func yamlScalar(v interface{}) (string, error) {
+	switch v.(type) {
+	case yaml.MapSlice, []interface{}:
+		return "", errors.New("expected a value or a list of values")
+	case nil:
+		return "", nil
+	}
+	var lines []string
+	for _, line := range strings.Split(fmt.Sprint(v), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for i := 0; i+1 < len(lines); i++ {
+		if strings.Contains(lines[i], "--") {
+			return "", fmt.Errorf("line %d has a -- comment, which would comment out "+
+				"the lines after it once they are joined (use /* */ instead)", i+1)
+		}
+	}
+	s := strings.Join(lines, " ")
+	if strings.HasSuffix(s, "\\") {
+		return "", errors.New("a value cannot end with a backslash")
+	}
+	return s, nil
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestYAMLConfigMatchesINI(t *testing.T) {
+	df := testFlavor(t, "mysql")
+	fromINI, err := parseConfig(df, "examples/locks.ini", "examples/")
+	if err != nil {
+		t.Fatalf("Error parsing INI config: %v", err)
+	}
+	fromYAML, err := parseConfig(df, "examples/locks.yaml", "examples/")
+	if err != nil {
+		t.Fatalf("Error parsing YAML config: %v", err)
+	}
+	if !reflect.DeepEqual(fromINI, fromYAML) {
+		t.Errorf("Expected the YAML config to match the INI config\n%+v\nbut got\n%+v", fromINI, fromYAML)
+	}
+}
+
+func TestParseYAMLConfig(t *testing.T) {
+	ini, err := parseYAMLConfig([]byte("duration: 10s\n" +
+		"test:\n  query: |\n    select 1\n    from  t\n  concurrency: 2\n" +
+		"empty:\n"))
+	if err != nil {
+		t.Fatalf("Error parsing YAML: %v", err)
+	}
+	if d := ini.GlobalSection["duration"]; !reflect.DeepEqual(d, []string{"10s"}) {
+		t.Errorf("Expected duration=10s but got %v", d)
+	}
+	if expected := []string{"test", "empty"}; !reflect.DeepEqual(ini.Sections(), expected) {
+		t.Errorf("Expected sections %v but got %v", expected, ini.Sections())
+	}
+	test := ini.Section("test")
+	if q := test["query"]; !reflect.DeepEqual(q, []string{"select 1 from  t"}) {
+		t.Errorf("Expected the lines of the query joined but got %q", q)
+	}
+
+	// A comment on the last line does not comment out any other line.
+	ini, err = parseYAMLConfig([]byte("test:\n  query: |\n    select 1\n    from t -- all rows\n"))
+	if err != nil {
+		t.Fatalf("Error parsing YAML: %v", err)
+	}
+	if q := ini.Section("test")["query"]; !reflect.DeepEqual(q, []string{"select 1 from t -- all rows"}) {
+		t.Errorf("Expected the comment to be kept but got %q", q)
+	}
+	if c := test["concurrency"]; !reflect.DeepEqual(c, []string{"2"}) {
+		t.Errorf("Expected concurrency=2 but got %v", c)
+	}
+
+	for _, bad := range []string{
+		"test: [1, 2",
+		"test:\n  query:\n    nested: 1\n",
+		"test:\n  query: select \\\n",
+		"test:\n  query: |\n    select 1 -- one\n    from t\n",
+		"test:\n  a=b: 1\n",
+	} {
+		if _, err := parseYAMLConfig([]byte(bad)); err == nil {
+			t.Errorf("Expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestIsYAMLFile(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"a.yaml": true, "a.YML": true, "a.ini": false, "yaml": false,
+	} {
+		if isYAMLFile(name) != expected {
+			t.Errorf("Expected isYAMLFile(%q) to be %v", name, expected)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var connectionInitFile = flag.String("connection-init-file", "",
+	"Run the statements of this file (separated as in query files) on "+
+		"every new connection to the database, e.g. to set session "+
+		"variables.")
+
+/*
+ * Reads the statements of the connection-init-file, if any, checking that
+ * each is a single statement that only affects the session.
+ */
+func readConnectionInitFile(df DatabaseFlavor, path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	statements, err := readQueriesFromFile(df, path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+	for _, statement := range statements {
+		if !isSessionStatement(statement) {
+			return nil, fmt.Errorf("%s: %s does not only affect the session",
+				path, strconv.Quote(strings.TrimSpace(statement)))
+		}
+	}
+	return statements, nil
+}
+
+/*
+ * Whether the statement can be run on every connection, i.e. it does not
+ * change the data or the schema of the database.
+ */
+func isSessionStatement(q string) bool {
+	if isWriteQuery(q) {
+		return false
+	}
+	switch strings.ToLower(strings.Fields(q)[0]) {
+	case "delete", "create", "drop", "alter", "truncate", "rename", "grant", "revoke":
+		return false
+	}
+	return true
+}
+
+/*
+ * Returns a connector that opens new connections to the database, which run
+ * the init statements (if any) when they are opened, before being used by
+ * any query.
+ */
+func openSQLConnector(driverName, dsn string, init []string) (driver.Connector, error) {
+	// The driver is only registered by name; get it from a database that
+	// is never connected.
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var connector driver.Connector
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	} else {
+		connector = &dsnConnector{d, dsn}
+	}
+	if len(init) == 0 {
+		return connector, nil
+	}
+	return &initConnector{connector, init}, nil
+}
+
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (dc *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return dc.driver.Open(dc.dsn)
+}
+
+func (dc *dsnConnector) Driver() driver.Driver {
+	return dc.driver
+}
+
+type initConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (ic *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := ic.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range ic.statements {
+		if err := execOnConn(ctx, conn, statement); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("connection init statement %s: %v",
+				strconv.Quote(statement), err)
+		}
+	}
+	return conn, nil
+}
+
+func execOnConn(ctx context.Context, conn driver.Conn, q string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		if _, err := execer.ExecContext(ctx, q, nil); err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(q)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
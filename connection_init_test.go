@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+/*
+ * A fake driver whose connections record the statements they execute.
+ */
+type recordingDriver struct {
+	mu       sync.Mutex
+	executed []string
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d}, nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, q string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.executed = append(c.d.executed, q)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+var testRecordingDriver = &recordingDriver{}
+
+func init() {
+	sql.Register("dbbench-recording", testRecordingDriver)
+}
+
+func TestConnectionInit(t *testing.T) {
+	statements := []string{"set a = 1", "set b = 2"}
+	connector, err := openSQLConnector("dbbench-recording", "", statements)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// Hold two connections at once, so that the pool opens two.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer conn.Close()
+	}
+
+	expected := append(append([]string{}, statements...), statements...)
+	if !reflect.DeepEqual(testRecordingDriver.executed, expected) {
+		t.Errorf("Expected %q to be run on each connection but got %q",
+			statements, testRecordingDriver.executed)
+	}
+}
+
+func TestReadConnectionInitFile(t *testing.T) {
+	df := testFlavor(t, "mysql")
+	write := func(contents string) string {
+		path := filepath.Join(t.TempDir(), "init.sql")
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return path
+	}
+
+	if statements, err := readConnectionInitFile(df, ""); err != nil || statements != nil {
+		t.Errorf("Expected no statements without a file but got %q, %v", statements, err)
+	}
+
+	statements, err := readConnectionInitFile(df, write("set names utf8mb4;\nset session sql_mode = 'ANSI';\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if len(statements) != 2 {
+		t.Errorf("Expected 2 statements but got %q", statements)
+	}
+
+	for _, contents := range []string{
+		"set a = 1;\ninsert into t values (1)",
+		"drop table t",
+		"use db",
+	} {
+		if _, err := readConnectionInitFile(df, write(contents)); err == nil {
+			t.Errorf("Unexpected success reading %q", contents)
+		}
+	}
+}
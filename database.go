@@ -17,10 +17,14 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 /*
@@ -52,6 +56,19 @@ type DatabaseFlavor interface {
 	 */
 	QuerySeparator() string
 
+	/*
+	 * A trivial query used to check that the database is reachable
+	 * (e.g. "select 1").
+	 */
+	ProbeQuery() string
+
+	/*
+	 * Rewrites the named placeholders (e.g. ":id") in the query into the
+	 * placeholders of this flavor of database, returning the rewritten
+	 * query and the names of the placeholders in the order they appear.
+	 */
+	BindNamed(query string) (string, []string)
+
 	/*
 	 * The extracted error code (string) from the error (error) thrown by the database driver. This is needed to let
 	 * dbbench handle arbitrary errors from any given database flavor.
@@ -61,6 +78,12 @@ type DatabaseFlavor interface {
 
 var EmptyQueryError = errors.New("empty query found")
 
+/*
+ * Called with the values of a row returned by a query; an invalid value is
+ * a NULL. Returning an error aborts the query.
+ */
+type RowHandler func(values []sql.NullString) error
+
 /*
  * The user specified parameters for connecting to a database. If any
  * field is zero, no user preference was provided.
@@ -72,6 +95,55 @@ type ConnectionConfig struct {
 	Port     int
 	Database string
 	Params   string
+	// How the connection uses TLS (see -tls-mode); empty for the default
+	// of the driver.
+	TLSMode string
+	// PEM files with the CA certificates that verify the server, and the
+	// client certificate and key to authenticate with.
+	TLSCACert     string
+	TLSClientCert string
+	TLSClientKey  string
+	// Run on every new connection (see -connection-init-file).
+	InitStatements []string
+}
+
+// Replaces the password when printing a connection config.
+const redactedPassword = "****"
+
+/*
+ * Returns a copy of the connection config that is safe to print, with the
+ * password (if any) redacted.
+ */
+func (cc ConnectionConfig) Redacted() ConnectionConfig {
+	if cc.Password != "" {
+		cc.Password = redactedPassword
+	}
+	return cc
+}
+
+func (cc ConnectionConfig) String() string {
+	r := cc.Redacted()
+	return fmt.Sprintf("{Username:%s Password:%s Host:%s Port:%d Database:%s Params:%s}",
+		r.Username, r.Password, r.Host, r.Port, r.Database, r.Params)
+}
+
+/*
+ * Returns the error with any occurrence of the password (as is, or escaped
+ * as in a URL) in its message redacted. Drivers may echo the data source
+ * name, including the password, in their errors.
+ */
+func (cc ConnectionConfig) RedactError(err error) error {
+	if err == nil || cc.Password == "" {
+		return err
+	}
+	msg := err.Error()
+	for _, password := range []string{cc.Password, url.QueryEscape(cc.Password), url.PathEscape(cc.Password)} {
+		msg = strings.ReplaceAll(msg, password, redactedPassword)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return errors.New(msg)
 }
 
 /*
@@ -120,6 +192,18 @@ type Database interface {
 	 */
 	RunQuery(results *SafeCSVWriter, query string, args []interface{}) (int64, error)
 
+	/*
+	 * Runs the query like RunQuery, additionally calling onRow (if not
+	 * nil) with the values of each row returned by the query. The values
+	 * are only valid for the duration of the call.
+	 */
+	RunQueryRows(results *SafeCSVWriter, query string, args []interface{}, onRow RowHandler) (int64, error)
+
+	/*
+	 * Returns a human readable description of the server version.
+	 */
+	ServerVersion() (string, error)
+
 	/*
 	 * Close the database, reclaiming any resources.
 	 *
@@ -128,10 +212,173 @@ type Database interface {
 	Close()
 }
 
-// TODO: implement error parsing for mssql and vertica
-var supportedDatabaseFlavors = map[string]DatabaseFlavor{
-	"mysql":    &sqlDatabaseFlavor{"mysql", mySQLDataSourceName, checkSQLQuery, mySQLErrorCodeParser},
-	"mssql":    &sqlDatabaseFlavor{"mssql", sqlServerDataSourceName, checkSQLQuery, unimplementedErrorCodeParser},
-	"postgres": &sqlDatabaseFlavor{"postgres", postgresDataSourceName, checkSQLQuery, postgresErrorCodeParser},
-	"vertica":  &sqlDatabaseFlavor{"vertica", verticaDataSourceName, checkSQLQuery, unimplementedErrorCodeParser},
+/*
+ * A database that can open a new connection on its own, to time the
+ * establishment of connections.
+ */
+type ConnectionCycler interface {
+	/*
+	 * Opens a new connection (that is not reused), checks that it is
+	 * alive and closes it.
+	 */
+	CycleConnection() error
+}
+
+/*
+ * A database that can open a connection of its own, outside of the pool
+ * used by the other queries.
+ */
+type ConnectionOpener interface {
+	/*
+	 * Opens a new connection, that is not reused once closed.
+	 */
+	OpenConnection() (Connection, error)
+}
+
+/*
+ * A single connection to a database.
+ */
+type Connection interface {
+	/*
+	 * Runs the query on the connection, as Database.RunQueryRows does.
+	 */
+	RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error)
+
+	/*
+	 * Closes the connection.
+	 */
+	Close()
+}
+
+/*
+ * A database that can run several queries in a transaction, on a single
+ * connection taken from its pool.
+ */
+type TransactionBeginner interface {
+	/*
+	 * Takes a connection from the pool and begins a transaction on it,
+	 * with the syntax of the driver.
+	 */
+	BeginTransaction() (Transaction, error)
+}
+
+/*
+ * A transaction on a single connection, which is returned to the pool once
+ * the transaction is committed or rolled back.
+ */
+type Transaction interface {
+	/*
+	 * Runs the query in the transaction, as Database.RunQueryRows does.
+	 */
+	RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error)
+
+	Commit() error
+	Rollback() error
+}
+
+/*
+ * A database, or a connection or transaction of one, that can abandon a
+ * query once its context is done.
+ */
+type ContextQueryRunner interface {
+	RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error)
+}
+
+/*
+ * A database that can prepare a query once and execute it with different
+ * args.
+ */
+type StatementPreparer interface {
+	Prepare(q string) (PreparedStatement, error)
+}
+
+/*
+ * A prepared query, which the database prepares again on each connection of
+ * its pool that it is executed on.
+ */
+type PreparedStatement interface {
+	/*
+	 * Executes the statement, as Database.RunQueryRows does the query.
+	 */
+	RunQueryRows(w *SafeCSVWriter, args []interface{}, onRow RowHandler) (int64, error)
+
+	Close()
+}
+
+/*
+ * A database with a pool of connections that can be opened ahead of time.
+ */
+type ConnectionPrewarmer interface {
+	/*
+	 * Takes a connection from the pool (opening one if none is idle) and
+	 * runs the query on it. The connection is held until release is
+	 * called, so that concurrent calls warm different connections.
+	 */
+	WarmConnection(query string) (release func(), err error)
+}
+
+/*
+ * A flavor of database that can run a query under EXPLAIN ANALYZE, returning
+ * its plan annotated with the actual time spent in each step.
+ */
+type ExplainAnalyzeFlavor interface {
+	/*
+	 * Returns the query wrapped in the EXPLAIN ANALYZE syntax of the
+	 * flavor, or false if the flavor does not support it.
+	 */
+	ExplainAnalyze(query string) (string, bool)
+}
+
+/*
+ * A database that can report how long the server spent executing a query,
+ * excluding the network round trip and any queueing in the client.
+ */
+type ServerTimedDatabase interface {
+	/*
+	 * Runs the query like RunQueryRows, additionally returning the latency
+	 * of the query as measured by the client and by the server. If the
+	 * query succeeded but the server time is not available, returns a
+	 * *ServerExecTimeError.
+	 */
+	RunQueryServerTime(results *SafeCSVWriter, query string, args []interface{}, onRow RowHandler) (int64, time.Duration, time.Duration, error)
+}
+
+var errServerExecTimeUnsupported = errors.New("server execution time is not supported")
+
+/*
+ * The query succeeded, but its server execution time is not available.
+ */
+type ServerExecTimeError struct {
+	Err error
+}
+
+func (e *ServerExecTimeError) Error() string {
+	return fmt.Sprintf("reading server execution time: %v", e.Err)
+}
+
+/*
+ * The flavors compiled into this binary, registered by the init function of
+ * the file of each driver. Each driver is behind a build tag of the same
+ * name (e.g. "go build -tags mysql,postgres"), and all of them are included
+ * if no driver tag is given.
+ */
+var supportedDatabaseFlavors = map[string]DatabaseFlavor{}
+
+// All the flavors dbbench knows about, whether compiled in or not.
+var knownDatabaseFlavors = []string{"mssql", "mysql", "postgres", "vertica"}
+
+func registerDatabaseFlavor(sq *sqlDatabaseFlavor) {
+	supportedDatabaseFlavors[sq.name] = sq
+}
+
+func lookupDatabaseFlavor(name string) (DatabaseFlavor, error) {
+	if df, ok := supportedDatabaseFlavors[name]; ok {
+		return df, nil
+	}
+	for _, known := range knownDatabaseFlavors {
+		if known == name {
+			return nil, fmt.Errorf("Database flavor %s was not compiled in (build with -tags %s)", name, name)
+		}
+	}
+	return nil, fmt.Errorf("Database flavor %s not supported", name)
 }
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestConnectionConfigRedacted(t *testing.T) {
+	const password = "s3cr:t/pa ss"
+	cc := ConnectionConfig{
+		Username: "root", Password: password,
+		Host: "localhost", Port: 3306, Database: "db",
+	}
+	redacted := cc.Redacted()
+
+	outputs := []string{
+		fmt.Sprint(cc),
+		fmt.Sprintf("%v %+v %s", cc, &cc, cc),
+		mySQLDataSourceName(&redacted),
+		postgresDataSourceName(&redacted),
+		sqlServerDataSourceName(&redacted),
+		verticaDataSourceName(&redacted),
+		cc.RedactError(errors.New("cannot connect to " + postgresDataSourceName(&cc))).Error(),
+		cc.RedactError(fmt.Errorf("bad password %q", password)).Error(),
+	}
+	for _, output := range outputs {
+		if strings.Contains(output, password) || strings.Contains(output, "s3cr") {
+			t.Errorf("Password not redacted from %s", output)
+		}
+	}
+
+	if cc.Password != password {
+		t.Errorf("Redacting modified the connection config")
+	}
+	if err := (ConnectionConfig{}).RedactError(errors.New("s3cr")); err.Error() != "s3cr" {
+		t.Errorf("Unexpected redaction without a password: %v", err)
+	}
+}
+
+/*
+ * Returns the flavor, skipping the test if its driver was not compiled in
+ * (see supportedDatabaseFlavors).
+ */
+func testFlavor(t *testing.T, name string) DatabaseFlavor {
+	t.Helper()
+	df, ok := supportedDatabaseFlavors[name]
+	if !ok {
+		t.Skipf("Database flavor %s was not compiled in", name)
+	}
+	return df
+}
@@ -0,0 +1,1223 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+ * A fake database that returns a single row with an increasing counter for
+ * every query.
+ */
+type counterDb struct {
+	counter int64
+	delay   time.Duration
+}
+
+func (c *counterDb) RunQuery(w *SafeCSVWriter, q string, args []interface{}) (int64, error) {
+	return c.RunQueryRows(w, q, args, nil)
+}
+
+func (c *counterDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	time.Sleep(c.delay)
+	n := strconv.FormatInt(atomic.AddInt64(&c.counter, 1), 10)
+	if onRow != nil {
+		if err := onRow([]sql.NullString{{String: n, Valid: true}}); err != nil {
+			return 0, err
+		}
+	}
+	if w != nil {
+		// Deliberately do not flush, the writer must be flushed on close.
+		if err := w.Write([]string{n, "a value that spans a number of bytes"}); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+func (c *counterDb) ServerVersion() (string, error) {
+	return "counter", nil
+}
+
+func (c *counterDb) Close() {
+}
+
+func TestTerminateStopsTest(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", QueueDepth: 1,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+
+	db := &counterDb{delay: time.Millisecond}
+	done := make(chan map[string]*JobStats)
+	go func() {
+		done <- runIterations(db, config.Flavor, config, 1)[0]
+	}()
+	select {
+	case stats := <-done:
+		if stats["counter"] == nil || stats["counter"].Queries == 0 {
+			t.Errorf("Expected the stats of the test so far but got %v", stats)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Test was not stopped by SIGTERM")
+	}
+}
+
+func TestInterruptFlushesResults(t *testing.T) {
+	resultsFile := filepath.Join(t.TempDir(), "results.csv")
+	results, err := NewSafeCSVWriter(resultsFile)
+	if err != nil {
+		t.Fatalf("Error creating results file: %v", err)
+	}
+
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", QueueDepth: 1,
+				Queries:      []string{"select 1"},
+				QueryResults: results,
+			},
+		},
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+
+	db := &counterDb{delay: time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		runTest(db, config.Flavor, config)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Test was not stopped by interrupt")
+	}
+
+	f, err := os.Open(resultsFile)
+	if err != nil {
+		t.Fatalf("Error opening results file: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Results file is not valid csv: %v", err)
+	}
+	if len(records) == 0 || int64(len(records)) != atomic.LoadInt64(&db.counter) {
+		t.Errorf("Expected %d records but got %d", db.counter, len(records))
+	}
+	for i, record := range records {
+		if record[0] != strconv.Itoa(i+1) {
+			t.Errorf("Expected record %d but got %v", i+1, record)
+			break
+		}
+	}
+}
+
+func TestRunIterations(t *testing.T) {
+	config := &Config{
+		Flavor:             testFlavor(t, "mysql"),
+		BetweenIterations:  []string{"reset query cache"},
+		SetupEachIteration: []string{"truncate table t"},
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", QueueDepth: 1, Count: 2,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	db := &counterDb{}
+	iterationStats := runIterations(db, config.Flavor, config, 3)
+	if len(iterationStats) != 3 {
+		t.Fatalf("Expected 3 iterations but got %d", len(iterationStats))
+	}
+	for i, testStats := range iterationStats {
+		if queries := testStats["counter"].Queries; queries != 2 {
+			t.Errorf("Expected 2 queries in iteration %d but got %d", i+1, queries)
+		}
+	}
+	// Each iteration runs the between-iterations query and the job twice,
+	// and all but the first (whose setup runTest runs) the each-iteration
+	// setup query.
+	if counter := atomic.LoadInt64(&db.counter); counter != 11 {
+		t.Errorf("Expected 11 queries but got %d", counter)
+	}
+}
+
+func TestRunIterationsRereadsJobFiles(t *testing.T) {
+	dir := t.TempDir()
+	args := filepath.Join(dir, "args.csv")
+	if err := ioutil.WriteFile(args, []byte("id\n1\n2\n3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "repeat.ini")
+	if err := ioutil.WriteFile(configFile, []byte("[reads]\n"+
+		"query=select * from t where id = :id\n"+
+		"query-args-file=args.csv\nquery-args-header=true\n"+
+		"query-results-file=results.csv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := parseConfig(testFlavor(t, "mysql"), configFile, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAllCSVWriters()
+
+	iterationStats := runIterations(&counterDb{}, config.Flavor, config, 2)
+	if len(iterationStats) != 2 {
+		t.Fatalf("Expected 2 iterations but got %d", len(iterationStats))
+	}
+	for i, testStats := range iterationStats {
+		if stats := testStats["reads"]; stats == nil || stats.Queries != 3 {
+			t.Errorf("Expected 3 queries in iteration %d but got %+v", i+1, stats)
+		}
+	}
+	closeAllCSVWriters()
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "results.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(contents), "\n"); lines != 6 {
+		t.Errorf("Expected the results of both iterations but got %q", contents)
+	}
+}
+
+/*
+ * A counterDb that records the queries it ran.
+ */
+type recordingDb struct {
+	counterDb
+	mu      sync.Mutex
+	queries []string
+}
+
+func (r *recordingDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	r.mu.Lock()
+	r.queries = append(r.queries, q)
+	r.mu.Unlock()
+	return r.counterDb.RunQueryRows(w, q, args, onRow)
+}
+
+func TestIterationQueries(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"variants": &Job{
+				Name: "variants", QueueDepth: 1, Count: 1,
+				Queries:          []string{"select * from t use index (a)"},
+				IterationQueries: []string{"select * from t use index (a)", "select * from t use index (b)"},
+			},
+		},
+	}
+
+	db := &recordingDb{}
+	iterationStats := runIterations(db, config.Flavor, config, 3)
+	expected := []string{"select * from t use index (a)", "select * from t use index (b)", "select * from t use index (a)"}
+	if !reflect.DeepEqual(db.queries, expected) {
+		t.Errorf("Expected the iterations to run %q but got %q", expected, db.queries)
+	}
+	for i, testStats := range iterationStats {
+		if variant := testStats["variants"].IterationVariant; variant != i%2+1 {
+			t.Errorf("Expected iteration %d to report variant %d but got %d", i+1, i%2+1, variant)
+		}
+	}
+}
+
+/*
+ * A counterDb whose even-numbered queries return no rows.
+ */
+type sometimesEmptyDb struct {
+	counterDb
+}
+
+func (e *sometimesEmptyDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	if atomic.AddInt64(&e.counter, 1)%2 == 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func TestWarnEmptyResults(t *testing.T) {
+	for _, warn := range []bool{false, true} {
+		config := &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"reader": &Job{
+					Name: "reader", QueueDepth: 1, Count: 10,
+					Queries:          []string{"select * from t"},
+					WarnEmptyResults: warn,
+				},
+			},
+		}
+
+		stats := runIterations(&sometimesEmptyDb{}, config.Flavor, config, 1)[0]["reader"]
+		expected := uint64(0)
+		if warn {
+			expected = 5
+		}
+		if stats.EmptyResults != expected {
+			t.Errorf("Expected %d empty results with warn-empty-results=%v but got %d",
+				expected, warn, stats.EmptyResults)
+		}
+		if stats.AssertionErrors != 0 || stats.TotalErrors != 0 {
+			t.Errorf("Expected empty results not to count as errors but got %d assertion errors and %d errors",
+				stats.AssertionErrors, stats.TotalErrors)
+		}
+	}
+}
+
+func TestWarmupExcludedFromStats(t *testing.T) {
+	const warmup = 50 * time.Millisecond
+	config := &Config{
+		Flavor:   testFlavor(t, "mysql"),
+		Duration: 3 * warmup,
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", Rate: 200, BatchSize: 1,
+				WarmupRate: 100, WarmupDuration: warmup,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	db := &counterDb{}
+	stats := runIterations(db, config.Flavor, config, 1)[0]["counter"]
+	if stats == nil || stats.Queries == 0 {
+		t.Fatalf("Expected queries after the warmup")
+	}
+	if stats.Start < warmup {
+		t.Errorf("Expected stats to start after the warmup (%v) but started at %v", warmup, stats.Start)
+	}
+	if executed := atomic.LoadInt64(&db.counter); uint64(executed) <= stats.Queries {
+		t.Errorf("Expected warmup queries to be executed but not counted: %d executed, %d counted",
+			executed, stats.Queries)
+	}
+}
+
+func TestRampDown(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", Rate: 200, BatchSize: 1,
+				Stop: 300 * time.Millisecond, RampDown: 200 * time.Millisecond,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	if stats == nil || stats.RampDown != 200*time.Millisecond {
+		t.Fatalf("Expected the job to ramp down")
+	}
+	// About 20 queries before the ramp down and 20 during it, rather than
+	// 60 at the full rate.
+	if stats.Queries == 0 || stats.Queries > 50 {
+		t.Errorf("Expected fewer queries while ramping down but got %d", stats.Queries)
+	}
+}
+
+func TestRampDownOfDelayedJob(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"load": &Job{
+				Name: "load", QueueDepth: 1, Count: 10,
+				Queries: []string{"insert"},
+			},
+			"counter": &Job{
+				Name: "counter", Rate: 400, BatchSize: 1,
+				Stop: 400 * time.Millisecond, RampDown: 300 * time.Millisecond,
+				Queries:   []string{"select 1"},
+				DependsOn: []string{"load"},
+			},
+		},
+	}
+
+	db := &counterDb{delay: 20 * time.Millisecond}
+	stats := runIterations(db, config.Flavor, config, 1)[0]["counter"]
+	if stats == nil || stats.RampDown != 300*time.Millisecond {
+		t.Fatalf("Expected the job to ramp down")
+	}
+	// The job starts after load, about 200ms in, already ramping down
+	// towards its stop at 400ms: about 25 queries, rather than about 75
+	// if it ramped down towards a stop 400ms after it started.
+	if stats.Queries == 0 || stats.Queries > 50 {
+		t.Errorf("Expected the job to ramp down until its stop but got %d queries", stats.Queries)
+	}
+}
+
+func TestRampUp(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", Rate: 200, BatchSize: 1,
+				Stop: 300 * time.Millisecond, RampUp: 200 * time.Millisecond,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	// About 20 queries during the ramp up and 20 after it, rather than 60
+	// at the full rate.
+	if stats == nil || stats.Queries == 0 || stats.Queries > 50 {
+		t.Errorf("Expected fewer queries while ramping up but got %v", stats)
+	}
+}
+
+func TestConnectWithRetries(t *testing.T) {
+	attempts := 0
+	connectAfter := func(n int) func() (Database, error) {
+		return func() (Database, error) {
+			attempts++
+			if attempts < n {
+				return nil, fmt.Errorf("attempt %d failed", attempts)
+			}
+			return &counterDb{}, nil
+		}
+	}
+
+	if db, err := connectWithRetries(connectAfter(3), 2, time.Millisecond); err != nil || db == nil {
+		t.Errorf("Expected to connect on the last retry but got %v", err)
+	} else if attempts != 3 {
+		t.Errorf("Expected 3 attempts but got %d", attempts)
+	}
+
+	attempts = 0
+	if _, err := connectWithRetries(connectAfter(5), 2, time.Millisecond); err == nil || err.Error() != "attempt 3 failed" {
+		t.Errorf("Expected the last error after running out of retries but got %v", err)
+	}
+
+	attempts = 0
+	if _, err := connectWithRetries(connectAfter(2), 0, time.Millisecond); err == nil || attempts != 1 {
+		t.Errorf("Expected a single attempt without retries but got %d", attempts)
+	}
+}
+
+func TestBatchSizeRange(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", Rate: 1000, Count: 50,
+				BatchSize: 2, MaxBatchSize: 6,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	if stats == nil || stats.AverageBatchSize < 2 || stats.AverageBatchSize > 6 {
+		t.Fatalf("Expected an average batch size between 2 and 6 but got %+v", stats)
+	}
+	if expected := uint64(stats.AverageBatchSize*50 + 0.5); stats.Queries != expected {
+		t.Errorf("Expected %d queries for 50 batches but got %d", expected, stats.Queries)
+	}
+}
+
+func TestWriteRowsAffected(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", QueueDepth: 1, Count: 5,
+				Queries:              []string{"update t set a = a + 1"},
+				FailZeroRowsAffected: true,
+			},
+		},
+	}
+
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	if writes := stats.RowsPerWrite.Count(); writes != 5 || stats.WriteRows != 5 {
+		t.Errorf("Expected 5 writes affecting 5 rows but got %d affecting %d", writes, stats.WriteRows)
+	}
+	if stats.ZeroRowWrites != 0 || stats.AssertionErrors != 0 {
+		t.Errorf("Unexpected writes affecting no rows")
+	}
+}
+
+func TestVerifyIdempotent(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"counter": &Job{
+				Name: "counter", QueueDepth: 1, Count: 5,
+				Queries:          []string{"select count(*) from t"},
+				VerifyIdempotent: true,
+			},
+		},
+	}
+
+	// The counter returns a different value every time it is queried.
+	db := &counterDb{}
+	stats := runIterations(db, config.Flavor, config, 1)[0]["counter"]
+	if db.counter != 10 {
+		t.Errorf("Expected 10 queries but got %d", db.counter)
+	}
+	if stats.IdempotencyMismatches != 5 || stats.AssertionErrors != 5 {
+		t.Errorf("Expected 5 mismatches but got %d (%d assertion errors)",
+			stats.IdempotencyMismatches, stats.AssertionErrors)
+	}
+	if !strings.Contains(stats.IdempotencySample, "select count(*) from t") {
+		t.Errorf("Expected sample of the mismatched query but got %q", stats.IdempotencySample)
+	}
+}
+
+/*
+ * A counterDb whose server always takes a millisecond.
+ */
+type serverTimedDb struct {
+	counterDb
+}
+
+func (s *serverTimedDb) RunQueryServerTime(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, time.Duration, time.Duration, error) {
+	start := time.Now()
+	rows, err := s.RunQueryRows(w, q, args, onRow)
+	return rows, time.Since(start), time.Millisecond, err
+}
+
+func TestServerExecTime(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"counter": &Job{
+					Name: "counter", QueueDepth: 1, Count: 5,
+					Queries:        []string{"select 1"},
+					ServerExecTime: true,
+				},
+			},
+		}
+	}
+
+	config := newConfig()
+	stats := runIterations(&serverTimedDb{}, config.Flavor, config, 1)[0]["counter"]
+	if n := stats.ServerLatency.Count(); n != 5 {
+		t.Errorf("Expected server latency of 5 transactions but got %d", n)
+	}
+	if mean := time.Duration(stats.ServerLatency.Mean()); mean != time.Millisecond {
+		t.Errorf("Expected server latency of 1ms but got %v", mean)
+	}
+
+	// Databases that cannot report the server time are skipped.
+	config = newConfig()
+	stats = runIterations(&counterDb{}, config.Flavor, config, 1)[0]["counter"]
+	if n := stats.ServerLatency.Count(); n != 0 {
+		t.Errorf("Expected no server latency but got %d", n)
+	}
+	if config.Jobs["counter"].ServerExecTimeUnsupported != 1 {
+		t.Errorf("Expected server execution time to be unsupported")
+	}
+}
+
+func TestFailFraction(t *testing.T) {
+	newConfig := func() *Config {
+		return &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"flaky": &Job{
+					Name: "flaky", QueueDepth: 1, Count: 1000,
+					Queries:      []string{"select 1"},
+					FailFraction: 0.25,
+				},
+			},
+		}
+	}
+
+	db := &counterDb{}
+	config := newConfig()
+	stats := runIterations(db, config.Flavor, config, 1)[0]["flaky"]
+	injected := stats.InjectedErrors
+	if injected < 150 || injected > 350 {
+		t.Errorf("Expected about 250 injected errors but got %d", injected)
+	}
+	if stats.TotalErrors != injected || stats.FailingErrors() != 0 {
+		t.Errorf("Expected only injected errors but got %d errors (%d failing)",
+			stats.TotalErrors, stats.FailingErrors())
+	}
+	if uint64(atomic.LoadInt64(&db.counter)) != 1000-injected {
+		t.Errorf("Expected injected invocations to not run, but ran %d queries", db.counter)
+	}
+
+	config = newConfig()
+	again := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["flaky"]
+	if again.InjectedErrors != injected {
+		t.Errorf("Expected the same seed to inject %d errors but got %d",
+			injected, again.InjectedErrors)
+	}
+}
+
+/*
+ * A fake database that returns the query it ran as its single row.
+ */
+type echoDb struct {
+	counterDb
+}
+
+func (e *echoDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	atomic.AddInt64(&e.counter, 1)
+	if onRow != nil {
+		if err := onRow([]sql.NullString{{String: q, Valid: true}, {}}); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"explained": &Job{
+				Name: "explained", QueueDepth: 1, Count: 20,
+				Queries:        []string{" select * from t "},
+				ExplainAnalyze: true,
+			},
+		},
+	}
+
+	stats := runIterations(&echoDb{}, config.Flavor, config, 1)[0]["explained"]
+	if len(stats.ExplainPlans) != maxExplainPlans || stats.planCount != 20 {
+		t.Fatalf("Expected %d of 20 plans but got %d of %d",
+			maxExplainPlans, len(stats.ExplainPlans), stats.planCount)
+	}
+	for _, plan := range stats.ExplainPlans {
+		if plan != "explain analyze select * from t\t\n" {
+			t.Errorf("Unexpected plan %q", plan)
+		}
+	}
+}
+
+func TestLatencyLog(t *testing.T) {
+	readLatencyLog := func(sampling float64, count uint64) [][]string {
+		path := filepath.Join(t.TempDir(), "latencies.csv")
+		latencyLog, err := NewSafeCSVWriter(path)
+		if err != nil {
+			t.Fatalf("Error creating latency log: %v", err)
+		}
+		config := &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"logged": &Job{
+					Name: "logged", QueueDepth: 2, Count: count,
+					Queries:            []string{"select 1"},
+					LatencyLog:         latencyLog,
+					LatencyLogSampling: sampling,
+				},
+			},
+		}
+		runIterations(&counterDb{}, config.Flavor, config, 1)
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Error opening latency log: %v", err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatalf("Error reading latency log: %v", err)
+		}
+		return records
+	}
+
+	records := readLatencyLog(1, 50)
+	if len(records) != 50 {
+		t.Fatalf("Expected a row per execution (50) but got %d", len(records))
+	}
+	for _, record := range records {
+		if _, err := strconv.ParseInt(record[0], 10, 64); err != nil {
+			t.Errorf("Invalid timestamp in %v: %v", record, err)
+		}
+		if latency, err := strconv.ParseInt(record[1], 10, 64); err != nil || latency <= 0 {
+			t.Errorf("Invalid latency in %v", record)
+		}
+		if record[2] != "false" {
+			t.Errorf("Expected no error in %v", record)
+		}
+	}
+
+	if n := len(readLatencyLog(0.5, 400)); n < 120 || n > 280 {
+		t.Errorf("Expected about half of 400 executions at 0.5 sampling but got %d", n)
+	}
+}
+
+/*
+ * A counterDb that counts the connections it opens and closes.
+ */
+type cyclingDb struct {
+	counterDb
+	connections int64
+	closed      int64
+}
+
+type cyclingConn struct {
+	db *cyclingDb
+}
+
+func (c *cyclingDb) CycleConnection() error {
+	atomic.AddInt64(&c.connections, 1)
+	return nil
+}
+
+func (c *cyclingDb) OpenConnection() (Connection, error) {
+	atomic.AddInt64(&c.connections, 1)
+	return &cyclingConn{c}, nil
+}
+
+func (c *cyclingConn) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return c.db.counterDb.RunQueryRows(w, q, args, onRow)
+}
+
+func (c *cyclingConn) Close() {
+	atomic.AddInt64(&c.db.closed, 1)
+}
+
+func TestConnectOnly(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"connect": &Job{
+				Name: "connect", QueueDepth: 2, Count: 20,
+				ConnectOnly: true,
+			},
+		},
+	}
+
+	db := &cyclingDb{}
+	stats := runIterations(db, config.Flavor, config, 1)[0]["connect"]
+	if db.connections != 20 || db.counter != 0 {
+		t.Errorf("Expected 20 connections and no queries but got %d and %d",
+			db.connections, db.counter)
+	}
+	if stats.ConnectLatency == nil || stats.ConnectLatency.Latency.Count() != 20 {
+		t.Fatalf("Expected the connect latency of 20 connections but got %+v", stats.ConnectLatency)
+	}
+	if stats.Queries != 0 {
+		t.Errorf("Expected no queries but got %d", stats.Queries)
+	}
+}
+
+func TestConnectionPerQuery(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"churn": &Job{
+				Name: "churn", QueueDepth: 2, Count: 20,
+				Queries:            []string{"select 1"},
+				ConnectionPerQuery: true,
+			},
+		},
+	}
+
+	db := &cyclingDb{}
+	stats := runIterations(db, config.Flavor, config, 1)[0]["churn"]
+	if db.connections != 20 || db.closed != 20 || db.counter != 20 {
+		t.Errorf("Expected 20 connections opened and closed and 20 queries but got %d, %d and %d",
+			db.connections, db.closed, db.counter)
+	}
+	if stats.ConnectLatency == nil || stats.ConnectLatency.Latency.Count() != 20 {
+		t.Fatalf("Expected the connect latency of 20 connections but got %+v", stats.ConnectLatency)
+	}
+	if stats.Queries != 20 {
+		t.Errorf("Expected 20 queries but got %d", stats.Queries)
+	}
+}
+
+/*
+ * A fake database whose queries hang until their context is done, or a
+ * second has passed.
+ */
+type hangingDb struct {
+	counterDb
+}
+
+func (h *hangingDb) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	atomic.AddInt64(&h.counter, 1)
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(time.Second):
+		return 1, nil
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"hang": &Job{
+				Name: "hang", QueueDepth: 2, Count: 10,
+				Queries:      []string{"select sleep(60)"},
+				QueryTimeout: 10 * time.Millisecond,
+			},
+		},
+	}
+
+	start := time.Now()
+	stats := runIterations(&hangingDb{}, config.Flavor, config, 1)[0]["hang"]
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the queries to be abandoned but the test took %v", elapsed)
+	}
+	if stats.TimeoutErrors != 10 || stats.TotalErrors != 10 {
+		t.Errorf("Expected 10 timeouts but got %d (of %d errors)",
+			stats.TimeoutErrors, stats.TotalErrors)
+	}
+	if !strings.Contains(stats.String(), "; 10 timeouts") {
+		t.Errorf("Expected the timeouts in the summary but got %s", stats.String())
+	}
+}
+
+func TestQueryTimeoutCancelledOnStop(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"hang": &Job{
+				Name: "hang", QueueDepth: 2, Stop: 50 * time.Millisecond,
+				Queries:      []string{"select sleep(60)"},
+				QueryTimeout: time.Minute,
+			},
+		},
+	}
+
+	start := time.Now()
+	stats := runIterations(&hangingDb{}, config.Flavor, config, 1)[0]["hang"]
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the queries to be cancelled when the job stopped but the test took %v", elapsed)
+	}
+	// The queries in flight when the job stopped (and any it issued while
+	// stopping) are cancelled.
+	if stats.TimeoutErrors < 2 || stats.TimeoutErrors != stats.TotalErrors {
+		t.Errorf("Expected the queries in flight to be cancelled but got %d timeouts (of %d errors)",
+			stats.TimeoutErrors, stats.TotalErrors)
+	}
+}
+
+/*
+ * A fake database that records the statements of its transactions, and whose
+ * queries fail with a deadlock when they contain "fail".
+ */
+type transactionalDb struct {
+	recordingDb
+}
+
+type transactionalTx struct {
+	db *transactionalDb
+}
+
+func (d *transactionalDb) BeginTransaction() (Transaction, error) {
+	d.recordingDb.RunQueryRows(nil, "begin", nil, nil)
+	return &transactionalTx{d}, nil
+}
+
+func (t *transactionalTx) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	t.db.recordingDb.RunQueryRows(w, q, args, onRow)
+	if strings.Contains(q, "fail") {
+		return 0, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	}
+	return 1, nil
+}
+
+func (t *transactionalTx) Commit() error {
+	t.db.recordingDb.RunQueryRows(nil, "commit", nil, nil)
+	return nil
+}
+
+func (t *transactionalTx) Rollback() error {
+	t.db.recordingDb.RunQueryRows(nil, "rollback", nil, nil)
+	return nil
+}
+
+func TestTransaction(t *testing.T) {
+	newConfig := func(queries ...string) *Config {
+		return &Config{
+			Flavor:         testFlavor(t, "mysql"),
+			AcceptedErrors: Set{"1213": struct{}{}},
+			Jobs: map[string]*Job{
+				"tx": &Job{
+					Name: "tx", QueueDepth: 1, Count: 2,
+					Queries:     queries,
+					Transaction: true,
+				},
+			},
+		}
+	}
+
+	db := &transactionalDb{}
+	stats := runIterations(db, testFlavor(t, "mysql"),
+		newConfig("update a", "update b"), 1)[0]["tx"]
+	expected := []string{"begin", "update a", "update b", "commit",
+		"begin", "update a", "update b", "commit"}
+	if !reflect.DeepEqual(db.queries, expected) {
+		t.Errorf("Expected %v but got %v", expected, db.queries)
+	}
+	if stats.Queries != 4 || stats.jobStats.Transactions.Count() != 2 {
+		t.Errorf("Expected 4 queries in 2 transactions but got %d in %d",
+			stats.Queries, stats.jobStats.Transactions.Count())
+	}
+
+	// The queries after a failed one are not run.
+	db = &transactionalDb{}
+	stats = runIterations(db, testFlavor(t, "mysql"),
+		newConfig("update a", "update fail", "update c"), 1)[0]["tx"]
+	expected = []string{"begin", "update a", "update fail", "rollback",
+		"begin", "update a", "update fail", "rollback"}
+	if !reflect.DeepEqual(db.queries, expected) {
+		t.Errorf("Expected %v but got %v", expected, db.queries)
+	}
+	if stats.TotalErrors != 2 {
+		t.Errorf("Expected 2 errors but got %d", stats.TotalErrors)
+	}
+}
+
+/*
+ * A fake database that counts the statements prepared and closed, and whose
+ * statements record their query and args when executed.
+ */
+type preparingDb struct {
+	recordingDb
+	prepared int64
+	closed   int64
+}
+
+type preparingStmt struct {
+	db *preparingDb
+	q  string
+}
+
+func (d *preparingDb) Prepare(q string) (PreparedStatement, error) {
+	atomic.AddInt64(&d.prepared, 1)
+	return &preparingStmt{d, q}, nil
+}
+
+func (s *preparingStmt) RunQueryRows(w *SafeCSVWriter, args []interface{}, onRow RowHandler) (int64, error) {
+	return s.db.recordingDb.RunQueryRows(w, fmt.Sprintf("%s %v", s.q, args), args, onRow)
+}
+
+func (s *preparingStmt) Close() {
+	atomic.AddInt64(&s.db.closed, 1)
+}
+
+func TestPrepared(t *testing.T) {
+	defer func(disable bool) { *disableStatementCache = disable }(*disableStatementCache)
+	for _, c := range []struct {
+		disableCache bool
+		prepared     int64
+		cache        string
+	}{
+		{false, 1, "job"},
+		// Without the cache, each execution prepares its statement.
+		{true, 3, "none"},
+	} {
+		*disableStatementCache = c.disableCache
+		config := &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"lookup": &Job{
+					Name: "lookup", QueueDepth: 2,
+					Queries:   []string{"select * from t where id = ?"},
+					QueryArgs: csv.NewReader(strings.NewReader("1\n2\n3")),
+					Prepared:  true,
+				},
+			},
+		}
+
+		db := &preparingDb{}
+		iterationStats := runIterations(db, config.Flavor, config, 1)
+		if db.prepared != c.prepared || db.closed != c.prepared {
+			t.Errorf("Expected %d statements prepared and closed but got %d and %d",
+				c.prepared, db.prepared, db.closed)
+		}
+		if cache := iterationStats[0]["lookup"].StatementCache; cache != c.cache {
+			t.Errorf("Expected the statement cache %q but got %q", c.cache, cache)
+		}
+		sort.Strings(db.queries)
+		expected := []string{"select * from t where id = ? [1]",
+			"select * from t where id = ? [2]", "select * from t where id = ? [3]"}
+		if !reflect.DeepEqual(db.queries, expected) {
+			t.Errorf("Expected %v but got %v", expected, db.queries)
+		}
+	}
+}
+
+/*
+ * A fake database whose queries fail with a deadlock when fail returns true
+ * for the number of the query (from 1).
+ */
+type deadlockingDb struct {
+	counterDb
+	fail func(n int64) bool
+}
+
+func (d *deadlockingDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	if d.fail(atomic.AddInt64(&d.counter, 1)) {
+		return 0, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}
+	}
+	return 1, nil
+}
+
+func TestRetries(t *testing.T) {
+	newConfig := func(retryBudget float64) *Config {
+		return &Config{
+			Flavor:         testFlavor(t, "mysql"),
+			AcceptedErrors: Set{"1213": struct{}{}},
+			RetryBudget:    retryBudget,
+			Jobs: map[string]*Job{
+				"test": &Job{
+					Name: "test", QueueDepth: 1, Count: 20, Retries: 2,
+					Queries: []string{"update t set a = a + 1"},
+				},
+			},
+		}
+	}
+
+	// Every other query deadlocks, so every invocation succeeds on its
+	// first retry.
+	db := &deadlockingDb{fail: func(n int64) bool { return n%2 == 1 }}
+	stats := runIterations(db, testFlavor(t, "mysql"), newConfig(0), 1)[0]["test"]
+	if stats.jobStats.Transactions.Count() != 20 || stats.TotalErrors != 0 ||
+		stats.Retries != 20 || stats.RetriesSkipped != 0 {
+		t.Errorf("Expected 20 transactions retried once each but got %d transactions, %d errors, %d retries, %d skipped",
+			stats.jobStats.Transactions.Count(), stats.TotalErrors, stats.Retries, stats.RetriesSkipped)
+	}
+
+	// Every query deadlocks, and the budget allows a retry every other
+	// invocation.
+	db = &deadlockingDb{fail: func(int64) bool { return true }}
+	stats = runIterations(db, testFlavor(t, "mysql"), newConfig(0.5), 1)[0]["test"]
+	if stats.TotalErrors != 20 || stats.Retries != 10 || stats.RetriesSkipped != 20 || db.counter != 30 {
+		t.Errorf("Expected 20 errors, 10 retries and 20 skipped out of 30 queries but got %d, %d, %d out of %d",
+			stats.TotalErrors, stats.Retries, stats.RetriesSkipped, db.counter)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	for _, c := range []struct {
+		maxP99 time.Duration
+		passed bool
+	}{
+		{time.Minute, true},
+		{time.Nanosecond, false},
+	} {
+		config := &Config{
+			Flavor: testFlavor(t, "mysql"),
+			Jobs: map[string]*Job{
+				"probe": &Job{
+					Name: "probe", QueueDepth: 1, Count: 5,
+					Queries: []string{"select 1"},
+				},
+				"load": &Job{
+					Name: "load", QueueDepth: 4, Count: 20,
+					Queries: []string{"select 2"},
+					Probe:   "probe", ProbeMaxP99: c.maxP99,
+				},
+			},
+		}
+
+		db := &counterDb{delay: time.Millisecond}
+		stats := runIterations(db, config.Flavor, config, 1)[0]
+		load, ok := stats["load"]
+		if !ok || load.Probe == nil {
+			t.Errorf("Expected the probe outcome of load to be reported but got %v", stats)
+			continue
+		}
+		if load.Probe.Passed != c.passed || load.Probe.Transactions != 5 {
+			t.Errorf("Expected the probe to pass (%v) over 5 transactions but got %+v",
+				c.passed, load.Probe)
+		}
+		expected := 0
+		if c.passed {
+			expected = 20
+		}
+		if count := load.jobStats.Transactions.Count(); count != expected || db.counter != int64(5+expected) {
+			t.Errorf("Expected load to run %d transactions but got %d (%d queries)",
+				expected, count, db.counter)
+		}
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"load": &Job{
+				Name: "load", QueueDepth: 2, Count: 10,
+				Queries: []string{"insert"},
+			},
+			"index": &Job{
+				Name: "index", QueueDepth: 1, Count: 1,
+				Queries:   []string{"create index"},
+				DependsOn: []string{"load"},
+			},
+			"read": &Job{
+				Name: "read", QueueDepth: 2, Count: 10,
+				Queries:   []string{"select"},
+				DependsOn: []string{"load", "index"},
+			},
+		},
+	}
+
+	db := &recordingDb{}
+	runIterations(db, config.Flavor, config, 1)
+	if len(db.queries) != 21 {
+		t.Fatalf("Expected 21 queries but got %d", len(db.queries))
+	}
+	for i, q := range db.queries {
+		expected := "insert"
+		if i == 10 {
+			expected = "create index"
+		} else if i > 10 {
+			expected = "select"
+		}
+		if q != expected {
+			t.Fatalf("Expected query %d to be %q but got %q", i, expected, q)
+		}
+	}
+}
+
+func TestTimeoutOfDependentJob(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"load": &Job{
+				Name: "load", QueueDepth: 1, Count: 10,
+				Queries: []string{"insert"},
+			},
+			// Its timeout only counts once load has stopped.
+			"read": &Job{
+				Name: "read", QueueDepth: 1, Count: 2,
+				Queries:   []string{"select"},
+				DependsOn: []string{"load"},
+				Timeout:   100 * time.Millisecond,
+			},
+		},
+	}
+
+	db := &counterDb{delay: 20 * time.Millisecond}
+	summary := getJobsSummary(runIterations(db, config.Flavor, config, 1)[0])
+	if read := summary["read"]; read == nil || read.TimedOut || read.Transactions != 2 {
+		t.Errorf("Expected read to complete within its timeout but got %+v", read)
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	jobs := map[string]*Job{
+		"a": &Job{Name: "a", Count: 1, DependsOn: []string{"b"}},
+		"b": &Job{Name: "b", Count: 1, DependsOn: []string{"c"}},
+		"c": &Job{Name: "c", Count: 1, DependsOn: []string{"b"}},
+	}
+	err := validateDependencies(jobs)
+	if expected := `jobs depend on each other in a cycle: "b" -> "c" -> "b"`; err == nil || err.Error() != expected {
+		t.Errorf("Expected %q but got %v", expected, err)
+	}
+}
+
+func TestShards(t *testing.T) {
+	rows := []string{"1,a", "2,b", "3,c", "4,a", "5,d", "6,b", "7,a", "8,e"}
+	job := &Job{
+		Name: "test", QueueDepth: 1,
+		Queries:        []string{"select ?, ?"},
+		QueryArgs:      csv.NewReader(strings.NewReader(strings.Join(rows, "\n"))),
+		ShardKeyColumn: 1, Shards: 3,
+	}
+	expected := make([]int, job.Shards)
+	for _, row := range rows {
+		expected[job.shardOf(strings.Split(row, ","))]++
+	}
+
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs:   map[string]*Job{"test": job},
+	}
+	stats := runIterations(&counterDb{}, config.Flavor, config, 1)[0]["test"]
+	if len(stats.Shards) != job.Shards {
+		t.Fatalf("Expected %d shards but got %d", job.Shards, len(stats.Shards))
+	}
+	for i := range stats.Shards {
+		shard := &stats.Shards[i]
+		if shard.Shard != strconv.Itoa(i) || shard.Summary().Count != expected[i] {
+			t.Errorf("Expected %d transactions in shard %d but got %d in shard %s",
+				expected[i], i, shard.Summary().Count, shard.Shard)
+		}
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"slow": &Job{
+				Name: "slow", QueueDepth: 1, Count: 1000,
+				Timeout: 50 * time.Millisecond,
+				Queries: []string{"select 1"},
+			},
+			"fast": &Job{
+				Name: "fast", QueueDepth: 1, Count: 5,
+				Timeout: time.Minute,
+				Queries: []string{"select 2"},
+			},
+		},
+	}
+
+	db := &counterDb{delay: 5 * time.Millisecond}
+	summary := getJobsSummary(runIterations(db, config.Flavor, config, 1)[0])
+	slow := summary["slow"]
+	if !slow.TimedOut || slow.RequestedCount != 1000 ||
+		slow.CompletedCount == 0 || slow.CompletedCount >= 1000 {
+		t.Errorf("Expected slow to time out before its count but got timed out %v with %d of %d",
+			slow.TimedOut, slow.CompletedCount, slow.RequestedCount)
+	}
+	if fast := summary["fast"]; fast.TimedOut || fast.Transactions != 5 {
+		t.Errorf("Expected fast to reach its count but got timed out %v with %d transactions",
+			fast.TimedOut, fast.Transactions)
+	}
+}
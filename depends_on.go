@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Checks that each job a job depends on is another job that stops on its
+ * own, and that no job depends on itself through others.
+ */
+func validateDependencies(jobs map[string]*Job) error {
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, dep := range jobs[name].DependsOn {
+			dependency, ok := jobs[dep]
+			if !ok {
+				return fmt.Errorf("job %s depends on an unknown job %s",
+					strconv.Quote(name), strconv.Quote(dep))
+			} else if dep == name {
+				return fmt.Errorf("job %s cannot depend on itself", strconv.Quote(name))
+			} else if dependency.Count == 0 && dependency.Stop == 0 &&
+				dependency.QueryArgs == nil && dependency.QueryLog == nil {
+				return fmt.Errorf("job %s that job %s depends on must stop (e.g. with count or stop)",
+					strconv.Quote(dep), strconv.Quote(name))
+			}
+		}
+	}
+
+	// The jobs on the path of the search, and those known not to be
+	// in a cycle.
+	visiting := make(map[string]bool)
+	checked := make(map[string]bool)
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		if checked[name] {
+			return nil
+		} else if visiting[name] {
+			cycle := []string{}
+			for i := len(path) - 1; i >= 0; i-- {
+				if path[i] == name {
+					cycle = append(cycle, path[i:]...)
+					break
+				}
+			}
+			cycle = append(cycle, name)
+			for i, n := range cycle {
+				cycle[i] = strconv.Quote(n)
+			}
+			return fmt.Errorf("jobs depend on each other in a cycle: %s",
+				strings.Join(cycle, " -> "))
+		}
+		visiting[name] = true
+		path = append(path, name)
+		for _, dep := range jobs[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		visiting[name] = false
+		checked[name] = true
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Gives each job a channel closed once it stops, and the channels of the
+ * jobs it depends on, for a run of the jobs.
+ */
+func setUpDependencies(jobs map[string]*Job) {
+	for _, job := range jobs {
+		job.Stopped = make(chan struct{})
+	}
+	for _, job := range jobs {
+		job.dependencies = nil
+		for _, dep := range job.DependsOn {
+			job.dependencies = append(job.dependencies, jobs[dep].Stopped)
+		}
+	}
+}
+
+/*
+ * Waits for the jobs the job depends on to stop. Returns false if the
+ * context is done first.
+ */
+func (job *Job) waitForDependencies(ctx context.Context) bool {
+	quoted := make([]string, len(job.DependsOn))
+	for i, dep := range job.DependsOn {
+		quoted[i] = strconv.Quote(dep)
+	}
+	log.Printf("%s: waiting for %s to stop", job.Name, strings.Join(quoted, ", "))
+	for _, stopped := range job.dependencies {
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
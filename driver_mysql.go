@@ -0,0 +1,194 @@
+//go:build mysql || !(mysql || postgres || mssql || vertica)
+// +build mysql !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	registerDatabaseFlavor(&sqlDatabaseFlavor{"mysql", mySQLDataSourceName, mySQLSyntax.checkQuery, mySQLErrorCodeParser, "select version()", questionPlaceholder, mySQLServerExecTime, "explain analyze "})
+	clientCertificateFuncs["mysql"] = mySQLClientCertificate
+	tlsConfigFuncs["mysql"] = mySQLTLSConfig
+	sqlStateFuncs["mysql"] = mySQLSQLState
+}
+
+// The name under which the TLS config with the client certificate is
+// registered with the driver.
+const mySQLClientCertificateTLS = "dbbench-client-certificate"
+
+/*
+ * Registers a TLS config with the client certificate and selects it in
+ * the params. The server certificate is only verified if the tls param
+ * asked for it (i.e. not with skip-verify or the default, preferred).
+ */
+func mySQLClientCertificate(cc *ConnectionConfig, cert *clientCertificate) (func(), error) {
+	params, err := url.ParseQuery(firstString(cc.Params, mySQLDefaultParams))
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert.Certificate}}
+	switch params.Get("tls") {
+	case "skip-verify", "preferred":
+		config.InsecureSkipVerify = true
+	}
+	if err := mysql.RegisterTLSConfig(mySQLClientCertificateTLS, config); err != nil {
+		return nil, err
+	}
+	params.Set("tls", mySQLClientCertificateTLS)
+	cc.Params = params.Encode()
+	return func() { mysql.DeregisterTLSConfig(mySQLClientCertificateTLS) }, nil
+}
+
+// The name under which the TLS config of -tls-mode is registered with the
+// driver.
+const mySQLTLSConfigName = "dbbench-tls"
+
+/*
+ * Registers the TLS config of -tls-mode and selects it in the params, or
+ * turns TLS off if the mode is disable.
+ */
+func mySQLTLSConfig(cc *ConnectionConfig) (func(), error) {
+	params, err := url.ParseQuery(firstString(cc.Params, mySQLDefaultParams))
+	if err != nil {
+		return nil, err
+	}
+	if cc.TLSMode == tlsModeDisable {
+		params.Set("tls", "false")
+		cc.Params = params.Encode()
+		return func() {}, nil
+	}
+	config, err := newTLSConfig(cc, firstString(cc.Host, "localhost"))
+	if err != nil {
+		return nil, err
+	}
+	if err := mysql.RegisterTLSConfig(mySQLTLSConfigName, config); err != nil {
+		return nil, err
+	}
+	params.Set("tls", mySQLTLSConfigName)
+	cc.Params = params.Encode()
+	return func() { mysql.DeregisterTLSConfig(mySQLTLSConfigName) }, nil
+}
+
+func mySQLErrorCodeParser(e error) (string, error) {
+	err, ok := e.(*mysql.MySQLError)
+	if !ok {
+		return "", fmt.Errorf("Unrecognized MySQL error: %v", e)
+	}
+	return fmt.Sprint(err.Number), nil
+}
+
+// The SQLSTATE of common MySQL server errors, from
+// https://dev.mysql.com/doc/mysql-errors/8.0/en/server-error-reference.html.
+// The driver does not expose the SQLSTATE sent by the server.
+var mySQLSQLStates = map[uint16]string{
+	1022: "23000", // ER_DUP_KEY
+	1040: "08004", // ER_CON_COUNT_ERROR
+	1044: "42000", // ER_DBACCESS_DENIED_ERROR
+	1045: "28000", // ER_ACCESS_DENIED_ERROR
+	1046: "3D000", // ER_NO_DB_ERROR
+	1048: "23000", // ER_BAD_NULL_ERROR
+	1049: "42000", // ER_BAD_DB_ERROR
+	1050: "42S01", // ER_TABLE_EXISTS_ERROR
+	1051: "42S02", // ER_BAD_TABLE_ERROR
+	1054: "42S22", // ER_BAD_FIELD_ERROR
+	1062: "23000", // ER_DUP_ENTRY
+	1064: "42000", // ER_PARSE_ERROR
+	1146: "42S02", // ER_NO_SUCH_TABLE
+	1205: "HY000", // ER_LOCK_WAIT_TIMEOUT
+	1213: "40001", // ER_LOCK_DEADLOCK
+	1216: "23000", // ER_NO_REFERENCED_ROW
+	1217: "23000", // ER_ROW_IS_REFERENCED
+	1264: "22003", // ER_WARN_DATA_OUT_OF_RANGE
+	1317: "70100", // ER_QUERY_INTERRUPTED
+	1406: "22001", // ER_DATA_TOO_LONG
+	1451: "23000", // ER_ROW_IS_REFERENCED_2
+	1452: "23000", // ER_NO_REFERENCED_ROW_2
+	3024: "HY000", // ER_QUERY_TIMEOUT
+	3572: "HY000", // ER_LOCK_NOWAIT
+}
+
+/*
+ * The SQLSTATE of a MySQL error. Errors that are not in mySQLSQLStates are
+ * unknown rather than HY000 (the SQLSTATE of most MySQL errors), since the
+ * table is not complete.
+ */
+func mySQLSQLState(e error) (string, bool) {
+	err, ok := e.(*mysql.MySQLError)
+	if !ok {
+		return "", false
+	}
+	state, ok := mySQLSQLStates[err.Number]
+	return state, ok
+}
+
+/*
+ * Runs the query with profiling enabled for the session, returning the
+ * duration of the query according to SHOW PROFILES.
+ */
+func mySQLServerExecTime(ctx context.Context, conn *sql.Conn, run func() error) (time.Duration, error) {
+	if _, err := conn.ExecContext(ctx, "set profiling = 1"); err != nil {
+		// Profiling is not supported (e.g. it was compiled out); run
+		// the query anyway.
+		if runErr := run(); runErr != nil {
+			return 0, runErr
+		}
+		return 0, err
+	}
+	if err := run(); err != nil {
+		return 0, err
+	}
+
+	rows, err := conn.QueryContext(ctx, "show profiles")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// The last profile is that of the query.
+	var queryID int64
+	var duration, query string
+	found := false
+	for rows.Next() {
+		if err = rows.Scan(&queryID, &duration, &query); err != nil {
+			return 0, err
+		}
+		found = true
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	} else if !found {
+		return 0, errServerExecTimeUnsupported
+	}
+
+	seconds, err := strconv.ParseFloat(duration, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
@@ -0,0 +1,127 @@
+//go:build postgres || !(mysql || postgres || mssql || vertica)
+// +build postgres !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	registerDatabaseFlavor(&sqlDatabaseFlavor{"postgres", postgresDataSourceName, postgresSyntax.checkQuery, postgresErrorCodeParser, "select version()", dollarPlaceholder, nil, "explain analyze "})
+	clientCertificateFuncs["postgres"] = postgresClientCertificate
+	tlsConfigFuncs["postgres"] = postgresTLSConfig
+	sqlStateFuncs["postgres"] = postgresSQLState
+}
+
+/*
+ * The driver only reads client certificates from files, so writes the
+ * certificate and key to temporary files (readable only by us, as the
+ * driver requires) and points sslcert and sslkey at them. Enables SSL if
+ * the params disabled it.
+ */
+func postgresClientCertificate(cc *ConnectionConfig, cert *clientCertificate) (func(), error) {
+	params, err := url.ParseQuery(firstString(cc.Params, postgresDefaultParams))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	cleanup := func() {
+		for _, name := range files {
+			os.Remove(name)
+		}
+	}
+	for _, f := range []struct {
+		param string
+		data  []byte
+	}{
+		{"sslcert", cert.CertPEM},
+		{"sslkey", cert.KeyPEM},
+	} {
+		file, err := ioutil.TempFile("", "dbbench-"+f.param+"-*.pem")
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		files = append(files, file.Name())
+		_, err = file.Write(f.data)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		params.Set(f.param, file.Name())
+	}
+
+	if mode := params.Get("sslmode"); mode == "" || mode == "disable" {
+		params.Set("sslmode", "require")
+	}
+	cc.Params = params.Encode()
+	return cleanup, nil
+}
+
+/*
+ * The modes of -tls-mode are those of sslmode, and the driver reads the
+ * certificates from files, so sets the params to them.
+ */
+func postgresTLSConfig(cc *ConnectionConfig) (func(), error) {
+	params, err := url.ParseQuery(firstString(cc.Params, postgresDefaultParams))
+	if err != nil {
+		return nil, err
+	}
+	params.Set("sslmode", cc.TLSMode)
+	if cc.TLSCACert != "" {
+		params.Set("sslrootcert", cc.TLSCACert)
+	}
+	if cc.TLSClientCert != "" {
+		params.Set("sslcert", cc.TLSClientCert)
+		params.Set("sslkey", cc.TLSClientKey)
+	}
+	cc.Params = params.Encode()
+	return func() {}, nil
+}
+
+/*
+ * The SQLSTATE of a Postgres error, which is its code.
+ */
+func postgresSQLState(e error) (string, bool) {
+	err, ok := e.(*pq.Error)
+	if !ok {
+		return "", false
+	}
+	return string(err.Code), true
+}
+
+func postgresErrorCodeParser(e error) (string, error) {
+	err, ok := e.(*pq.Error)
+	if !ok {
+		return "", fmt.Errorf("Unrecognized Postgres error: %v", e)
+	}
+	// err.Code is a pq.ErrorCode type, which is just an alias of string:
+	// https://github.com/lib/pq/blob/cb2b4276bb62435f140cb330f14dea6feeccfe71/error.go#L46
+	return string(err.Code), nil
+}
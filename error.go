@@ -17,9 +17,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Go's map can only handle comparable types as a key. We can't be sure that an error thrown by any possible database
@@ -30,6 +33,9 @@ type errorCounts struct {
 	errorsPerQuery
 
 	Error error
+	// The number of errors with each normalized message (see
+	// normalizeErrorMessage), since errors with the same code may differ.
+	messages map[string]uint64
 }
 
 type errorsPerQuery map[string]uint64 // query -> count
@@ -44,17 +50,102 @@ func (ec ErrorCounts) String() string {
 }
 
 func (ec ErrorCounts) Add(err error, query string, df DatabaseFlavor) error {
-	code, e := df.ErrorCode(err)
-	if e != nil {
+	var code string
+	if _, ok := err.(*queryTimeoutError); ok {
+		code = timeoutErrorCode
+	} else if c, e := df.ErrorCode(err); e != nil {
 		return e
+	} else {
+		code = c
 	}
 	if _, ok := ec[code]; !ok {
-		ec[code] = errorCounts{make(errorsPerQuery), err}
+		ec[code] = errorCounts{make(errorsPerQuery), err, make(map[string]uint64)}
 	}
 	ec[code].Add(query)
+	ec[code].messages[normalizeErrorMessage(code, err.Error())]++
 	return nil
 }
 
+// The volatile bits of error messages: parenthesized SQLSTATEs (kept),
+// UUIDs, hexadecimal and decimal numbers.
+var volatileErrorPattern = regexp.MustCompile(
+	`\([0-9A-Z]{5}\)|\b[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\b|\b0x[0-9a-fA-F]+\b|\b\d+(?:\.\d+)?\b`)
+
+/*
+ * Replaces the volatile bits of an error message, like row counts, IDs or
+ * duplicate keys, with N so that similar errors group together, keeping
+ * the error code and SQLSTATE. Whitespace is collapsed, since some
+ * messages span several lines.
+ */
+func normalizeErrorMessage(code, message string) string {
+	message = volatileErrorPattern.ReplaceAllStringFunc(message, func(s string) string {
+		if s == code || strings.HasPrefix(s, "(") {
+			return s
+		}
+		return "N"
+	})
+	return strings.Join(strings.Fields(message), " ")
+}
+
+/*
+ * Adds the number of errors with each normalized message to counts.
+ */
+func (ec ErrorCounts) addMessages(counts map[string]uint64) {
+	for _, ecc := range ec {
+		for message, count := range ecc.messages {
+			counts[message] += count
+		}
+	}
+}
+
+/*
+ * The code of the errors injected by fail-fraction, which are counted apart
+ * from the errors returned by the database.
+ */
+const injectedErrorCode = "injected"
+
+var errInjected = errors.New("error injected by fail-fraction")
+
+/*
+ * The code of the queries abandoned after the query-timeout of their job,
+ * or cancelled because the job stopped, which are counted apart from the
+ * errors returned by the database.
+ */
+const timeoutErrorCode = "timeout"
+
+type queryTimeoutError struct {
+	timeout time.Duration
+	// Whether the query was cancelled because the job stopped, before
+	// its timeout.
+	stopped bool
+}
+
+func (e *queryTimeoutError) Error() string {
+	if e.stopped {
+		return "query cancelled as the job stopped"
+	}
+	return fmt.Sprintf("query timed out after %v", e.timeout)
+}
+
+// The errors reported by dbbench itself, which are never unexpected.
+var dbbenchErrorCodes = Set{injectedErrorCode: struct{}{}, timeoutErrorCode: struct{}{}}
+
+func (ec ErrorCounts) AddInjected(query string) {
+	if _, ok := ec[injectedErrorCode]; !ok {
+		ec[injectedErrorCode] = errorCounts{make(errorsPerQuery), errInjected, make(map[string]uint64)}
+	}
+	ec[injectedErrorCode].Add(query)
+	ec[injectedErrorCode].messages[errInjected.Error()]++
+}
+
+func (ec ErrorCounts) TotalInjected() uint64 {
+	return ec[injectedErrorCode].Total()
+}
+
+func (ec ErrorCounts) TotalTimeouts() uint64 {
+	return ec[timeoutErrorCode].Total()
+}
+
 func (ec ErrorCounts) TotalErrors() (total uint64) {
 	for _, ecc := range ec {
 		total += ecc.Total()
@@ -64,24 +155,77 @@ func (ec ErrorCounts) TotalErrors() (total uint64) {
 
 func (ec ErrorCounts) TotalAccepted(df DatabaseFlavor, errors Set) (total uint64) {
 	for errCode, ecc := range ec {
-		if errors.Contains(errCode) {
+		if errorSetContains(errors, df, errCode, ecc.Error) {
 			total += ecc.Total()
 		}
 	}
 	return
 }
 
-// Return a new ErrorCounts that contains just the subset of unhandled errors
-func (ec ErrorCounts) UnhandledErrors(df DatabaseFlavor, errors Set) (newEc ErrorCounts) {
+// Return a new ErrorCounts that contains just the subset of errors not
+// contained in any of the given sets.
+func (ec ErrorCounts) UnhandledErrors(df DatabaseFlavor, errorSets ...Set) (newEc ErrorCounts) {
 	newEc = make(ErrorCounts)
 	for errCode, ecc := range ec {
-		if !errors.Contains(errCode) {
+		handled := false
+		for _, errors := range errorSets {
+			if errorSetContains(errors, df, errCode, ecc.Error) {
+				handled = true
+				break
+			}
+		}
+		if !handled {
 			newEc[errCode] = ecc
 		}
 	}
 	return
 }
 
+// The prefix of the accepted (or tolerated) errors given by SQLSTATE
+// rather than by the error code of the flavor.
+const sqlStatePrefix = "sqlstate:"
+
+/*
+ * Returns the SQLSTATE of an error returned by the driver of a flavor, and
+ * whether it is known. Registered by the flavors that support it.
+ */
+type sqlStateFunc func(err error) (string, bool)
+
+var sqlStateFuncs = make(map[string]sqlStateFunc)
+
+/*
+ * Whether the set contains the errors with the code, either by their code
+ * or, for the entries prefixed with "sqlstate:", by the SQLSTATE of err.
+ */
+func errorSetContains(errors Set, df DatabaseFlavor, code string, err error) bool {
+	if errors.Contains(code) {
+		return true
+	}
+	if sqlState, ok := sqlStateFuncs[flavorName(df)]; ok {
+		if state, ok := sqlState(err); ok {
+			return errors.Contains(sqlStatePrefix + state)
+		}
+	}
+	return false
+}
+
+/*
+ * Checks an accepted (or tolerated) error given by SQLSTATE, which must be
+ * five digits or upper case letters, for a flavor that supports it.
+ */
+func checkSQLStateError(df DatabaseFlavor, e string) error {
+	state := strings.TrimPrefix(e, sqlStatePrefix)
+	if len(state) != 5 || strings.IndexFunc(state, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z')
+	}) >= 0 {
+		return fmt.Errorf("invalid SQLSTATE %q, must be 5 digits or upper case letters", state)
+	}
+	if _, ok := sqlStateFuncs[flavorName(df)]; !ok {
+		return fmt.Errorf("errors cannot be given by SQLSTATE with the %s driver", flavorName(df))
+	}
+	return nil
+}
+
 func (epq errorsPerQuery) String() string {
 	var str strings.Builder
 
@@ -0,0 +1,30 @@
+//go:build mssql || !(mysql || postgres || mssql || vertica)
+// +build mssql !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMSSQLSQLStateErrors(t *testing.T) {
+	if err := checkSQLStateError(supportedDatabaseFlavors["mssql"], "sqlstate:40001"); err == nil {
+		t.Error("Expected SQLSTATE errors to be unsupported with mssql")
+	}
+}
@@ -0,0 +1,43 @@
+//go:build mysql || !(mysql || postgres || mssql || vertica)
+// +build mysql !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMySQLSQLStateErrors(t *testing.T) {
+	df := supportedDatabaseFlavors["mysql"]
+	testSQLStateError(t, df, &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, "1213", "40001")
+	testSQLStateError(t, df, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, "1062", "23000")
+
+	// The injected errors have no SQLSTATE.
+	ec := make(ErrorCounts)
+	ec.AddInjected("q")
+	if n := ec.TotalAccepted(df, Set{sqlStatePrefix + "HY000": struct{}{}}); n != 0 {
+		t.Errorf("Expected injected errors not to be accepted by SQLSTATE but got %d", n)
+	}
+	if _, ok := mySQLSQLState(errors.New("not a MySQL error")); ok {
+		t.Error("Expected an error that is not a MySQLError to have no SQLSTATE")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build postgres || !(mysql || postgres || mssql || vertica)
+// +build postgres !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestPostgresSQLStateErrors(t *testing.T) {
+	testSQLStateError(t, supportedDatabaseFlavors["postgres"], &pq.Error{Code: "23505"}, "23505", "23505")
+}
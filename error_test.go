@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+ * Checks that the error is counted under its code and is accepted by its
+ * SQLSTATE (and still by its code).
+ */
+func testSQLStateError(t *testing.T, df DatabaseFlavor, err error, code, state string) {
+	ec := make(ErrorCounts)
+	if err := ec.Add(err, "q", df); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ec[code]; !ok {
+		t.Errorf("Expected error code %s but got %v", code, ec)
+	}
+	if err := checkSQLStateError(df, sqlStatePrefix+state); err != nil {
+		t.Error(err)
+	}
+
+	accepted := Set{sqlStatePrefix + state: struct{}{}}
+	if n := ec.TotalAccepted(df, accepted); n != 1 {
+		t.Errorf("Expected sqlstate:%s to accept %v but got %d", state, err, n)
+	}
+	if n := ec.TotalAccepted(df, Set{sqlStatePrefix + "42000": struct{}{}}); n != 0 {
+		t.Errorf("Expected sqlstate:42000 not to accept %v", err)
+	}
+	if unhandled := ec.UnhandledErrors(df, accepted); len(unhandled) != 0 {
+		t.Errorf("Expected %v to be handled but got %v", err, unhandled)
+	}
+	// Codes are still matched as before.
+	if n := ec.TotalAccepted(df, Set{code: struct{}{}}); n != 1 {
+		t.Errorf("Expected %s to accept %v but got %d", code, err, n)
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	for _, c := range []struct {
+		code, message, expected string
+	}{
+		{"1062", "Error 1062 (23000): Duplicate entry '42' for key 'PRIMARY'",
+			"Error 1062 (23000): Duplicate entry 'N' for key 'PRIMARY'"},
+		{"1205", "Error 1205: Lock wait timeout exceeded; try restarting transaction",
+			"Error 1205: Lock wait timeout exceeded; try restarting transaction"},
+		{"40P01", "pq: deadlock detected\nProcess 123 waits for ShareLock on transaction 4567",
+			"pq: deadlock detected Process N waits for ShareLock on transaction N"},
+		{"0", "no row for id 5f0c3a6e-1b2d-4c3e-8f9a-0b1c2d3e4f5a (0x1f) in t1",
+			"no row for id N (N) in t1"},
+	} {
+		if got := normalizeErrorMessage(c.code, c.message); got != c.expected {
+			t.Errorf("Expected %q to be normalized to %q but got %q", c.message, c.expected, got)
+		}
+	}
+
+	config := &Config{
+		Flavor:         testFlavor(t, "mysql"),
+		AcceptedErrors: Set{"1062": struct{}{}},
+	}
+	var stats JobStats
+	for _, key := range []string{"1", "2", "3"} {
+		ec := make(ErrorCounts)
+		if err := ec.Add(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '" + key + "' for key 'PRIMARY'"}, "q", config.Flavor); err != nil {
+			t.Fatal(err)
+		}
+		stats.Update(config, &JobResult{Name: "test", Errors: ec})
+	}
+	ec := make(ErrorCounts)
+	ec.AddInjected("q")
+	stats.Update(config, &JobResult{Name: "test", Errors: ec})
+
+	expected := map[string]uint64{
+		normalizeErrorMessage("1062", (&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}).Error()): 3,
+		errInjected.Error(): 1,
+	}
+	if !reflect.DeepEqual(stats.ErrorMessages, expected) {
+		t.Errorf("Expected the error messages %v but got %v", expected, stats.ErrorMessages)
+	}
+	if summary := getJobsSummary(map[string]*JobStats{"test": &stats})["test"]; !reflect.DeepEqual(summary.ErrorMessages, expected) {
+		t.Errorf("Expected the error messages %v in the summary but got %v", expected, summary.ErrorMessages)
+	}
+}
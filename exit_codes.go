@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+/*
+ * The exit codes of dbbench, so that scripts can tell why it failed. Any
+ * other failure (e.g. an unexpected error while running the test) exits
+ * with exitRuntimeError, as log.Fatal does.
+ */
+const (
+	exitRuntimeError = 1
+	// An invalid flag or config file; the flag package exits with 2 too.
+	exitConfigError     = 2
+	exitConnectionError = 3
+	// The test ran, but a job had assertion errors or failed its probe.
+	exitAssertionFailure = 4
+	// -compare found a job that regressed by more than -threshold.
+	exitRegression = 5
+)
+
+/*
+ * Like log.Fatal, but exits with the given code.
+ */
+func fatalExit(code int, v ...interface{}) {
+	log.Print(v...)
+	os.Exit(code)
+}
+
+/*
+ * Like log.Fatalf, but exits with the given code.
+ */
+func fatalfExit(code int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	os.Exit(code)
+}
+
+/*
+ * Describes each job of the summaries (of every iteration) that had
+ * assertion errors (see success-expr, fail-zero-rows-affected and
+ * verify-idempotent) or failed its probe.
+ */
+func failedAssertions(summaries []map[string]*JobStatsSummary) []string {
+	var failed []string
+	for i, iteration := range summaries {
+		names := make([]string, 0, len(iteration))
+		for name := range iteration {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			s := iteration[name]
+			label := name
+			if len(summaries) > 1 {
+				label = fmt.Sprintf("%s (iteration %d)", name, i+1)
+			}
+			if s.AssertionErrors > 0 {
+				failed = append(failed, fmt.Sprintf("%s had %d assertion errors", label, s.AssertionErrors))
+			}
+			if s.Probe != nil && !s.Probe.Passed {
+				failed = append(failed, fmt.Sprintf("%s failed its probe", label))
+			}
+		}
+	}
+	return failed
+}
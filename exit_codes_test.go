@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Set to the args (one per line) to run main with, in a test binary
+// run by TestExitCodes.
+const exitCodesArgsEnv = "DBBENCH_TEST_MAIN_ARGS"
+
+func TestExitCodes(t *testing.T) {
+	if args, ok := os.LookupEnv(exitCodesArgsEnv); ok {
+		os.Args = append([]string{"dbbench"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	writeConfig := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	good := writeConfig("good.ini", "[job]\nquery=select 1\ncount=5\n")
+	assertion := writeConfig("assertion.ini", "[job]\nquery=select 1\ncount=5\nsuccess-expr=rows > 1\n")
+	bad := writeConfig("bad.ini", "[job]\nquery=select 1\nfail-fraction=1.5\n")
+	before := writeConfig("before.json", `{"job": {"queriesPerSecond": 100}}`)
+	after := writeConfig("after.json", `{"job": {"queriesPerSecond": 50}}`)
+
+	// Any compiled in driver fails to connect to a closed port.
+	var driver string
+	for _, name := range []string{"mysql", "postgres", "mssql", "vertica"} {
+		if _, ok := supportedDatabaseFlavors[name]; ok {
+			driver = name
+			break
+		}
+	}
+
+	for _, c := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"success", []string{"-driver=mock", good}, 0},
+		{"runtime error", []string{"-driver=mock", "-params=error-rate=1", good}, exitRuntimeError},
+		{"invalid config", []string{"-driver=mock", bad}, exitConfigError},
+		{"missing config", []string{"-driver=mock", filepath.Join(dir, "missing.ini")}, exitConfigError},
+		{"invalid flag", []string{"-driver=mock", "-repeat=0", good}, exitConfigError},
+		{"connection failure", []string{"-driver=" + driver, "-host=127.0.0.1", "-port=1", good}, exitConnectionError},
+		{"assertion failure", []string{"-driver=mock", assertion}, exitAssertionFailure},
+		{"no regression", []string{"-compare", before, before}, 0},
+		{"regression", []string{"-compare", before, after}, exitRegression},
+		{"compare without a current run", []string{"-compare", before}, exitConfigError},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestExitCodes$")
+		cmd.Env = append(os.Environ(), exitCodesArgsEnv+"="+strings.Join(c.args, "\n"))
+		out, err := cmd.CombinedOutput()
+		code := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if code != c.code {
+			t.Errorf("%s: expected exit code %d but got %d:\n%s", c.name, c.code, code, out)
+		}
+	}
+}
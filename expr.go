@@ -0,0 +1,498 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * A small expression language used in config values, e.g.
+ *
+ *     rows > 0 && col0 == 'ok'
+ *     100 * NCPU
+ *
+ * Values are numbers (float64), strings, booleans or null (nil). Strings
+ * that look like numbers compare numerically with numbers, since values
+ * read from the database are always strings.
+ */
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+/*
+ * Resolves the value of a variable in an expression. Returns false if the
+ * variable is not defined.
+ */
+type ExprVars func(name string) (interface{}, bool)
+
+type exprNode interface {
+	eval(vars ExprVars) (interface{}, error)
+}
+
+func ParseExpr(s string) (*Expr, error) {
+	p := new(exprParser)
+	if err := p.tokenize(s); err != nil {
+		return nil, err
+	}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s in expression", strconv.Quote(p.tokens[p.pos].text))
+	}
+	return &Expr{s, root}, nil
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+func (e *Expr) Eval(vars ExprVars) (interface{}, error) {
+	return e.root.eval(vars)
+}
+
+func (e *Expr) EvalBool(vars ExprVars) (bool, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %s is not a boolean", strconv.Quote(e.source))
+	}
+	return b, nil
+}
+
+func (e *Expr) EvalNumber(vars ExprVars) (float64, error) {
+	v, err := e.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := exprNumber(v)
+	if !ok {
+		return 0, fmt.Errorf("expression %s is not a number", strconv.Quote(e.source))
+	}
+	return f, nil
+}
+
+/*
+ * The names of all variables referenced by the expression.
+ */
+func (e *Expr) Vars() []string {
+	var vars []string
+	var walk func(n exprNode)
+	walk = func(n exprNode) {
+		switch n := n.(type) {
+		case exprVar:
+			vars = append(vars, string(n))
+		case exprUnary:
+			walk(n.operand)
+		case exprBinary:
+			walk(n.left)
+			walk(n.right)
+		}
+	}
+	walk(e.root)
+	return vars
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (n exprLiteral) eval(ExprVars) (interface{}, error) {
+	return n.value, nil
+}
+
+type exprVar string
+
+func (n exprVar) eval(vars ExprVars) (interface{}, error) {
+	if vars != nil {
+		if v, ok := vars(string(n)); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("undefined variable %s", string(n))
+}
+
+type exprUnary struct {
+	op      string
+	operand exprNode
+}
+
+func (n exprUnary) eval(vars ExprVars) (interface{}, error) {
+	v, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("operand of ! is not a boolean")
+		}
+		return !b, nil
+	default: // "-"
+		f, ok := exprNumber(v)
+		if !ok {
+			return nil, errors.New("operand of - is not a number")
+		}
+		return -f, nil
+	}
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (n exprBinary) eval(vars ExprVars) (interface{}, error) {
+	l, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuit boolean operators.
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("left operand of %s is not a boolean", n.op)
+		}
+		if lb == (n.op == "||") {
+			return lb, nil
+		}
+		r, err := n.right.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("right operand of %s is not a boolean", n.op)
+		}
+		return rb, nil
+	}
+
+	r, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "!=":
+		eq := exprEqual(l, r)
+		return eq == (n.op == "=="), nil
+	case "<", "<=", ">", ">=":
+		c, err := exprCompare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	}
+
+	lf, lok := exprNumber(l)
+	rf, rok := exprNumber(r)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operands of %s are not numbers", n.op)
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		return lf / rf, nil
+	default: // "%"
+		return math.Mod(lf, rf), nil
+	}
+}
+
+func exprNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func exprEqual(l, r interface{}) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	if lf, ok := exprNumber(l); ok {
+		if rf, ok := exprNumber(r); ok {
+			return lf == rf
+		}
+	}
+	return fmt.Sprint(l) == fmt.Sprint(r)
+}
+
+func exprCompare(l, r interface{}) (int, error) {
+	if l == nil || r == nil {
+		return 0, errors.New("cannot compare null values")
+	}
+	if lf, ok := exprNumber(l); ok {
+		if rf, ok := exprNumber(r); ok {
+			switch {
+			case lf < rf:
+				return -1, nil
+			case lf > rf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if !lok || !rok {
+		return 0, fmt.Errorf("cannot compare %v and %v", l, r)
+	}
+	return strings.Compare(ls, rs), nil
+}
+
+type exprTokenKind int
+
+const (
+	exprTokenNumber exprTokenKind = iota
+	exprTokenString
+	exprTokenIdent
+	exprTokenOp
+)
+
+type exprToken struct {
+	kind  exprTokenKind
+	text  string
+	value interface{}
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// Longer operators must come first.
+var exprOperators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")",
+}
+
+var exprKeywordOperators = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+}
+
+func (p *exprParser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' ||
+				s[j] == 'e' || s[j] == 'E') {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %s", strconv.Quote(s[i:j]))
+			}
+			p.tokens = append(p.tokens, exprToken{exprTokenNumber, s[i:j], f})
+			i = j
+		case c == '\'' || c == '"':
+			j := strings.IndexRune(s[i+1:], c)
+			if j < 0 {
+				return errors.New("unterminated string in expression")
+			}
+			str := s[i+1 : i+1+j]
+			p.tokens = append(p.tokens, exprToken{exprTokenString, s[i : i+j+2], str})
+			i += j + 2
+		case c == '_' || c == '$' || unicode.IsLetter(c):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) ||
+				unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			word := s[i:j]
+			if op, ok := exprKeywordOperators[strings.ToLower(word)]; ok {
+				p.tokens = append(p.tokens, exprToken{exprTokenOp, op, nil})
+			} else {
+				p.tokens = append(p.tokens, exprToken{exprTokenIdent, word, nil})
+			}
+			i = j
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, exprToken{exprTokenOp, op, nil})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected character %s in expression",
+					strconv.QuoteRune(c))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != exprTokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.tokens[p.pos].text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseBinary(next func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{op, left, right}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary(p.parseNot, "&&")
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if _, ok := p.acceptOp("!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{"!", operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.acceptOp("==", "!=", "<=", ">=", "<", ">"); ok {
+		right, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		return exprBinary{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	return p.parseBinary(p.parseProduct, "+", "-")
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if _, ok := p.acceptOp("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{"-", operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+
+	switch t.kind {
+	case exprTokenNumber, exprTokenString:
+		return exprLiteral{t.value}, nil
+	case exprTokenIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return exprLiteral{true}, nil
+		case "false":
+			return exprLiteral{false}, nil
+		case "null":
+			return exprLiteral{nil}, nil
+		}
+		return exprVar(t.text), nil
+	}
+
+	if t.text == "(" {
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.acceptOp(")"); !ok {
+			return nil, errors.New("missing ) in expression")
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unexpected %s in expression", strconv.Quote(t.text))
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := successExprVars(3, []sql.NullString{
+		{String: "1", Valid: true},
+		{String: "1.0", Valid: true},
+		{String: "ok", Valid: true},
+		{},
+	})
+
+	var cases = []struct {
+		in  string
+		out interface{}
+	}{
+		{"rows > 0", true},
+		{"rows == 3 && col0 == col1", true},
+		{"col2 == 'ok'", true},
+		{"col2 != \"ok\" or rows < 3", false},
+		{"not (rows >= 3)", false},
+		{"col3 == null", true},
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3 % 4", 1.0},
+		{"-rows / 2", -1.5},
+		{"col0 < 'a'", true},
+	}
+
+	for _, c := range cases {
+		e, err := ParseExpr(c.in)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", strconv.Quote(c.in), err)
+			continue
+		}
+		v, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Error evaluating %s: %v", strconv.Quote(c.in), err)
+		} else if !reflect.DeepEqual(v, c.out) {
+			t.Errorf("Failure evaluating %s: got %v but expected %v",
+				strconv.Quote(c.in), v, c.out)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, c := range []string{"", "rows >", "(rows", "rows # 1", "'abc", "1 2"} {
+		if _, err := ParseExpr(c); err == nil {
+			t.Errorf("Unexpected success parsing %s", strconv.Quote(c))
+		}
+	}
+
+	vars := successExprVars(0, nil)
+	for _, c := range []string{"col0 == 1", "rows && true", "null < 1", "foo"} {
+		e, err := ParseExpr(c)
+		if err != nil {
+			t.Errorf("Error parsing %s: %v", strconv.Quote(c), err)
+		} else if _, err := e.EvalBool(vars); err == nil {
+			t.Errorf("Unexpected success evaluating %s", strconv.Quote(c))
+		}
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+)
+
+var fingerprintQueries = flag.Bool("fingerprint-queries", false,
+	"Report the stats of each query (as with -per-query-stats) grouped by "+
+		"fingerprint: the query with its literals replaced by ?, lists of "+
+		"literals collapsed and whitespace normalized, e.g. to group the "+
+		"queries of a query log.")
+
+/*
+ * Returns the fingerprint of the query: the query in lower case with each
+ * string or numeric literal replaced by "?", lists of them (e.g. in an IN
+ * clause) collapsed to "(?+)", runs of whitespace replaced by a single
+ * space and any trailing semicolon removed. Quoted identifiers are kept as
+ * is.
+ */
+func fingerprintQuery(q string) string {
+	var out strings.Builder
+	space := false
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		case c == '\'':
+			// A string literal, in which quotes are escaped by doubling
+			// them or with a backslash.
+			for i++; i < len(q); i++ {
+				if q[i] == '\\' {
+					i++
+				} else if q[i] == '\'' {
+					if i+1 < len(q) && q[i+1] == '\'' {
+						i++
+					} else {
+						break
+					}
+				}
+			}
+			c = '?'
+		case c == '"' || c == '`':
+			// A quoted identifier.
+			j := i + 1
+			for j < len(q) && q[j] != c {
+				j++
+			}
+			if j < len(q) {
+				j++
+			}
+			if space && out.Len() > 0 {
+				out.WriteByte(' ')
+			}
+			space = false
+			out.WriteString(q[i:j])
+			i = j - 1
+			continue
+		case c >= '0' && c <= '9' && (i == 0 || !isSQLIdentifierByte(q[i-1], false) && q[i-1] != '$'):
+			// A number, including decimals, exponents and hex literals.
+			for i+1 < len(q) && (isSQLIdentifierByte(q[i+1], false) || q[i+1] == '.' ||
+				((q[i+1] == '+' || q[i+1] == '-') && (q[i] == 'e' || q[i] == 'E'))) {
+				i++
+			}
+			c = '?'
+		case c >= 'A' && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		if space && out.Len() > 0 {
+			out.WriteByte(' ')
+		}
+		space = false
+		out.WriteByte(c)
+	}
+	q = strings.TrimSpace(strings.TrimSuffix(out.String(), ";"))
+	return literalList.ReplaceAllString(q, "(?+)")
+}
+
+// A list of two or more literals, once whitespace is normalized.
+var literalList = regexp.MustCompile(`\(\?(?: ?, ?\?)+\)`)
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "testing"
+
+func TestFingerprintQuery(t *testing.T) {
+	for _, c := range []struct {
+		query, fingerprint string
+	}{
+		{"select * from t where id = 5", "select * from t where id = ?"},
+		{"SELECT *\n  FROM t\tWHERE id = 6;", "select * from t where id = ?"},
+		{"select 1 ;", "select ?"},
+		{"select * from t1 where a = -1.5e+3 and b = 0x1f", "select * from t1 where a = -? and b = ?"},
+		{"insert into t values ('it''s', 'a\\'b', 'c')", "insert into t values (?+)"},
+		{"select * from t where id in (1, 2,3)", "select * from t where id in (?+)"},
+		{"select * from t where id in (1)", "select * from t where id in (?)"},
+		{"select \"Col 1\", `x2` from t where a = $1", "select \"Col 1\", `x2` from t where a = $1"},
+	} {
+		if f := fingerprintQuery(c.query); f != c.fingerprint {
+			t.Errorf("fingerprint of %q is %q, expected %q", c.query, f, c.fingerprint)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+/*
+ * Like the query-stats-file, the dashboard file is opened when we first
+ * parse the flags (i.e. before we change our base directory).
+ */
+var grafanaDashboardFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&grafanaDashboardFile, "grafana-dashboard",
+		"Write a Grafana dashboard (JSON) with the throughput and latency of "+
+			"each job, as exported to Prometheus by -metrics-addr, to this file.")
+}
+
+// The metrics exported for each job, labeled with the name of the job.
+const (
+	queriesMetric        = "dbbench_queries_total"
+	transactionsMetric   = "dbbench_transactions_total"
+	errorsMetric         = "dbbench_errors_total"
+	acceptedErrorsMetric = "dbbench_accepted_errors_total"
+	latencyMetric        = "dbbench_transaction_latency_seconds"
+	jobLabel             = "dbbench_job"
+	grafanaDatasource    = "${DS_PROMETHEUS}"
+	grafanaSchemaVersion = 27
+	grafanaPanelHeight   = 8
+	grafanaPanelWidth    = 12
+)
+
+// The latency quantiles exported for each job.
+var latencyQuantiles = []float64{0.5, 0.95, 0.99}
+
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaPanel struct {
+	ID          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Datasource  string                 `json:"datasource"`
+	GridPos     grafanaGridPos         `json:"gridPos"`
+	Targets     []grafanaTarget        `json:"targets"`
+	FieldConfig map[string]interface{} `json:"fieldConfig"`
+}
+
+func newGrafanaPanel(id int, title, unit string, targets []grafanaTarget) grafanaPanel {
+	return grafanaPanel{
+		ID:         id,
+		Type:       "timeseries",
+		Title:      title,
+		Datasource: grafanaDatasource,
+		GridPos: grafanaGridPos{
+			H: grafanaPanelHeight, W: grafanaPanelWidth,
+			X: ((id - 1) % 2) * grafanaPanelWidth,
+			Y: ((id - 1) / 2) * grafanaPanelHeight,
+		},
+		Targets: targets,
+		FieldConfig: map[string]interface{}{
+			"defaults":  map[string]interface{}{"unit": unit},
+			"overrides": []interface{}{},
+		},
+	}
+}
+
+/*
+ * Returns a Grafana dashboard, importable with a Prometheus datasource,
+ * with a throughput and a latency panel for each job.
+ */
+func grafanaDashboard(title string, jobNames []string) map[string]interface{} {
+	names := append([]string(nil), jobNames...)
+	sort.Strings(names)
+
+	var panels []grafanaPanel
+	for _, name := range names {
+		selector := fmt.Sprintf("{%s=%s}", jobLabel, strconv.Quote(name))
+		panels = append(panels, newGrafanaPanel(len(panels)+1, name+" throughput", "ops", []grafanaTarget{
+			{fmt.Sprintf("rate(%s%s[1m])", queriesMetric, selector), "queries/s", "A"},
+			{fmt.Sprintf("rate(%s%s[1m])", transactionsMetric, selector), "transactions/s", "B"},
+		}))
+
+		var latencyTargets []grafanaTarget
+		for i, quantile := range latencyQuantiles {
+			latencyTargets = append(latencyTargets, grafanaTarget{
+				fmt.Sprintf("histogram_quantile(%g, sum by (le) (rate(%s_bucket%s[1m])))", quantile, latencyMetric, selector),
+				fmt.Sprintf("p%g", quantile*100), string(rune('A' + i)),
+			})
+		}
+		panels = append(panels, newGrafanaPanel(len(panels)+1, name+" latency", "s", latencyTargets))
+	}
+
+	return map[string]interface{}{
+		"__inputs": []map[string]string{{
+			"name":     "DS_PROMETHEUS",
+			"label":    "Prometheus",
+			"type":     "datasource",
+			"pluginId": "prometheus",
+		}},
+		"title":         title,
+		"schemaVersion": grafanaSchemaVersion,
+		"editable":      true,
+		"refresh":       "5s",
+		"time":          map[string]string{"from": "now-15m", "to": "now"},
+		"panels":        panels,
+	}
+}
+
+func writeGrafanaDashboard(w io.Writer, title string, jobNames []string) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(grafanaDashboard(title, jobNames))
+}
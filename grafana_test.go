@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGrafanaDashboard(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeGrafanaDashboard(&buf, "test", []string{"writes", `say "hi"`}); err != nil {
+		t.Fatalf("Error writing dashboard: %v", err)
+	}
+
+	var dashboard struct {
+		Title  string
+		Panels []struct {
+			ID      int
+			Title   string
+			Targets []struct {
+				Expr         string
+				LegendFormat string
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &dashboard); err != nil {
+		t.Fatalf("Dashboard is not valid JSON: %v", err)
+	}
+
+	if len(dashboard.Panels) != 4 {
+		t.Fatalf("Expected 4 panels but got %d", len(dashboard.Panels))
+	}
+	ids := make(map[int]bool)
+	for _, panel := range dashboard.Panels {
+		if ids[panel.ID] {
+			t.Errorf("Duplicate panel id %d", panel.ID)
+		}
+		ids[panel.ID] = true
+	}
+
+	latency := dashboard.Panels[1]
+	if latency.Title != `say "hi" latency` || len(latency.Targets) != 3 {
+		t.Fatalf("Unexpected latency panel %+v", latency)
+	}
+	if expr := latency.Targets[2].Expr; !strings.Contains(expr, `dbbench_job="say \"hi\""`) ||
+		!strings.HasPrefix(expr, "histogram_quantile(0.99, ") || latency.Targets[2].LegendFormat != "p99" {
+		t.Errorf("Unexpected latency target %+v", latency.Targets[2])
+	}
+}
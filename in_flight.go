@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+)
+
+var saturationWarnAfter = flag.Duration("saturation-warning", 10*time.Second,
+	"Warn when all the workers of a queue-depth job have been busy for this "+
+		"long (0 to disable).")
+
+// How often the number of in-flight invocations of a job is sampled.
+const inFlightSampleInterval = 100 * time.Millisecond
+
+/*
+ * The number of in-flight invocations of a job at the end of an interval,
+ * and the most that were in flight during the interval.
+ */
+type InFlightSample struct {
+	Time     time.Duration `json:"time"`
+	InFlight uint64        `json:"inFlight"`
+	Peak     uint64        `json:"peak"`
+}
+
+/*
+ * Tracks the number of invocations of a job that are in flight (issued but
+ * not completed).
+ */
+type inFlightTracker struct {
+	name  string
+	depth uint64
+	start time.Time
+	// Warn when the utilization of the workers during an interval is under
+	// this percentage (0 to disable).
+	minUtilization float64
+
+	m            sync.Mutex
+	current      uint64
+	peak         uint64
+	intervalPeak uint64
+	series       []InFlightSample
+	samples      uint64
+	full         uint64
+	fullFrom     time.Time
+	warned       bool
+	// The sum of the in-flight samples, overall and during the interval.
+	busy            uint64
+	intervalBusy    uint64
+	intervalSamples uint64
+	lowWarned       bool
+	// The integral of the number of in-flight invocations over time, up to
+	// the last time it changed, and when the job stopped.
+	busyTime time.Duration
+	changed  time.Time
+	stopped  time.Time
+}
+
+/*
+ * Creates a tracker for a job with the given queue depth (0 if unbounded)
+ * that started at the given time, warning when the utilization of the
+ * workers is under minUtilization (a percentage, 0 to disable).
+ */
+func newInFlightTracker(name string, depth uint64, start time.Time, minUtilization float64) *inFlightTracker {
+	return &inFlightTracker{name: name, depth: depth, start: start, minUtilization: minUtilization, changed: start}
+}
+
+func (t *inFlightTracker) Issue() {
+	t.issueAt(time.Now())
+}
+
+func (t *inFlightTracker) Complete() {
+	t.completeAt(time.Now())
+}
+
+// Must be called with the lock held, before the number in flight changes.
+func (t *inFlightTracker) accumulate(now time.Time) {
+	t.busyTime += time.Duration(t.current) * now.Sub(t.changed)
+	t.changed = now
+}
+
+func (t *inFlightTracker) issueAt(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.accumulate(now)
+	t.current++
+	if t.current > t.peak {
+		t.peak = t.current
+	}
+	if t.current > t.intervalPeak {
+		t.intervalPeak = t.current
+	}
+}
+
+func (t *inFlightTracker) completeAt(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.accumulate(now)
+	t.current--
+}
+
+func (t *inFlightTracker) sample(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.samples++
+	t.busy += t.current
+	t.intervalBusy += t.current
+	t.intervalSamples++
+	if t.depth == 0 || t.current < t.depth {
+		t.fullFrom = time.Time{}
+		t.warned = false
+		return
+	}
+
+	t.full++
+	if t.fullFrom.IsZero() {
+		t.fullFrom = now
+	}
+	if busy := now.Sub(t.fullFrom); *saturationWarnAfter > 0 &&
+		busy >= *saturationWarnAfter && !t.warned {
+		log.Printf("%s: all %d workers have been busy for %v, the job is "+
+			"saturated and its latency may not reflect the server",
+			t.name, t.depth, busy.Round(time.Second))
+		t.warned = true
+	}
+}
+
+func (t *inFlightTracker) endInterval(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.series = append(t.series, InFlightSample{now.Sub(t.start), t.current, t.intervalPeak})
+	t.intervalPeak = t.current
+
+	if t.minUtilization > 0 && t.depth > 0 && t.intervalSamples > 0 {
+		utilization := 100 * float64(t.intervalBusy) / float64(t.intervalSamples*t.depth)
+		if utilization >= t.minUtilization {
+			t.lowWarned = false
+		} else if !t.lowWarned {
+			log.Printf("%s: only %.1f%% of the %d workers were busy (under "+
+				"min-utilization %g%%), the job is limited by latency rather "+
+				"than throughput", t.name, utilization, t.depth, t.minUtilization)
+			t.lowWarned = true
+		}
+	}
+	t.intervalBusy = 0
+	t.intervalSamples = 0
+}
+
+/*
+ * Samples the number of in-flight invocations until done is closed,
+ * recording a point in the in-flight series every interval.
+ */
+func (t *inFlightTracker) run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(inFlightSampleInterval)
+	defer ticker.Stop()
+
+	intervalTicker := time.NewTicker(interval)
+	defer intervalTicker.Stop()
+
+	for {
+		select {
+		case <-done:
+			now := time.Now()
+			t.endInterval(now)
+			t.stop(now)
+			return
+		case now := <-ticker.C:
+			t.sample(now)
+		case now := <-intervalTicker.C:
+			t.endInterval(now)
+		}
+	}
+}
+
+func (t *inFlightTracker) stop(now time.Time) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.stopped = now
+}
+
+func (t *inFlightTracker) Peak() uint64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return t.peak
+}
+
+func (t *inFlightTracker) Series() []InFlightSample {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return append([]InFlightSample(nil), t.series...)
+}
+
+/*
+ * The percentage of samples in which every worker was busy.
+ */
+func (t *inFlightTracker) Saturation() float64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.samples == 0 {
+		return 0
+	}
+	return 100 * float64(t.full) / float64(t.samples)
+}
+
+/*
+ * The average percentage of the workers that were busy.
+ */
+func (t *inFlightTracker) Utilization() float64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.samples == 0 || t.depth == 0 {
+		return 0
+	}
+	return 100 * float64(t.busy) / float64(t.samples*t.depth)
+}
+
+/*
+ * The average number of invocations in flight from the start of the job
+ * until it stopped (or now, if it is running): the total time spent in
+ * invocations over the wall time of the job.
+ */
+func (t *inFlightTracker) EffectiveParallelism() float64 {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	end := t.stopped
+	if end.IsZero() {
+		end = time.Now()
+	}
+	wall := end.Sub(t.start)
+	if wall <= 0 {
+		return 0
+	}
+	busy := t.busyTime + time.Duration(t.current)*end.Sub(t.changed)
+	return busy.Seconds() / wall.Seconds()
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInFlightSaturation(t *testing.T) {
+	now := time.Now()
+	tracker := newInFlightTracker("test", 2, now, 0)
+
+	tracker.Issue()
+	tracker.sample(now)
+	tracker.Issue()
+	tracker.sample(now.Add(time.Second))
+	tracker.sample(now.Add(2 * time.Second))
+	tracker.Complete()
+	tracker.sample(now.Add(3 * time.Second))
+
+	if saturation := tracker.Saturation(); saturation != 50 {
+		t.Errorf("Expected 50%% saturation but got %v", saturation)
+	}
+	if utilization := tracker.Utilization(); utilization != 75 {
+		t.Errorf("Expected 75%% utilization but got %v", utilization)
+	}
+}
+
+func TestInFlightMinUtilization(t *testing.T) {
+	now := time.Now()
+	tracker := newInFlightTracker("test", 2, now, 80)
+
+	tracker.Issue()
+	tracker.sample(now)
+	tracker.sample(now)
+	tracker.endInterval(now.Add(time.Second))
+	if !tracker.lowWarned {
+		t.Errorf("Expected a warning for 50%% utilization")
+	}
+
+	tracker.Issue()
+	tracker.sample(now.Add(time.Second))
+	tracker.endInterval(now.Add(2 * time.Second))
+	if tracker.lowWarned {
+		t.Errorf("Expected no warning for 100%% utilization")
+	}
+}
+
+func TestInFlightSeries(t *testing.T) {
+	now := time.Now()
+	tracker := newInFlightTracker("test", 0, now, 0)
+
+	tracker.Issue()
+	tracker.Issue()
+	tracker.Complete()
+	tracker.endInterval(now.Add(time.Second))
+	tracker.Complete()
+	tracker.endInterval(now.Add(2 * time.Second))
+
+	expected := []InFlightSample{{time.Second, 1, 2}, {2 * time.Second, 0, 1}}
+	if series := tracker.Series(); !reflect.DeepEqual(series, expected) {
+		t.Errorf("Expected series %v but got %v", expected, series)
+	}
+	if peak := tracker.Peak(); peak != 2 {
+		t.Errorf("Expected peak of 2 but got %v", peak)
+	}
+}
+
+func TestInFlightEffectiveParallelism(t *testing.T) {
+	now := time.Now()
+	tracker := newInFlightTracker("test", 4, now, 0)
+
+	// Two invocations for the first second, then one for the next, out of
+	// four seconds.
+	tracker.issueAt(now)
+	tracker.issueAt(now)
+	tracker.completeAt(now.Add(time.Second))
+	tracker.completeAt(now.Add(2 * time.Second))
+	tracker.stop(now.Add(4 * time.Second))
+
+	if parallelism := tracker.EffectiveParallelism(); parallelism != 0.75 {
+		t.Errorf("Expected an effective parallelism of 0.75 but got %v", parallelism)
+	}
+}
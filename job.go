@@ -17,25 +17,60 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"database/sql"
+	"encoding/binary"
 	"encoding/csv"
+	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type queryInvocation struct {
 	query string
 	args  []interface{}
+	// The query-template the query was expanded from, if any.
+	template string
+}
+
+/*
+ * The query the invocation is reported as: its template, if it has one.
+ */
+func (qi *queryInvocation) label() string {
+	if qi.template != "" {
+		return qi.template
+	}
+	return qi.query
 }
 
 type jobInvocation struct {
 	name    string
 	queries []queryInvocation
+	// Whether the invocation is part of the warmup of the job, and so
+	// excluded from the stats.
+	warmup bool
+	// How long the worker waits after the invocation before the next one.
+	thinkTime time.Duration
+	// Whether to report an injected error instead of running the queries.
+	injectError bool
+	// Whether to write the latency of the invocation to the latency log.
+	logLatency bool
+	// The index of the phase the invocation was made in, if the job has
+	// phases.
+	phase int
+	// The shard of the key of the invocation, if the job has shards.
+	shard int
 }
 
 type Job struct {
@@ -46,47 +81,730 @@ type Job struct {
 	Rate       float64
 	Count      uint64
 	BatchSize  uint64
+	// If set, the size of each batch is drawn from [BatchSize, MaxBatchSize].
+	MaxBatchSize uint64
+
+	AdaptiveRate *AdaptiveRate
+
+	// Run at WarmupRate for WarmupDuration before running at Rate, without
+	// counting the results of the warmup.
+	WarmupRate     float64
+	WarmupDuration time.Duration
+
+	// Stop the job this long after it starts running (i.e. after its
+	// Start, dependencies and probe), even if it has not run Count times
+	// yet.
+	Timeout time.Duration
+	// Only set once the job has been stopped by its Timeout.
+	TimedOut bool
+
+	// Linearly increase the rate from zero to Rate over this long after
+	// the job starts.
+	RampUp time.Duration
+
+	// Linearly reduce the rate to zero over this long before Stop.
+	RampDown time.Duration
+	// Only set once the job has started ramping down.
+	RampedDown bool
+
+	// Stop the job once it has written an estimated this many bytes.
+	MaxWriteBytes int64
+	// Shared by all the jobs of the test when max-write-bytes is global;
+	// set when the test runs.
+	TestWriteBudget *WriteBudget
+
+	QueryLog       io.ReadCloser
+	QueryLogFormat string
+	QueryArgs      *csv.Reader
+	// Where the QueryArgs are read from and whether they start with a
+	// header, so that each iteration of -repeat reads them from the start.
+	queryArgsSource io.ReadSeeker
+	queryArgsHeader bool
+	// If the query args have a header, the columns of the args bound to
+	// the placeholders of each query, in order.
+	QueryArgColumns [][]int
+
+	// If Shards is set, the latency of each invocation is also bucketed by
+	// the hash of the ShardKeyColumn of its args modulo Shards.
+	ShardKeyColumn int
+	Shards         int
+
+	// Inclusive upper bounds of the row counts by which the latency of
+	// the job is bucketed.
+	RowCountBuckets []int64
+
+	// After each invocation of a queue-depth job, the worker waits for a
+	// think time drawn from these.
+	ThinkTimes []time.Duration
+	// Or for ThinkTime, plus or minus up to ThinkTimeJitter (uniformly).
+	ThinkTime       time.Duration
+	ThinkTimeJitter time.Duration
+
+	// Warn when less than this percentage of the workers of a queue-depth
+	// job are busy during an interval.
+	MinUtilization float64
+
+	// Run the queries of each invocation in a random order.
+	ShuffleQueries bool
+
+	// Instead of running queries, each invocation opens, pings and closes
+	// a new connection.
+	ConnectOnly bool
+
+	// Each invocation opens a new connection (outside of the pool), runs
+	// its queries on it and closes it.
+	ConnectionPerQuery bool
+
+	// Each invocation runs its queries, in order, in a transaction on one
+	// connection, which is rolled back if a query fails.
+	Transaction bool
+
+	// If set, the seed of the Rand of the job instead of one derived from
+	// -seed.
+	Seed int64
+
+	// Each query is a text/template, expanded before each execution.
+	QueryTemplate  bool
+	queryTemplates []*queryTemplate
+
+	// Each query is abandoned (and counted as a timeout) once it has run
+	// for this long.
+	QueryTimeout time.Duration
 
-	QueryLog     io.ReadCloser
-	QueryArgs    *csv.Reader
+	// Each query is prepared once, and its invocations execute the
+	// prepared statement.
+	Prepared bool
+	// The prepared statements by query; only set once the job has started
+	// running.
+	statements   map[string]PreparedStatement
+	statementsMu sync.Mutex
+
+	// Variants of the query of the job, of which iteration i of the test
+	// (see -repeat) runs variant i modulo their number.
+	IterationQueries []string
+	// The variant (from 1) of the current iteration, if the job has any.
+	IterationVariant int
+
+	// If set, each invocation runs a single query, picked with the weights
+	// of the phase the test is in.
+	Phases []Phase
+	// If set, each invocation runs a single query, picked with these
+	// weights (one per query) throughout the job.
+	QueryWeights []float64
+	// When the test started; only set once the job is running.
+	Started time.Time
+
+	// Run each query twice and count differing results as assertion
+	// errors.
+	VerifyIdempotent bool
+
+	// Run the queries under the EXPLAIN ANALYZE of the flavor, and sample
+	// the plans it returns.
+	ExplainAnalyze bool
+
+	// Also measure how long the server spent executing the queries, if
+	// the database supports it. Set to 1 once we found it does not.
+	ServerExecTime            bool
+	ServerExecTimeUnsupported int32
+
+	// With -watch-config, receives the new rate of a job with a fixed rate.
+	RateChanges chan float64
+
+	// Advisory; the invocations of jobs with a higher priority are
+	// dispatched first when the Scheduler is contended.
+	Priority  int
+	Scheduler *PriorityScheduler
+	// Shared by all jobs if there is a max-total-concurrency.
+	TotalConcurrency *ConcurrencyLimit
+	// Only set once the job has started running.
+	Rand         *rand.Rand
 	QueryResults *SafeCSVWriter
+	// The latency of (the given fraction of) each execution is written to
+	// the LatencyLog.
+	LatencyLog         *SafeCSVWriter
+	LatencyLogSampling float64
+
+	// Evaluated against the result of each query; if false, the query
+	// counts as an assertion error.
+	SuccessExpr *Expr
+	// Count writes that affect no rows as assertion errors.
+	FailZeroRowsAffected bool
+	// Count (and warn once about) the queries that return rows but
+	// returned none.
+	WarnEmptyResults bool
+	// Set once the warning about an empty result was logged.
+	emptyResultWarned int32
+	// The fraction of invocations that report an injected error instead of
+	// running their queries.
+	FailFraction float64
+
+	// Run a failed invocation again up to this many times, if the
+	// RetryBudget (shared by all jobs; set when the test runs) allows it.
+	Retries     int
+	RetryBudget *RetryBudget
+
+	// Only start the job once its probe job has stopped, and only if the
+	// p99 of the probe was at most ProbeMaxP99.
+	Probe       string
+	ProbeMaxP99 time.Duration
+	// Set when the test runs: the outcome the job waits for (if it has a
+	// probe) or records (if it is a probe), and whether its probe passed.
+	ProbeGate    *ProbeOutcome
+	ProbeOutcome *ProbeOutcome
+	ProbeResult  *ProbeSummary
 
 	Start time.Duration
 	Stop  time.Duration
+
+	// The names of the jobs that must stop before this job starts.
+	DependsOn []string
+	// Set when the test runs: closed once the job stops, and the channels
+	// of the jobs it depends on.
+	Stopped      chan struct{}
+	dependencies []chan struct{}
+
+	// Only set once the job has started running.
+	InFlight   *inFlightTracker
+	BatchSizes StreamingStats
 }
 
 type JobResult struct {
-	Name         string
-	Start        time.Duration
+	Name            string
+	Start           time.Duration
+	Elapsed         time.Duration
+	Queries         int
+	RowsAffected    int64
+	Errors          ErrorCounts
+	AssertionErrors int
+	// The result of each query, only set with -per-query-stats.
+	QueryResults []QueryResult
+	// Warmup results are not included in the stats.
+	Warmup bool
+	// The estimated number of bytes sent by write queries.
+	BytesWritten int64
+	// The rows affected by each successful statement that does not return
+	// rows (e.g. an insert or update).
+	WriteRowsAffected []int64
+	// With warn-empty-results, the queries that returned no rows.
+	EmptyResults int
+	// With verify-idempotent, the number of queries whose second run
+	// returned a different result, and a description of the first.
+	IdempotencyMismatches int
+	IdempotencySample     string
+	// With server-exec-time, the time the server spent executing the
+	// queries, if it could be measured for all of them.
+	ServerElapsed time.Duration
+	ServerTimed   bool
+	// With explain-analyze, the plans returned for the queries.
+	Plan string
+	// The index of the phase of the job the invocation was made in.
+	Phase int
+	// The shard of the key of the invocation, if the job has shards.
+	Shard int
+	// With connection-per-query, the time it took to open the connection
+	// of the invocation, and whether it failed.
+	ConnectElapsed time.Duration
+	ConnectFailed  bool
+	// How many times the invocation was retried, and whether it failed
+	// but could not be retried because the retry budget was exhausted.
+	Retries      int
+	RetrySkipped bool
+}
+
+/*
+ * The result of a single query of a job invocation.
+ */
+type QueryResult struct {
+	Query        string
 	Elapsed      time.Duration
-	Queries      int
 	RowsAffected int64
-	Errors       ErrorCounts
+	Failed       bool
 }
 
-func (ji *jobInvocation) Invoke(db Database, df DatabaseFlavor, results *SafeCSVWriter, start time.Duration) *JobResult {
+/*
+ * The variables available to a success-expr: "rows", the number of rows
+ * returned (or affected), and "col0", "col1", ..., the values of the
+ * first row.
+ */
+func successExprVars(rows int64, firstRow []sql.NullString) ExprVars {
+	return func(name string) (interface{}, bool) {
+		if name == "rows" {
+			return float64(rows), true
+		}
+		if i, ok := successExprColumn(name); ok && i < len(firstRow) {
+			if !firstRow[i].Valid {
+				return nil, true
+			}
+			return firstRow[i].String, true
+		}
+		return nil, false
+	}
+}
+
+func successExprColumn(name string) (int, bool) {
+	if !strings.HasPrefix(name, "col") {
+		return 0, false
+	}
+	i, err := strconv.ParseUint(name[len("col"):], 10, 0)
+	return int(i), err == nil
+}
+
+func validateSuccessExpr(e *Expr) error {
+	for _, name := range e.Vars() {
+		if _, ok := successExprColumn(name); !ok && name != "rows" {
+			return fmt.Errorf("unknown variable %s, must be rows or colN", name)
+		}
+	}
+	return nil
+}
+
+func (ji *jobInvocation) Invoke(ctx context.Context, db Database, df DatabaseFlavor, job *Job, start time.Duration) *JobResult {
 	var elapsed time.Duration
 	var rowsAffected int64
+	var assertionErrors int
+	var queryResults []QueryResult
+	var bytesWritten int64
+	var writeRowsAffected []int64
+	var idempotencyMismatches int
+	var idempotencySample string
+	var serverElapsed time.Duration
+	var plan string
+	var emptyResults int
+	serverTimed := job.ServerExecTime
 	errorCounts := make(ErrorCounts)
 
+	if job.ConnectOnly && !ji.injectError {
+		return ji.invokeConnect(db, df, start)
+	}
+
+	if ji.injectError {
+		errorCounts.AddInjected(ji.label())
+		return &JobResult{
+			Name:    ji.name,
+			Start:   start,
+			Queries: len(ji.queries),
+			Errors:  errorCounts,
+			Warmup:  ji.warmup,
+			Phase:   ji.phase,
+			Shard:   ji.shard,
+		}
+	}
+
+	runQuery := db.RunQueryRows
+	// What the queries run on, to run them with a timeout.
+	var runner interface{} = db
+	var connectElapsed time.Duration
+	if job.ConnectionPerQuery {
+		opener, ok := db.(ConnectionOpener)
+		if !ok {
+			log.Fatalf("%s: the database does not support connection-per-query", ji.name)
+		}
+		connectStart := time.Now()
+		conn, err := opener.OpenConnection()
+		connectElapsed = time.Since(connectStart)
+		if err != nil {
+			if e := errorCounts.Add(err, connectOnlyQuery, df); e != nil {
+				log.Fatalf("%v. Error occurred while connecting for %v:\n%v", e, ji.name, err)
+			}
+			return &JobResult{
+				Name:           ji.name,
+				Start:          start,
+				Queries:        len(ji.queries),
+				Errors:         errorCounts,
+				Warmup:         ji.warmup,
+				Phase:          ji.phase,
+				Shard:          ji.shard,
+				ConnectElapsed: connectElapsed,
+				ConnectFailed:  true,
+			}
+		}
+		defer conn.Close()
+		runQuery = conn.RunQueryRows
+		runner = conn
+	}
+
+	var tx Transaction
+	if job.Transaction {
+		beginner, ok := db.(TransactionBeginner)
+		if !ok {
+			log.Fatalf("%s: the database does not support multi-query-mode=transaction", ji.name)
+		}
+		beginStart := time.Now()
+		var err error
+		tx, err = beginner.BeginTransaction()
+		elapsed += time.Since(beginStart)
+		if err != nil {
+			if e := errorCounts.Add(err, transactionBeginQuery, df); e != nil {
+				log.Fatalf("%v. Error occurred while beginning a transaction for %v:\n%v", e, ji.name, err)
+			}
+			return &JobResult{
+				Name:    ji.name,
+				Start:   start,
+				Elapsed: elapsed,
+				Queries: len(ji.queries),
+				Errors:  errorCounts,
+				Warmup:  ji.warmup,
+				Phase:   ji.phase,
+				Shard:   ji.shard,
+			}
+		}
+		runQuery = tx.RunQueryRows
+		runner = tx
+	}
+
+	if job.QueryTimeout > 0 {
+		cr, ok := runner.(ContextQueryRunner)
+		if !ok {
+			log.Fatalf("%s: the database does not support query-timeout", ji.name)
+		}
+		runQuery = func(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+			// Stopping the job (or the test) also cancels the query.
+			queryCtx, cancel := context.WithTimeout(ctx, job.QueryTimeout)
+			defer cancel()
+			rows, err := cr.RunQueryRowsContext(queryCtx, w, q, args, onRow)
+			if err != nil && queryCtx.Err() != nil {
+				err = &queryTimeoutError{timeout: job.QueryTimeout, stopped: ctx.Err() != nil}
+			}
+			return rows, err
+		}
+	}
+
+	if job.Prepared {
+		preparer, ok := db.(StatementPreparer)
+		if !ok {
+			log.Fatalf("%s: the database does not support prepared statements", ji.name)
+		}
+		runQuery = func(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+			stmt, err := job.preparedStatement(preparer, q)
+			if err != nil {
+				return 0, err
+			}
+			if *disableStatementCache {
+				defer stmt.Close()
+			}
+			return stmt.RunQueryRows(w, args, onRow)
+		}
+	}
+
 	for _, qi := range ji.queries {
-		runQueryStart := time.Now()
-		rows, err := db.RunQuery(results, qi.query, qi.args)
-		elapsed += time.Since(runQueryStart)
+		if tx != nil && errorCounts.TotalErrors() > 0 {
+			// The rest of the transaction is rolled back anyway.
+			break
+		}
+		var firstRow []sql.NullString
+		var digest *resultDigest
+		var onRow RowHandler
+		query := qi.query
+		if job.ExplainAnalyze {
+			// The flavor was checked when parsing the config.
+			query, _ = df.(ExplainAnalyzeFlavor).ExplainAnalyze(qi.query)
+			onRow = func(values []sql.NullString) error {
+				plan = appendPlanRow(plan, values)
+				return nil
+			}
+		} else if job.SuccessExpr != nil || job.VerifyIdempotent {
+			if job.VerifyIdempotent {
+				digest = newResultDigest()
+			}
+			onRow = func(values []sql.NullString) error {
+				if firstRow == nil && job.SuccessExpr != nil {
+					firstRow = append([]sql.NullString{}, values...)
+				}
+				if digest != nil {
+					digest.Add(values)
+				}
+				return nil
+			}
+		}
+
+		var rows int64
+		var err error
+		var queryElapsed, queryServerElapsed time.Duration
+		std, ok := db.(ServerTimedDatabase)
+		if job.ServerExecTime && !ok {
+			job.skipServerExecTime(errServerExecTimeUnsupported)
+		}
+		if ok && job.ServerExecTime && atomic.LoadInt32(&job.ServerExecTimeUnsupported) == 0 {
+			rows, queryElapsed, queryServerElapsed, err = std.RunQueryServerTime(job.QueryResults, query, qi.args, onRow)
+			if ste, ok := err.(*ServerExecTimeError); ok {
+				err = nil
+				serverTimed = false
+				job.skipServerExecTime(ste.Err)
+			}
+			serverElapsed += queryServerElapsed
+		} else {
+			serverTimed = false
+			runQueryStart := time.Now()
+			rows, err = runQuery(job.QueryResults, query, qi.args, onRow)
+			queryElapsed = time.Since(runQueryStart)
+		}
+		elapsed += queryElapsed
+		bytesWritten += estimateWriteBytes(qi.query, qi.args)
+		if *perQueryStats || *fingerprintQueries {
+			q := qi.label()
+			if *fingerprintQueries {
+				q = fingerprintQuery(q)
+			}
+			queryResults = append(queryResults, QueryResult{q, queryElapsed, rows, err != nil})
+		}
 
 		if err != nil {
 			// Attempt to handle the error
-			e := errorCounts.Add(err, qi.query, df)
+			e := errorCounts.Add(err, qi.label(), df)
 			if e != nil {
 				// Error handling not available for this DB flavor
 				log.Fatalf("%v. Error occurred while running %v:\n%v", e, ji.name, err)
 			}
 		} else {
 			rowsAffected += rows
+			if rows == 0 && job.WarnEmptyResults && returnsRows(qi.query) {
+				emptyResults++
+				if atomic.CompareAndSwapInt32(&job.emptyResultWarned, 0, 1) {
+					log.Printf("Warning: %s: query %s returned no rows; counting empty results in the summary",
+						ji.name, strconv.Quote(qi.label()))
+				}
+			}
+			if !returnsRows(qi.query) {
+				writeRowsAffected = append(writeRowsAffected, rows)
+				if rows == 0 && job.FailZeroRowsAffected {
+					assertionErrors++
+				}
+			}
+			if job.SuccessExpr != nil {
+				// An expression that cannot be evaluated (e.g. it
+				// references a column of an empty result) fails.
+				if ok, _ := job.SuccessExpr.EvalBool(successExprVars(rows, firstRow)); !ok {
+					assertionErrors++
+				}
+			}
+		}
+
+		if job.VerifyIdempotent && err == nil {
+			// The second run is not included in the latency of the
+			// job.
+			first := digest
+			digest = newResultDigest()
+			secondRows, err := runQuery(nil, qi.query, qi.args, onRow)
+			if err != nil {
+				if e := errorCounts.Add(err, qi.label(), df); e != nil {
+					log.Fatalf("%v. Error occurred while running %v:\n%v", e, ji.name, err)
+				}
+			} else if secondRows != rows || digest.Sum() != first.Sum() {
+				assertionErrors++
+				idempotencyMismatches++
+				if idempotencySample == "" {
+					idempotencySample = fmt.Sprintf("%q with args %v returned %d rows (digest %016x), then %d rows (digest %016x)",
+						qi.query, qi.args, rows, first.Sum(), secondRows, digest.Sum())
+				}
+			}
+		}
+	}
+
+	if tx != nil {
+		endStart := time.Now()
+		if errorCounts.TotalErrors() > 0 {
+			// The error of the query is the one counted.
+			tx.Rollback()
+		} else if err := tx.Commit(); err != nil {
+			if e := errorCounts.Add(err, transactionCommitQuery, df); e != nil {
+				log.Fatalf("%v. Error occurred while committing a transaction for %v:\n%v", e, ji.name, err)
+			}
+		}
+		elapsed += time.Since(endStart)
+	}
+
+	return &JobResult{
+		Name:              ji.name,
+		Start:             start,
+		Elapsed:           elapsed,
+		Queries:           len(ji.queries),
+		RowsAffected:      rowsAffected,
+		Errors:            errorCounts,
+		AssertionErrors:   assertionErrors,
+		QueryResults:      queryResults,
+		Warmup:            ji.warmup,
+		BytesWritten:      bytesWritten,
+		WriteRowsAffected: writeRowsAffected,
+
+		IdempotencyMismatches: idempotencyMismatches,
+		IdempotencySample:     idempotencySample,
+		EmptyResults:          emptyResults,
+
+		ServerElapsed: serverElapsed,
+		ServerTimed:   serverTimed,
+
+		Plan:  plan,
+		Phase: ji.phase,
+		Shard: ji.shard,
+
+		ConnectElapsed: connectElapsed,
+	}
+}
+
+/*
+ * Invokes the job, running a failed invocation again up to job.Retries
+ * times (while the retry budget, if any, allows it). Returns the result of
+ * the last attempt, with the latency of all of them.
+ */
+func (ji *jobInvocation) InvokeWithRetries(ctx context.Context, db Database, df DatabaseFlavor, job *Job, start time.Duration) *JobResult {
+	r := ji.Invoke(ctx, db, df, job, start)
+	if job.Retries == 0 || ji.injectError {
+		return r
+	}
+	if job.RetryBudget != nil {
+		job.RetryBudget.Deposit()
+	}
+
+	elapsed := r.Elapsed
+	retries := 0
+	skipped := false
+	for ; retries < job.Retries && r.Errors.TotalErrors() > 0; retries++ {
+		if job.RetryBudget != nil && !job.RetryBudget.Withdraw() {
+			skipped = true
+			break
+		}
+		r = ji.Invoke(ctx, db, df, job, start)
+		elapsed += r.Elapsed
+	}
+	r.Elapsed = elapsed
+	r.Retries = retries
+	r.RetrySkipped = skipped
+	return r
+}
+
+// Stands for the query of a connect-only invocation, e.g. in errors.
+const connectOnlyQuery = "<connect>"
+
+// Stand for the begin and commit of a transaction, e.g. in errors.
+const (
+	transactionBeginQuery  = "<begin>"
+	transactionCommitQuery = "<commit>"
+)
+
+/*
+ * The query the invocation is reported as.
+ */
+func (ji *jobInvocation) label() string {
+	if len(ji.queries) == 0 {
+		return connectOnlyQuery
+	}
+	return ji.queries[0].label()
+}
+
+/*
+ * Times opening, pinging and closing a new connection.
+ */
+func (ji *jobInvocation) invokeConnect(db Database, df DatabaseFlavor, start time.Duration) *JobResult {
+	cc, ok := db.(ConnectionCycler)
+	if !ok {
+		log.Fatalf("%s: the database does not support connect-only", ji.name)
+	}
+
+	errorCounts := make(ErrorCounts)
+	connectStart := time.Now()
+	err := cc.CycleConnection()
+	elapsed := time.Since(connectStart)
+	if err != nil {
+		if e := errorCounts.Add(err, connectOnlyQuery, df); e != nil {
+			log.Fatalf("%v. Error occurred while connecting for %v:\n%v", e, ji.name, err)
 		}
 	}
+	return &JobResult{
+		Name:    ji.name,
+		Start:   start,
+		Elapsed: elapsed,
+		Errors:  errorCounts,
+		Warmup:  ji.warmup,
+	}
+}
+
+/*
+ * Appends a row returned by EXPLAIN ANALYZE to the plan, as a line of its
+ * tab separated values.
+ */
+func appendPlanRow(plan string, values []sql.NullString) string {
+	columns := make([]string, len(values))
+	for i, v := range values {
+		columns[i] = v.String
+	}
+	return plan + strings.Join(columns, "\t") + "\n"
+}
+
+/*
+ * How the statements of the jobs with prepared=true are cached: once per
+ * job, or not at all with -disable-statement-cache.
+ */
+func statementCacheMode() string {
+	if *disableStatementCache {
+		return "none"
+	}
+	return "job"
+}
+
+/*
+ * Returns the prepared statement of the query, preparing it the first time.
+ * A query that fails to prepare is prepared again by its next invocation.
+ * With -disable-statement-cache, the query is prepared every time and the
+ * caller closes the statement.
+ */
+func (job *Job) preparedStatement(preparer StatementPreparer, q string) (PreparedStatement, error) {
+	if *disableStatementCache {
+		return preparer.Prepare(q)
+	}
+	job.statementsMu.Lock()
+	defer job.statementsMu.Unlock()
+	if stmt, ok := job.statements[q]; ok {
+		return stmt, nil
+	}
+	stmt, err := preparer.Prepare(q)
+	if err != nil {
+		return nil, err
+	}
+	if job.statements == nil {
+		job.statements = make(map[string]PreparedStatement)
+	}
+	job.statements[q] = stmt
+	return stmt, nil
+}
 
-	return &JobResult{ji.name, start, elapsed, len(ji.queries), rowsAffected, errorCounts}
+/*
+ * Stops measuring the server execution time of the job's queries, logging
+ * why the first time.
+ */
+func (job *Job) skipServerExecTime(err error) {
+	if atomic.CompareAndSwapInt32(&job.ServerExecTimeUnsupported, 0, 1) {
+		log.Printf("%s: not measuring server execution time: %v", job.Name, err)
+	}
+}
+
+/*
+ * An order sensitive digest of the rows returned by a query, to compare
+ * results without keeping them.
+ */
+type resultDigest struct {
+	h hash.Hash64
+}
+
+func newResultDigest() *resultDigest {
+	return &resultDigest{fnv.New64a()}
+}
+
+func (rd *resultDigest) Add(values []sql.NullString) {
+	var buf [binary.MaxVarintLen64]byte
+	rd.h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(values)))])
+	for _, v := range values {
+		if !v.Valid {
+			// Distinguish NULL from any string by its length.
+			rd.h.Write(buf[:binary.PutVarint(buf[:], -1)])
+			continue
+		}
+		rd.h.Write(buf[:binary.PutVarint(buf[:], int64(len(v.String)))])
+		io.WriteString(rd.h, v.String)
+	}
+}
+
+func (rd *resultDigest) Sum() uint64 {
+	return rd.h.Sum64()
 }
 
 func (ji *jobInvocation) String() string {
@@ -97,7 +815,19 @@ func (job *Job) String() string {
 	return quotedStruct(job)
 }
 
-func (job *Job) getNextQueryArgs() ([]interface{}, error) {
+func (job *Job) getNextQueryArgs(queryIndex int) ([]interface{}, error) {
+	textArgs, err := job.readQueryArgs()
+	if textArgs == nil {
+		return nil, err
+	}
+	return job.bindQueryArgs(queryIndex, textArgs), nil
+}
+
+/*
+ * Reads the next row of the query args, or returns nil if the job has
+ * none.
+ */
+func (job *Job) readQueryArgs() ([]string, error) {
 	if job.QueryArgs == nil {
 		return nil, nil
 	}
@@ -110,24 +840,154 @@ func (job *Job) getNextQueryArgs() ([]interface{}, error) {
 		}
 		return nil, err
 	}
+	return textArgs, nil
+}
+
+func (job *Job) bindQueryArgs(queryIndex int, textArgs []string) []interface{} {
+	if job.QueryArgColumns != nil {
+		iargs := make([]interface{}, 0, len(job.QueryArgColumns[queryIndex]))
+		for _, column := range job.QueryArgColumns[queryIndex] {
+			iargs = append(iargs, textArgs[column])
+		}
+		return iargs
+	}
 
 	iargs := make([]interface{}, 0, len(textArgs))
 	for _, arg := range textArgs {
 		iargs = append(iargs, arg)
 	}
-	return iargs, nil
+	return iargs
+}
+
+/*
+ * Returns the shard of the key in the row of query args, if the job has
+ * shards.
+ */
+func (job *Job) shardOf(textArgs []string) int {
+	if job.Shards == 0 {
+		return 0
+	}
+	if job.ShardKeyColumn >= len(textArgs) {
+		// TODO(awreece) Avoid log.Fatal.
+		log.Fatalf("shard-key-column %d of job %s is out of range for a row of %d query args",
+			job.ShardKeyColumn, job.Name, len(textArgs))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(textArgs[job.ShardKeyColumn]))
+	return int(h.Sum32() % uint32(job.Shards))
+}
+
+/*
+ * The invocation of query i of the job with the args, expanding the query
+ * if the job has query-template.
+ */
+func (job *Job) newQueryInvocation(i int, args []interface{}) queryInvocation {
+	if job.queryTemplates == nil {
+		return queryInvocation{query: job.Queries[i], args: args}
+	}
+	query, err := job.queryTemplates[i].Expand(job.Rand)
+	if err != nil {
+		log.Fatalf("error expanding the query template of job %s: %v", job.Name, err)
+	}
+	return queryInvocation{query: query, args: args, template: job.Queries[i]}
 }
 
 func (job *Job) getNextJobInvocation() (*jobInvocation, error) {
+	if len(job.Phases) > 0 || len(job.QueryWeights) > 0 {
+		return job.getNextWeightedInvocation()
+	}
 	queryInvocations := make([]queryInvocation, 0, len(job.Queries))
-	for _, query := range job.Queries {
-		args, err := job.getNextQueryArgs()
+	shard := 0
+	for i := range job.Queries {
+		textArgs, err := job.readQueryArgs()
 		if err != nil {
 			return nil, err
 		}
-		queryInvocations = append(queryInvocations, queryInvocation{query, args})
+		var args []interface{}
+		if textArgs != nil {
+			args = job.bindQueryArgs(i, textArgs)
+			if i == 0 {
+				// The key of the invocation is in the args of its first query.
+				shard = job.shardOf(textArgs)
+			}
+		}
+		queryInvocations = append(queryInvocations, job.newQueryInvocation(i, args))
+	}
+	if job.ShuffleQueries {
+		job.Rand.Shuffle(len(queryInvocations), func(i, j int) {
+			queryInvocations[i], queryInvocations[j] = queryInvocations[j], queryInvocations[i]
+		})
+	}
+	ji := &jobInvocation{name: job.Name, queries: queryInvocations, shard: shard}
+	ji.thinkTime = job.nextThinkTime()
+	return ji, nil
+}
+
+/*
+ * Draws the think time of an invocation, if the job has one.
+ */
+func (job *Job) nextThinkTime() time.Duration {
+	if len(job.ThinkTimes) > 0 {
+		return job.ThinkTimes[job.Rand.Intn(len(job.ThinkTimes))]
+	}
+	if job.ThinkTimeJitter > 0 {
+		return job.ThinkTime - job.ThinkTimeJitter + time.Duration(job.Rand.Int63n(int64(2*job.ThinkTimeJitter)+1))
+	}
+	return job.ThinkTime
+}
+
+/*
+ * Returns an invocation of a single query of the job, picked with the
+ * weights of the current phase, or the query weights.
+ */
+func (job *Job) getNextWeightedInvocation() (*jobInvocation, error) {
+	phase, weights := 0, job.QueryWeights
+	if len(job.Phases) > 0 {
+		phase = phaseAt(job.Phases, time.Since(job.Started))
+		weights = job.Phases[phase].Weights
+	}
+	i := pickWeighted(job.Rand, weights)
+	textArgs, err := job.readQueryArgs()
+	if err != nil {
+		return nil, err
+	}
+	var args []interface{}
+	if textArgs != nil {
+		args = job.bindQueryArgs(i, textArgs)
+	}
+	ji := &jobInvocation{name: job.Name, queries: []queryInvocation{job.newQueryInvocation(i, args)},
+		phase: phase, shard: job.shardOf(textArgs)}
+	ji.thinkTime = job.nextThinkTime()
+	return ji, nil
+}
+
+/*
+ * Returns the labels of the row count buckets with the given inclusive
+ * upper bounds, e.g. "0", "1-10", "11-100" and "101+" for 0, 10 and 100.
+ */
+func rowCountBucketLabels(bounds []int64) []string {
+	labels := make([]string, 0, len(bounds)+1)
+	lower := int64(0)
+	for _, upper := range bounds {
+		if lower == upper {
+			labels = append(labels, strconv.FormatInt(upper, 10))
+		} else {
+			labels = append(labels, fmt.Sprintf("%d-%d", lower, upper))
+		}
+		lower = upper + 1
 	}
-	return &jobInvocation{job.Name, queryInvocations}, nil
+	return append(labels, fmt.Sprintf("%d+", lower))
+}
+
+/*
+ * Returns the index of the bucket of the row count.
+ */
+func rowCountBucket(bounds []int64, rows int64) int {
+	return sort.Search(len(bounds), func(i int) bool { return rows <= bounds[i] })
+}
+
+func rateInterval(rate float64) time.Duration {
+	return time.Duration(float64(time.Second) / rate)
 }
 
 func (job *Job) startTickQueryChannel(ctx context.Context) <-chan *jobInvocation {
@@ -135,21 +995,124 @@ func (job *Job) startTickQueryChannel(ctx context.Context) <-chan *jobInvocation
 	go func() {
 		defer close(ch)
 
-		ticker := time.NewTicker(time.Duration(float64(time.Second) / job.Rate))
+		startTime := time.Now()
+		rate := job.Rate
+		job.RampedDown = false
+		job.BatchSizes = StreamingStats{}
+		var warmupEnd <-chan time.Time
+		if job.WarmupDuration > 0 {
+			rate = job.WarmupRate
+			warmupTimer := time.NewTimer(job.WarmupDuration)
+			defer warmupTimer.Stop()
+			warmupEnd = warmupTimer.C
+		}
+		// While ramping up, the first tick comes when one batch would have
+		// run at the rising rate.
+		rampingUp := job.RampUp > 0
+		firstTick := rateInterval(rate)
+		if rampingUp {
+			firstTick = time.Duration(math.Sqrt(2*job.RampUp.Seconds()/job.Rate) * float64(time.Second))
+		}
+		ticker := time.NewTicker(firstTick)
 		defer ticker.Stop()
+		// While ramping up, the rate is recomputed after every tick from
+		// the time since the job started.
+		rampUp := func() {
+			elapsed := time.Since(startTime)
+			if elapsed >= job.RampUp {
+				log.Printf("%s: ramped up to rate %.3f", job.Name, job.Rate)
+				rampingUp = false
+				ticker.Reset(rateInterval(job.Rate))
+				return
+			}
+			ticker.Reset(rateInterval(job.Rate * float64(elapsed) / float64(job.RampUp)))
+		}
+
+		// The stop of the job is measured from the start of the test (see
+		// Run), whether or not the job was delayed (e.g. by depends-on).
+		var rampDownStart <-chan time.Time
+		stopTime := job.Started.Add(job.Stop)
+		if job.RampDown > 0 {
+			rampDownTimer := time.NewTimer(time.Until(stopTime.Add(-job.RampDown)))
+			defer rampDownTimer.Stop()
+			rampDownStart = rampDownTimer.C
+		}
+		// While ramping down, the rate is recomputed after every tick.
+		rampDown := func() {
+			remaining := time.Until(stopTime)
+			if remaining <= 0 {
+				return
+			}
+			ticker.Reset(rateInterval(job.Rate * float64(remaining) / float64(job.RampDown)))
+		}
+
+		var adjust <-chan time.Time
+		if job.AdaptiveRate != nil {
+			job.AdaptiveRate.Start(job.Rate, job.Start)
+			adjustTicker := time.NewTicker(job.AdaptiveRate.Interval)
+			defer adjustTicker.Stop()
+			adjust = adjustTicker.C
+		}
+
+		waitForTick := func() bool {
+			for {
+				select {
+				case <-ctx.Done():
+					return false
+				case <-warmupEnd:
+					log.Printf("%s: warmup finished, running at rate %.3f", job.Name, job.Rate)
+					warmupEnd = nil
+					ticker.Reset(rateInterval(job.Rate))
+				case <-rampDownStart:
+					log.Printf("%s: ramping down to 0 over %v", job.Name, job.RampDown)
+					rampDownStart = nil
+					job.RampedDown = true
+					rampDown()
+				case rate := <-job.RateChanges:
+					log.Printf("%s: rate changed from %.3f to %.3f", job.Name, job.Rate, rate)
+					job.Rate = rate
+					// The new rate applies once we are done warming
+					// up, and to what is left of a ramp up or down.
+					if job.RampedDown {
+						rampDown()
+					} else if rampingUp {
+						rampUp()
+					} else if warmupEnd == nil {
+						ticker.Reset(rateInterval(rate))
+					}
+				case <-adjust:
+					now := job.Start + time.Since(startTime)
+					if rate, changed := job.AdaptiveRate.Adjust(now); changed {
+						log.Printf("%s: adjusting rate to %.3f", job.Name, rate)
+						ticker.Reset(rateInterval(rate))
+					}
+				case <-ticker.C:
+					if job.RampedDown {
+						rampDown()
+					} else if rampingUp {
+						rampUp()
+					}
+					return true
+				}
+			}
+		}
 
 		for ticks := uint64(0); job.Count == 0 || ticks < job.Count; ticks++ {
 			ji, err := job.getNextJobInvocation()
 			if err != nil {
 				return
 			}
-			select {
-			case <-ctx.Done():
+			if !waitForTick() {
 				return
-			case <-ticker.C:
-				for bi := uint64(0); bi < job.BatchSize; bi++ {
-					ch <- ji
-				}
+			}
+			ji.warmup = warmupEnd != nil
+			batchSize := job.BatchSize
+			if job.MaxBatchSize > job.BatchSize {
+				batchSize += uint64(job.Rand.Int63n(int64(job.MaxBatchSize - job.BatchSize + 1)))
+			}
+			job.BatchSizes.Add(float64(batchSize))
+			for bi := uint64(0); bi < batchSize; bi++ {
+				ch <- ji
 			}
 		}
 	}()
@@ -161,34 +1124,35 @@ func (job *Job) startLogQueryChannel(ctx context.Context) <-chan *jobInvocation
 	go func() {
 		defer close(ch)
 
-		scanner := bufio.NewScanner(job.QueryLog)
+		reader := queryLogFormats[firstString(job.QueryLogFormat, defaultQueryLogFormat)](job.QueryLog)
+		defer func() {
+			if skipped := reader.Skipped(); skipped > 0 {
+				log.Printf("%s: skipped %d unparseable lines in query log",
+					job.Name, skipped)
+			}
+		}()
 		var lastTime int64
 
-		for linesScanned := uint64(0); scanner.Scan() &&
-			(job.Count == 0 || linesScanned < job.Count); linesScanned++ {
-			line := scanner.Text()
-			parts := strings.SplitN(line, ",", 2)
-			if len(parts) != 2 {
-				log.Fatalf("%s: invalid query log on line %d",
-					job.Name, linesScanned+1)
-			}
-			if timeMicros, err := strconv.ParseInt(parts[0], 10, 64); err != nil {
-				log.Fatalf("%s: error parsing query log time on line %d: %v",
-					job.Name, linesScanned+1, err)
-			} else {
-				var timeToSleep = time.Duration(0)
-				if linesScanned > 0 {
-					timeToSleep = time.Duration(timeMicros-lastTime) * time.Microsecond
-				}
-				lastTime = timeMicros
+		for queriesRead := uint64(0); job.Count == 0 || queriesRead < job.Count; queriesRead++ {
+			entry, err := reader.Next()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				log.Fatalf("%s: %v", job.Name, err)
+			}
 
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.NewTimer(timeToSleep).C:
-					// TODO(awreece) Support multi statement log files.
-					ch <- &jobInvocation{job.Name, []queryInvocation{{parts[1], nil}}}
-				}
+			var timeToSleep = time.Duration(0)
+			if queriesRead > 0 {
+				timeToSleep = time.Duration(entry.timeMicros-lastTime) * time.Microsecond
+			}
+			lastTime = entry.timeMicros
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.NewTimer(timeToSleep).C:
+				// TODO(awreece) Support multi statement log files.
+				ch <- &jobInvocation{name: job.Name, queries: []queryInvocation{{query: entry.query}}}
 			}
 		}
 	}()
@@ -196,6 +1160,18 @@ func (job *Job) startLogQueryChannel(ctx context.Context) <-chan *jobInvocation
 }
 
 func (job *Job) startQueryChannel(ctx context.Context) <-chan *jobInvocation {
+	if job.Seed != 0 {
+		job.Rand = rand.New(rand.NewSource(job.Seed))
+	} else {
+		job.Rand = newJobRand(job.Name)
+	}
+	job.queryTemplates = nil
+	if job.QueryTemplate {
+		var err error
+		if job.queryTemplates, err = parseQueryTemplates(job.Queries); err != nil {
+			log.Fatalf("%s: %v", job.Name, err)
+		}
+	}
 	if job.Rate > 0 {
 		return job.startTickQueryChannel(ctx)
 	} else if job.QueryLog != nil {
@@ -221,7 +1197,11 @@ func (job *Job) startQueryChannel(ctx context.Context) <-chan *jobInvocation {
 }
 
 func (job *Job) runLoop(ctx context.Context, db Database, df DatabaseFlavor, startTime time.Time, results chan<- *JobResult) {
-	log.Printf("starting %v", job.Name)
+	if job.Rate > 0 && job.AdaptiveRate == nil {
+		log.Printf("starting %v at rate %g (every %v)", job.Name, job.Rate, rateInterval(job.Rate))
+	} else {
+		log.Printf("starting %v", job.Name)
+	}
 	defer log.Printf("stopping %v", job.Name)
 
 	queueSem := make(chan interface{}, job.QueueDepth)
@@ -229,15 +1209,91 @@ func (job *Job) runLoop(ctx context.Context, db Database, df DatabaseFlavor, sta
 		queueSem <- nil
 	}
 
+	var writeBudgets []*WriteBudget
+	if job.MaxWriteBytes > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		writeBudgets = append(writeBudgets, NewWriteBudget(job.Name, job.MaxWriteBytes, cancel))
+	}
+	if job.TestWriteBudget != nil {
+		writeBudgets = append(writeBudgets, job.TestWriteBudget)
+	}
+
+	job.InFlight = newInFlightTracker(job.Name, job.QueueDepth, startTime, job.MinUtilization)
+	samplerDone := make(chan struct{})
+	defer close(samplerDone)
+	go job.InFlight.run(samplerDone, *updateInterval)
+
+	// The producer of the invocations has its own source of randomness.
+	var failRand, latencyLogRand *rand.Rand
+	if job.FailFraction > 0 {
+		failRand = newJobRand(job.Name + " fail-fraction")
+	}
+	if job.LatencyLog != nil && job.LatencyLogSampling < 1 {
+		latencyLogRand = newJobRand(job.Name + " latency-log-sampling")
+	}
+
 	var wg sync.WaitGroup
 	for ji := range job.startQueryChannel(ctx) {
+		if failRand != nil {
+			ji.injectError = failRand.Float64() < job.FailFraction
+		}
+		if job.LatencyLog != nil && !ji.warmup {
+			ji.logLatency = latencyLogRand == nil || latencyLogRand.Float64() < job.LatencyLogSampling
+		}
 		wg.Add(1)
 		if job.QueueDepth > 0 {
 			<-queueSem
 		}
+		if job.TotalConcurrency != nil && !job.TotalConcurrency.Acquire(ctx) {
+			// We are stopping; keep draining the channel so that it
+			// is closed.
+			wg.Done()
+			if job.QueueDepth > 0 {
+				queueSem <- nil
+			}
+			continue
+		}
+		if job.Scheduler != nil && !job.Scheduler.Acquire(ctx, job.Priority) {
+			wg.Done()
+			if job.TotalConcurrency != nil {
+				job.TotalConcurrency.Release()
+			}
+			if job.QueueDepth > 0 {
+				queueSem <- nil
+			}
+			continue
+		}
+		job.InFlight.Issue()
 		go func(_ji *jobInvocation) {
 			defer wg.Done()
-			r := _ji.Invoke(db, df, job.QueryResults, time.Since(startTime))
+			if job.Scheduler != nil {
+				job.Scheduler.Release()
+			}
+			r := _ji.InvokeWithRetries(ctx, db, df, job, time.Since(startTime))
+			if job.TotalConcurrency != nil {
+				job.TotalConcurrency.Release()
+			}
+			if _ji.logLatency {
+				job.writeLatencyLog(startTime.Add(r.Start), r)
+			}
+			job.InFlight.Complete()
+			if job.ProbeOutcome != nil && !r.Warmup {
+				job.ProbeOutcome.Record(r.Elapsed, r.Errors.TotalErrors() > 0)
+			}
+			if job.AdaptiveRate != nil {
+				job.AdaptiveRate.Record(r.Elapsed)
+			}
+			for _, wb := range writeBudgets {
+				wb.Add(r.BytesWritten)
+			}
+			if _ji.thinkTime > 0 {
+				select {
+				case <-ctx.Done():
+				case <-time.After(_ji.thinkTime):
+				}
+			}
 			if job.QueueDepth > 0 {
 				queueSem <- nil
 			}
@@ -254,44 +1310,165 @@ func (job *Job) runLoop(ctx context.Context, db Database, df DatabaseFlavor, sta
 
 func (job *Job) Run(ctx context.Context, db Database, df DatabaseFlavor, results chan<- *JobResult) {
 	startTime := time.Now()
+	job.Started = startTime
+	job.TimedOut = false
 
 	if job.Stop > 0 {
-		ctx, _ = context.WithTimeout(ctx, job.Stop)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Stop)
+		defer cancel()
 	}
 
 	defer job.cleanup()
+	if job.Stopped != nil {
+		defer close(job.Stopped)
+	}
+	if job.ProbeOutcome != nil {
+		defer job.ProbeOutcome.Finish()
+	}
+
+	if len(job.dependencies) > 0 && !job.waitForDependencies(ctx) {
+		return
+	}
+	if job.ProbeGate != nil && !job.waitForProbe(ctx) {
+		return
+	}
 
 	select {
 	case <-ctx.Done():
 		return
-	case <-time.NewTimer(job.Start).C:
-		job.runLoop(ctx, db, df, startTime, results)
+	case <-time.NewTimer(time.Until(startTime.Add(job.Start))).C:
+	}
+
+	runCtx := ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	job.runLoop(runCtx, db, df, startTime, results)
+	if job.Timeout > 0 && runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		log.Printf("%s: stopped by its timeout of %v", job.Name, job.Timeout)
+		job.TimedOut = true
+	}
+}
+
+/*
+ * Writes the start time, latency and whether it failed of the invocation to
+ * the latency log.
+ */
+func (job *Job) writeLatencyLog(start time.Time, r *JobResult) {
+	err := job.LatencyLog.Write([]string{
+		strconv.FormatInt(start.UnixNano(), 10),
+		strconv.FormatInt(r.Elapsed.Nanoseconds(), 10),
+		strconv.FormatBool(r.Errors.TotalErrors() > 0),
+	})
+	if err != nil && err != errCSVWriterClosed {
+		log.Printf("%s: error writing latency log: %v", job.Name, err)
 	}
 }
 
+/*
+ * Releases what the job used while running. The files of the job are
+ * flushed rather than closed, since later iterations of -repeat write to
+ * them too; runTest closes them once the test stops.
+ */
 func (job *Job) cleanup() {
 	if job.QueryResults != nil {
-		job.QueryResults.Close()
+		job.QueryResults.Flush()
+	}
+	if job.LatencyLog != nil {
+		job.LatencyLog.Flush()
+	}
+	job.statementsMu.Lock()
+	for _, stmt := range job.statements {
+		stmt.Close()
+	}
+	job.statements = nil
+	job.statementsMu.Unlock()
+}
+
+/*
+ * Makes the job read its query log and query args from the start again, for
+ * the next iteration of -repeat.
+ */
+func (job *Job) rewindInputs() error {
+	if job.QueryLog != nil {
+		seeker, ok := job.QueryLog.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("%s: cannot read the query log again", job.Name)
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("%s: rewinding the query log: %v", job.Name, err)
+		}
+	}
+	if job.queryArgsSource != nil {
+		if _, err := job.queryArgsSource.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("%s: rewinding the query args: %v", job.Name, err)
+		}
+		comma := job.QueryArgs.Comma
+		job.QueryArgs = csv.NewReader(job.queryArgsSource)
+		job.QueryArgs.Comma = comma
+		if job.queryArgsHeader {
+			// The columns were bound to the header when the config was
+			// parsed.
+			if _, err := job.QueryArgs.Read(); err != nil {
+				return fmt.Errorf("%s: reading the query args header: %v", job.Name, err)
+			}
+		}
 	}
+	return nil
+}
+
+/*
+ * Closes the query log and query args of the job once the test stops.
+ */
+func (job *Job) closeInputs() {
 	if job.QueryLog != nil {
 		job.QueryLog.Close()
 	}
+	if c, ok := job.queryArgsSource.(io.Closer); ok {
+		c.Close()
+	}
 }
 
-func makeJobResultChan(ctx context.Context, db Database, df DatabaseFlavor, jobs map[string]*Job) <-chan *JobResult {
+func makeJobResultChan(ctx context.Context, db Database, df DatabaseFlavor, jobs map[string]*Job, maxTotalConcurrency int) <-chan *JobResult {
 	outChan := make(chan *JobResult)
 
+	// Only schedule the dispatch of invocations if some job asked for it.
+	var scheduler *PriorityScheduler
+	for _, job := range jobs {
+		if job.Priority != 0 {
+			scheduler = newPriorityScheduler(runtime.GOMAXPROCS(0))
+			break
+		}
+	}
+	var totalConcurrency *ConcurrencyLimit
+	if maxTotalConcurrency > 0 {
+		totalConcurrency = newConcurrencyLimit(maxTotalConcurrency)
+	}
+	for _, job := range jobs {
+		job.Scheduler = scheduler
+		job.TotalConcurrency = totalConcurrency
+	}
+	setUpProbes(jobs)
+	setUpDependencies(jobs)
+
 	go func() {
 		var wg sync.WaitGroup
 		for _, job := range jobs {
 			wg.Add(1)
 			go func(j *Job) {
+				defer wg.Done()
 				j.Run(ctx, db, df, outChan)
-				wg.Done()
 			}(job)
 		}
 
 		wg.Wait()
+		if totalConcurrency != nil {
+			log.Printf("max-total-concurrency of %d was contended %d times",
+				maxTotalConcurrency, totalConcurrency.Contended())
+		}
 		close(outChan)
 	}()
 
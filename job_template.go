@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Setup, teardown and job queries may reference {job_index} and {job_name}
+ * to give every job its own objects (e.g. a table per job). Job queries are
+ * expanded with the values of their own job, and setup and teardown queries
+ * are run once for every job. Jobs are indexed in order of their names.
+ */
+const (
+	jobIndexTemplate = "{job_index}"
+	jobNameTemplate  = "{job_name}"
+)
+
+var jobTemplateRegexp = regexp.MustCompile(`\{job_[A-Za-z_]*\}`)
+
+func hasJobTemplate(query string) bool {
+	return strings.Contains(query, jobIndexTemplate) ||
+		strings.Contains(query, jobNameTemplate)
+}
+
+func validateJobTemplate(query string) error {
+	for _, t := range jobTemplateRegexp.FindAllString(query, -1) {
+		if t != jobIndexTemplate && t != jobNameTemplate {
+			return fmt.Errorf("unknown template %s in query %s, must be %s or %s",
+				t, strconv.Quote(query), jobIndexTemplate, jobNameTemplate)
+		}
+	}
+	return nil
+}
+
+func expandJobTemplate(query string, index int, name string) string {
+	return strings.NewReplacer(
+		jobIndexTemplate, strconv.Itoa(index),
+		jobNameTemplate, name,
+	).Replace(query)
+}
+
+/*
+ * Expands every templated query in queries once per job.
+ */
+func expandSetupJobTemplates(queries []string, jobNames []string) ([]string, error) {
+	var expanded []string
+	for _, query := range queries {
+		if err := validateJobTemplate(query); err != nil {
+			return nil, err
+		}
+		if !hasJobTemplate(query) {
+			expanded = append(expanded, query)
+			continue
+		}
+		for i, name := range jobNames {
+			expanded = append(expanded, expandJobTemplate(query, i, name))
+		}
+	}
+	return expanded, nil
+}
+
+func expandJobTemplates(config *Config) error {
+	jobNames := make([]string, 0, len(config.Jobs))
+	for name := range config.Jobs {
+		jobNames = append(jobNames, name)
+	}
+	sort.Strings(jobNames)
+
+	for i, name := range jobNames {
+		job := config.Jobs[name]
+		for qi, query := range job.Queries {
+			if err := validateJobTemplate(query); err != nil {
+				return fmt.Errorf("Error parsing job %s: %v", strconv.Quote(name), err)
+			}
+			job.Queries[qi] = expandJobTemplate(query, i, name)
+		}
+		for qi, query := range job.IterationQueries {
+			if err := validateJobTemplate(query); err != nil {
+				return fmt.Errorf("Error parsing job %s: %v", strconv.Quote(name), err)
+			}
+			job.IterationQueries[qi] = expandJobTemplate(query, i, name)
+		}
+	}
+
+	var err error
+	if config.Setup, err = expandSetupJobTemplates(config.Setup, jobNames); err != nil {
+		return fmt.Errorf("Error parsing setup section: %v", err)
+	}
+	if config.SetupEachIteration, err = expandSetupJobTemplates(config.SetupEachIteration, jobNames); err != nil {
+		return fmt.Errorf("Error parsing setup section: %v", err)
+	}
+	if config.Teardown, err = expandSetupJobTemplates(config.Teardown, jobNames); err != nil {
+		return fmt.Errorf("Error parsing teardown section: %v", err)
+	}
+	return nil
+}
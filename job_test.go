@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestShuffleQueries(t *testing.T) {
+	*seed = 42
+	queries := []string{"select 1", "select 2", "select 3", "select 4", "select 5"}
+
+	invocationOrders := func() [][]string {
+		job := &Job{Name: "shuffle", Queries: queries, ShuffleQueries: true}
+		job.Rand = newJobRand(job.Name)
+		var orders [][]string
+		for i := 0; i < 10; i++ {
+			ji, err := job.getNextJobInvocation()
+			if err != nil {
+				t.Fatalf("Error getting job invocation: %v", err)
+			}
+			var order []string
+			for _, qi := range ji.queries {
+				order = append(order, qi.query)
+			}
+			orders = append(orders, order)
+		}
+		return orders
+	}
+
+	orders := invocationOrders()
+	shuffled := false
+	for _, order := range orders {
+		if !reflect.DeepEqual(order, queries) {
+			shuffled = true
+		}
+		sorted := append([]string(nil), order...)
+		sort.Strings(sorted)
+		if !reflect.DeepEqual(sorted, queries) {
+			t.Errorf("Expected each query once but got %v", order)
+		}
+	}
+	if !shuffled {
+		t.Errorf("Expected queries to be shuffled")
+	}
+	if !reflect.DeepEqual(orders, invocationOrders()) {
+		t.Errorf("Expected the same order with the same seed")
+	}
+}
+
+func TestRowCountBuckets(t *testing.T) {
+	bounds := []int64{0, 10, 100}
+	if labels, expected := rowCountBucketLabels(bounds), []string{"0", "1-10", "11-100", "101+"}; !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Expected labels %v but got %v", expected, labels)
+	}
+	if labels, expected := rowCountBucketLabels([]int64{5}), []string{"0-5", "6+"}; !reflect.DeepEqual(labels, expected) {
+		t.Errorf("Expected labels %v but got %v", expected, labels)
+	}
+
+	var cases = []struct {
+		rows   int64
+		bucket int
+	}{
+		{0, 0}, {1, 1}, {10, 1}, {11, 2}, {100, 2}, {101, 3}, {1000000, 3},
+	}
+	for _, c := range cases {
+		if bucket := rowCountBucket(bounds, c.rows); bucket != c.bucket {
+			t.Errorf("Expected %d rows in bucket %d but got %d", c.rows, c.bucket, bucket)
+		}
+	}
+}
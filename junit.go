@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+/*
+ * Like the query-stats-file, the report file is opened when we first parse
+ * the flags (i.e. before we change our base directory).
+ */
+var junitFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&junitFile, "junit",
+		"Write a JUnit XML report to this file, with a test case for the "+
+			"setup, each job and the teardown.")
+}
+
+const junitClassName = "dbbench"
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+/*
+ * Collects the test cases of a test, in the order they ran.
+ */
+type junitReport struct {
+	testCases []junitTestCase
+	elapsed   time.Duration
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func (jr *junitReport) add(name string, elapsed time.Duration, failure *junitFailure) {
+	jr.testCases = append(jr.testCases, junitTestCase{
+		Name:      name,
+		ClassName: junitClassName,
+		Time:      junitTime(elapsed),
+		Failure:   failure,
+	})
+	jr.elapsed += elapsed
+}
+
+/*
+ * Adds a test case for the setup or teardown, failing with the error (if
+ * any).
+ */
+func (jr *junitReport) AddHook(name string, elapsed time.Duration, err error) {
+	var failure *junitFailure
+	if err != nil {
+		failure = &junitFailure{Message: err.Error(), Type: "error"}
+	}
+	jr.add(name, elapsed, failure)
+}
+
+/*
+ * Adds a test case for each job of an iteration, failing if the job had any
+ * failing or assertion errors. The iteration is only included in the name
+ * of the test cases if there are several.
+ */
+func (jr *junitReport) AddIteration(iteration, iterations int, summary map[string]*JobStatsSummary) {
+	names := make([]string, 0, len(summary))
+	for name := range summary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := summary[name]
+		var failure *junitFailure
+		if s.FailingErrors > 0 || s.AssertionErrors > 0 {
+			failure = &junitFailure{
+				Message: fmt.Sprintf("%d failing errors, %d assertion errors",
+					s.FailingErrors, s.AssertionErrors),
+				Type: "assertion",
+				Text: fmt.Sprintf("%d transactions (%.3f TPS), latency %v; %d queries, %d errors",
+					s.Transactions, s.TPS, s.TransactionLatency, s.Queries, s.TotalErrors),
+			}
+		}
+		if iterations > 1 {
+			name = fmt.Sprintf("%s (iteration %d)", name, iteration)
+		}
+		jr.add(name, s.Stop-s.Start, failure)
+	}
+}
+
+func (jr *junitReport) Write(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:      junitClassName,
+		Tests:     len(jr.testCases),
+		Time:      junitTime(jr.elapsed),
+		TestCases: jr.testCases,
+	}
+	for _, tc := range jr.testCases {
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJUnitReport(t *testing.T) {
+	report := &junitReport{}
+	report.AddHook("setup", 500*time.Millisecond, nil)
+	report.AddIteration(1, 2, map[string]*JobStatsSummary{
+		"b": &JobStatsSummary{Start: time.Second, Stop: 3 * time.Second},
+		"a": &JobStatsSummary{Stop: time.Second, AssertionErrors: 2},
+	})
+	report.AddHook("teardown", 0, errors.New("error in teardown query"))
+
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatalf("Error writing report: %v", err)
+	}
+
+	var suite junitTestSuite
+	if err := xml.Unmarshal(buf.Bytes(), &suite); err != nil {
+		t.Fatalf("Error parsing report %s: %v", buf.String(), err)
+	}
+	if suite.Tests != 4 || suite.Failures != 2 || suite.Time != "3.500" {
+		t.Errorf("Unexpected suite %d tests, %d failures, time %s",
+			suite.Tests, suite.Failures, suite.Time)
+	}
+
+	expected := []struct {
+		name   string
+		time   string
+		failed bool
+	}{
+		{"setup", "0.500", false},
+		{"a (iteration 1)", "1.000", true},
+		{"b (iteration 1)", "2.000", false},
+		{"teardown", "0.000", true},
+	}
+	for i, tc := range suite.TestCases {
+		e := expected[i]
+		if tc.Name != e.name || tc.Time != e.time || (tc.Failure != nil) != e.failed {
+			t.Errorf("Expected test case %+v but got %+v", e, tc)
+		}
+	}
+}
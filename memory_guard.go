@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+)
+
+var maxMemory int64
+
+// How often the heap is checked against -max-memory.
+var memoryCheckInterval = time.Second
+
+func init() {
+	flag.Func("max-memory", "Stop the test and write the results so far once "+
+		"the heap in use exceeds this size (e.g. 4GB), rather than risk "+
+		"being killed for running out of memory.",
+		func(v string) (err error) {
+			maxMemory, err = parseByteSize(v)
+			if err == nil && maxMemory <= 0 {
+				return fmt.Errorf("max-memory must be positive")
+			}
+			return err
+		})
+}
+
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
+
+/*
+ * Checks the heap in use every interval until ctx is done, calling cancel
+ * if it exceeds limit.
+ */
+func guardMemory(ctx context.Context, cancel context.CancelFunc, limit uint64, interval time.Duration, inUse func() uint64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if heap := inUse(); heap > limit {
+				log.Printf("heap in use is %d bytes, over max-memory %d; stopping the test "+
+					"and writing the results so far", heap, limit)
+				cancel()
+				return
+			}
+		}
+	}
+}
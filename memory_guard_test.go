@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGuardMemory(t *testing.T) {
+	var heap uint64 = 100
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		guardMemory(ctx, cancel, 1000, time.Millisecond, func() uint64 {
+			return atomic.LoadUint64(&heap)
+		})
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("Expected the test to keep running under max-memory")
+	}
+	atomic.StoreUint64(&heap, 2000)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the guard to trip over max-memory")
+	}
+	if ctx.Err() == nil {
+		t.Errorf("Expected the test to be cancelled over max-memory")
+	}
+}
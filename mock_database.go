@@ -0,0 +1,328 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * A database that runs no query, for testing configs (and dbbench itself)
+ * without a database. Each query waits for its latency and returns canned
+ * rows or an error, as given by the connection params (see -params):
+ *
+ *   latency=1ms       how long each query takes
+ *   jitter=500us      a random amount of time (up to this much) added to or
+ *                     removed from the latency
+ *   rows=10           the rows returned (or affected, for a write)
+ *   values=a,b        the values of the columns of each row (by default a
+ *                     single column with the number of the row)
+ *   error-rate=0.01   the fraction of the queries that fail
+ *   error-code=1213   the code of the errors, as matched by accepted errors
+ *                     (by default "mock")
+ *   rule=insert:latency=5ms,rows=1
+ *                     overrides the above for the queries that contain
+ *                     "insert" (ignoring case); may be given several times,
+ *                     and the first rule that matches applies
+ */
+type mockDatabaseFlavor struct{}
+
+func init() {
+	supportedDatabaseFlavors["mock"] = mockDatabaseFlavor{}
+}
+
+/*
+ * How the mock database answers a query.
+ */
+type mockBehavior struct {
+	latency   time.Duration
+	jitter    time.Duration
+	rows      int64
+	values    []string
+	errorRate float64
+	errorCode string
+}
+
+type mockRule struct {
+	match string
+	mockBehavior
+}
+
+type mockDb struct {
+	defaults mockBehavior
+	rules    []mockRule
+
+	// The randomness of the jitter and errors, from -seed.
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+/*
+ * An error returned by the mock database.
+ */
+type mockError struct {
+	code string
+}
+
+func (e *mockError) Error() string {
+	return fmt.Sprintf("mock error %s", e.code)
+}
+
+func (mockDatabaseFlavor) Connect(cc *ConnectionConfig) (Database, error) {
+	params, err := url.ParseQuery(cc.Params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock params: %v", err)
+	}
+	db := &mockDb{
+		defaults: mockBehavior{rows: 1, errorCode: "mock"},
+		rand:     newJobRand("mock"),
+	}
+	for key, values := range params {
+		if key == "rule" {
+			continue
+		}
+		for _, v := range values {
+			if err := db.defaults.set(key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The rules override the defaults, whatever the order of the params.
+	for _, rule := range params["rule"] {
+		r, err := parseMockRule(rule, db.defaults)
+		if err != nil {
+			return nil, err
+		}
+		db.rules = append(db.rules, r)
+	}
+	return db, nil
+}
+
+func (mb *mockBehavior) set(key, v string) (err error) {
+	switch key {
+	case "latency":
+		mb.latency, err = time.ParseDuration(v)
+	case "jitter":
+		mb.jitter, err = time.ParseDuration(v)
+	case "rows":
+		mb.rows, err = strconv.ParseInt(v, 10, 64)
+		if err == nil && mb.rows < 0 {
+			err = errors.New("must not be negative")
+		}
+	case "values":
+		mb.values = strings.Split(v, ",")
+	case "error-rate":
+		mb.errorRate, err = strconv.ParseFloat(v, 64)
+		if err == nil && !(mb.errorRate >= 0 && mb.errorRate <= 1) {
+			err = errors.New("must be between 0 and 1")
+		}
+	case "error-code":
+		mb.errorCode = v
+	default:
+		return fmt.Errorf("unknown mock param %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid mock param %s=%s: %v", key, v, err)
+	}
+	return nil
+}
+
+/*
+ * Parses a rule, e.g. "insert:latency=5ms,rows=1", whose behavior starts
+ * from the defaults.
+ */
+func parseMockRule(rule string, defaults mockBehavior) (mockRule, error) {
+	i := strings.LastIndex(rule, ":")
+	if i <= 0 {
+		return mockRule{}, fmt.Errorf("invalid mock rule %s, must be <text>:<param>=<value>,...", strconv.Quote(rule))
+	}
+	r := mockRule{strings.ToLower(rule[:i]), defaults}
+	for _, kv := range strings.Split(rule[i+1:], ",") {
+		eq := strings.Index(kv, "=")
+		if eq < 0 {
+			return mockRule{}, fmt.Errorf("invalid mock rule %s, must be <text>:<param>=<value>,...", strconv.Quote(rule))
+		}
+		// The params of a rule are separated by commas, as are values.
+		if kv[:eq] == "values" {
+			return mockRule{}, errors.New("values cannot be given by a mock rule")
+		}
+		if err := r.set(kv[:eq], kv[eq+1:]); err != nil {
+			return mockRule{}, err
+		}
+	}
+	return r, nil
+}
+
+func (mockDatabaseFlavor) CheckQuery(q string) error {
+	if strings.TrimSpace(q) == "" {
+		return EmptyQueryError
+	}
+	return nil
+}
+
+func (mockDatabaseFlavor) QuerySeparator() string {
+	return ";"
+}
+
+func (mockDatabaseFlavor) ProbeQuery() string {
+	return "select 1"
+}
+
+func (mockDatabaseFlavor) BindNamed(q string) (string, []string) {
+	return bindNamedSQLPlaceholders(q, questionPlaceholder)
+}
+
+func (mockDatabaseFlavor) ErrorCode(e error) (string, error) {
+	err, ok := e.(*mockError)
+	if !ok {
+		return "", fmt.Errorf("Unrecognized mock error: %v", e)
+	}
+	return err.code, nil
+}
+
+func (db *mockDb) behavior(q string) *mockBehavior {
+	q = strings.ToLower(q)
+	for i := range db.rules {
+		if strings.Contains(q, db.rules[i].match) {
+			return &db.rules[i].mockBehavior
+		}
+	}
+	return &db.defaults
+}
+
+func (db *mockDb) RunQuery(w *SafeCSVWriter, q string, args []interface{}) (int64, error) {
+	return db.RunQueryRows(w, q, args, nil)
+}
+
+func (db *mockDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return db.RunQueryRowsContext(context.Background(), w, q, args, onRow)
+}
+
+func (db *mockDb) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	mb := db.behavior(q)
+	latency := mb.latency
+	db.mu.Lock()
+	if mb.jitter > 0 {
+		latency += time.Duration(db.rand.Int63n(int64(2*mb.jitter)+1)) - mb.jitter
+	}
+	failed := mb.errorRate > 0 && db.rand.Float64() < mb.errorRate
+	db.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+	}
+	if failed {
+		return 0, &mockError{mb.errorCode}
+	}
+	if !returnsRows(q) || (w == nil && onRow == nil) {
+		return mb.rows, nil
+	}
+
+	values := make([]sql.NullString, len(mb.values))
+	for i, v := range mb.values {
+		values[i] = sql.NullString{String: v, Valid: true}
+	}
+	if len(values) == 0 {
+		values = make([]sql.NullString, 1)
+	}
+	record := make([]string, len(values))
+	for n := int64(1); n <= mb.rows; n++ {
+		if len(mb.values) == 0 {
+			values[0] = sql.NullString{String: strconv.FormatInt(n, 10), Valid: true}
+		}
+		if onRow != nil {
+			if err := onRow(values); err != nil {
+				return 0, err
+			}
+		}
+		if w != nil {
+			if err := w.WriteNullStrings(values, record); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if w != nil {
+		return mb.rows, w.Error()
+	}
+	return mb.rows, nil
+}
+
+/*
+ * A transaction on the mock database, which runs its queries as the database
+ * does and always commits.
+ */
+type mockTx struct {
+	db *mockDb
+}
+
+func (db *mockDb) BeginTransaction() (Transaction, error) {
+	return &mockTx{db}, nil
+}
+
+func (t *mockTx) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return t.db.RunQueryRows(w, q, args, onRow)
+}
+
+func (t *mockTx) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return t.db.RunQueryRowsContext(ctx, w, q, args, onRow)
+}
+
+func (t *mockTx) Commit() error {
+	return nil
+}
+
+func (t *mockTx) Rollback() error {
+	return nil
+}
+
+/*
+ * A prepared query on the mock database, which runs as the query does.
+ */
+type mockStmt struct {
+	db *mockDb
+	q  string
+}
+
+func (db *mockDb) Prepare(q string) (PreparedStatement, error) {
+	return &mockStmt{db, q}, nil
+}
+
+func (s *mockStmt) RunQueryRows(w *SafeCSVWriter, args []interface{}, onRow RowHandler) (int64, error) {
+	return s.db.RunQueryRows(w, s.q, args, onRow)
+}
+
+func (s *mockStmt) Close() {}
+
+func (db *mockDb) ServerVersion() (string, error) {
+	return "mock", nil
+}
+
+func (db *mockDb) Close() {}
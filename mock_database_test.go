@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestMockDatabase(t *testing.T) {
+	df := supportedDatabaseFlavors["mock"]
+	db, err := df.Connect(&ConnectionConfig{
+		Params: "rows=2&values=a,b&rule=insert:rows=1,error-rate=1,error-code=1213&rule=update:rows=5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var got [][]string
+	rows, err := db.RunQueryRows(nil, "select * from t", nil, func(values []sql.NullString) error {
+		got = append(got, []string{values[0].String, values[1].String})
+		return nil
+	})
+	if err != nil || rows != 2 {
+		t.Errorf("Expected 2 rows but got %d (%v)", rows, err)
+	}
+	if expected := [][]string{{"a", "b"}, {"a", "b"}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected rows %v but got %v", expected, got)
+	}
+
+	if rows, err := db.RunQuery(nil, "UPDATE t set a = 1", nil); err != nil || rows != 5 {
+		t.Errorf("Expected the update rule to affect 5 rows but got %d (%v)", rows, err)
+	}
+
+	_, err = db.RunQuery(nil, "insert into t values (1)", nil)
+	if code, e := df.ErrorCode(err); e != nil || code != "1213" {
+		t.Errorf("Expected the insert rule to fail with 1213 but got %v (%v)", err, e)
+	}
+}
+
+func TestMockDatabaseInvalidParams(t *testing.T) {
+	for _, params := range []string{
+		"rows=-1",
+		"latency=fast",
+		"error-rate=1.5",
+		"unknown=1",
+		"rule=insert",
+		"rule=insert:rows",
+		"rule=insert:values=a",
+	} {
+		if _, err := supportedDatabaseFlavors["mock"].Connect(&ConnectionConfig{Params: params}); err == nil {
+			t.Errorf("Expected mock params %q to be invalid", params)
+		}
+	}
+}
+
+func TestMockDatabaseJob(t *testing.T) {
+	*seed = 42
+	df := supportedDatabaseFlavors["mock"]
+	db, err := df.Connect(&ConnectionConfig{Params: "error-rate=0.5&error-code=deadlock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		Flavor:         df,
+		AcceptedErrors: Set{"deadlock": struct{}{}},
+		Jobs: map[string]*Job{
+			"mocked": &Job{
+				Name: "mocked", QueueDepth: 1, Count: 200,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	stats := runIterations(db, df, config, 1)[0]["mocked"]
+	if stats.TotalErrors < 50 || stats.TotalErrors > 150 || stats.AcceptedErrors != stats.TotalErrors {
+		t.Errorf("Expected about 100 accepted errors of 200 queries but got %d errors, %d accepted",
+			stats.TotalErrors, stats.AcceptedErrors)
+	}
+}
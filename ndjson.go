@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"sort"
+	"time"
+)
+
+/*
+ * We use a FileFlagValue so that the ndjson file is opened when we first
+ * parse the flags (i.e. before we change our base directory).
+ */
+var ndjsonFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&ndjsonFile, "ndjson",
+		"Append the stats of each job for each intermediate stats interval "+
+			"to this file, as newline-delimited JSON.")
+}
+
+type IntervalStatsRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Job       string    `json:"job"`
+	QPS       float64   `json:"queriesPerSecond"`
+	Errors    uint64    `json:"errors"`
+	// The fraction of the transactions of the interval that failed with
+	// an error that was not accepted.
+	ErrorRate float64       `json:"errorRate"`
+	P50       time.Duration `json:"p50"`
+	P99       time.Duration `json:"p99"`
+}
+
+/*
+ * Writes a record for each job that ran in the interval ending at now. Each
+ * record is written straight to w, so that a crashed test still leaves the
+ * records of the intervals before the crash.
+ */
+func writeIntervalStats(w io.Writer, now time.Time, interval time.Duration,
+	stats map[string]*jobStats, latencies map[string]*queryStats) error {
+
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	encoder := json.NewEncoder(w)
+	for _, name := range names {
+		record := &IntervalStatsRecord{
+			Timestamp: now,
+			Job:       name,
+			QPS:       float64(stats[name].Queries) / interval.Seconds(),
+			Errors:    stats[name].TotalErrors,
+			ErrorRate: stats[name].ErrorRate(),
+		}
+		if qs, ok := latencies[name]; ok {
+			record.P50 = qs.Percentile(0.5)
+			record.P99 = qs.Percentile(0.99)
+		}
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteIntervalStats(t *testing.T) {
+	now := time.Date(2020, 4, 15, 12, 57, 30, 0, time.UTC)
+	stats := map[string]*jobStats{
+		"b": &jobStats{Queries: 20, TotalErrors: 2, FailedTransactions: 2},
+		"a": &jobStats{Queries: 5},
+	}
+	for i := 0; i < 8; i++ {
+		stats["b"].Transactions.Add(float64(time.Millisecond))
+	}
+	stats["b"].Errors.Add(float64(time.Millisecond))
+	stats["b"].Errors.Add(float64(time.Millisecond))
+	latencies := map[string]*queryStats{"b": new(queryStats)}
+	for _, elapsed := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond} {
+		latencies["b"].Update(&QueryResult{Elapsed: elapsed})
+	}
+
+	var buf bytes.Buffer
+	if err := writeIntervalStats(&buf, now, 2*time.Second, stats, latencies); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per job but got %q", buf.String())
+	}
+	var records []IntervalStatsRecord
+	for _, line := range lines {
+		var record IntervalStatsRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	expected := []IntervalStatsRecord{
+		{Timestamp: now, Job: "a", QPS: 2.5},
+		{Timestamp: now, Job: "b", QPS: 10, Errors: 2, ErrorRate: 0.2,
+			P50: 2 * time.Millisecond, P99: 3 * time.Millisecond},
+	}
+	for i := range expected {
+		if !records[i].Timestamp.Equal(expected[i].Timestamp) {
+			t.Errorf("Expected timestamp %v but got %v", expected[i].Timestamp, records[i].Timestamp)
+		}
+		records[i].Timestamp = expected[i].Timestamp
+		if records[i] != expected[i] {
+			t.Errorf("Expected record %+v but got %+v", expected[i], records[i])
+		}
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Writes the summaries of the iterations of a test (see -repeat) in some
+ * format.
+ */
+type summaryWriter func(w io.Writer, summaries []map[string]*JobStatsSummary) error
+
+// The output formats, keyed by file extension.
+var summaryWriters = map[string]summaryWriter{
+	".csv":  writeCSVSummaries,
+	".json": writeJSONSummaries,
+}
+
+/*
+ * The files given to -output. Each is made absolute when we first parse the
+ * flags (i.e. before we change our base directory).
+ */
+type outputFilesValue []string
+
+func (o *outputFilesValue) String() string {
+	if o == nil {
+		return ""
+	}
+	return strings.Join(*o, ",")
+}
+
+func (o *outputFilesValue) Set(name string) error {
+	if name == "" {
+		return errors.New("empty output file")
+	}
+	if _, err := lookupSummaryWriter(name); err != nil {
+		return err
+	}
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	*o = append(*o, path)
+	return nil
+}
+
+var outputFiles outputFilesValue
+
+/*
+ * The path of the -json output file with the name: the name with a .json
+ * extension, made absolute when we first parse the flags (i.e. before we
+ * change our base directory), like the -output files.
+ */
+func jsonOutputPath(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty json output file")
+	}
+	return filepath.Abs(name + ".json")
+}
+
+// The indentation of JSON output files, or none at all with -json-compact.
+var jsonIndent = "    "
+var jsonCompact bool
+
+func init() {
+	flag.Var(&outputFiles, "output",
+		"Save the test output statistics to this file, in the format given "+
+			"by its extension (.json or .csv). May be given several times.")
+	flag.Func("csv", "Saves test output statistics in a .csv file with the provided name "+
+		"(an alias of -output <name>.csv)", func(name string) error {
+		if name == "" {
+			return errors.New("empty csv output file")
+		}
+		return outputFiles.Set(name + ".csv")
+	})
+	flag.Func("json-indent", "Indent JSON output files with this string, in "+
+		"which Go escapes such as \\t are allowed (default four spaces).",
+		func(s string) error {
+			indent, err := strconv.Unquote(`"` + s + `"`)
+			if err != nil {
+				return fmt.Errorf("invalid indent %s: %v", strconv.Quote(s), err)
+			} else if strings.Trim(indent, " \t") != "" {
+				return fmt.Errorf("indent %s must only contain spaces and tabs", strconv.Quote(s))
+			}
+			jsonIndent = indent
+			return nil
+		})
+	flag.BoolVar(&jsonCompact, "json-compact", false,
+		"Write JSON output files on a single line, without indentation "+
+			"(overrides -json-indent).")
+}
+
+func lookupSummaryWriter(name string) (summaryWriter, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if w, ok := summaryWriters[ext]; ok {
+		return w, nil
+	}
+	supported := make([]string, 0, len(summaryWriters))
+	for ext := range summaryWriters {
+		supported = append(supported, ext)
+	}
+	sort.Strings(supported)
+	return nil, fmt.Errorf("unsupported output format %q for %s (supported: %s)",
+		ext, name, strings.Join(supported, ", "))
+}
+
+func writeSummariesToFile(name string, summaries []map[string]*JobStatsSummary) error {
+	write, err := lookupSummaryWriter(name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = write(file, summaries); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/*
+ * Writes the summary of each job as a JSON object keyed by job name, or a
+ * list of such objects (one per iteration) if there are several iterations.
+ */
+func writeJSONSummaries(w io.Writer, summaries []map[string]*JobStatsSummary) error {
+	encoder := json.NewEncoder(w)
+	if !jsonCompact {
+		encoder.SetIndent("", jsonIndent)
+	}
+	if len(summaries) == 1 {
+		return encoder.Encode(summaries[0])
+	}
+	return encoder.Encode(summaries)
+}
+
+var csvSummaryHeader = append([]string{
+	"iteration", "job", "transactions", "transactionsPerSecond",
+	"transactionLatency", "transactionLatencyDelta", "rows", "rowsPerSecond",
+	"queries", "queriesPerSecond", "totalErrors", "acceptedErrors",
+	"toleratedErrors", "failingErrors", "assertionErrors", "errorLatency",
+	"errorLatencyDelta", "start", "stop",
+}, append(summaryPercentileNames(""), summaryPercentileNames("allIterations")...)...)
+
+/*
+ * The names of the summary percentiles, in camel case after the prefix
+ * (e.g. allIterationsP50).
+ */
+func summaryPercentileNames(prefix string) []string {
+	names := make([]string, len(summaryPercentiles))
+	for i, p := range summaryPercentiles {
+		if prefix == "" {
+			names[i] = p.name
+		} else {
+			names[i] = prefix + strings.ToUpper(p.name[:1]) + p.name[1:]
+		}
+	}
+	return names
+}
+
+/*
+ * Writes a row per job and iteration with the scalar stats of the job and
+ * its latency percentiles, then its percentiles across all the iterations
+ * (null with a single iteration). Like in the JSON output, durations are in
+ * nanoseconds.
+ */
+func writeCSVSummaries(w io.Writer, summaries []map[string]*JobStatsSummary) error {
+	cw := newSafeCSVWriterTo(w, "the csv summaries")
+	if err := cw.Write(csvSummaryHeader); err != nil {
+		return err
+	}
+
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	for i, summary := range summaries {
+		names := make([]string, 0, len(summary))
+		for name := range summary {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			s := summary[name]
+			record := []string{
+				strconv.Itoa(i + 1), name,
+				strconv.Itoa(s.Transactions), formatFloat(s.TPS),
+				strconv.FormatInt(int64(s.TransactionLatency), 10),
+				strconv.FormatInt(int64(s.TransactionLatencyDelta), 10),
+				strconv.FormatInt(s.Rows, 10), formatFloat(s.RPS),
+				strconv.FormatUint(s.Queries, 10), formatFloat(s.QPS),
+				strconv.FormatUint(s.TotalErrors, 10),
+				strconv.FormatUint(s.AcceptedErrors, 10),
+				strconv.FormatUint(s.ToleratedErrors, 10),
+				strconv.FormatUint(s.FailingErrors, 10),
+				strconv.FormatUint(s.AssertionErrors, 10),
+				strconv.FormatInt(int64(s.ErrorLatency), 10),
+				strconv.FormatInt(int64(s.ErrorLatencyDelta), 10),
+				strconv.FormatInt(int64(s.Start), 10),
+				strconv.FormatInt(int64(s.Stop), 10),
+			}
+			for _, p := range summaryPercentiles {
+				record = append(record, strconv.FormatInt(int64(s.Percentiles[p.name]), 10))
+			}
+			for _, p := range summaryPercentiles {
+				if latency, ok := s.MergedPercentiles[p.name]; ok {
+					record = append(record, strconv.FormatInt(int64(latency), 10))
+				} else {
+					record = append(record, cw.nullMarker)
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Close()
+	return cw.Error()
+}
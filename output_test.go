@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputFiles(t *testing.T) {
+	var o outputFilesValue
+	for _, name := range []string{"results.json", "results.CSV"} {
+		if err := o.Set(name); err != nil {
+			t.Errorf("Unexpected error for %s: %v", name, err)
+		}
+	}
+	if len(o) != 2 {
+		t.Errorf("Expected 2 output files but got %v", o)
+	}
+	for _, name := range []string{"", "results", "results.parquet", "results.txt"} {
+		if err := o.Set(name); err == nil {
+			t.Errorf("Expected error for %q", name)
+		}
+	}
+}
+
+func TestJSONOutputIgnoresBaseDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func() { RunnerConfig.JsonOutputFile = "" }()
+
+	dir := t.TempDir()
+	baseDir := filepath.Join(dir, "configs", "nested")
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// The temporary directory may be behind a symlink.
+	if dir, err = os.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+	if err := flag.Set("json", "results"); err != nil {
+		t.Fatal(err)
+	}
+	// As main does once the flags are parsed.
+	if err := os.Chdir(baseDir); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"test": &Job{
+				Name: "test", QueueDepth: 1, Count: 1,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+	outputs, _ := runTest(&counterDb{}, config.Flavor, config)
+	expected := filepath.Join(dir, "results.json")
+	if !reflect.DeepEqual(outputs, []string{expected}) {
+		t.Errorf("Expected the output %s but got %v", expected, outputs)
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Expected the json output in the working directory: %v", err)
+	}
+}
+
+func TestWriteSummaries(t *testing.T) {
+	merged := map[string]time.Duration{"p50": 1, "p75": 2, "p90": 3, "p95": 4, "p99": 5, "p999": 6}
+	summaries := []map[string]*JobStatsSummary{
+		{
+			"b": &JobStatsSummary{Transactions: 2, TPS: 0.5, TransactionLatency: time.Millisecond,
+				Percentiles: map[string]time.Duration{"p50": time.Millisecond, "p99": 2 * time.Millisecond}},
+			"a": &JobStatsSummary{Transactions: 1, Queries: 1, TotalErrors: 1,
+				MergedPercentiles: merged},
+		},
+		{
+			"a": &JobStatsSummary{Transactions: 3, MergedPercentiles: merged},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeCSVSummaries(&buf, summaries); err != nil {
+		t.Fatalf("Error writing csv: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{
+		strings.Join(csvSummaryHeader, ","),
+		"1,a,1,0,0,0,0,0,1,0,1,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,2,3,4,5,6",
+		`1,b,2,0.5,1000000,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1000000,0,0,0,2000000,0,\N,\N,\N,\N,\N,\N`,
+		"2,a,3,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,2,3,4,5,6",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected csv\n%s\nbut got\n%s", strings.Join(expected, "\n"), buf.String())
+	}
+
+	buf.Reset()
+	if err := writeJSONSummaries(&buf, summaries[:1]); err != nil {
+		t.Fatalf("Error writing json: %v", err)
+	}
+	var single map[string]*JobStatsSummary
+	if err := json.Unmarshal(buf.Bytes(), &single); err != nil {
+		t.Errorf("Expected a single summary but got %s: %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	if err := writeJSONSummaries(&buf, summaries); err != nil {
+		t.Fatalf("Error writing json: %v", err)
+	}
+	var multiple []map[string]*JobStatsSummary
+	if err := json.Unmarshal(buf.Bytes(), &multiple); err != nil || len(multiple) != 2 {
+		t.Errorf("Expected 2 summaries but got %s: %v", buf.String(), err)
+	}
+}
+
+func TestJSONSummariesIndent(t *testing.T) {
+	summaries := []map[string]*JobStatsSummary{{"a": &JobStatsSummary{Transactions: 1}}}
+	defer func(indent string, compact bool) {
+		jsonIndent, jsonCompact = indent, compact
+	}(jsonIndent, jsonCompact)
+
+	var buf bytes.Buffer
+	jsonCompact = true
+	if err := writeJSONSummaries(&buf, summaries); err != nil {
+		t.Fatalf("Error writing json: %v", err)
+	}
+	if out := strings.TrimSuffix(buf.String(), "\n"); strings.Contains(out, "\n") {
+		t.Errorf("Expected compact json on a single line but got %s", buf.String())
+	}
+
+	buf.Reset()
+	jsonCompact, jsonIndent = false, "\t"
+	if err := writeJSONSummaries(&buf, summaries); err != nil {
+		t.Fatalf("Error writing json: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\n\t\"a\": {\n\t\t") {
+		t.Errorf("Expected json indented with tabs but got %s", buf.String())
+	}
+}
+
+func TestCSVFlag(t *testing.T) {
+	defer func(saved outputFilesValue) { outputFiles = saved }(outputFiles)
+	outputFiles = nil
+
+	if err := flag.Set("csv", "results"); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := filepath.Abs("results.csv")
+	if !reflect.DeepEqual([]string(outputFiles), []string{expected}) {
+		t.Errorf("Expected the output %s but got %v", expected, outputFiles)
+	}
+	if err := flag.Set("csv", ""); err == nil {
+		t.Error("Expected an error for an empty csv output file")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * A window of time (since the start of the test) during which each
+ * invocation of a job runs one of its queries, picked with the weight of
+ * the query in the phase.
+ */
+type Phase struct {
+	Start time.Duration
+	// Zero if the phase lasts until the job stops.
+	End     time.Duration
+	Weights []float64
+}
+
+/*
+ * Parses a phase given as "<start>-[<end>] <weight>...", e.g. "0s-1h 9 1".
+ */
+func parsePhase(v string) (Phase, error) {
+	fields := strings.Fields(v)
+	if len(fields) < 2 {
+		return Phase{}, fmt.Errorf("phase %s must be <start>-[<end>] <weight>...", strconv.Quote(v))
+	}
+	window := strings.SplitN(fields[0], "-", 2)
+	if len(window) != 2 {
+		return Phase{}, fmt.Errorf("invalid phase window %s, must be <start>-[<end>]", strconv.Quote(fields[0]))
+	}
+
+	var p Phase
+	var err error
+	if p.Start, err = time.ParseDuration(window[0]); err != nil {
+		return Phase{}, err
+	}
+	if window[1] != "" {
+		if p.End, err = time.ParseDuration(window[1]); err != nil {
+			return Phase{}, err
+		} else if p.End <= p.Start {
+			return Phase{}, fmt.Errorf("phase %s must end after it starts", fields[0])
+		}
+	}
+
+	var total float64
+	for _, field := range fields[1:] {
+		weight, err := strconv.ParseFloat(field, 64)
+		if err != nil || weight < 0 {
+			return Phase{}, fmt.Errorf("invalid weight %s", strconv.Quote(field))
+		}
+		total += weight
+		p.Weights = append(p.Weights, weight)
+	}
+	if total == 0 {
+		return Phase{}, fmt.Errorf("phase %s must have a positive weight", fields[0])
+	}
+	return p, nil
+}
+
+func (p Phase) String() string {
+	if p.End == 0 {
+		return fmt.Sprintf("%v-", p.Start)
+	}
+	return fmt.Sprintf("%v-%v", p.Start, p.End)
+}
+
+/*
+ * Checks that the phases of the job follow each other and cover the time
+ * the job runs, and that they have a weight for each query.
+ */
+func validatePhases(job *Job) error {
+	if job.QueryLog != nil {
+		return errors.New("cannot use phases with query-log-file")
+	} else if job.ShuffleQueries {
+		return errors.New("cannot use phases with shuffle-queries")
+	}
+
+	for i, p := range job.Phases {
+		if len(p.Weights) != len(job.Queries) {
+			return fmt.Errorf("phase %v has %d weights for %d queries",
+				p, len(p.Weights), len(job.Queries))
+		}
+		if i == 0 && p.Start != job.Start {
+			return fmt.Errorf("the first phase must start when the job starts (%v)", job.Start)
+		} else if i > 0 && p.Start != job.Phases[i-1].End {
+			return fmt.Errorf("phase %v must start when phase %v ends", p, job.Phases[i-1])
+		}
+		if job.Stop > 0 && p.End > job.Stop {
+			return fmt.Errorf("phase %v ends after the job stops (%v)", p, job.Stop)
+		}
+	}
+
+	last := job.Phases[len(job.Phases)-1]
+	if last.End != 0 && last.End != job.Stop {
+		return fmt.Errorf("the last phase must end when the job stops, or have no end")
+	}
+	return nil
+}
+
+/*
+ * Returns the index of the phase at the given time since the start of the
+ * test.
+ */
+func phaseAt(phases []Phase, elapsed time.Duration) int {
+	i := sort.Search(len(phases), func(i int) bool { return phases[i].Start > elapsed })
+	if i > 0 {
+		i--
+	}
+	return i
+}
+
+/*
+ * Returns an index picked at random with the given weights.
+ */
+func pickWeighted(r *rand.Rand, weights []float64) int {
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+	x := r.Float64() * total
+	for i, weight := range weights {
+		if x < weight {
+			return i
+		}
+		x -= weight
+	}
+	// Rounding; return the last query with a weight.
+	for i := len(weights) - 1; ; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePhase(t *testing.T) {
+	for _, c := range []struct {
+		in  string
+		out Phase
+	}{
+		{"0s-1h 9 1", Phase{0, time.Hour, []float64{9, 1}}},
+		{"1h- 0 0.5", Phase{time.Hour, 0, []float64{0, 0.5}}},
+	} {
+		if p, err := parsePhase(c.in); err != nil {
+			t.Errorf("Unexpected error parsing %q: %v", c.in, err)
+		} else if !reflect.DeepEqual(p, c.out) {
+			t.Errorf("Expected %q to parse as %+v but got %+v", c.in, c.out, p)
+		}
+	}
+
+	for _, in := range []string{"0s-1h", "0s 1 1", "1h-1m 1", "0s-1h 1 x", "0s-1h -1 2", "0s-1h 0 0"} {
+		if _, err := parsePhase(in); err == nil {
+			t.Errorf("Unexpected success parsing %q", in)
+		}
+	}
+}
+
+func TestPhaseAt(t *testing.T) {
+	phases := []Phase{{0, time.Minute, nil}, {time.Minute, 2 * time.Minute, nil}, {2 * time.Minute, 0, nil}}
+	for _, c := range []struct {
+		elapsed time.Duration
+		phase   int
+	}{
+		{0, 0}, {30 * time.Second, 0}, {time.Minute, 1}, {3 * time.Minute, 2},
+	} {
+		if phase := phaseAt(phases, c.elapsed); phase != c.phase {
+			t.Errorf("Expected phase %d at %v but got %d", c.phase, c.elapsed, phase)
+		}
+	}
+}
+
+func TestPickWeighted(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	counts := make([]int, 3)
+	for i := 0; i < 10000; i++ {
+		counts[pickWeighted(r, []float64{3, 0, 1})]++
+	}
+	if counts[1] != 0 {
+		t.Errorf("Expected no picks of a zero weight but got %d", counts[1])
+	}
+	if counts[0] < 7000 || counts[0] > 8000 {
+		t.Errorf("Expected about 7500 picks of weight 3 of 4 but got %d", counts[0])
+	}
+}
+
+func TestPhaseStats(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"phased": &Job{
+				Name: "phased", QueueDepth: 1, Stop: 100 * time.Millisecond,
+				Queries: []string{"select 1", "select 2"},
+				Phases: []Phase{
+					{0, 50 * time.Millisecond, []float64{1, 0}},
+					{50 * time.Millisecond, 100 * time.Millisecond, []float64{0, 1}},
+				},
+			},
+		},
+	}
+
+	stats := runIterations(&counterDb{delay: time.Millisecond}, config.Flavor, config, 1)[0]["phased"]
+	if len(stats.Phases) != 2 {
+		t.Fatalf("Expected stats of 2 phases but got %d", len(stats.Phases))
+	}
+	for i, phase := range stats.Phases {
+		if phase.Latency.Count() == 0 {
+			t.Errorf("Expected transactions in phase %d (%s)", i, phase.Phase)
+		}
+	}
+	if stats.Phases[0].Phase != "0s-50ms" {
+		t.Errorf("Unexpected label of the first phase %q", stats.Phases[0].Phase)
+	}
+}
+
+func TestQueryWeights(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"weighted": &Job{
+				Name: "weighted", QueueDepth: 1, Count: 1000,
+				Queries:      []string{"select 1", "update t set a = 1", "delete from t"},
+				QueryWeights: []float64{9, 1, 0},
+			},
+		},
+	}
+
+	db := &recordingDb{}
+	runIterations(db, config.Flavor, config, 1)
+	counts := make(map[string]int)
+	for _, q := range db.queries {
+		counts[q]++
+	}
+	if len(db.queries) != 1000 {
+		t.Errorf("Expected one query per execution but got %d", len(db.queries))
+	}
+	if counts["delete from t"] != 0 || counts["select 1"] < 850 || counts["select 1"] > 950 {
+		t.Errorf("Expected about 900 reads, 100 writes and no deletes but got %v", counts)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var postRunHook = flag.String("post-run-hook", "",
+	"Run this shell command after the teardown, e.g. to upload the results. "+
+		"The output files are passed in DBBENCH_OUTPUT_FILES (separated as "+
+		"in PATH) and the summary as JSON in DBBENCH_SUMMARY. Its output is "+
+		"logged.")
+var postRunHookFatal = flag.Bool("post-run-hook-fatal", false,
+	"Exit with an error if the -post-run-hook command fails.")
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+/*
+ * Runs the post-run hook command with the output files and summaries of
+ * the test, returning its combined output.
+ */
+func runPostRunHook(command string, outputs []string, summaries []map[string]*JobStatsSummary) ([]byte, error) {
+	paths := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		if path, err := filepath.Abs(output); err == nil {
+			output = path
+		}
+		paths = append(paths, output)
+	}
+	// The same shape as the JSON output files.
+	var summary interface{} = summaries
+	if len(summaries) == 1 {
+		summary = summaries[0]
+	}
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"DBBENCH_OUTPUT_FILES="+strings.Join(paths, string(os.PathListSeparator)),
+		"DBBENCH_SUMMARY="+string(summaryJSON))
+	return cmd.CombinedOutput()
+}
+
+/*
+ * Runs -post-run-hook, if given, logging its output. A failure of the hook
+ * is only fatal with -post-run-hook-fatal.
+ */
+func postRun(outputs []string, summaries []map[string]*JobStatsSummary) {
+	if *postRunHook == "" {
+		return
+	}
+	log.Printf("Running post-run hook %q", *postRunHook)
+	out, err := runPostRunHook(*postRunHook, outputs, summaries)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		log.Printf("post-run-hook: %s", scanner.Text())
+	}
+	if err == nil {
+		return
+	}
+	if *postRunHookFatal {
+		log.Fatalf("post-run hook failed: %v", err)
+	}
+	log.Printf("post-run hook failed: %v", err)
+}
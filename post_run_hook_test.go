@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunPostRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook command is written for sh")
+	}
+	summaries := []map[string]*JobStatsSummary{{"a": &JobStatsSummary{Transactions: 3}}}
+	out, err := runPostRunHook(`echo "$DBBENCH_OUTPUT_FILES"; echo "$DBBENCH_SUMMARY"`,
+		[]string{"results.json", "/tmp/results.csv"}, summaries)
+	if err != nil {
+		t.Fatalf("Error running hook: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected the output files and summary but got %q", out)
+	}
+	wd, _ := os.Getwd()
+	expected := filepath.Join(wd, "results.json") + string(os.PathListSeparator) + "/tmp/results.csv"
+	if lines[0] != expected {
+		t.Errorf("Expected output files %s but got %s", expected, lines[0])
+	}
+	var summary map[string]*JobStatsSummary
+	if err := json.Unmarshal([]byte(lines[1]), &summary); err != nil || summary["a"].Transactions != 3 {
+		t.Errorf("Expected the summary of the iteration but got %s: %v", lines[1], err)
+	}
+
+	if _, err := runPostRunHook("exit 3", nil, summaries); err == nil {
+		t.Errorf("Expected a failing hook to return an error")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var prewarmConnections = flag.Int("prewarm-connections", 0,
+	"Open this many connections and run the prewarm query on each before "+
+		"running the test, so that the jobs do not pay for opening them.")
+var prewarmQuery = flag.String("prewarm-query", "",
+	"The query to run on each prewarmed connection (default the probe "+
+		"query of the driver, e.g. 'select 1').")
+var prewarmParallelism = flag.Int("prewarm-parallelism", 8,
+	"Open at most this many prewarmed connections at once.")
+
+func checkPrewarmFlags() error {
+	if *prewarmConnections < 0 {
+		return errors.New("-prewarm-connections cannot be negative")
+	} else if *prewarmParallelism < 1 {
+		return errors.New("-prewarm-parallelism must be at least 1")
+	} else if *maxActiveConns > 0 && *prewarmConnections > *maxActiveConns {
+		return fmt.Errorf("cannot prewarm %d connections with -max-active-conns=%d",
+			*prewarmConnections, *maxActiveConns)
+	}
+	return nil
+}
+
+/*
+ * Warms the given number of connections of the database, at most
+ * parallelism at a time, and returns them all to the pool. Returns the
+ * number of connections that failed and the first error.
+ */
+func prewarm(db Database, connections, parallelism int, query string) (int, error) {
+	pw, ok := db.(ConnectionPrewarmer)
+	if !ok {
+		return connections, errors.New("the database does not support prewarming connections")
+	}
+
+	var mu sync.Mutex
+	var releases []func()
+	var failures int
+	var firstErr error
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelism)
+	for i := 0; i < connections; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := pw.WarmConnection(query)
+			<-slots
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures++
+				if firstErr == nil {
+					firstErr = err
+				}
+			} else {
+				releases = append(releases, release)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only return the connections once they are all open, so that every
+	// call got a different connection.
+	for _, release := range releases {
+		release()
+	}
+	return failures, firstErr
+}
+
+func runPrewarm(db Database, df DatabaseFlavor) {
+	if *prewarmConnections == 0 {
+		return
+	}
+	if *prewarmConnections > *maxIdleConns {
+		log.Printf("Warning: only %d of the %d prewarmed connections will be "+
+			"kept (see -max-idle-conns)", *maxIdleConns, *prewarmConnections)
+	}
+	query := firstString(*prewarmQuery, df.ProbeQuery())
+
+	log.Printf("Prewarming %d connections", *prewarmConnections)
+	start := time.Now()
+	failures, err := prewarm(db, *prewarmConnections, *prewarmParallelism, query)
+	if failures > 0 {
+		log.Printf("Prewarmed %d connections in %v; %d failed (first error: %v)",
+			*prewarmConnections-failures, time.Since(start), failures, err)
+	} else {
+		log.Printf("Prewarmed %d connections in %v", *prewarmConnections, time.Since(start))
+	}
+}
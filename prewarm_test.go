@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type prewarmingDb struct {
+	counterDb
+	mu          sync.Mutex
+	held, peak  int
+	warmed      int
+	released    int
+	failEvery   int
+	warmQueries []string
+}
+
+func (p *prewarmingDb) WarmConnection(query string) (func(), error) {
+	p.mu.Lock()
+	p.warmed++
+	p.warmQueries = append(p.warmQueries, query)
+	if p.failEvery > 0 && p.warmed%p.failEvery == 0 {
+		p.mu.Unlock()
+		return nil, errors.New("connection refused")
+	}
+	p.held++
+	if p.held > p.peak {
+		p.peak = p.held
+	}
+	p.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.released++
+	}, nil
+}
+
+func TestPrewarm(t *testing.T) {
+	db := &prewarmingDb{failEvery: 5}
+	failures, err := prewarm(db, 20, 4, "select 1")
+	if failures != 4 || err == nil {
+		t.Errorf("Expected 4 failures but got %d (%v)", failures, err)
+	}
+	if db.warmed != 20 || db.released != 16 {
+		t.Errorf("Expected 20 connections warmed and 16 released but got %d and %d",
+			db.warmed, db.released)
+	}
+	// Connections are held until all are warm, so all 16 are held at once.
+	if db.peak != 16 {
+		t.Errorf("Expected all 16 connections to be held at once but got %d", db.peak)
+	}
+	for _, query := range db.warmQueries {
+		if query != "select 1" {
+			t.Errorf("Unexpected prewarm query %q", query)
+		}
+	}
+
+	if failures, err := prewarm(&counterDb{}, 2, 1, "select 1"); failures != 2 || err == nil {
+		t.Errorf("Expected a database that cannot prewarm to fail but got %d (%v)", failures, err)
+	}
+}
+
+type concurrencyDb struct {
+	counterDb
+	mu            sync.Mutex
+	opening, peak int
+}
+
+func (c *concurrencyDb) WarmConnection(query string) (func(), error) {
+	c.mu.Lock()
+	c.opening++
+	if c.opening > c.peak {
+		c.peak = c.opening
+	}
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.opening--
+	c.mu.Unlock()
+	return func() {}, nil
+}
+
+func TestPrewarmParallelism(t *testing.T) {
+	db := &concurrencyDb{}
+	if failures, err := prewarm(db, 12, 3, "select 1"); failures != 0 {
+		t.Fatalf("Unexpected failures %d (%v)", failures, err)
+	}
+	if db.peak > 3 {
+		t.Errorf("Expected at most 3 connections opened at once but got %d", db.peak)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+ * The latencies of the transactions of a probe job, which the jobs gated
+ * on it wait for.
+ */
+type ProbeOutcome struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	done      chan struct{}
+}
+
+func newProbeOutcome() *ProbeOutcome {
+	return &ProbeOutcome{done: make(chan struct{})}
+}
+
+func (po *ProbeOutcome) Record(elapsed time.Duration, failed bool) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+	if failed {
+		po.errors++
+	} else {
+		po.latencies = append(po.latencies, elapsed)
+	}
+}
+
+/*
+ * Called once the probe job has stopped.
+ */
+func (po *ProbeOutcome) Finish() {
+	close(po.done)
+}
+
+/*
+ * Waits for the probe job to stop. Returns false if the context is done
+ * first.
+ */
+func (po *ProbeOutcome) Wait(ctx context.Context) bool {
+	select {
+	case <-po.done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+/*
+ * The p99 of the successful transactions of the probe, how many there were
+ * and how many failed.
+ */
+func (po *ProbeOutcome) P99() (time.Duration, int, int) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+	if len(po.latencies) == 0 {
+		return 0, 0, po.errors
+	}
+	latencies := append([]time.Duration(nil), po.latencies...)
+	return durationPercentile(latencies, 0.99), len(latencies), po.errors
+}
+
+/*
+ * Whether the probe of a job passed, as reported in the summary of the
+ * job.
+ */
+type ProbeSummary struct {
+	Job          string        `json:"job"`
+	P99          time.Duration `json:"p99"`
+	MaxP99       time.Duration `json:"maxP99"`
+	Transactions int           `json:"transactions"`
+	Errors       int           `json:"errors"`
+	Passed       bool          `json:"passed"`
+}
+
+func (ps *ProbeSummary) String() string {
+	outcome := "passed"
+	if !ps.Passed {
+		outcome = "failed"
+	}
+	return fmt.Sprintf("probe %s %s: p99 %v (max %v) over %d transactions, %d errors",
+		strconv.Quote(ps.Job), outcome, ps.P99, ps.MaxP99, ps.Transactions, ps.Errors)
+}
+
+/*
+ * Waits for the probe of the job to stop, and checks that its p99 was
+ * under probe-max-p99. Returns whether the job should run.
+ */
+func (job *Job) waitForProbe(ctx context.Context) bool {
+	log.Printf("%s: waiting for probe %s", job.Name, strconv.Quote(job.Probe))
+	if !job.ProbeGate.Wait(ctx) {
+		return false
+	}
+
+	p99, transactions, errors := job.ProbeGate.P99()
+	job.ProbeResult = &ProbeSummary{
+		Job:          job.Probe,
+		P99:          p99,
+		MaxP99:       job.ProbeMaxP99,
+		Transactions: transactions,
+		Errors:       errors,
+		Passed:       transactions > 0 && p99 <= job.ProbeMaxP99,
+	}
+	if job.ProbeResult.Passed {
+		log.Printf("%s: %v", job.Name, job.ProbeResult)
+	} else {
+		log.Printf("%s: %v; skipping the job", job.Name, job.ProbeResult)
+	}
+	return job.ProbeResult.Passed
+}
+
+/*
+ * Checks that the probe of each job gated on one is a job that stops on
+ * its own and is not gated itself.
+ */
+func validateProbes(jobs map[string]*Job) error {
+	for name, job := range jobs {
+		if job.Probe == "" {
+			continue
+		}
+		probe, ok := jobs[job.Probe]
+		if !ok {
+			return fmt.Errorf("job %s has an unknown probe %s",
+				strconv.Quote(name), strconv.Quote(job.Probe))
+		} else if probe == job {
+			return fmt.Errorf("job %s cannot be its own probe", strconv.Quote(name))
+		} else if probe.Probe != "" {
+			return fmt.Errorf("probe %s of job %s cannot have a probe itself",
+				strconv.Quote(job.Probe), strconv.Quote(name))
+		} else if probe.Count == 0 && probe.Stop == 0 && probe.QueryArgs == nil && probe.QueryLog == nil {
+			return fmt.Errorf("probe %s of job %s must stop (e.g. with count or stop)",
+				strconv.Quote(job.Probe), strconv.Quote(name))
+		}
+	}
+	return nil
+}
+
+/*
+ * Shares the outcome of each probe with the jobs gated on it, for a run of
+ * the jobs.
+ */
+func setUpProbes(jobs map[string]*Job) {
+	for _, job := range jobs {
+		job.ProbeOutcome = nil
+		job.ProbeGate = nil
+		job.ProbeResult = nil
+	}
+	for _, job := range jobs {
+		if job.Probe == "" {
+			continue
+		}
+		probe := jobs[job.Probe]
+		if probe.ProbeOutcome == nil {
+			probe.ProbeOutcome = newProbeOutcome()
+		}
+		job.ProbeGate = probe.ProbeOutcome
+	}
+}
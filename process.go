@@ -22,6 +22,9 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"math/rand"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -31,6 +34,8 @@ var confidence = flag.Float64("confidence", 0.99, "Confidence interval.")
 var updateInterval = flag.Duration("intermediate-stats-interval", 1*time.Second,
 	"Show intermediate stats at this interval.")
 var intermediateUpdates = flag.Bool("intermediate-stats", true, "Show intermediate stats every update-interval.")
+var perQueryStats = flag.Bool("per-query-stats", false,
+	"Also report the stats of each query of multi-query jobs.")
 
 /*
  * We use a FileFlagValue so that the query-stats-file is opened when we
@@ -44,48 +49,275 @@ func init() {
 }
 
 type JobStatsSummary struct {
-	Transactions            int             `json:"transactions"`
-	TPS                     float64         `json:"transactionsPerSecond"`
-	TransactionLatency      time.Duration   `json:"transactionLatency"`
-	TransactionLatencyDelta time.Duration   `json:"transactionLatencyDelta"`
-	Rows                    int64           `json:"rows"`
-	RPS                     float64         `json:"rowsPerSecond"`
-	Queries                 uint64          `json:"queries"`
-	QPS                     float64         `json:"queriesPerSecond"`
-	TotalErrors             uint64          `json:"totalErrors"`
-	AcceptedErrors          uint64          `json:"acceptedErrors"`
-	ErrorLatency            time.Duration   `json:"errorLatency"`
-	ErrorLatencyDelta       time.Duration   `json:"errorLatencyDelta"`
-	Start                   time.Duration   `json:"start"`
-	Stop                    time.Duration   `json:"stop"`
+	Transactions            int                           `json:"transactions"`
+	TPS                     float64                       `json:"transactionsPerSecond"`
+	TPSDev                  float64                       `json:"transactionsPerSecondStdDev"`
+	TPSMax                  float64                       `json:"transactionsPerSecondMax"`
+	Throughput              float64                       `json:"throughput"`
+	Goodput                 float64                       `json:"goodput"`
+	TransactionLatency      time.Duration                 `json:"transactionLatency"`
+	TransactionLatencyDelta time.Duration                 `json:"transactionLatencyDelta"`
+	TransactionLatencyDev   time.Duration                 `json:"transactionLatencyStdDev"`
+	TransactionLatencyMax   time.Duration                 `json:"transactionLatencyMax"`
+	Percentiles             map[string]time.Duration      `json:"percentiles,omitempty"`
+	MergedPercentiles       map[string]time.Duration      `json:"allIterationsPercentiles,omitempty"`
+	Baseline                *BaselineSummary              `json:"baseline,omitempty"`
+	Rows                    int64                         `json:"rows"`
+	RPS                     float64                       `json:"rowsPerSecond"`
+	Queries                 uint64                        `json:"queries"`
+	QPS                     float64                       `json:"queriesPerSecond"`
+	TotalErrors             uint64                        `json:"totalErrors"`
+	AcceptedErrors          uint64                        `json:"acceptedErrors"`
+	ToleratedErrors         uint64                        `json:"toleratedErrors"`
+	FailingErrors           uint64                        `json:"failingErrors"`
+	AssertionErrors         uint64                        `json:"assertionErrors"`
+	InjectedErrors          uint64                        `json:"injectedErrors,omitempty"`
+	TimeoutErrors           uint64                        `json:"timeoutErrors,omitempty"`
+	Retries                 uint64                        `json:"retries,omitempty"`
+	RetriesSkipped          uint64                        `json:"retriesSkipped,omitempty"`
+	BytesWritten            int64                         `json:"bytesWritten"`
+	Writes                  int                           `json:"writes"`
+	WriteRowsAffected       int64                         `json:"writeRowsAffected"`
+	RowsAffectedPerWrite    float64                       `json:"rowsAffectedPerWrite"`
+	RowsAffectedPerWriteDev float64                       `json:"rowsAffectedPerWriteStdDev"`
+	ZeroRowWrites           uint64                        `json:"zeroRowWrites"`
+	EmptyResults            uint64                        `json:"emptyResults,omitempty"`
+	IdempotencyMismatches   uint64                        `json:"idempotencyMismatches,omitempty"`
+	IdempotencySample       string                        `json:"idempotencyMismatchSample,omitempty"`
+	ErrorLatency            time.Duration                 `json:"errorLatency"`
+	ErrorLatencyDelta       time.Duration                 `json:"errorLatencyDelta"`
+	Start                   time.Duration                 `json:"start"`
+	Stop                    time.Duration                 `json:"stop"`
+	RateTimeline            []RateChange                  `json:"rateTimeline,omitempty"`
+	Saturation              *float64                      `json:"saturation,omitempty"`
+	Utilization             *float64                      `json:"utilization,omitempty"`
+	ServerLatency           time.Duration                 `json:"serverLatency,omitempty"`
+	ServerLatencyDelta      time.Duration                 `json:"serverLatencyDelta,omitempty"`
+	ExplainPlans            []string                      `json:"explainPlans,omitempty"`
+	RampDown                time.Duration                 `json:"rampDown,omitempty"`
+	TimedOut                bool                          `json:"timedOut,omitempty"`
+	RequestedCount          uint64                        `json:"requestedCount,omitempty"`
+	CompletedCount          uint64                        `json:"completedCount,omitempty"`
+	AverageBatchSize        float64                       `json:"averageBatchSize,omitempty"`
+	PeakInFlight            uint64                        `json:"peakInFlight"`
+	EffectiveParallelism    float64                       `json:"effectiveParallelism"`
+	InFlight                []InFlightSample              `json:"inFlight,omitempty"`
+	TimeSeries              []TimeSeriesWindow            `json:"timeSeries,omitempty"`
+	PerQuery                map[string]*QueryStatsSummary `json:"perQuery,omitempty"`
+	RowCountBuckets         []RowCountBucketSummary       `json:"rowCountBuckets,omitempty"`
+	Phases                  []PhaseSummary                `json:"phases,omitempty"`
+	Shards                  []ShardSummary                `json:"shards,omitempty"`
+	ResultsCapped           bool                          `json:"resultsCapped,omitempty"`
+	ConnectLatency          *QueryStatsSummary            `json:"connectLatency,omitempty"`
+	Probe                   *ProbeSummary                 `json:"probe,omitempty"`
+	IterationVariant        int                           `json:"iterationVariant,omitempty"`
+	ErrorMessages           map[string]uint64             `json:"errors,omitempty"`
+	StatementCache          string                        `json:"statementCache,omitempty"`
+}
+
+type RowCountBucketSummary struct {
+	Rows string `json:"rows"`
+	*QueryStatsSummary
+}
+
+type PhaseSummary struct {
+	Phase string `json:"phase"`
+	*QueryStatsSummary
+}
+
+type ShardSummary struct {
+	Shard string `json:"shard"`
+	*QueryStatsSummary
+}
+
+type QueryStatsSummary struct {
+	Count   int           `json:"count"`
+	Rows    int64         `json:"rows"`
+	Errors  uint64        `json:"errors"`
+	Latency time.Duration `json:"latency"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	P99     time.Duration `json:"p99"`
 }
 
 type jobStats struct {
-	Transactions   StreamingStats
-	Errors         StreamingStats
-	Queries        uint64
-	RowsAffected   int64
-	TotalErrors    uint64
-	AcceptedErrors uint64
-	Start          time.Duration
-	Stop           time.Duration
+	Transactions StreamingStats
+	Errors       StreamingStats
+	// The transactions that count towards the goodput: the successful
+	// ones, and (with accepted-errors-are-goodput) those that only failed
+	// with accepted errors.
+	GoodTransactions uint64
+	// The transactions that failed with a failing error.
+	FailedTransactions uint64
+	Queries            uint64
+	RowsAffected       int64
+	TotalErrors        uint64
+	AcceptedErrors     uint64
+	ToleratedErrors    uint64
+	AssertionErrors    uint64
+	// Errors injected by fail-fraction.
+	InjectedErrors uint64
+	// Queries abandoned after the query-timeout of the job.
+	TimeoutErrors uint64
+	// The retries of failed transactions, and the failed transactions that
+	// were not retried because the retry-budget was exhausted.
+	Retries        uint64
+	RetriesSkipped uint64
+	BytesWritten   int64
+	// The rows affected by each write, i.e. statement that does not return
+	// rows.
+	RowsPerWrite  StreamingStats
+	WriteRows     int64
+	ZeroRowWrites uint64
+	// With warn-empty-results, the queries that returned no rows.
+	EmptyResults uint64
+	// Queries whose result changed when run again with verify-idempotent,
+	// and a description of the first one.
+	IdempotencyMismatches uint64
+	IdempotencySample     string
+	Start                 time.Duration
+	Stop                  time.Duration
 }
 
 type JobStats struct {
 	jobStats
 	Transactions StreamingHistogram
 	Errors       StreamingHistogram
+	RateTimeline []RateChange
+	// The average size of the batches of a job with a batch-size range.
+	AverageBatchSize float64
+	// How long the job ramped down for, if it did.
+	RampDown time.Duration
+	// The timeout that stopped the job, if it did, and the count the job
+	// was asked to run.
+	TimedOut time.Duration
+	Count    uint64
+	// The percentage of time all workers of a queue-depth job were busy.
+	Saturation *float64
+	// The average percentage of the workers of a queue-depth job that were
+	// busy.
+	Utilization *float64
+	// The most invocations of the job in flight at once, overall and per
+	// interval.
+	PeakInFlight   uint64
+	InFlightSeries []InFlightSample
+	// The average number of invocations of the job in flight while it ran.
+	EffectiveParallelism float64
+	// The time the server spent executing the successful transactions,
+	// with server-exec-time.
+	ServerLatency StreamingStats
+	// A sample of the plans returned with explain-analyze, of the
+	// transactions with a plan so far.
+	ExplainPlans []string
+	planCount    int
+	// Stats of each query of the job, by query, with -per-query-stats.
+	PerQuery map[string]*queryStats
+	// Stats of the transactions of the job, by the number of rows they
+	// returned, with row-count-buckets.
+	RowCountBuckets []rowCountBucketStats
+	// Stats of the transactions of the job in each of its phases.
+	Phases []phaseStats
+	// Stats of the transactions of the job by the shard of their key.
+	Shards []shardStats
+	// Whether the query-results-file reached results-max-rows.
+	ResultsCapped bool
+	// The time to establish the connections of a connect-only job.
+	ConnectLatency *queryStats
+	// A sample of the latencies of the successful transactions, and the
+	// highest latency.
+	Latencies  StreamingSample
+	MaxLatency time.Duration
+	// The successful transactions started in each second of the test.
+	secondCounts []uint64
+	// The transactions started in each -time-series-interval of the test.
+	timeSeries []timeSeriesWindow
+	// Whether the probe of the job passed, if it has one.
+	Probe *ProbeSummary
+	// The variant of iteration-query that ran, if the job has any.
+	IterationVariant int
+	// The number of errors with each normalized message.
+	ErrorMessages map[string]uint64
+	// Whether the statements of a prepared job were cached, see
+	// statementCacheMode.
+	StatementCache string
+}
+
+type phaseStats struct {
+	Phase string
+	queryStats
+}
+
+type shardStats struct {
+	Shard string
+	queryStats
+}
+
+type rowCountBucketStats struct {
+	Rows string
+	queryStats
+}
+
+/*
+ * The stats of a single query of a job. Percentiles are computed from a
+ * sample of the latencies.
+ */
+type queryStats struct {
+	Latency      StreamingStats
+	Latencies    StreamingSample
+	RowsAffected int64
+	Errors       uint64
+}
+
+func (qs *queryStats) Update(qr *QueryResult) {
+	if qr.Failed {
+		qs.Errors++
+		return
+	}
+	qs.RowsAffected += qr.RowsAffected
+	qs.Latency.Add(float64(qr.Elapsed))
+	qs.Latencies.Add(float64(qr.Elapsed))
+}
+
+func (qs *queryStats) Percentile(p float64) time.Duration {
+	samples := qs.Latencies.Samples()
+	if len(samples) == 0 {
+		return 0
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		latencies[i] = time.Duration(sample)
+	}
+	return durationPercentile(latencies, p)
+}
+
+func (qs *queryStats) Summary() *QueryStatsSummary {
+	return &QueryStatsSummary{
+		Count:   qs.Latency.Count(),
+		Rows:    qs.RowsAffected,
+		Errors:  qs.Errors,
+		Latency: time.Duration(qs.Latency.Mean()),
+		P50:     qs.Percentile(0.5),
+		P95:     qs.Percentile(0.95),
+		P99:     qs.Percentile(0.99),
+	}
 }
 
 /*
  * The user specified parameters for runner options.
  */
- type ExecutionConfig struct {
-	JsonOutputFile   string
+type ExecutionConfig struct {
+	// The absolute path of the -json output file.
+	JsonOutputFile string
 }
 
 func (js *jobStats) Update(config *Config, jr *JobResult) {
-	js.AcceptedErrors += jr.Errors.TotalAccepted(config.Flavor, config.AcceptedErrors)
+	accepted := jr.Errors.TotalAccepted(config.Flavor, config.AcceptedErrors)
+	tolerated := jr.Errors.TotalAccepted(config.Flavor, config.ToleratedErrors)
+	injected := jr.Errors.TotalInjected()
+	js.AcceptedErrors += accepted
+	js.ToleratedErrors += tolerated
+	js.InjectedErrors += injected
+	js.TimeoutErrors += jr.Errors.TotalTimeouts()
 	if totalErrors := jr.Errors.TotalErrors(); totalErrors > 0 {
 		// TODO(msilver): why do we have both? it appears the concept of "transaction" within dbbench maps to one end to
 		// end execution of a job, even if that job contains multiple queries (this is only possible with the
@@ -94,12 +326,37 @@ func (js *jobStats) Update(config *Config, jr *JobResult) {
 		// "jobs per second".
 		js.TotalErrors += totalErrors      // actual number of errors
 		js.Errors.Add(float64(jr.Elapsed)) // number of jobs that caused errors
+		if config.AcceptedErrorsAreGoodput && accepted == totalErrors {
+			js.GoodTransactions++
+		}
+		if accepted+tolerated+injected < totalErrors {
+			js.FailedTransactions++
+		}
 	} else {
 		// Only count transactions that succeed
 		js.RowsAffected += jr.RowsAffected
 		js.Transactions.Add(float64(jr.Elapsed))
+		js.GoodTransactions++
 	}
 	js.Queries += uint64(jr.Queries)
+	js.AssertionErrors += uint64(jr.AssertionErrors)
+	js.Retries += uint64(jr.Retries)
+	if jr.RetrySkipped {
+		js.RetriesSkipped++
+	}
+	js.BytesWritten += jr.BytesWritten
+	for _, rows := range jr.WriteRowsAffected {
+		js.RowsPerWrite.Add(float64(rows))
+		js.WriteRows += rows
+		if rows == 0 {
+			js.ZeroRowWrites++
+		}
+	}
+	js.EmptyResults += uint64(jr.EmptyResults)
+	js.IdempotencyMismatches += uint64(jr.IdempotencyMismatches)
+	if js.IdempotencySample == "" {
+		js.IdempotencySample = jr.IdempotencySample
+	}
 	if js.Start == 0 || jr.Start < js.Start {
 		js.Start = jr.Start
 	}
@@ -108,41 +365,542 @@ func (js *jobStats) Update(config *Config, jr *JobResult) {
 	}
 }
 
+/*
+ * The transactions per second, whether they succeeded or not.
+ */
+func (js *jobStats) Throughput(seconds float64) float64 {
+	return float64(js.Transactions.Count()+js.Errors.Count()) / seconds
+}
+
+/*
+ * The transactions per second that count towards the goodput.
+ */
+func (js *jobStats) Goodput(seconds float64) float64 {
+	return float64(js.GoodTransactions) / seconds
+}
+
+/*
+ * The fraction of the transactions that failed with a failing error (see
+ * FailingErrors).
+ */
+func (js *jobStats) ErrorRate() float64 {
+	if n := js.Transactions.Count() + js.Errors.Count(); n > 0 {
+		return float64(js.FailedTransactions) / float64(n)
+	}
+	return 0
+}
+
+/*
+ * Errors that were neither accepted, tolerated nor injected.
+ */
+func (js *jobStats) FailingErrors() uint64 {
+	return js.TotalErrors - js.AcceptedErrors - js.ToleratedErrors - js.InjectedErrors
+}
+
 func (js *jobStats) String() string {
 	jsTime := js.Stop.Seconds() - js.Start.Seconds()
-	return fmt.Sprintf("%d transactions (%.3f TPS), latency %v±%v; %d rows (%.3f RPS), %d queries (%.3f QPS); %d aborts (%.3f%%), latency %v±%v",
+	var assertions string
+	if js.AssertionErrors > 0 {
+		assertions = fmt.Sprintf("; %d assertion errors", js.AssertionErrors)
+	}
+	if js.InjectedErrors > 0 {
+		assertions += fmt.Sprintf("; %d injected errors", js.InjectedErrors)
+	}
+	if js.TimeoutErrors > 0 {
+		assertions += fmt.Sprintf("; %d timeouts", js.TimeoutErrors)
+	}
+	if js.Retries > 0 || js.RetriesSkipped > 0 {
+		assertions += fmt.Sprintf("; %d retries, %d skipped by the retry-budget",
+			js.Retries, js.RetriesSkipped)
+	}
+	if js.BytesWritten > 0 {
+		assertions += fmt.Sprintf("; %d bytes written", js.BytesWritten)
+	}
+	if writes := js.RowsPerWrite.Count(); writes > 0 {
+		assertions += fmt.Sprintf("; %d writes, %.3f rows affected per write, %d affected no rows",
+			writes, js.RowsPerWrite.Mean(), js.ZeroRowWrites)
+	}
+	if js.EmptyResults > 0 {
+		assertions += fmt.Sprintf("; %d empty results", js.EmptyResults)
+	}
+	if js.IdempotencyMismatches > 0 {
+		assertions += fmt.Sprintf("; %d idempotency mismatches (e.g. %s)",
+			js.IdempotencyMismatches, js.IdempotencySample)
+	}
+	return fmt.Sprintf("%d transactions (%.3f TPS), latency %v±%v; throughput %.3f TPS, goodput %.3f TPS; %d rows (%.3f RPS), %d queries (%.3f QPS); %d aborts (%.3f%%), latency %v±%v; %d ignored, %d tolerated, %d failing errors%s",
 		js.Transactions.Count(), float64(js.Transactions.Count())/jsTime,
 		time.Duration(js.Transactions.Mean()), time.Duration(js.Transactions.Confidence(*confidence)),
+		js.Throughput(jsTime), js.Goodput(jsTime),
 		js.RowsAffected, float64(js.RowsAffected)/jsTime,
 		js.Queries, float64(js.Queries)/jsTime,
 		// TODO(msilver) see above re inconsistent counting methods. Should we divide by js.Transactions.Count() instead?
 		js.TotalErrors, 100*float64(js.TotalErrors)/float64(js.Queries),
-		time.Duration(js.Errors.Mean()), time.Duration(js.Errors.Confidence(*confidence)))
+		time.Duration(js.Errors.Mean()), time.Duration(js.Errors.Confidence(*confidence)),
+		js.AcceptedErrors, js.ToleratedErrors, js.FailingErrors(), assertions)
 }
 
-func (js *JobStats) Update(config *Config, jr *JobResult) {
-	unhandledErrors := jr.Errors.UnhandledErrors(config.Flavor, config.AcceptedErrors)
+func checkUnhandledErrors(config *Config, jr *JobResult) {
+	unhandledErrors := jr.Errors.UnhandledErrors(config.Flavor, config.AcceptedErrors, config.ToleratedErrors, dbbenchErrorCodes)
 	if len(unhandledErrors) > 0 {
 		log.Fatalf("Unexpected errors while running %v:\n%v", jr.Name, unhandledErrors)
 	}
+}
+
+func (js *JobStats) Update(config *Config, jr *JobResult) {
+	checkUnhandledErrors(config, jr)
 	js.jobStats.Update(config, jr)
 	if jr.Errors.TotalErrors() == 0 {
 		js.Transactions.Add(uint64(jr.Elapsed))
+		js.Latencies.Add(float64(jr.Elapsed))
+		if jr.Elapsed > js.MaxLatency {
+			js.MaxLatency = jr.Elapsed
+		}
+		second := int(jr.Start / time.Second)
+		for len(js.secondCounts) <= second {
+			js.secondCounts = append(js.secondCounts, 0)
+		}
+		js.secondCounts[second]++
+		if jr.ServerTimed {
+			js.ServerLatency.Add(float64(jr.ServerElapsed))
+		}
 	} else {
 		js.Errors.Add(uint64(jr.Elapsed))
+		if js.ErrorMessages == nil {
+			js.ErrorMessages = make(map[string]uint64)
+		}
+		jr.Errors.addMessages(js.ErrorMessages)
+	}
+	js.updateTimeSeries(jr)
+	if jr.Plan != "" {
+		js.addPlan(jr.Plan)
+	}
+	for i := range jr.QueryResults {
+		qr := &jr.QueryResults[i]
+		if js.PerQuery == nil {
+			js.PerQuery = make(map[string]*queryStats)
+		}
+		if _, ok := js.PerQuery[qr.Query]; !ok {
+			js.PerQuery[qr.Query] = new(queryStats)
+		}
+		js.PerQuery[qr.Query].Update(qr)
+	}
+	if job := config.Jobs[jr.Name]; job != nil && len(job.RowCountBuckets) > 0 && jr.Errors.TotalErrors() == 0 {
+		if js.RowCountBuckets == nil {
+			for _, label := range rowCountBucketLabels(job.RowCountBuckets) {
+				js.RowCountBuckets = append(js.RowCountBuckets, rowCountBucketStats{Rows: label})
+			}
+		}
+		bucket := &js.RowCountBuckets[rowCountBucket(job.RowCountBuckets, jr.RowsAffected)]
+		bucket.Update(&QueryResult{Elapsed: jr.Elapsed, RowsAffected: jr.RowsAffected})
+	}
+	if job := config.Jobs[jr.Name]; job != nil && job.ConnectOnly {
+		if js.ConnectLatency == nil {
+			js.ConnectLatency = new(queryStats)
+		}
+		js.ConnectLatency.Update(&QueryResult{
+			Elapsed: jr.Elapsed,
+			Failed:  jr.Errors.TotalErrors() > 0,
+		})
+	} else if job != nil && job.ConnectionPerQuery {
+		if js.ConnectLatency == nil {
+			js.ConnectLatency = new(queryStats)
+		}
+		js.ConnectLatency.Update(&QueryResult{
+			Elapsed: jr.ConnectElapsed,
+			Failed:  jr.ConnectFailed,
+		})
+	}
+	if job := config.Jobs[jr.Name]; job != nil && len(job.Phases) > 0 {
+		if js.Phases == nil {
+			for _, phase := range job.Phases {
+				js.Phases = append(js.Phases, phaseStats{Phase: phase.String()})
+			}
+		}
+		js.Phases[jr.Phase].Update(&QueryResult{
+			Elapsed:      jr.Elapsed,
+			RowsAffected: jr.RowsAffected,
+			Failed:       jr.Errors.TotalErrors() > 0,
+		})
+	}
+	if job := config.Jobs[jr.Name]; job != nil && job.Shards > 0 {
+		if js.Shards == nil {
+			for i := 0; i < job.Shards; i++ {
+				js.Shards = append(js.Shards, shardStats{Shard: strconv.Itoa(i)})
+			}
+		}
+		js.Shards[jr.Shard].Update(&QueryResult{
+			Elapsed:      jr.Elapsed,
+			RowsAffected: jr.RowsAffected,
+			Failed:       jr.Errors.TotalErrors() > 0,
+		})
+	}
+}
+
+// The percentiles of the latencies of the transactions in the summary.
+// They are computed from a sample of the latencies (see -max-sample-count),
+// so the highest need a large sample to be accurate.
+var summaryPercentiles = []struct {
+	name string
+	p    float64
+}{
+	{"p50", 0.5}, {"p75", 0.75}, {"p90", 0.9}, {"p95", 0.95}, {"p99", 0.99}, {"p999", 0.999},
+}
+
+/*
+ * Formats the summary percentiles, as given by the function, for logging.
+ */
+func percentilesString(percentile func(p float64) time.Duration) string {
+	var str strings.Builder
+	for i, p := range summaryPercentiles {
+		if i > 0 {
+			str.WriteString(", ")
+		}
+		str.WriteString(fmt.Sprintf("%s %v", p.name, percentile(p.p)))
+	}
+	return str.String()
+}
+
+func (js *JobStats) Percentile(p float64) time.Duration {
+	samples := js.Latencies.Samples()
+	if len(samples) == 0 {
+		return 0
+	}
+	latencies := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		latencies[i] = time.Duration(sample)
+	}
+	return durationPercentile(latencies, p)
+}
+
+/*
+ * The percentile of the latencies of the successful transactions of a job
+ * across several runs (e.g. the iterations of a test), computed from the
+ * latencies of all of them rather than by averaging their percentiles.
+ * Each run only keeps a sample of its latencies, so each latency in the
+ * sample of a run stands for count/len(sample) of its transactions.
+ */
+func mergedPercentile(runs []*JobStats, p float64) time.Duration {
+	type weightedLatency struct {
+		latency float64
+		weight  float64
+	}
+	var latencies []weightedLatency
+	var total float64
+	for _, js := range runs {
+		samples := js.Latencies.Samples()
+		if len(samples) == 0 {
+			continue
+		}
+		weight := float64(js.Latencies.Count()) / float64(len(samples))
+		for _, sample := range samples {
+			latencies = append(latencies, weightedLatency{sample, weight})
+		}
+		total += float64(js.Latencies.Count())
+	}
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i].latency < latencies[j].latency
+	})
+	var cumulative float64
+	for _, wl := range latencies {
+		cumulative += wl.weight
+		if cumulative >= p*total {
+			return time.Duration(wl.latency)
+		}
+	}
+	return time.Duration(latencies[len(latencies)-1].latency)
+}
+
+/*
+ * Logs the percentiles of the latencies of each job across all the
+ * iterations of a test.
+ */
+func logMergedPercentiles(iterationStats []map[string]*JobStats) {
+	runs := jobRuns(iterationStats)
+	names := make([]string, 0, len(runs))
+	for name := range runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stats := runs[name]
+		log.Printf("all %d iterations: %s: latency %s", len(iterationStats), name,
+			percentilesString(func(p float64) time.Duration { return mergedPercentile(stats, p) }))
+	}
+}
+
+/*
+ * The stats of each job in every iteration it ran.
+ */
+func jobRuns(iterationStats []map[string]*JobStats) map[string][]*JobStats {
+	runs := make(map[string][]*JobStats)
+	for _, testStats := range iterationStats {
+		for name, stats := range testStats {
+			runs[name] = append(runs[name], stats)
+		}
+	}
+	return runs
+}
+
+/*
+ * Sets the percentiles of the latencies of each job across all the
+ * iterations of a test (as logged by logMergedPercentiles) in its summary
+ * of every iteration, if there are several iterations.
+ */
+func setAllIterationsPercentiles(summaries []map[string]*JobStatsSummary, iterationStats []map[string]*JobStats) {
+	if len(iterationStats) < 2 {
+		return
+	}
+	for name, stats := range jobRuns(iterationStats) {
+		var count uint64
+		for _, js := range stats {
+			count += uint64(js.Latencies.Count())
+		}
+		if count == 0 {
+			continue
+		}
+		percentiles := make(map[string]time.Duration, len(summaryPercentiles))
+		for _, p := range summaryPercentiles {
+			percentiles[p.name] = mergedPercentile(stats, p.p)
+		}
+		for _, summary := range summaries {
+			if s, ok := summary[name]; ok {
+				// Each summary gets its own copy, as a baseline is
+				// subtracted from each.
+				s.MergedPercentiles = make(map[string]time.Duration, len(percentiles))
+				for p, latency := range percentiles {
+					s.MergedPercentiles[p] = latency
+				}
+			}
+		}
+	}
+}
+
+/*
+ * The number of successful transactions started in each second the job
+ * ran (from the first to the last).
+ */
+func (js *JobStats) PerSecond() []uint64 {
+	if first := int(js.Start / time.Second); first < len(js.secondCounts) {
+		return js.secondCounts[first:]
+	}
+	return nil
+}
+
+// The number of plans kept of each job with explain-analyze.
+const maxExplainPlans = 5
+
+/*
+ * Keeps a uniform sample of the plans, as StreamingSample does for values.
+ */
+func (js *JobStats) addPlan(plan string) {
+	js.planCount++
+	if len(js.ExplainPlans) < maxExplainPlans {
+		js.ExplainPlans = append(js.ExplainPlans, plan)
+	} else if i := rand.Intn(js.planCount); i < maxExplainPlans {
+		js.ExplainPlans[i] = plan
 	}
 }
 
 func (js *JobStats) String() string {
 	var str strings.Builder
-	str.WriteString(fmt.Sprintf("%v\nTransactions:\n%v", js.jobStats.String(), js.Transactions.Histogram()))
+	str.WriteString(fmt.Sprintf("%v\n", js.jobStats.String()))
+	if js.Latencies.Count() > 0 {
+		str.WriteString(fmt.Sprintf("Latency percentiles: %s\n", percentilesString(js.Percentile)))
+	}
+	str.WriteString(fmt.Sprintf("Transactions:\n%v", js.Transactions.Histogram()))
 	if abortHistogram := js.Errors.Histogram(); len(abortHistogram) > 0 {
 		str.WriteString(fmt.Sprintf("Aborts:\n%v", abortHistogram))
 	}
+	if len(js.ErrorMessages) > 0 {
+		str.WriteString(fmt.Sprintf("Errors by message:\n%v", errorMessagesString(js.ErrorMessages)))
+	}
+	if len(js.RateTimeline) > 0 {
+		str.WriteString(fmt.Sprintf("Rate timeline:\n%v", rateTimelineString(js.RateTimeline)))
+	}
+	if js.AverageBatchSize > 0 {
+		str.WriteString(fmt.Sprintf("Average batch size: %.2f\n", js.AverageBatchSize))
+	}
+	if js.RampDown > 0 {
+		str.WriteString(fmt.Sprintf("Ramped down over %v\n", js.RampDown))
+	}
+	if js.TimedOut > 0 {
+		str.WriteString(fmt.Sprintf("Timed out after %v", js.TimedOut))
+		if js.Count > 0 {
+			str.WriteString(fmt.Sprintf(" with %d of %d transactions completed", js.completed(), js.Count))
+		}
+		str.WriteString("\n")
+	}
+	if js.ResultsCapped {
+		str.WriteString("Query results capped by results-max-rows\n")
+	}
+	if js.Probe != nil {
+		str.WriteString(fmt.Sprintf("%v\n", js.Probe))
+	}
+	if js.IterationVariant > 0 {
+		str.WriteString(fmt.Sprintf("Ran iteration-query variant %d\n", js.IterationVariant))
+	}
+	if js.StatementCache != "" {
+		str.WriteString(fmt.Sprintf("Statement cache: %s\n", js.StatementCache))
+	}
+	if js.Saturation != nil {
+		str.WriteString(fmt.Sprintf("Saturation: %.1f%%\n", *js.Saturation))
+	}
+	if js.ServerLatency.Count() > 0 {
+		str.WriteString(fmt.Sprintf("Server latency: %v±%v (of %d transactions)\n",
+			time.Duration(js.ServerLatency.Mean()),
+			time.Duration(js.ServerLatency.Confidence(*confidence)),
+			js.ServerLatency.Count()))
+	}
+	if len(js.ExplainPlans) > 0 {
+		str.WriteString(fmt.Sprintf("Sampled plan (1 of %d):\n%s", js.planCount, js.ExplainPlans[0]))
+	}
+	if js.Utilization != nil {
+		str.WriteString(fmt.Sprintf("Utilization: %.1f%%\n", *js.Utilization))
+	}
+	if js.PeakInFlight > 0 {
+		str.WriteString(fmt.Sprintf("Peak in-flight: %d\n", js.PeakInFlight))
+		str.WriteString(fmt.Sprintf("Effective parallelism: %.2f\n", js.EffectiveParallelism))
+	}
+	if len(js.RowCountBuckets) > 0 {
+		str.WriteString("Latency by rows:\n")
+		for i := range js.RowCountBuckets {
+			bucket := &js.RowCountBuckets[i]
+			qs := bucket.Summary()
+			str.WriteString(fmt.Sprintf("%12s rows: %d transactions, latency %v (p50 %v, p95 %v, p99 %v)\n",
+				bucket.Rows, qs.Count, qs.Latency, qs.P50, qs.P95, qs.P99))
+		}
+	}
+	if js.ConnectLatency != nil {
+		qs := js.ConnectLatency.Summary()
+		str.WriteString(fmt.Sprintf("Connect latency: %v (p50 %v, p95 %v, p99 %v) of %d connections; %d failed\n",
+			qs.Latency, qs.P50, qs.P95, qs.P99, qs.Count, qs.Errors))
+	}
+	if len(js.Phases) > 0 {
+		str.WriteString("Phases:\n")
+		for i := range js.Phases {
+			phase := &js.Phases[i]
+			qs := phase.Summary()
+			str.WriteString(fmt.Sprintf("%s: %d transactions, latency %v (p50 %v, p95 %v, p99 %v); %d errors\n",
+				phase.Phase, qs.Count, qs.Latency, qs.P50, qs.P95, qs.P99, qs.Errors))
+		}
+	}
+	if len(js.Shards) > 0 {
+		str.WriteString("Shards:\n")
+		for i := range js.Shards {
+			shard := &js.Shards[i]
+			qs := shard.Summary()
+			str.WriteString(fmt.Sprintf("shard %s: %d transactions, latency %v (p50 %v, p95 %v, p99 %v); %d errors\n",
+				shard.Shard, qs.Count, qs.Latency, qs.P50, qs.P95, qs.P99, qs.Errors))
+		}
+	}
+	if len(js.PerQuery) > 0 {
+		queries := make([]string, 0, len(js.PerQuery))
+		for query := range js.PerQuery {
+			queries = append(queries, query)
+		}
+		sort.Strings(queries)
+		str.WriteString("Queries:\n")
+		for _, query := range queries {
+			qs := js.PerQuery[query].Summary()
+			str.WriteString(fmt.Sprintf("%s: %d queries, latency %v (p50 %v, p95 %v, p99 %v); %d rows; %d errors\n",
+				strconv.Quote(query), qs.Count, qs.Latency, qs.P50, qs.P95, qs.P99, qs.Rows, qs.Errors))
+		}
+	}
 	return str.String()
 }
 
+/*
+ * Lists the error messages, the most frequent first, with their counts.
+ */
+func errorMessagesString(messages map[string]uint64) string {
+	sorted := make([]string, 0, len(messages))
+	for message := range messages {
+		sorted = append(sorted, message)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if messages[sorted[i]] != messages[sorted[j]] {
+			return messages[sorted[i]] > messages[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	var str strings.Builder
+	for _, message := range sorted {
+		str.WriteString(fmt.Sprintf("  (%dx) %s\n", messages[message], message))
+	}
+	return str.String()
+}
+
+/*
+ * Adds the information tracked by the job itself while running, rather
+ * than computed from its results.
+ */
+func (js *JobStats) addJobInfo(job *Job) {
+	if job.AdaptiveRate != nil {
+		js.RateTimeline = job.AdaptiveRate.Timeline()
+	}
+	if job.RampedDown {
+		js.RampDown = job.RampDown
+	}
+	if job.TimedOut {
+		js.TimedOut = job.Timeout
+		js.Count = job.Count
+	}
+	if job.MaxBatchSize > 0 {
+		js.AverageBatchSize = job.BatchSizes.Mean()
+	}
+	if job.QueryResults != nil {
+		js.ResultsCapped = job.QueryResults.Capped()
+	}
+	js.Probe = job.ProbeResult
+	js.IterationVariant = job.IterationVariant
+	if job.Prepared {
+		js.StatementCache = statementCacheMode()
+	}
+	if job.InFlight != nil {
+		js.PeakInFlight = job.InFlight.Peak()
+		js.InFlightSeries = job.InFlight.Series()
+		js.EffectiveParallelism = job.InFlight.EffectiveParallelism()
+		if job.QueueDepth > 0 {
+			saturation := job.InFlight.Saturation()
+			js.Saturation = &saturation
+			utilization := job.InFlight.Utilization()
+			js.Utilization = &utilization
+		}
+	}
+}
+
+/*
+ * The number of transactions that completed, successfully or not.
+ */
+func (js *JobStats) completed() uint64 {
+	return uint64(js.jobStats.Transactions.Count() + js.jobStats.Errors.Count())
+}
+
+/*
+ * Clears the stats in place, as if the job had just started.
+ */
+func (js *JobStats) Reset() {
+	*js = JobStats{}
+}
+
 func processResults(config *Config, resultChan <-chan *JobResult) map[string]*JobStats {
+	resets, stop := notifyStatsReset()
+	defer stop()
+	return collectResults(config, resultChan, resets)
+}
+
+/*
+ * Accumulates the results of the jobs until the result channel is closed.
+ * Receiving from resets clears the stats accumulated so far, so that the
+ * final stats only cover the results after the last reset. Since the stats
+ * are only updated here, the reset never races with an update.
+ */
+func collectResults(config *Config, resultChan <-chan *JobResult, resets <-chan os.Signal) map[string]*JobStats {
 	var resultFile *csv.Writer
 	var allTestStats = make(map[string]*JobStats)
 	var recentTestStats = make(map[string]*jobStats)
@@ -153,18 +911,57 @@ func processResults(config *Config, resultChan <-chan *JobResult) map[string]*Jo
 		defer resultFile.Flush()
 	}
 
+	// The latencies of the interval, only sampled for the ndjson file and
+	// -run-until-stable.
+	var recentLatencies map[string]*queryStats
+	if ndjsonFile.GetFile() != nil || config.stability != nil {
+		recentLatencies = make(map[string]*queryStats)
+	}
+	writeIntervals := func(now time.Time, interval time.Duration) {
+		if recentLatencies == nil {
+			return
+		}
+		if ndjsonFile.GetFile() != nil {
+			err := writeIntervalStats(ndjsonFile.GetFile(), now, interval, recentTestStats, recentLatencies)
+			if err != nil {
+				log.Fatalf("Error writing ndjson file: %v", err)
+			}
+		}
+		if config.stability != nil {
+			config.stability.Observe(now, recentLatencies)
+		}
+		recentLatencies = make(map[string]*queryStats)
+	}
+
 	ticker := time.NewTicker(*updateInterval)
-	if !*intermediateUpdates {
+	if !*intermediateUpdates && recentLatencies == nil {
 		ticker.Stop()
 	}
 	defer ticker.Stop()
+	lastTick := time.Now()
 
 	for {
 		select {
 		case jr, ok := <-resultChan:
 			if !ok {
+				if now := time.Now(); len(recentTestStats) > 0 {
+					writeIntervals(now, now.Sub(lastTick))
+				}
+				for name, job := range config.Jobs {
+					if _, ok := allTestStats[name]; !ok && job.ProbeResult != nil {
+						// Report the failed probe of a skipped job.
+						allTestStats[name] = new(JobStats)
+					}
+					if stats, ok := allTestStats[name]; ok {
+						stats.addJobInfo(job)
+					}
+				}
 				return allTestStats
 			}
+			if jr.Warmup {
+				checkUnhandledErrors(config, jr)
+				continue
+			}
 			if resultFile != nil {
 				resultFile.Write([]string{
 					jr.Name,
@@ -183,11 +980,34 @@ func processResults(config *Config, resultChan <-chan *JobResult) map[string]*Jo
 
 			allTestStats[jr.Name].Update(config, jr)
 			recentTestStats[jr.Name].Update(config, jr)
+			if liveMetrics != nil {
+				liveMetrics.Observe(config, jr)
+			}
+			if recentLatencies != nil {
+				if _, ok := recentLatencies[jr.Name]; !ok {
+					recentLatencies[jr.Name] = new(queryStats)
+				}
+				recentLatencies[jr.Name].Update(&QueryResult{
+					Elapsed:      jr.Elapsed,
+					RowsAffected: jr.RowsAffected,
+					Failed:       jr.Errors.TotalErrors() > 0,
+				})
+			}
 
-		case <-ticker.C:
-			for name, stats := range recentTestStats {
-				log.Printf("%s: %v", name, stats)
+		case <-resets:
+			log.Printf("Resetting the stats of %d jobs", len(allTestStats))
+			for _, stats := range allTestStats {
+				stats.Reset()
 			}
+
+		case now := <-ticker.C:
+			if *intermediateUpdates {
+				for name, stats := range recentTestStats {
+					log.Printf("%s: %v; error rate %.3f%%", name, stats, 100*stats.ErrorRate())
+				}
+			}
+			writeIntervals(now, now.Sub(lastTick))
+			lastTick = now
 			recentTestStats = make(map[string]*jobStats)
 		}
 	}
@@ -200,24 +1020,109 @@ func getJobsSummary(jobs map[string]*JobStats) map[string]*JobStatsSummary {
 		jobStats := stats.jobStats
 
 		jobStatsSummary := &JobStatsSummary{
-			Transactions: jobStats.Transactions.Count(),
-			TransactionLatency: time.Duration(jobStats.Transactions.Mean()),
+			Transactions:            jobStats.Transactions.Count(),
+			TransactionLatency:      time.Duration(jobStats.Transactions.Mean()),
 			TransactionLatencyDelta: time.Duration(jobStats.Transactions.Confidence(*confidence)),
-			Rows: jobStats.RowsAffected,
-			Queries: jobStats.Queries,
-			TotalErrors: jobStats.TotalErrors,
-			AcceptedErrors: jobStats.AcceptedErrors,
-			ErrorLatency: time.Duration(jobStats.Errors.Mean()),
-			ErrorLatencyDelta: time.Duration(jobStats.Errors.Confidence(*confidence)),
-			Start: jobStats.Start,
-			Stop: jobStats.Stop,
-		}
-		
+			Rows:                    jobStats.RowsAffected,
+			Queries:                 jobStats.Queries,
+			TotalErrors:             jobStats.TotalErrors,
+			AcceptedErrors:          jobStats.AcceptedErrors,
+			ToleratedErrors:         jobStats.ToleratedErrors,
+			FailingErrors:           jobStats.FailingErrors(),
+			AssertionErrors:         jobStats.AssertionErrors,
+			InjectedErrors:          jobStats.InjectedErrors,
+			TimeoutErrors:           jobStats.TimeoutErrors,
+			Retries:                 jobStats.Retries,
+			RetriesSkipped:          jobStats.RetriesSkipped,
+			BytesWritten:            jobStats.BytesWritten,
+			Writes:                  jobStats.RowsPerWrite.Count(),
+			WriteRowsAffected:       jobStats.WriteRows,
+			RowsAffectedPerWrite:    jobStats.RowsPerWrite.Mean(),
+			RowsAffectedPerWriteDev: jobStats.RowsPerWrite.SampleStdDev(),
+			ZeroRowWrites:           jobStats.ZeroRowWrites,
+			EmptyResults:            jobStats.EmptyResults,
+			IdempotencyMismatches:   jobStats.IdempotencyMismatches,
+			IdempotencySample:       jobStats.IdempotencySample,
+			ErrorLatency:            time.Duration(jobStats.Errors.Mean()),
+			ErrorLatencyDelta:       time.Duration(jobStats.Errors.Confidence(*confidence)),
+			Start:                   jobStats.Start,
+			Stop:                    jobStats.Stop,
+			RateTimeline:            stats.RateTimeline,
+			Saturation:              stats.Saturation,
+			Utilization:             stats.Utilization,
+			ServerLatency:           time.Duration(stats.ServerLatency.Mean()),
+			ServerLatencyDelta:      time.Duration(stats.ServerLatency.Confidence(*confidence)),
+			ExplainPlans:            stats.ExplainPlans,
+			RampDown:                stats.RampDown,
+			TimedOut:                stats.TimedOut > 0,
+			RequestedCount:          stats.Count,
+			AverageBatchSize:        stats.AverageBatchSize,
+			PeakInFlight:            stats.PeakInFlight,
+			EffectiveParallelism:    stats.EffectiveParallelism,
+			ResultsCapped:           stats.ResultsCapped,
+			InFlight:                stats.InFlightSeries,
+			TimeSeries:              stats.TimeSeries(),
+			Probe:                   stats.Probe,
+			IterationVariant:        stats.IterationVariant,
+			ErrorMessages:           stats.ErrorMessages,
+			StatementCache:          stats.StatementCache,
+			TransactionLatencyDev:   time.Duration(jobStats.Transactions.SampleStdDev()),
+			TransactionLatencyMax:   stats.MaxLatency,
+		}
+
+		if stats.Latencies.Count() > 0 {
+			jobStatsSummary.Percentiles = make(map[string]time.Duration, len(summaryPercentiles))
+			for _, p := range summaryPercentiles {
+				jobStatsSummary.Percentiles[p.name] = stats.Percentile(p.p)
+			}
+		}
+		var perSecond StreamingStats
+		for _, count := range stats.PerSecond() {
+			perSecond.Add(float64(count))
+			jobStatsSummary.TPSMax = math.Max(jobStatsSummary.TPSMax, float64(count))
+		}
+		jobStatsSummary.TPSDev = perSecond.SampleStdDev()
+
+		if stats.TimedOut > 0 {
+			jobStatsSummary.CompletedCount = stats.completed()
+		}
+
+		for i := range stats.RowCountBuckets {
+			bucket := &stats.RowCountBuckets[i]
+			jobStatsSummary.RowCountBuckets = append(jobStatsSummary.RowCountBuckets,
+				RowCountBucketSummary{bucket.Rows, bucket.Summary()})
+		}
+
+		if stats.ConnectLatency != nil {
+			jobStatsSummary.ConnectLatency = stats.ConnectLatency.Summary()
+		}
+
+		for i := range stats.Phases {
+			phase := &stats.Phases[i]
+			jobStatsSummary.Phases = append(jobStatsSummary.Phases,
+				PhaseSummary{phase.Phase, phase.Summary()})
+		}
+
+		for i := range stats.Shards {
+			shard := &stats.Shards[i]
+			jobStatsSummary.Shards = append(jobStatsSummary.Shards,
+				ShardSummary{shard.Shard, shard.Summary()})
+		}
+
+		if len(stats.PerQuery) > 0 {
+			jobStatsSummary.PerQuery = make(map[string]*QueryStatsSummary, len(stats.PerQuery))
+			for query, qs := range stats.PerQuery {
+				jobStatsSummary.PerQuery[query] = qs.Summary()
+			}
+		}
+
 		jobTime := stats.Stop.Seconds() - stats.Start.Seconds()
 		if math.Abs(jobTime) > 0.000001 {
-			jobStatsSummary.TPS = float64(jobStats.Transactions.Count())/jobTime
-			jobStatsSummary.RPS = float64(jobStats.RowsAffected)/jobTime
-			jobStatsSummary.QPS = float64(jobStats.Queries)/jobTime
+			jobStatsSummary.TPS = float64(jobStats.Transactions.Count()) / jobTime
+			jobStatsSummary.Throughput = jobStats.Throughput(jobTime)
+			jobStatsSummary.Goodput = jobStats.Goodput(jobTime)
+			jobStatsSummary.RPS = float64(jobStats.RowsAffected) / jobTime
+			jobStatsSummary.QPS = float64(jobStats.Queries) / jobTime
 		}
 
 		jobsSummary[name] = jobStatsSummary
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGoodput(t *testing.T) {
+	results := []*JobResult{
+		{Name: "test", Elapsed: time.Millisecond, Errors: ErrorCounts{}},
+		{Name: "test", Elapsed: time.Millisecond, Errors: ErrorCounts{}},
+		{Name: "test", Elapsed: time.Millisecond,
+			Errors: ErrorCounts{"1205": errorCounts{errorsPerQuery{"q": 1}, nil, nil}}},
+		{Name: "test", Elapsed: time.Millisecond,
+			Errors: ErrorCounts{"1213": errorCounts{errorsPerQuery{"q": 1}, nil, nil}}},
+	}
+
+	for _, c := range []struct {
+		acceptedErrorsAreGoodput bool
+		goodput                  float64
+	}{
+		{false, 1},
+		{true, 1.5},
+	} {
+		config := &Config{
+			Flavor:                   testFlavor(t, "mysql"),
+			AcceptedErrors:           Set{"1205": struct{}{}},
+			ToleratedErrors:          Set{"1213": struct{}{}},
+			AcceptedErrorsAreGoodput: c.acceptedErrorsAreGoodput,
+		}
+		var js jobStats
+		for _, jr := range results {
+			js.Update(config, jr)
+		}
+		if throughput := js.Throughput(2); throughput != 2 {
+			t.Errorf("Expected throughput of 2 but got %v", throughput)
+		}
+		if goodput := js.Goodput(2); goodput != c.goodput {
+			t.Errorf("Expected goodput of %v with accepted-errors-are-goodput=%v but got %v",
+				c.goodput, c.acceptedErrorsAreGoodput, goodput)
+		}
+		// Neither the accepted nor the tolerated error is failing.
+		if rate := js.ErrorRate(); rate != 0 {
+			t.Errorf("Expected an error rate of 0 but got %v", rate)
+		}
+	}
+}
+
+func TestErrorRate(t *testing.T) {
+	config := &Config{
+		Flavor:          testFlavor(t, "mysql"),
+		AcceptedErrors:  Set{"1205": struct{}{}},
+		ToleratedErrors: Set{"1213": struct{}{}},
+	}
+	injected := make(ErrorCounts)
+	injected.AddInjected("q")
+	var js jobStats
+	for _, errors := range []ErrorCounts{
+		{},
+		{"1205": errorCounts{errorsPerQuery{"q": 1}, nil, nil}},
+		{"1213": errorCounts{errorsPerQuery{"q": 1}, nil, nil}},
+		injected,
+		{"1062": errorCounts{errorsPerQuery{"q": 1}, nil, nil}},
+	} {
+		js.Update(config, &JobResult{Name: "test", Elapsed: time.Millisecond, Errors: errors})
+	}
+	if n := js.FailingErrors(); n != 1 {
+		t.Errorf("Expected 1 failing error but got %d", n)
+	}
+	if rate := js.ErrorRate(); rate != 0.2 {
+		t.Errorf("Expected only the failing error to count towards the error rate but got %v", rate)
+	}
+}
+
+func TestCollectResultsReset(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs:   map[string]*Job{"before": {}, "after": {}},
+	}
+	resultChan := make(chan *JobResult)
+	resets := make(chan os.Signal)
+	done := make(chan map[string]*JobStats)
+	go func() { done <- collectResults(config, resultChan, resets) }()
+
+	for i := 0; i < 3; i++ {
+		resultChan <- &JobResult{Name: "before", Elapsed: time.Millisecond, Errors: ErrorCounts{}}
+		resultChan <- &JobResult{Name: "after", Elapsed: time.Millisecond, Errors: ErrorCounts{}}
+	}
+	resets <- os.Interrupt
+	resultChan <- &JobResult{Name: "after", Elapsed: time.Second, Errors: ErrorCounts{}}
+	close(resultChan)
+	stats := <-done
+
+	if before, ok := stats["before"]; !ok {
+		t.Errorf("Expected the stats of before to be kept after the reset")
+	} else if count := before.jobStats.Transactions.Count(); count != 0 {
+		t.Errorf("Expected no transactions for before but got %d", count)
+	}
+	if after := stats["after"]; after.jobStats.Transactions.Count() != 1 ||
+		time.Duration(after.jobStats.Transactions.Mean()) != time.Second {
+		t.Errorf("Expected only the transaction after the reset but got %v", after)
+	}
+}
+
+func TestMergedPercentile(t *testing.T) {
+	// A short iteration with latencies of 1-10ms, and a long one in which
+	// all 1000 transactions took 100ms but only 10 were sampled.
+	short := new(JobStats)
+	for i := 1; i <= 10; i++ {
+		short.Latencies.samples = append(short.Latencies.samples, float64(time.Duration(i)*time.Millisecond))
+	}
+	short.Latencies.count = 10
+	long := new(JobStats)
+	for i := 0; i < 10; i++ {
+		long.Latencies.samples = append(long.Latencies.samples, float64(100*time.Millisecond))
+	}
+	long.Latencies.count = 1000
+
+	runs := []*JobStats{short, long}
+	if p50 := mergedPercentile(runs, 0.5); p50 != 100*time.Millisecond {
+		t.Errorf("Expected a merged p50 of 100ms but got %v", p50)
+	}
+	if p := mergedPercentile(runs, 0.004); p != 5*time.Millisecond {
+		t.Errorf("Expected the 5th of 1010 latencies to be 5ms but got %v", p)
+	}
+	if p := mergedPercentile([]*JobStats{new(JobStats)}, 0.5); p != 0 {
+		t.Errorf("Expected no percentile without latencies but got %v", p)
+	}
+}
+
+func TestSetAllIterationsPercentiles(t *testing.T) {
+	short := new(JobStats)
+	short.Latencies.samples = []float64{float64(time.Millisecond)}
+	short.Latencies.count = 1
+	long := new(JobStats)
+	long.Latencies.samples = []float64{float64(time.Second)}
+	long.Latencies.count = 3
+	iterationStats := []map[string]*JobStats{{"job": short}, {"job": long}}
+	summaries := []map[string]*JobStatsSummary{{"job": {}}, {"job": {}}}
+
+	setAllIterationsPercentiles(summaries[:1], iterationStats[:1])
+	if summaries[0]["job"].MergedPercentiles != nil {
+		t.Errorf("Expected no percentiles across a single iteration")
+	}
+	setAllIterationsPercentiles(summaries, iterationStats)
+	for i, summary := range summaries {
+		merged := summary["job"].MergedPercentiles
+		if merged["p50"] != time.Second || len(merged) != len(summaryPercentiles) {
+			t.Errorf("Expected the percentiles across all iterations in iteration %d but got %v", i+1, merged)
+		}
+	}
+	summaries[0]["job"].MergedPercentiles["p50"] = 0
+	if summaries[1]["job"].MergedPercentiles["p50"] != time.Second {
+		t.Errorf("Expected each iteration to have its own percentiles")
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var metricsAddr = flag.String("metrics-addr", "",
+	"Serve Prometheus metrics of the jobs (queries, transactions, errors and "+
+		"latency) at http://<addr>/metrics while the test runs, e.g. :9090.")
+
+// How long to wait for in flight scrapes when stopping the metrics server.
+const metricsShutdownTimeout = time.Second
+
+// The upper bounds of the buckets of the latency histogram, in seconds:
+// from 100us, doubling up to about 13s.
+var latencyBuckets = func() []float64 {
+	buckets := make([]float64, 18)
+	for i := range buckets {
+		buckets[i] = 0.0001 * float64(uint(1)<<uint(i))
+	}
+	return buckets
+}()
+
+type jobMetrics struct {
+	queries      uint64
+	transactions uint64
+	// The errors of the transactions, apart from the accepted errors.
+	errors         uint64
+	acceptedErrors uint64
+	// The count of the latencies in each bucket (not cumulative), and
+	// their sum in seconds.
+	buckets    []uint64
+	latencySum float64
+}
+
+/*
+ * The metrics of the jobs since the test started, exported to Prometheus.
+ * Unlike the stats, they are never reset, as counters must only increase.
+ */
+type metricsRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*jobMetrics
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{jobs: make(map[string]*jobMetrics)}
+}
+
+// The metrics updated as the results are processed; nil unless serving
+// -metrics-addr.
+var liveMetrics *metricsRegistry
+
+func (mr *metricsRegistry) Observe(config *Config, jr *JobResult) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	jm, ok := mr.jobs[jr.Name]
+	if !ok {
+		jm = &jobMetrics{buckets: make([]uint64, len(latencyBuckets)+1)}
+		mr.jobs[jr.Name] = jm
+	}
+	jm.queries += uint64(jr.Queries)
+	jm.transactions++
+	accepted := jr.Errors.TotalAccepted(config.Flavor, config.AcceptedErrors)
+	jm.errors += jr.Errors.TotalErrors() - accepted
+	jm.acceptedErrors += accepted
+	seconds := jr.Elapsed.Seconds()
+	jm.buckets[sort.SearchFloat64s(latencyBuckets, seconds)]++
+	jm.latencySum += seconds
+}
+
+/*
+ * Writes the metrics in the Prometheus text format, each labeled with the
+ * name of its job.
+ */
+func (mr *metricsRegistry) WriteMetrics(w io.Writer) error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	names := make([]string, 0, len(mr.jobs))
+	for name := range mr.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, counter := range []struct {
+		name, help string
+		value      func(jm *jobMetrics) uint64
+	}{
+		{queriesMetric, "Queries run by the job.", func(jm *jobMetrics) uint64 { return jm.queries }},
+		{transactionsMetric, "Transactions (invocations) of the job.", func(jm *jobMetrics) uint64 { return jm.transactions }},
+		{errorsMetric, "Errors of the transactions of the job, except accepted errors.", func(jm *jobMetrics) uint64 { return jm.errors }},
+		{acceptedErrorsMetric, "Accepted errors of the transactions of the job.", func(jm *jobMetrics) uint64 { return jm.acceptedErrors }},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{%s=%s} %d\n", counter.name, jobLabel, quoteLabelValue(name), counter.value(mr.jobs[name])); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "# HELP %s Latency of the transactions of the job.\n# TYPE %s histogram\n", latencyMetric, latencyMetric); err != nil {
+		return err
+	}
+	for _, name := range names {
+		jm := mr.jobs[name]
+		label := fmt.Sprintf("%s=%s", jobLabel, quoteLabelValue(name))
+		var cumulative uint64
+		for i, count := range jm.buckets {
+			cumulative += count
+			le := "+Inf"
+			if i < len(latencyBuckets) {
+				le = strconv.FormatFloat(latencyBuckets[i], 'g', -1, 64)
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", latencyMetric, label, le, cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum{%s} %g\n%s_count{%s} %d\n",
+			latencyMetric, label, jm.latencySum, latencyMetric, label, jm.transactions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The escapes of label values in the Prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+/*
+ * Quotes a label value for the Prometheus text format, which only escapes
+ * backslashes, double quotes and newlines. Other characters are written as
+ * is, while strconv.Quote would escape e.g. tabs and invalid UTF-8, which
+ * Prometheus does not unescape.
+ */
+func quoteLabelValue(v string) string {
+	return `"` + labelValueEscaper.Replace(v) + `"`
+}
+
+func (mr *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := mr.WriteMetrics(w); err != nil {
+		log.Printf("Error serving metrics: %v", err)
+	}
+}
+
+/*
+ * Serves the metrics of -metrics-addr, if given, until the returned
+ * function is called.
+ */
+func startMetricsServer() func() {
+	if *metricsAddr == "" {
+		return func() {}
+	}
+
+	listener, err := net.Listen("tcp", *metricsAddr)
+	if err != nil {
+		log.Fatalf("listening on -metrics-addr: %v", err)
+	}
+	liveMetrics = newMetricsRegistry()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", liveMetrics)
+	server := &http.Server{Handler: mux}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("Error serving metrics: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics at http://%s/metrics", listener.Addr())
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error stopping the metrics server: %v", err)
+		}
+		<-done
+		liveMetrics = nil
+	}
+}
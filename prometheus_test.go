@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	config := &Config{
+		Flavor:         testFlavor(t, "mysql"),
+		AcceptedErrors: Set{"1062": struct{}{}},
+	}
+	mr := newMetricsRegistry()
+	mr.Observe(config, &JobResult{Name: "reads", Queries: 2, Elapsed: 150 * time.Microsecond})
+	mr.Observe(config, &JobResult{Name: "reads", Queries: 2, Elapsed: 3 * time.Millisecond,
+		Errors: ErrorCounts{
+			"1205": errorCounts{errorsPerQuery{"q": 1}, nil, nil},
+			"1062": errorCounts{errorsPerQuery{"q": 2}, nil, nil},
+		}})
+	mr.Observe(config, &JobResult{Name: `say "hi"`, Queries: 1, Elapsed: time.Minute})
+	mr.Observe(config, &JobResult{Name: "café\t\\\n", Queries: 1, Elapsed: time.Second})
+
+	server := httptest.NewServer(mr)
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Error scraping metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Error reading metrics: %v", err)
+	}
+
+	for _, expected := range []string{
+		"# TYPE dbbench_queries_total counter\n",
+		`dbbench_queries_total{dbbench_job="reads"} 4` + "\n",
+		`dbbench_transactions_total{dbbench_job="reads"} 2` + "\n",
+		`dbbench_errors_total{dbbench_job="reads"} 1` + "\n",
+		`dbbench_errors_total{dbbench_job="say \"hi\""} 0` + "\n",
+		`dbbench_accepted_errors_total{dbbench_job="reads"} 2` + "\n",
+		"dbbench_queries_total{dbbench_job=\"café\t\\\\\\n\"} 1\n",
+		"# TYPE dbbench_transaction_latency_seconds histogram\n",
+		`dbbench_transaction_latency_seconds_bucket{dbbench_job="reads",le="0.0001"} 0` + "\n",
+		`dbbench_transaction_latency_seconds_bucket{dbbench_job="reads",le="0.0002"} 1` + "\n",
+		`dbbench_transaction_latency_seconds_bucket{dbbench_job="reads",le="0.0032"} 2` + "\n",
+		`dbbench_transaction_latency_seconds_bucket{dbbench_job="say \"hi\"",le="13.1072"} 0` + "\n",
+		`dbbench_transaction_latency_seconds_bucket{dbbench_job="say \"hi\"",le="+Inf"} 1` + "\n",
+		`dbbench_transaction_latency_seconds_count{dbbench_job="reads"} 2` + "\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected metrics to contain %q but got\n%s", expected, body)
+		}
+	}
+}
+
+func TestMetricsServerStops(t *testing.T) {
+	defer func(addr string) { *metricsAddr = addr }(*metricsAddr)
+	*metricsAddr = "127.0.0.1:0"
+
+	stop := startMetricsServer()
+	if liveMetrics == nil {
+		t.Fatalf("Expected the metrics to be collected while serving")
+	}
+	stop()
+	if liveMetrics != nil {
+		t.Errorf("Expected the metrics to stop being collected")
+	}
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * A single query read from a query log, along with the time (in
+ * microseconds) at which it was originally issued.
+ */
+type queryLogEntry struct {
+	timeMicros int64
+	query      string
+}
+
+/*
+ * A parser for a particular query log format.
+ */
+type queryLogReader interface {
+	/*
+	 * Returns the next query in the log, or io.EOF if there are no more
+	 * queries. Any other error is fatal to the replay.
+	 */
+	Next() (*queryLogEntry, error)
+
+	/*
+	 * The number of unparseable lines that were skipped so far.
+	 */
+	Skipped() uint64
+}
+
+var queryLogFormats = map[string]func(io.Reader) queryLogReader{
+	"csv":           newCSVQueryLogReader,
+	"mysql-general": newMySQLGeneralLogReader,
+	"mysql-slow":    newMySQLSlowLogReader,
+}
+
+const defaultQueryLogFormat = "csv"
+
+/*
+ * The native dbbench format: one "<time in micros>,<query>" record per line.
+ */
+type csvQueryLogReader struct {
+	scanner *bufio.Scanner
+	line    uint64
+}
+
+func newCSVQueryLogReader(r io.Reader) queryLogReader {
+	return &csvQueryLogReader{scanner: bufio.NewScanner(r)}
+}
+
+func (r *csvQueryLogReader) Next() (*queryLogEntry, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	r.line++
+
+	parts := strings.SplitN(r.scanner.Text(), ",", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid query log on line %d", r.line)
+	}
+	timeMicros, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query log time on line %d: %v",
+			r.line, err)
+	}
+	return &queryLogEntry{timeMicros, parts[1]}, nil
+}
+
+func (r *csvQueryLogReader) Skipped() uint64 {
+	return 0
+}
+
+/*
+ * Both MySQL log formats start with a banner describing the server, which
+ * is repeated every time the server is restarted.
+ */
+func isMySQLLogHeader(line string) bool {
+	return strings.Contains(line, ", Version: ") ||
+		strings.HasPrefix(line, "Tcp port: ") ||
+		strings.HasPrefix(line, "Time ") && strings.Contains(line, "Id Command")
+}
+
+/*
+ * Parses the timestamps used by MySQL logs: either RFC3339 (MySQL 5.7+) or
+ * the legacy "YYMMDD HH:MM:SS" format.
+ */
+func parseMySQLLogTime(s string) (int64, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		if t, err = time.Parse("060102 15:04:05", s); err != nil {
+			return 0, err
+		}
+	}
+	return t.UnixNano() / int64(time.Microsecond), nil
+}
+
+/*
+ * The MySQL general query log, e.g.
+ *
+ *     2020-06-22T21:00:00.123456Z	    8 Query	select 1
+ *
+ * Only "Query" commands are replayed. Queries may span multiple lines.
+ */
+type mySQLGeneralLogReader struct {
+	scanner  *bufio.Scanner
+	skipped  uint64
+	lastTime int64
+	pending  *queryLogEntry
+}
+
+func newMySQLGeneralLogReader(r io.Reader) queryLogReader {
+	return &mySQLGeneralLogReader{scanner: bufio.NewScanner(r)}
+}
+
+/*
+ * Splits a general log line into its time, command and argument. The time
+ * is empty for legacy entries logged within the same second as the previous
+ * entry.
+ */
+func splitMySQLGeneralLogLine(line string) (t, command, argument string, ok bool) {
+	var rest string
+	if strings.HasPrefix(line, "\t\t") {
+		rest = line[2:]
+	} else if i := strings.IndexByte(line, '\t'); i > 0 {
+		t, rest = line[:i], line[i+1:]
+	} else {
+		return "", "", "", false
+	}
+
+	parts := strings.SplitN(rest, "\t", 2)
+	fields := strings.Fields(parts[0])
+	if len(fields) < 2 {
+		return "", "", "", false
+	}
+	if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return "", "", "", false
+	}
+	if len(parts) == 2 {
+		argument = parts[1]
+	}
+	return t, strings.Join(fields[1:], " "), argument, true
+}
+
+func (r *mySQLGeneralLogReader) Next() (*queryLogEntry, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if isMySQLLogHeader(line) {
+			continue
+		}
+
+		t, command, argument, ok := splitMySQLGeneralLogLine(line)
+		if !ok {
+			// Continuation of a multi-line query.
+			if r.pending != nil {
+				r.pending.query += "\n" + line
+			} else {
+				r.skipped++
+			}
+			continue
+		}
+
+		if t != "" {
+			timeMicros, err := parseMySQLLogTime(t)
+			if err != nil {
+				r.skipped++
+				continue
+			}
+			r.lastTime = timeMicros
+		}
+
+		entry := r.pending
+		r.pending = nil
+		if command == "Query" {
+			r.pending = &queryLogEntry{r.lastTime, argument}
+		}
+		if entry != nil {
+			return entry, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if entry := r.pending; entry != nil {
+		r.pending = nil
+		return entry, nil
+	}
+	return nil, io.EOF
+}
+
+func (r *mySQLGeneralLogReader) Skipped() uint64 {
+	return r.skipped
+}
+
+/*
+ * The MySQL slow query log, e.g.
+ *
+ *     # Time: 2020-06-22T21:00:00.123456Z
+ *     # User@Host: root[root] @ localhost []  Id:     8
+ *     # Query_time: 0.000152  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 0
+ *     SET timestamp=1592859600;
+ *     select 1;
+ *
+ * The "# Time:" line is preferred for timing since it has sub-second
+ * precision, falling back to the "SET timestamp" line otherwise.
+ */
+type mySQLSlowLogReader struct {
+	scanner  *bufio.Scanner
+	skipped  uint64
+	lastTime int64
+	haveTime bool
+	query    strings.Builder
+}
+
+func newMySQLSlowLogReader(r io.Reader) queryLogReader {
+	return &mySQLSlowLogReader{scanner: bufio.NewScanner(r)}
+}
+
+func (r *mySQLSlowLogReader) flush() *queryLogEntry {
+	query := strings.TrimSpace(r.query.String())
+	r.query.Reset()
+	if query == "" {
+		return nil
+	}
+	r.haveTime = false
+	return &queryLogEntry{r.lastTime, strings.TrimSuffix(query, ";")}
+}
+
+func (r *mySQLSlowLogReader) Next() (*queryLogEntry, error) {
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		lower := strings.ToLower(trimmed)
+
+		switch {
+		case isMySQLLogHeader(line):
+		case strings.HasPrefix(line, "#"):
+			// A comment line always starts a new entry; flush any
+			// unterminated query.
+			entry := r.flush()
+			if strings.HasPrefix(line, "# Time:") {
+				if timeMicros, err := parseMySQLLogTime(line[len("# Time:"):]); err != nil {
+					r.skipped++
+				} else {
+					r.lastTime = timeMicros
+					r.haveTime = true
+				}
+			}
+			if entry != nil {
+				return entry, nil
+			}
+		case r.query.Len() == 0 && strings.HasPrefix(lower, "set timestamp="):
+			v := strings.TrimSuffix(trimmed[len("set timestamp="):], ";")
+			if seconds, err := strconv.ParseInt(v, 10, 64); err != nil {
+				r.skipped++
+			} else if !r.haveTime {
+				r.lastTime = seconds * int64(time.Second/time.Microsecond)
+			}
+		case r.query.Len() == 0 && strings.HasPrefix(lower, "use "):
+			// The slow log records the current database before the
+			// query; this cannot be replayed on a connection pool.
+		default:
+			if r.query.Len() > 0 {
+				r.query.WriteString("\n")
+			}
+			r.query.WriteString(line)
+			if strings.HasSuffix(trimmed, ";") {
+				if entry := r.flush(); entry != nil {
+					return entry, nil
+				}
+			}
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if entry := r.flush(); entry != nil {
+		return entry, nil
+	}
+	return nil, io.EOF
+}
+
+func (r *mySQLSlowLogReader) Skipped() uint64 {
+	return r.skipped
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readQueryLog(t *testing.T, format string, in string) ([]queryLogEntry, uint64) {
+	reader := queryLogFormats[format](strings.NewReader(in))
+	var entries []queryLogEntry
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Error reading %s query log: %v", format, err)
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, reader.Skipped()
+}
+
+func TestQueryLogFormats(t *testing.T) {
+	var cases = []struct {
+		format  string
+		in      string
+		out     []queryLogEntry
+		skipped uint64
+	}{
+		{"csv", "0,select 1\n500,select 2, 3\n",
+			[]queryLogEntry{{0, "select 1"}, {500, "select 2, 3"}}, 0,
+		},
+		{"mysql-general",
+			"/usr/sbin/mysqld, Version: 5.7.30 (MySQL Community Server (GPL)). started with:\n" +
+				"Tcp port: 3306  Unix socket: /tmp/mysql.sock\n" +
+				"Time                 Id Command    Argument\n" +
+				"2020-06-22T21:00:00.000001Z\t    8 Connect\troot@localhost on  using Socket\n" +
+				"2020-06-22T21:00:00.000010Z\t    8 Query\tselect 1\n" +
+				"2020-06-22T21:00:00.000500Z\t    8 Query\tselect *\n" +
+				"from t\n" +
+				"garbage\t    8 Query\tselect 3\n" +
+				"2020-06-22T21:00:01.000000Z\t    8 Quit\t\n",
+			[]queryLogEntry{
+				{1592859600000010, "select 1"},
+				{1592859600000500, "select *\nfrom t"},
+			}, 1,
+		},
+		{"mysql-general",
+			"200622 21:00:00\t    8 Query\tselect 1\n" +
+				"\t\t    8 Query\tselect 2\n",
+			[]queryLogEntry{
+				{1592859600000000, "select 1"},
+				{1592859600000000, "select 2"},
+			}, 0,
+		},
+		{"mysql-slow",
+			"/usr/sbin/mysqld, Version: 5.7.30 (MySQL Community Server (GPL)). started with:\n" +
+				"Tcp port: 3306  Unix socket: /tmp/mysql.sock\n" +
+				"Time                 Id Command    Argument\n" +
+				"# Time: 2020-06-22T21:00:00.000010Z\n" +
+				"# User@Host: root[root] @ localhost []  Id:     8\n" +
+				"# Query_time: 0.000152  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 0\n" +
+				"use test;\n" +
+				"SET timestamp=1592859600;\n" +
+				"select 1;\n" +
+				"# User@Host: root[root] @ localhost []  Id:     8\n" +
+				"# Query_time: 0.000152  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 0\n" +
+				"SET timestamp=1592859601;\n" +
+				"select *\n" +
+				"from t;\n" +
+				"# Time: not a time\n" +
+				"SET timestamp=1592859602;\n" +
+				"select 3;\n",
+			[]queryLogEntry{
+				{1592859600000010, "select 1"},
+				{1592859601000000, "select *\nfrom t"},
+				{1592859602000000, "select 3"},
+			}, 1,
+		},
+	}
+
+	for _, c := range cases {
+		entries, skipped := readQueryLog(t, c.format, c.in)
+		if !reflect.DeepEqual(entries, c.out) {
+			t.Errorf("Failure reading %s query log:\ngot\t\t%v\nbut expected\t%v",
+				c.format, entries, c.out)
+		}
+		if skipped != c.skipped {
+			t.Errorf("Failure reading %s query log: expected %d skipped lines but got %d",
+				c.format, c.skipped, skipped)
+		}
+	}
+}
+
+func TestCSVQueryLogInvalidLine(t *testing.T) {
+	reader := newCSVQueryLogReader(strings.NewReader("0,select 1\nselect 2\n"))
+	if _, err := reader.Next(); err != nil {
+		t.Fatalf("Unexpected error reading first line: %v", err)
+	}
+	if _, err := reader.Next(); err == nil {
+		t.Errorf("Unexpected success reading invalid line")
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/*
+ * A query of a job with query-template, expanded with text/template before
+ * each execution, e.g. "select * from t where id = {{randInt 1 1000}}".
+ * The random values are drawn from the rand of the job (see -seed).
+ */
+type queryTemplate struct {
+	text string
+	t    *template.Template
+	// The rand of the current expansion, and the Zipf distributions drawn
+	// from it.
+	rand  *rand.Rand
+	zipfs map[zipfParams]*rand.Zipf
+}
+
+type zipfParams struct {
+	min, max int64
+	theta    float64
+}
+
+const randStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func newQueryTemplate(text string) (*queryTemplate, error) {
+	qt := &queryTemplate{text: text}
+	t, err := template.New("query").Funcs(template.FuncMap{
+		"randInt":    qt.randInt,
+		"randString": qt.randString,
+		"uuid":       qt.uuid,
+		"now":        qt.now,
+		"zipf":       qt.zipf,
+	}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	qt.t = t
+	return qt, nil
+}
+
+/*
+ * Expands the template, drawing its random values from r.
+ */
+func (qt *queryTemplate) Expand(r *rand.Rand) (string, error) {
+	if qt.rand != r {
+		qt.rand = r
+		qt.zipfs = nil
+	}
+	var query strings.Builder
+	if err := qt.t.Execute(&query, nil); err != nil {
+		return "", err
+	}
+	return query.String(), nil
+}
+
+/*
+ * A random integer in [min, max].
+ */
+func (qt *queryTemplate) randInt(min, max int64) (int64, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt %d %d: max is less than min", min, max)
+	}
+	return min + qt.rand.Int63n(max-min+1), nil
+}
+
+/*
+ * A random integer in [min, max], following a Zipf distribution with
+ * exponent theta (> 1): min is the most likely, then min+1, etc.
+ */
+func (qt *queryTemplate) zipf(min, max int64, theta float64) (int64, error) {
+	if max < min {
+		return 0, fmt.Errorf("zipf %d %d %v: max is less than min", min, max, theta)
+	} else if !(theta > 1) {
+		return 0, fmt.Errorf("zipf %d %d %v: theta must be greater than 1", min, max, theta)
+	}
+	p := zipfParams{min, max, theta}
+	z, ok := qt.zipfs[p]
+	if !ok {
+		z = rand.NewZipf(qt.rand, theta, 1, uint64(max-min))
+		if qt.zipfs == nil {
+			qt.zipfs = make(map[zipfParams]*rand.Zipf)
+		}
+		qt.zipfs[p] = z
+	}
+	return min + int64(z.Uint64()), nil
+}
+
+/*
+ * A random string of n letters and digits.
+ */
+func (qt *queryTemplate) randString(n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("randString %d: length is negative", n)
+	}
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = randStringLetters[qt.rand.Intn(len(randStringLetters))]
+	}
+	return string(s), nil
+}
+
+/*
+ * A random (version 4) UUID.
+ */
+func (qt *queryTemplate) uuid() string {
+	var b [16]byte
+	qt.rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+/*
+ * The current time, in a format that databases parse as a timestamp.
+ */
+func (qt *queryTemplate) now() string {
+	return time.Now().Format("2006-01-02 15:04:05.000000")
+}
+
+/*
+ * Parses the queries as templates, and expands them once to check their
+ * helpers are called correctly.
+ */
+func parseQueryTemplates(queries []string) ([]*queryTemplate, error) {
+	templates := make([]*queryTemplate, len(queries))
+	r := rand.New(rand.NewSource(1))
+	for i, query := range queries {
+		qt, err := newQueryTemplate(query)
+		if err == nil {
+			_, err = qt.Expand(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in query %s: %v", strconv.Quote(query), err)
+		}
+		templates[i] = qt
+	}
+	return templates, nil
+}
+
+/*
+ * Checks the templated queries of the jobs with query-template, once their
+ * job templates have been expanded.
+ */
+func validateQueryTemplates(jobs map[string]*Job) error {
+	for name, job := range jobs {
+		if !job.QueryTemplate {
+			continue
+		}
+		for _, queries := range [][]string{job.Queries, job.IterationQueries} {
+			if _, err := parseQueryTemplates(queries); err != nil {
+				return fmt.Errorf("Error parsing job %s: %v", strconv.Quote(name), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestQueryTemplate(t *testing.T) {
+	qt, err := newQueryTemplate("insert into t values ({{randInt 5 7}}, '{{randString 8}}', '{{uuid}}', '{{now}}')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern := regexp.MustCompile(`^insert into t values \([5-7], '[a-zA-Z0-9]{8}', ` +
+		`'[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}', ` +
+		`'\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{6}'\)$`)
+
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		query, err := qt.Expand(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pattern.MatchString(query) {
+			t.Fatalf("Unexpected expansion %q", query)
+		}
+	}
+}
+
+func TestQueryTemplateSeed(t *testing.T) {
+	qt, err := newQueryTemplate("select {{randInt 1 1000000}}, '{{randString 16}}', '{{uuid}}'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := rand.New(rand.NewSource(42)), rand.New(rand.NewSource(42))
+	for i := 0; i < 10; i++ {
+		query, _ := qt.Expand(first)
+		if again, _ := qt.Expand(second); again != query {
+			t.Fatalf("Expected the same seed to expand to %q but got %q", query, again)
+		}
+	}
+}
+
+func TestQueryTemplateZipf(t *testing.T) {
+	qt, err := newQueryTemplate("{{zipf 10 1009 1.5}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := rand.New(rand.NewSource(42))
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		key, err := qt.Expand(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := strconv.Atoi(key); err != nil || n < 10 || n > 1009 {
+			t.Fatalf("Expected a key in [10, 1009] but got %q", key)
+		}
+		counts[key]++
+	}
+	// With theta 1.5, the hottest key is drawn about 40% of the time, and
+	// more often than the next.
+	if counts["10"] < 3000 || counts["10"] <= counts["11"] || counts["11"] <= counts["12"] {
+		t.Errorf("Expected the lowest keys to be the hottest but got %d, %d and %d",
+			counts["10"], counts["11"], counts["12"])
+	}
+}
+
+func TestQueryTemplateJob(t *testing.T) {
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"lookup": &Job{
+				Name: "lookup", QueueDepth: 1, Count: 20,
+				Queries:       []string{"select * from t where id = {{randInt 1 1000000}}"},
+				QueryTemplate: true,
+			},
+		},
+	}
+
+	db := &recordingDb{}
+	runIterations(db, config.Flavor, config, 1)
+	pattern := regexp.MustCompile(`^select \* from t where id = \d+$`)
+	distinct := make(map[string]bool)
+	for _, q := range db.queries {
+		if !pattern.MatchString(q) {
+			t.Fatalf("Unexpected query %q", q)
+		}
+		distinct[q] = true
+	}
+	if len(db.queries) != 20 || len(distinct) < 10 {
+		t.Errorf("Expected 20 mostly distinct queries but got %v", db.queries)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var canonicalResults = flag.Bool("canonical-results", false,
+	"Read the values of query results (for query-results-file, success-expr "+
+		"and verify-idempotent) as the same text for the same value whatever "+
+		"the driver: dates as 2006-01-02, times as 2006-01-02 15:04:05.999999 "+
+		"(in UTC if they have a zone), floats in their shortest form and "+
+		"booleans as 1 or 0.")
+
+const (
+	canonicalDateFormat = "2006-01-02"
+	canonicalTimeFormat = "2006-01-02 15:04:05.999999999"
+)
+
+/*
+ * Returns the canonical text of a value scanned from a column of the given
+ * database type (as reported by the driver, e.g. DATETIME or FLOAT8).
+ * Drivers return the same value either as text or as a Go value depending
+ * on the database and protocol, so both are handled.
+ */
+func canonicalValue(v interface{}, typeName string) sql.NullString {
+	typeName = strings.ToUpper(typeName)
+	switch v := v.(type) {
+	case nil:
+		return sql.NullString{}
+	case []byte:
+		return sql.NullString{String: canonicalText(string(v), typeName), Valid: true}
+	case string:
+		return sql.NullString{String: canonicalText(v, typeName), Valid: true}
+	case time.Time:
+		if typeName == "DATE" {
+			return sql.NullString{String: v.Format(canonicalDateFormat), Valid: true}
+		}
+		return sql.NullString{String: v.UTC().Format(canonicalTimeFormat), Valid: true}
+	case bool:
+		if v {
+			return sql.NullString{String: "1", Valid: true}
+		}
+		return sql.NullString{String: "0", Valid: true}
+	case float64:
+		return sql.NullString{String: strconv.FormatFloat(v, 'g', -1, 64), Valid: true}
+	case float32:
+		return sql.NullString{String: strconv.FormatFloat(float64(v), 'g', -1, 32), Valid: true}
+	case int64:
+		return sql.NullString{String: strconv.FormatInt(v, 10), Valid: true}
+	default:
+		return sql.NullString{String: fmt.Sprint(v), Valid: true}
+	}
+}
+
+/*
+ * Returns the canonical form of a value returned as text, or the text
+ * itself if it is not of a type we know to vary between drivers.
+ */
+func canonicalText(s string, typeName string) string {
+	switch typeName {
+	case "DATETIME", "TIMESTAMP":
+		if t, err := time.Parse(canonicalTimeFormat, s); err == nil {
+			return t.Format(canonicalTimeFormat)
+		}
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case "BOOL", "BOOLEAN":
+		switch strings.ToLower(s) {
+		case "t", "true":
+			return "1"
+		case "f", "false":
+			return "0"
+		}
+	}
+	return s
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+ * A fake driver that returns a single row with the same logical values
+ * as the driver of the flavor named by the data source name would.
+ */
+type typedDriver struct{}
+
+type typedConn struct {
+	flavor string
+}
+
+type typedRows struct {
+	types  []string
+	values []driver.Value
+	done   bool
+}
+
+func (typedDriver) Open(name string) (driver.Conn, error) {
+	return &typedConn{name}, nil
+}
+
+func (c *typedConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 500000000, time.UTC)
+	switch c.flavor {
+	case "mysql":
+		// The text protocol returns every value as text.
+		return &typedRows{
+			types: []string{"INT", "DOUBLE", "DATETIME", "DATE", "TINYINT", "VARCHAR"},
+			values: []driver.Value{[]byte("1"), []byte("1.50"), []byte("2020-01-02 03:04:05.500000"),
+				[]byte("2020-01-02"), []byte("1"), nil},
+		}, nil
+	case "postgres":
+		return &typedRows{
+			types: []string{"INT8", "FLOAT8", "TIMESTAMP", "DATE", "BOOL", "TEXT"},
+			values: []driver.Value{int64(1), 1.5, created,
+				time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), true, nil},
+		}, nil
+	}
+	return nil, errors.New("unknown flavor")
+}
+
+func (c *typedConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *typedConn) Close() error {
+	return nil
+}
+
+func (c *typedConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (r *typedRows) Columns() []string {
+	columns := make([]string, len(r.types))
+	for i := range columns {
+		columns[i] = "col"
+	}
+	return columns
+}
+
+func (r *typedRows) ColumnTypeDatabaseTypeName(i int) string {
+	return r.types[i]
+}
+
+func (r *typedRows) Close() error {
+	return nil
+}
+
+func (r *typedRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.done = true
+	return nil
+}
+
+func init() {
+	sql.Register("dbbench-typed", typedDriver{})
+}
+
+func TestCanonicalResults(t *testing.T) {
+	defer func(canonical bool) { *canonicalResults = canonical }(*canonicalResults)
+	*canonicalResults = true
+
+	readResults := func(flavor string) string {
+		db, err := sql.Open("dbbench-typed", flavor)
+		if err != nil {
+			t.Fatalf("Error opening %s: %v", flavor, err)
+		}
+		defer db.Close()
+
+		path := filepath.Join(t.TempDir(), "results.csv")
+		w, err := NewSafeCSVWriter(path)
+		if err != nil {
+			t.Fatalf("Error creating results file: %v", err)
+		}
+		if _, err := countQueryRows(context.Background(), db, w, "select", nil, nil); err != nil {
+			t.Fatalf("Error reading %s results: %v", flavor, err)
+		}
+		w.Close()
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Error reading results file: %v", err)
+		}
+		return string(contents)
+	}
+
+	expected := "1,1.5,2020-01-02 03:04:05.5,2020-01-02,1,\\N\n"
+	for _, flavor := range []string{"mysql", "postgres"} {
+		if results := readResults(flavor); results != expected {
+			t.Errorf("Expected %s results %q but got %q", flavor, expected, results)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+)
+
+// The most retries a RetryBudget saves up for while invocations succeed.
+const maxRetryBudgetTokens = 10
+
+/*
+ * Caps the retries of one or more jobs to a fraction of their invocations,
+ * so that an outage does not make every invocation retry at once. Each
+ * invocation deposits ratio tokens (up to maxRetryBudgetTokens) and each
+ * retry withdraws one.
+ */
+type RetryBudget struct {
+	ratio  float64
+	mu     sync.Mutex
+	tokens float64
+}
+
+func NewRetryBudget(ratio float64) *RetryBudget {
+	return &RetryBudget{ratio: ratio}
+}
+
+func (rb *RetryBudget) Deposit() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens += rb.ratio
+	if rb.tokens > maxRetryBudgetTokens {
+		rb.tokens = maxRetryBudgetTokens
+	}
+}
+
+/*
+ * Returns whether a retry is allowed, spending a token if it is.
+ */
+func (rb *RetryBudget) Withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
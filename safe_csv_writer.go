@@ -17,34 +17,166 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/csv"
+	"errors"
 	"io"
+	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 type SafeCSVWriter struct {
 	m         sync.Mutex
 	csvWriter *csv.Writer
 	ioCloser  io.Closer
+	name      string
+	closed    bool
+	// Written in place of NULL values, to tell them apart from empty
+	// strings.
+	nullMarker string
+	// If positive, rows after the first maxRows are not written.
+	maxRows int64
+	rows    int64
+	capped  bool
+	// Rows are flushed to the file once flushRows rows were written since
+	// the last flush, or when a row is written flushInterval or more after
+	// it; either is disabled if zero. With both disabled, rows are only
+	// flushed when the buffer is full and on Close.
+	flushRows     int64
+	flushInterval time.Duration
+	unflushed     int64
+	lastFlush     time.Time
 }
 
+const defaultNullMarker = `\N`
+
+// How often the rows are flushed, unless the job sets its own policy.
+const defaultFlushInterval = time.Second
+
+/*
+ * All writers that have been created but not closed yet, so that they can
+ * be flushed and closed when the test is stopped.
+ */
+var openCSVWriters = struct {
+	sync.Mutex
+	writers map[*SafeCSVWriter]struct{}
+}{writers: make(map[*SafeCSVWriter]struct{})}
+
+var errCSVWriterClosed = errors.New("csv writer is closed")
+
+/*
+ * Flushes any buffered records and closes the underlying file. It is safe
+ * to call Close more than once.
+ */
 func (scw *SafeCSVWriter) Close() {
-	scw.ioCloser.Close()
+	scw.m.Lock()
+	if !scw.closed {
+		scw.csvWriter.Flush()
+		if scw.ioCloser != nil {
+			scw.ioCloser.Close()
+		}
+		scw.closed = true
+	}
+	scw.m.Unlock()
+
+	openCSVWriters.Lock()
+	delete(openCSVWriters.writers, scw)
+	openCSVWriters.Unlock()
+}
+
+/*
+ * Flushes and closes every writer that is still open.
+ */
+func closeAllCSVWriters() {
+	openCSVWriters.Lock()
+	writers := make([]*SafeCSVWriter, 0, len(openCSVWriters.writers))
+	for scw := range openCSVWriters.writers {
+		writers = append(writers, scw)
+	}
+	openCSVWriters.Unlock()
+
+	for _, scw := range writers {
+		scw.Close()
+	}
 }
 
 func (scw *SafeCSVWriter) Write(record []string) error {
 	scw.m.Lock()
 	defer scw.m.Unlock()
 
-	return scw.csvWriter.Write(record)
+	if scw.closed {
+		return errCSVWriterClosed
+	}
+	if scw.maxRows > 0 && scw.rows >= scw.maxRows {
+		if !scw.capped {
+			scw.capped = true
+			log.Printf("%s reached results-max-rows (%d rows); not writing any more rows",
+				scw.name, scw.maxRows)
+		}
+		return nil
+	}
+	scw.rows++
+	if err := scw.csvWriter.Write(record); err != nil {
+		return err
+	}
+
+	scw.unflushed++
+	if scw.flushRows > 0 && scw.unflushed >= scw.flushRows ||
+		scw.flushInterval > 0 && time.Since(scw.lastFlush) >= scw.flushInterval {
+		scw.csvWriter.Flush()
+		scw.unflushed = 0
+		scw.lastFlush = time.Now()
+		return scw.csvWriter.Error()
+	}
+	return nil
+}
+
+/*
+ * Sets when the rows are flushed to the file (see flushRows).
+ */
+func (scw *SafeCSVWriter) SetFlushPolicy(rows int64, interval time.Duration) {
+	scw.m.Lock()
+	defer scw.m.Unlock()
+
+	scw.flushRows = rows
+	scw.flushInterval = interval
+}
+
+/*
+ * Whether rows were dropped because the writer reached its maximum number of
+ * rows.
+ */
+func (scw *SafeCSVWriter) Capped() bool {
+	scw.m.Lock()
+	defer scw.m.Unlock()
+
+	return scw.capped
+}
+
+/*
+ * Writes a row of values, with the null marker for the NULL values. The
+ * record is used as scratch space to avoid allocating for each row.
+ */
+func (scw *SafeCSVWriter) WriteNullStrings(values []sql.NullString, record []string) error {
+	for i, v := range values {
+		if v.Valid {
+			record[i] = v.String
+		} else {
+			record[i] = scw.nullMarker
+		}
+	}
+	return scw.Write(record)
 }
 
 func (scw *SafeCSVWriter) Flush() {
 	scw.m.Lock()
 	defer scw.m.Unlock()
 
-	scw.csvWriter.Flush()
+	if !scw.closed {
+		scw.csvWriter.Flush()
+	}
 }
 
 func (scw *SafeCSVWriter) Error() error {
@@ -59,5 +191,23 @@ func NewSafeCSVWriter(path string) (*SafeCSVWriter, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &SafeCSVWriter{csvWriter: csv.NewWriter(f), ioCloser: f}, nil
+	scw := newSafeCSVWriterTo(f, path)
+	scw.ioCloser = f
+	scw.flushInterval = defaultFlushInterval
+
+	openCSVWriters.Lock()
+	openCSVWriters.writers[scw] = struct{}{}
+	openCSVWriters.Unlock()
+
+	return scw, nil
+}
+
+/*
+ * Creates a writer of the records to w, which the caller must close after
+ * closing the writer. Rows are only flushed when the buffer is full and on
+ * Close.
+ */
+func newSafeCSVWriterTo(w io.Writer, name string) *SafeCSVWriter {
+	return &SafeCSVWriter{csvWriter: csv.NewWriter(w), name: name,
+		nullMarker: defaultNullMarker, lastFlush: time.Now()}
 }
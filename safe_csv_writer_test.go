@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awreece/goini"
+)
+
+func TestWriteNullStrings(t *testing.T) {
+	row := []sql.NullString{
+		{String: "a", Valid: true},
+		{String: "", Valid: true},
+		{},
+	}
+
+	for _, c := range []struct {
+		nullMarker string
+		expected   string
+	}{
+		{"", "a,,\n"},
+		{defaultNullMarker, "a,,\\N\n"},
+		{"NULL", "a,,NULL\n"},
+	} {
+		path := filepath.Join(t.TempDir(), "results.csv")
+		w, err := NewSafeCSVWriter(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		w.nullMarker = c.nullMarker
+		if err := w.WriteNullStrings(row, make([]string, len(row))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		w.Close()
+
+		if contents, err := ioutil.ReadFile(path); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if string(contents) != c.expected {
+			t.Errorf("Expected %q with null-marker %q but got %q",
+				c.expected, c.nullMarker, contents)
+		}
+	}
+}
+
+func TestResultsMaxRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	w, err := NewSafeCSVWriter(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w.maxRows = 3
+	for i := 0; i < 5; i++ {
+		if err := w.Write([]string{strconv.Itoa(i)}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if capped := w.Capped(); capped != (i >= 3) {
+			t.Errorf("Expected capped to be %v after %d rows", i >= 3, i+1)
+		}
+	}
+	w.Close()
+
+	if contents, err := ioutil.ReadFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	} else if string(contents) != "0\n1\n2\n" {
+		t.Errorf("Expected the first 3 rows but got %q", contents)
+	}
+
+	// The global limit applies to the jobs that do not set their own.
+	cp := goini.NewRawConfigParser()
+	cp.Parse(strings.NewReader("results-max-rows=10\n" +
+		"[a]\nquery=select 1\nquery-results-file=/dev/null\n" +
+		"[b]\nquery=select 1\nquery-results-file=/dev/null\nresults-max-rows=5\n"))
+	iniConfig, err := cp.Finish()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config, err := parseIniConfig(testFlavor(t, "mysql"), iniConfig, nil, ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeAllCSVWriters()
+	if a, b := config.Jobs["a"].QueryResults.maxRows, config.Jobs["b"].QueryResults.maxRows; a != 10 || b != 5 {
+		t.Errorf("Expected results-max-rows of 10 and 5 but got %d and %d", a, b)
+	}
+}
+
+func TestFlushPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		rows     int64
+		interval time.Duration
+		// The rows in the file after writing each of 6 rows.
+		flushed []int
+	}{
+		{"every 2 rows", 2, 0, []int{0, 2, 2, 4, 4, 6}},
+		{"every 30ms", 0, 30 * time.Millisecond, []int{0, 0, 3, 3, 3, 6}},
+		{"on close only", 0, 0, []int{0, 0, 0, 0, 0, 0}},
+	} {
+		path := filepath.Join(t.TempDir(), "results.csv")
+		w, err := NewSafeCSVWriter(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		w.SetFlushPolicy(c.rows, c.interval)
+		for i, expected := range c.flushed {
+			if c.interval > 0 && i%3 == 2 {
+				// The third row of every three is written after
+				// the interval.
+				time.Sleep(c.interval)
+			}
+			if err := w.Write([]string{strconv.Itoa(i)}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n := strings.Count(string(contents), "\n"); n != expected {
+				t.Errorf("%s: expected %d rows flushed after writing %d but got %d",
+					c.name, expected, i+1, n)
+			}
+		}
+		w.Close()
+		if contents, err := ioutil.ReadFile(path); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if n := strings.Count(string(contents), "\n"); n != 6 {
+			t.Errorf("%s: expected 6 rows once closed but got %d", c.name, n)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * Orders the dispatch of job invocations by the priority of their jobs when
+ * the harness itself is busy. There are a fixed number of dispatch slots
+ * shared by all the jobs; when a slot frees up, it goes to the waiting job
+ * with the highest priority (first come, first served within a priority).
+ *
+ * This is advisory: it only orders invocations competing for a slot and
+ * cannot preempt the Go runtime scheduler or the database.
+ */
+type PriorityScheduler struct {
+	mu      sync.Mutex
+	free    int
+	waiters []*priorityWaiter
+}
+
+type priorityWaiter struct {
+	priority int
+	ready    chan struct{}
+}
+
+func newPriorityScheduler(slots int) *PriorityScheduler {
+	return &PriorityScheduler{free: slots}
+}
+
+/*
+ * Waits for a dispatch slot, returning false if the context was done first.
+ * The slot must be returned with Release.
+ */
+func (ps *PriorityScheduler) Acquire(ctx context.Context, priority int) bool {
+	ps.mu.Lock()
+	if ps.free > 0 && len(ps.waiters) == 0 {
+		ps.free--
+		ps.mu.Unlock()
+		return true
+	}
+	w := &priorityWaiter{priority, make(chan struct{})}
+	// Keep the waiters sorted by decreasing priority, after any waiter of
+	// the same priority.
+	i := sort.Search(len(ps.waiters), func(i int) bool {
+		return ps.waiters[i].priority < priority
+	})
+	ps.waiters = append(ps.waiters, nil)
+	copy(ps.waiters[i+1:], ps.waiters[i:])
+	ps.waiters[i] = w
+	ps.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-ctx.Done():
+		ps.mu.Lock()
+		defer ps.mu.Unlock()
+		for i, other := range ps.waiters {
+			if other == w {
+				ps.waiters = append(ps.waiters[:i], ps.waiters[i+1:]...)
+				return false
+			}
+		}
+		// We were handed the slot as we gave up; pass it on.
+		ps.releaseLocked()
+		return false
+	}
+}
+
+func (ps *PriorityScheduler) Release() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.releaseLocked()
+}
+
+func (ps *PriorityScheduler) releaseLocked() {
+	if len(ps.waiters) == 0 {
+		ps.free++
+		return
+	}
+	w := ps.waiters[0]
+	ps.waiters = ps.waiters[1:]
+	close(w.ready)
+}
+
+/*
+ * Caps the number of queries in flight across all the jobs. Unlike the
+ * PriorityScheduler, a slot is held for the whole invocation.
+ */
+type ConcurrencyLimit struct {
+	slots chan struct{}
+	// How many times an invocation had to wait for a slot.
+	contended uint64
+}
+
+func newConcurrencyLimit(limit int) *ConcurrencyLimit {
+	return &ConcurrencyLimit{slots: make(chan struct{}, limit)}
+}
+
+/*
+ * Waits for a slot, returning false if the context was done first. The slot
+ * must be returned with Release.
+ */
+func (cl *ConcurrencyLimit) Acquire(ctx context.Context) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+	atomic.AddUint64(&cl.contended, 1)
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (cl *ConcurrencyLimit) Release() {
+	<-cl.slots
+}
+
+func (cl *ConcurrencyLimit) Contended() uint64 {
+	return atomic.LoadUint64(&cl.contended)
+}
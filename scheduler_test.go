@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPriorityScheduler(t *testing.T) {
+	ps := newPriorityScheduler(1)
+	ctx := context.Background()
+	if !ps.Acquire(ctx, 0) {
+		t.Fatal("Expected to acquire a free slot")
+	}
+
+	// Queue up waiters while the only slot is taken, waiting for each to
+	// be queued so the order is deterministic.
+	order := make(chan int, 4)
+	for i, priority := range []int{0, 5, -1, 5} {
+		go func(i, priority int) {
+			if ps.Acquire(ctx, priority) {
+				order <- i
+				ps.Release()
+			}
+		}(i, priority)
+		for deadline := time.Now().Add(time.Second); ; {
+			ps.mu.Lock()
+			queued := len(ps.waiters)
+			ps.mu.Unlock()
+			if queued == i+1 {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("Waiter %d was not queued", i)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	ps.Release()
+	var got []int
+	for range []int{0, 5, -1, 5} {
+		got = append(got, <-order)
+	}
+	if expected := []int{1, 3, 0, 2}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected dispatch order %v but got %v", expected, got)
+	}
+}
+
+func TestPrioritySchedulerCancel(t *testing.T) {
+	ps := newPriorityScheduler(1)
+	if !ps.Acquire(context.Background(), 0) {
+		t.Fatal("Expected to acquire a free slot")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ps.Acquire(ctx, 1) {
+		t.Error("Expected cancelled acquire to fail")
+	}
+
+	ps.Release()
+	if !ps.Acquire(context.Background(), 0) {
+		t.Error("Expected slot to be free after cancelled acquire")
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	cl := newConcurrencyLimit(2)
+	ctx := context.Background()
+	if !cl.Acquire(ctx) || !cl.Acquire(ctx) {
+		t.Fatal("Expected to acquire the free slots")
+	}
+	if cl.Contended() != 0 {
+		t.Errorf("Expected no contention but got %d", cl.Contended())
+	}
+
+	acquired := make(chan bool)
+	go func() { acquired <- cl.Acquire(ctx) }()
+	select {
+	case <-acquired:
+		t.Fatal("Expected acquire to block while the limit is reached")
+	case <-time.After(10 * time.Millisecond):
+	}
+	cl.Release()
+	if !<-acquired {
+		t.Error("Expected blocked acquire to succeed after a release")
+	}
+	if cl.Contended() != 1 {
+		t.Errorf("Expected 1 contended acquire but got %d", cl.Contended())
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if cl.Acquire(cancelled) {
+		t.Error("Expected cancelled acquire to fail")
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var seed = flag.Int64("seed", 0,
+	"Seed for all randomness of the test, to make it reproducible (default "+
+		"a random seed, which is logged).")
+
+var seedOnce sync.Once
+
+/*
+ * Returns the seed of the test, choosing (and logging) a random one if none
+ * was given.
+ */
+func testSeed() int64 {
+	seedOnce.Do(func() {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+			log.Printf("using seed %d", *seed)
+		}
+	})
+	return *seed
+}
+
+/*
+ * Returns a source of randomness for the job, derived from the seed of the
+ * test and the name of the job so that each job gets a different but
+ * reproducible sequence. The result is not safe for concurrent use.
+ */
+func newJobRand(name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(testSeed() ^ int64(h.Sum64())))
+}
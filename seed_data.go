@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awreece/goini"
+)
+
+/*
+ * Synthetic rows loaded into a table before the jobs run, declared by the
+ * [seed] section.
+ */
+type SeedData struct {
+	Table   string
+	Columns []SeedColumn
+	Rows    int
+	// The number of rows per insert statement.
+	BatchSize int
+}
+
+/*
+ * A column of seed data and how to generate its values:
+ *
+ *   serial       the row number, starting at 1
+ *   int          a random non-negative 32 bit integer
+ *   float        a random float in [0, 1)
+ *   string(n)    a random alphanumeric string of length n (default 16)
+ *   date         a random date in the year before the test
+ *   datetime     a random time (to the second) in the year before the test
+ */
+type SeedColumn struct {
+	Name   string
+	Type   string
+	Length int
+}
+
+const defaultSeedBatchSize = 1000
+const defaultSeedStringLength = 16
+
+// Dates and times are drawn from this long before the test.
+const seedTimeRange = 365 * 24 * time.Hour
+
+var seedIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+var seedColumnType = regexp.MustCompile(`^(serial|int|float|date|datetime|string)(?:\(([0-9]+)\))?$`)
+
+func parseSeedColumn(v string) (SeedColumn, error) {
+	fields := strings.Fields(v)
+	if len(fields) != 2 {
+		return SeedColumn{}, fmt.Errorf("column %s must be <name> <type>", strconv.Quote(v))
+	} else if !seedIdentifier.MatchString(fields[0]) {
+		return SeedColumn{}, fmt.Errorf("invalid column name %s", strconv.Quote(fields[0]))
+	}
+
+	m := seedColumnType.FindStringSubmatch(strings.ToLower(fields[1]))
+	if m == nil {
+		return SeedColumn{}, fmt.Errorf("unknown column type %s", strconv.Quote(fields[1]))
+	}
+	column := SeedColumn{Name: fields[0], Type: m[1]}
+	if m[1] == "string" {
+		column.Length = defaultSeedStringLength
+		if m[2] != "" {
+			column.Length, _ = strconv.Atoi(m[2])
+		}
+		if column.Length <= 0 {
+			return SeedColumn{}, fmt.Errorf("invalid length for column %s", fields[0])
+		}
+	} else if m[2] != "" {
+		return SeedColumn{}, fmt.Errorf("column type %s does not take a length", m[1])
+	}
+	return column, nil
+}
+
+var seedOptions = goini.DecodeOptionSet{
+	"table": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The (existing) table to load the seed data into.",
+		Parse: func(v string, sdi interface{}) error {
+			if !seedIdentifier.MatchString(v) {
+				return fmt.Errorf("invalid table name %s", strconv.Quote(v))
+			}
+			sdi.(*SeedData).Table = v
+			return nil
+		},
+	},
+	"column": &goini.DecodeOption{Kind: goini.MultiOption,
+		Usage: "A column of the seed data, as '<name> <type>' where type " +
+			"is one of serial, int, float, string(n), date or datetime.",
+		Parse: func(v string, sdi interface{}) error {
+			sd := sdi.(*SeedData)
+			column, err := parseSeedColumn(v)
+			if err == nil {
+				sd.Columns = append(sd.Columns, column)
+			}
+			return err
+		},
+	},
+	"rows": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The number of rows to load.",
+		Parse: func(v string, sdi interface{}) (err error) {
+			sd := sdi.(*SeedData)
+			sd.Rows, err = strconv.Atoi(v)
+			if err == nil && sd.Rows <= 0 {
+				return errors.New("rows must be positive")
+			}
+			return err
+		},
+	},
+	"batch-size": &goini.DecodeOption{Kind: goini.UniqueOption,
+		Usage: "The number of rows inserted by each insert statement " +
+			"(default 1000).",
+		Parse: func(v string, sdi interface{}) (err error) {
+			sd := sdi.(*SeedData)
+			sd.BatchSize, err = strconv.Atoi(v)
+			if err == nil && sd.BatchSize <= 0 {
+				return errors.New("batch-size must be positive")
+			}
+			return err
+		},
+	},
+}
+
+func decodeSeedSection(s goini.RawSection) (*SeedData, error) {
+	if s == nil {
+		return nil, nil
+	}
+	sd := &SeedData{BatchSize: defaultSeedBatchSize}
+	if err := decodeOptions(seedOptions, s, sd); err != nil {
+		return nil, err
+	} else if sd.Table == "" {
+		return nil, errors.New("no table provided")
+	} else if len(sd.Columns) == 0 {
+		return nil, errors.New("no column provided")
+	} else if sd.Rows == 0 {
+		return nil, errors.New("no rows provided")
+	}
+	return sd, nil
+}
+
+const seedAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+/*
+ * Returns the SQL literal of a value of the column for the (0-based) row.
+ */
+func (c *SeedColumn) value(r *rand.Rand, row int, now time.Time) string {
+	switch c.Type {
+	case "serial":
+		return strconv.Itoa(row + 1)
+	case "int":
+		return strconv.FormatInt(int64(r.Int31()), 10)
+	case "float":
+		return strconv.FormatFloat(r.Float64(), 'f', -1, 64)
+	case "string":
+		b := make([]byte, c.Length)
+		for i := range b {
+			b[i] = seedAlphabet[r.Intn(len(seedAlphabet))]
+		}
+		return "'" + string(b) + "'"
+	case "date":
+		return now.Add(-time.Duration(r.Int63n(int64(seedTimeRange)))).Format("'2006-01-02'")
+	case "datetime":
+		return now.Add(-time.Duration(r.Int63n(int64(seedTimeRange)))).Format("'2006-01-02 15:04:05'")
+	}
+	panic("unknown seed column type " + c.Type)
+}
+
+/*
+ * Calls insert with each multi-row insert statement of the seed data.
+ * Values are generated from r, so the same seed generates the same data
+ * (with dates and times relative to now).
+ */
+func (sd *SeedData) statements(r *rand.Rand, now time.Time, insert func(query string) error) error {
+	names := make([]string, len(sd.Columns))
+	for i := range sd.Columns {
+		names[i] = sd.Columns[i].Name
+	}
+	prefix := fmt.Sprintf("insert into %s (%s) values ", sd.Table, strings.Join(names, ", "))
+
+	var query strings.Builder
+	values := make([]string, len(sd.Columns))
+	for start := 0; start < sd.Rows; start += sd.BatchSize {
+		query.Reset()
+		query.WriteString(prefix)
+		for row := start; row < sd.Rows && row < start+sd.BatchSize; row++ {
+			if row > start {
+				query.WriteString(", ")
+			}
+			for i := range sd.Columns {
+				values[i] = sd.Columns[i].value(r, row, now)
+			}
+			query.WriteString("(" + strings.Join(values, ", ") + ")")
+		}
+		if err := insert(query.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Loads the seed data into the database, logging how long it took.
+ */
+func (sd *SeedData) Load(db Database) error {
+	log.Printf("Loading %d rows of seed data into %s", sd.Rows, sd.Table)
+	start := time.Now()
+	err := sd.statements(newJobRand("seed "+sd.Table), start, func(query string) error {
+		_, err := db.RunQuery(nil, query, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("loading seed data into %s: %v", sd.Table, err)
+	}
+	log.Printf("Loaded %d rows of seed data into %s in %v", sd.Rows, sd.Table, time.Since(start))
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSeedDataStatements(t *testing.T) {
+	sd := &SeedData{
+		Table: "t", Rows: 5, BatchSize: 2,
+		Columns: []SeedColumn{
+			{"id", "serial", 0}, {"a", "int", 0}, {"b", "float", 0},
+			{"c", "string", 4}, {"d", "date", 0}, {"e", "datetime", 0},
+		},
+	}
+
+	generate := func() []string {
+		var queries []string
+		now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+		err := sd.statements(rand.New(rand.NewSource(1)), now, func(q string) error {
+			queries = append(queries, q)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return queries
+	}
+
+	queries := generate()
+	if len(queries) != 3 {
+		t.Fatalf("Expected 3 inserts but got %v", queries)
+	}
+	prefix := `^insert into t \(id, a, b, c, d, e\) values `
+	row := `\((%d), [0-9]+, [0-9.]+, '[A-Za-z0-9]{4}', '(2019|2020)-[0-9]{2}-[0-9]{2}', '(2019|2020)-[0-9]{2}-[0-9]{2} [0-9:]{8}'\)`
+	for i, expected := range []string{
+		prefix + fmt.Sprintf(row, 1) + ", " + fmt.Sprintf(row, 2) + "$",
+		prefix + fmt.Sprintf(row, 3) + ", " + fmt.Sprintf(row, 4) + "$",
+		prefix + fmt.Sprintf(row, 5) + "$",
+	} {
+		if !regexp.MustCompile(expected).MatchString(queries[i]) {
+			t.Errorf("Expected insert %d to match %s but got %s", i, expected, queries[i])
+		}
+	}
+
+	if again := generate(); !reflect.DeepEqual(queries, again) {
+		t.Errorf("Expected the same seed to generate the same data")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+var serverMetricsCommand = flag.String("server-metrics-command", "",
+	"Shell command (e.g. \"vmstat 1\") run over SSH on the database host "+
+		"while the test runs; its output is written to -server-metrics-file.")
+var sshHost = flag.String("ssh-host", "",
+	"SSH destination ([user@]host) for -server-metrics-command (default the "+
+		"database host).")
+var sshPort = flag.Int("ssh-port", 0, "SSH port (default the ssh default).")
+var sshIdentity = flag.String("ssh-identity", "", "SSH identity (private key) file.")
+
+/*
+ * Like the query-stats-file, the server metrics file is opened when we
+ * first parse the flags (i.e. before we change our base directory).
+ */
+var serverMetricsFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&serverMetricsFile, "server-metrics-file",
+		"Write the output of -server-metrics-command to this file, each line "+
+			"prefixed with the seconds elapsed since the test started.")
+}
+
+// The ssh client used to run the server metrics command.
+var sshCommand = "ssh"
+
+func sshArgs(host string, command string) []string {
+	args := []string{"-T", "-o", "BatchMode=yes"}
+	if *sshPort != 0 {
+		args = append(args, "-p", strconv.Itoa(*sshPort))
+	}
+	if *sshIdentity != "" {
+		args = append(args, "-i", *sshIdentity)
+	}
+	return append(args, host, command)
+}
+
+/*
+ * Captures the output of a command running on the database host for the
+ * duration of the test.
+ */
+type serverMetricsCapture struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	output *os.File
+	done   chan struct{}
+}
+
+// How long to wait for the rest of the output of the command once it has
+// been stopped, in case a process it started still holds its output open.
+const serverMetricsDrainTimeout = time.Second
+
+/*
+ * Starts the command and writes each line of its output to w, prefixed
+ * with the time elapsed since start.
+ */
+func startServerMetrics(name string, args []string, start time.Time, w io.Writer) (*serverMetricsCapture, error) {
+	r, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &serverMetricsCapture{
+		cmd:    exec.CommandContext(ctx, name, args...),
+		cancel: cancel,
+		output: r,
+		done:   make(chan struct{}),
+	}
+	c.cmd.Stdout = pw
+	err = c.cmd.Start()
+	pw.Close()
+	if err != nil {
+		cancel()
+		r.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer close(c.done)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			fmt.Fprintf(w, "%.3f\t%s\n", time.Since(start).Seconds(), scanner.Text())
+		}
+	}()
+	return c, nil
+}
+
+/*
+ * Stops the command and waits until all of its output has been written.
+ */
+func (c *serverMetricsCapture) Stop() {
+	c.cancel()
+	c.cmd.Wait()
+	select {
+	case <-c.done:
+	case <-time.After(serverMetricsDrainTimeout):
+		c.output.Close()
+		<-c.done
+	}
+	c.output.Close()
+}
+
+/*
+ * Starts capturing server metrics if requested, returning a function that
+ * stops the capture.
+ */
+func captureServerMetrics(start time.Time) func() {
+	f := serverMetricsFile.GetFile()
+	if *serverMetricsCommand == "" || f == nil {
+		return func() {}
+	}
+
+	host := firstString(*sshHost, firstString(GlobalConfig.Host, "localhost"))
+	c, err := startServerMetrics(sshCommand, sshArgs(host, *serverMetricsCommand), start, f)
+	if err != nil {
+		log.Fatalf("starting server metrics command: %v", err)
+	}
+	log.Printf("Capturing server metrics from %s", host)
+	return func() {
+		c.Stop()
+		f.Close()
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestServerMetricsCapture(t *testing.T) {
+	var out bytes.Buffer
+	c, err := startServerMetrics("sh", []string{"-c", "echo first; echo second; sleep 10"}, time.Now(), &out)
+	if err != nil {
+		t.Fatalf("Error starting command: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Command was not stopped")
+	}
+
+	if !regexp.MustCompile(`^\d+\.\d{3}\tfirst\n\d+\.\d{3}\tsecond\n$`).Match(out.Bytes()) {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
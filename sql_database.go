@@ -17,31 +17,234 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
-
-	"github.com/go-sql-driver/mysql"
-	"github.com/lib/pq"
+	"time"
 )
 
 type sqlDb struct {
-	db *sql.DB
+	db     *sql.DB
+	flavor *sqlDatabaseFlavor
+	// Opens connections outside of the pool of the db.
+	connector driver.Connector
+}
+
+/*
+ * Opens a new connection (outside of the connection pool), pings it and
+ * closes it.
+ */
+func (s *sqlDb) CycleConnection() error {
+	ctx := context.Background()
+	conn, err := s.connector.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if pinger, ok := conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+/*
+ * A connection with a pool of its own, so that closing it closes the
+ * connection rather than returning it to the pool of the db.
+ */
+type sqlConn struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func (s *sqlDb) OpenConnection() (Connection, error) {
+	db := sql.OpenDB(s.connector)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlConn{db, conn}, nil
+}
+
+func (c *sqlConn) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return c.RunQueryRowsContext(context.Background(), w, q, args, onRow)
+}
+
+func (c *sqlConn) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return runSQLQueryRows(ctx, c.conn, w, q, args, onRow)
+}
+
+func (c *sqlConn) Close() {
+	c.conn.Close()
+	c.db.Close()
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (s *sqlDb) BeginTransaction() (Transaction, error) {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx}, nil
+}
+
+func (t *sqlTx) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return t.RunQueryRowsContext(context.Background(), w, q, args, onRow)
+}
+
+func (t *sqlTx) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return runSQLQueryRows(ctx, t.tx, w, q, args, onRow)
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+type sqlStmt struct {
+	stmt *sql.Stmt
+	q    string
+}
+
+func (s *sqlDb) Prepare(q string) (PreparedStatement, error) {
+	stmt, err := s.db.Prepare(q)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStmt{stmt, q}, nil
+}
+
+func (s *sqlStmt) RunQueryRows(w *SafeCSVWriter, args []interface{}, onRow RowHandler) (int64, error) {
+	return runSQLQueryRows(context.Background(), sqlStmtQueryer{s.stmt}, w, s.q, args, onRow)
+}
+
+func (s *sqlStmt) Close() {
+	s.stmt.Close()
+}
+
+/*
+ * Runs a prepared statement in place of the query it was prepared from.
+ */
+type sqlStmtQueryer struct {
+	stmt *sql.Stmt
+}
+
+func (s sqlStmtQueryer) QueryContext(ctx context.Context, _ string, args ...interface{}) (*sql.Rows, error) {
+	return s.stmt.QueryContext(ctx, args...)
+}
+
+func (s sqlStmtQueryer) ExecContext(ctx context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	return s.stmt.ExecContext(ctx, args...)
+}
+
+func (s *sqlDb) WarmConnection(q string) (func(), error) {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runSQLQueryRows(ctx, conn, nil, q, nil, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() { conn.Close() }, nil
 }
 
 func (s *sqlDb) RunQuery(w *SafeCSVWriter, q string, args []interface{}) (int64, error) {
+	return s.RunQueryRows(w, q, args, nil)
+}
+
+func (s *sqlDb) RunQueryRows(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return s.RunQueryRowsContext(context.Background(), w, q, args, onRow)
+}
 
+func (s *sqlDb) RunQueryRowsContext(ctx context.Context, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	return runSQLQueryRows(ctx, s.db, w, q, args, onRow)
+}
+
+func (s *sqlDb) RunQueryServerTime(w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, time.Duration, time.Duration, error) {
+	if s.flavor.serverExecTime == nil {
+		start := time.Now()
+		rows, err := s.RunQueryRows(w, q, args, onRow)
+		elapsed := time.Since(start)
+		if err != nil {
+			return rows, elapsed, 0, err
+		}
+		return rows, elapsed, 0, &ServerExecTimeError{errServerExecTimeUnsupported}
+	}
+
+	// The server time is only available on the connection that ran the
+	// query.
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer conn.Close()
+
+	var rows int64
+	var elapsed time.Duration
+	var queryErr error
+	serverElapsed, err := s.flavor.serverExecTime(ctx, conn, func() error {
+		start := time.Now()
+		rows, queryErr = runSQLQueryRows(ctx, conn, w, q, args, onRow)
+		elapsed = time.Since(start)
+		return queryErr
+	})
+	if queryErr != nil {
+		return 0, elapsed, 0, queryErr
+	} else if err != nil {
+		return rows, elapsed, 0, &ServerExecTimeError{err}
+	}
+	return rows, elapsed, serverElapsed, nil
+}
+
+/*
+ * Either a *sql.DB, a *sql.Conn or a *sql.Tx.
+ */
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func runSQLQueryRows(ctx context.Context, db sqlQueryer, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
 	switch action := strings.ToLower(strings.Fields(q)[0]); action {
-	case "select", "show", "explain", "describe", "desc":
-		return s.countQueryRows(w, q, args)
 	case "use", "begin":
 		return 0, fmt.Errorf("invalid query action: %v", action)
 	default:
-		return s.countExecRows(q, args)
+		if returnsRows(q) {
+			return countQueryRows(ctx, db, w, q, args, onRow)
+		}
+		return countExecRows(ctx, db, q, args)
+	}
+}
+
+/*
+ * Whether the query returns rows, as opposed to a statement for which we
+ * count the rows affected.
+ */
+func returnsRows(q string) bool {
+	fields := strings.Fields(q)
+	if len(fields) == 0 {
+		return false
 	}
+	switch strings.ToLower(fields[0]) {
+	case "select", "show", "explain", "describe", "desc":
+		return true
+	}
+	return false
 }
 
 type rowOutputter struct {
@@ -49,9 +252,15 @@ type rowOutputter struct {
 	outputValues []string
 	pointers     []interface{}
 	w            *SafeCSVWriter
+	onRow        RowHandler
+	// With -canonical-results, the values are scanned as returned by the
+	// driver, and converted to values using the database types of the
+	// columns.
+	raw   []interface{}
+	types []string
 }
 
-func makeRowOutputter(w *SafeCSVWriter, r *sql.Rows) (*rowOutputter, error) {
+func makeRowOutputter(w *SafeCSVWriter, onRow RowHandler, r *sql.Rows) (*rowOutputter, error) {
 	columns, err := r.Columns()
 	if err != nil {
 		return nil, err
@@ -61,34 +270,49 @@ func makeRowOutputter(w *SafeCSVWriter, r *sql.Rows) (*rowOutputter, error) {
 	res := make([]sql.NullString, len(columns))
 	resO := make([]string, len(columns))
 	resP := make([]interface{}, len(columns))
-	for i := range columns {
-		resP[i] = &res[i]
+	ro := &rowOutputter{values: res, outputValues: resO, pointers: resP, w: w, onRow: onRow}
+	if !*canonicalResults {
+		for i := range columns {
+			resP[i] = &res[i]
+		}
+		return ro, nil
 	}
 
-	return &rowOutputter{res, resO, resP, w}, nil
+	columnTypes, err := r.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	ro.raw = make([]interface{}, len(columns))
+	ro.types = make([]string, len(columns))
+	for i, ct := range columnTypes {
+		resP[i] = &ro.raw[i]
+		ro.types[i] = ct.DatabaseTypeName()
+	}
+	return ro, nil
 }
 
 func (ro *rowOutputter) outputRows(r *sql.Rows) error {
 	if err := r.Scan(ro.pointers...); err != nil {
 		return err
 	}
+	for i, v := range ro.raw {
+		ro.values[i] = canonicalValue(v, ro.types[i])
+	}
 
-	for i, v := range ro.values {
-		if v.Valid {
-			ro.outputValues[i] = v.String
-		} else {
-			ro.outputValues[i] = "\\N"
+	if ro.onRow != nil {
+		if err := ro.onRow(ro.values); err != nil {
+			return err
 		}
 	}
-	if err := ro.w.Write(ro.outputValues); err != nil {
-		return err
+	if ro.w == nil {
+		return nil
 	}
 
-	return nil
+	return ro.w.WriteNullStrings(ro.values, ro.outputValues)
 }
 
-func (s *sqlDb) countQueryRows(w *SafeCSVWriter, q string, args []interface{}) (int64, error) {
-	rows, err := s.db.Query(q, args...)
+func countQueryRows(ctx context.Context, db sqlQueryer, w *SafeCSVWriter, q string, args []interface{}, onRow RowHandler) (int64, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -97,14 +321,14 @@ func (s *sqlDb) countQueryRows(w *SafeCSVWriter, q string, args []interface{}) (
 	var rowsAffected int64
 	var ro *rowOutputter
 
-	if w != nil {
-		if ro, err = makeRowOutputter(w, rows); err != nil {
+	if w != nil || onRow != nil {
+		if ro, err = makeRowOutputter(w, onRow, rows); err != nil {
 			return 0, err
 		}
 	}
 
 	for rows.Next() {
-		if w != nil {
+		if ro != nil {
 			if err = ro.outputRows(rows); err != nil {
 				return 0, err
 			}
@@ -116,9 +340,7 @@ func (s *sqlDb) countQueryRows(w *SafeCSVWriter, q string, args []interface{}) (
 	}
 
 	if w != nil {
-		w.Flush()
-		err = w.Error()
-		if err != nil {
+		if err = w.Error(); err != nil {
 			return 0, err
 		}
 	}
@@ -126,46 +348,69 @@ func (s *sqlDb) countQueryRows(w *SafeCSVWriter, q string, args []interface{}) (
 	return rowsAffected, nil
 }
 
-func (s *sqlDb) countExecRows(q string, args []interface{}) (int64, error) {
-	res, err := s.db.Exec(q, args...)
+func countExecRows(ctx context.Context, db sqlQueryer, q string, args []interface{}) (int64, error) {
+	res, err := db.ExecContext(ctx, q, args...)
 	if err != nil {
 		return 0, err
 	}
 	return res.RowsAffected()
 }
 
+func (s *sqlDb) ServerVersion() (string, error) {
+	var version string
+	err := s.db.QueryRow(s.flavor.versionQuery).Scan(&version)
+	return version, err
+}
+
 func (s *sqlDb) Close() {
 	s.db.Close()
 }
 
 type sqlDatabaseFlavor struct {
-	name      string
-	dsnFunc   func(cc *ConnectionConfig) string
-	checkFunc func(q string) error
-	errFunc   func(e error) (string, error)
+	// The name of the database/sql driver, which is also the name of the
+	// flavor.
+	name         string
+	dsnFunc      func(cc *ConnectionConfig) string
+	checkFunc    func(q string) error
+	errFunc      func(e error) (string, error)
+	versionQuery string
+	placeholder  func(n int) string
+	// Runs the query (by calling run exactly once) on the connection,
+	// returning how long the server spent executing it. Nil if the
+	// flavor cannot report it.
+	serverExecTime func(ctx context.Context, conn *sql.Conn, run func() error) (time.Duration, error)
+	// The prefix that runs a query under EXPLAIN ANALYZE. Empty if the
+	// flavor does not support it.
+	explainAnalyze string
 }
 
 var maxIdleConns = flag.Int("max-idle-conns", 100, "Maximum idle database connections")
 var maxActiveConns = flag.Int("max-active-conns", 0, "Maximum active database connections")
+var disableStatementCache = flag.Bool("disable-statement-cache", false,
+	"Prepare the queries of the jobs with prepared=true for every "+
+		"execution instead of once per job, to measure the cost of parsing "+
+		"and planning every query.")
 
 func (sq *sqlDatabaseFlavor) QuerySeparator() string {
 	return ";"
 }
 
 func (sq *sqlDatabaseFlavor) Connect(cc *ConnectionConfig) (Database, error) {
-	realPassword := cc.Password
-	cc.Password = "XXX" // Mask password before printing it.
-	dsn := sq.dsnFunc(cc)
-	log.Println("Connecting to", dsn)
-	cc.Password = realPassword
-	dsn = sq.dsnFunc(cc)
-
-	db, err := sql.Open(sq.name, dsn)
+	redacted := cc.Redacted()
+	log.Println("Connecting to", sq.dsnFunc(&redacted))
+
+	if len(cc.InitStatements) > 0 {
+		log.Printf("Running %d statements on every new connection: %q",
+			len(cc.InitStatements), cc.InitStatements)
+	}
+	connector, err := openSQLConnector(sq.name, sq.dsnFunc(cc), cc.InitStatements)
 	if err != nil {
-		return nil, err
+		return nil, cc.RedactError(err)
 	}
+	db := sql.OpenDB(connector)
 	if err = db.Ping(); err != nil {
-		return nil, err
+		db.Close()
+		return nil, cc.RedactError(err)
 	}
 	log.Println("Connected")
 
@@ -186,7 +431,15 @@ func (sq *sqlDatabaseFlavor) Connect(cc *ConnectionConfig) (Database, error) {
 	 */
 	db.SetMaxOpenConns(*maxActiveConns)
 
-	return &sqlDb{db}, nil
+	return &sqlDb{db, sq, connector}, nil
+}
+
+func (sq *sqlDatabaseFlavor) ProbeQuery() string {
+	return "select 1"
+}
+
+func (sq *sqlDatabaseFlavor) BindNamed(q string) (string, []string) {
+	return bindNamedSQLPlaceholders(q, sq.placeholder)
 }
 
 func (sq *sqlDatabaseFlavor) CheckQuery(q string) error {
@@ -197,16 +450,54 @@ func (sq *sqlDatabaseFlavor) ErrorCode(e error) (string, error) {
 	return sq.errFunc(e)
 }
 
-func checkSQLQuery(q string) error {
-	query := strings.TrimSpace(q)
-	if len(query) == 0 {
+func (sq *sqlDatabaseFlavor) ExplainAnalyze(q string) (string, bool) {
+	if sq.explainAnalyze == "" {
+		return "", false
+	}
+	return sq.explainAnalyze + strings.TrimSpace(q), true
+}
+
+/*
+ * The lexical syntax of the SQL of a flavor, as far as we need it to find
+ * the statements of a query.
+ */
+type sqlSyntax struct {
+	// Backslashes escape quotes inside of quoted strings.
+	backslashEscapes bool
+	// "#" starts a comment, and "--" only starts a comment if it is
+	// followed by whitespace (MySQL).
+	hashComments bool
+	// "/*!" comments hold code to run rather than a comment (MySQL).
+	executableComments bool
+	// "/*" comments may be nested.
+	nestedComments bool
+	// Strings may be dollar quoted (e.g. "$body$ ... $body$"), and E'...'
+	// strings may contain backslash escapes (Postgres).
+	dollarQuotes bool
+}
+
+var (
+	mySQLSyntax     = sqlSyntax{backslashEscapes: true, hashComments: true, executableComments: true}
+	postgresSyntax  = sqlSyntax{nestedComments: true, dollarQuotes: true}
+	sqlServerSyntax = sqlSyntax{nestedComments: true}
+	verticaSyntax   = sqlSyntax{}
+)
+
+/*
+ * Checks that the query is a single statement (possibly followed by a
+ * semicolon) that does not start a transaction or change the database.
+ * Comments and the contents of quoted strings are ignored.
+ */
+func (s sqlSyntax) checkQuery(q string) error {
+	statements := s.statements(q)
+	if len(statements) == 0 {
 		return EmptyQueryError
 	}
-	if strings.Contains(query, ";") {
-		return errors.New("cannot have a semicolon")
+	if len(statements) > 1 {
+		return errors.New("cannot have more than one statement")
 	}
 
-	switch strings.ToLower(strings.Fields(query)[0]) {
+	switch strings.ToLower(strings.Fields(statements[0])[0]) {
 	case "begin":
 		return errors.New("cannot use transactions")
 	case "use":
@@ -215,6 +506,208 @@ func checkSQLQuery(q string) error {
 	return nil
 }
 
+/*
+ * Splits the query into its statements, without their comments. Semicolons
+ * inside of comments or quoted strings do not end a statement, and empty
+ * statements are dropped.
+ */
+func (s sqlSyntax) statements(q string) []string {
+	var statements []string
+	var current strings.Builder
+	endStatement := func() {
+		if statement := strings.TrimSpace(current.String()); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		next := byte(0)
+		if i+1 < len(q) {
+			next = q[i+1]
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			escapes := s.backslashEscapes ||
+				(s.dollarQuotes && c == '\'' && i > 0 && (q[i-1] == 'e' || q[i-1] == 'E') &&
+					(i == 1 || !isSQLIdentifierByte(q[i-2], false)))
+			end := i + 1
+			for end < len(q) && q[end] != c {
+				if escapes && q[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(q) {
+				end++
+			}
+			current.WriteString(q[i:end])
+			i = end - 1
+		case c == '$' && s.dollarQuotes:
+			tag := dollarQuoteTag(q[i:])
+			if tag == "" {
+				current.WriteByte(c)
+				continue
+			}
+			end := len(q)
+			if j := strings.Index(q[i+len(tag):], tag); j >= 0 {
+				end = i + len(tag) + j + len(tag)
+			}
+			current.WriteString(q[i:end])
+			i = end - 1
+		case c == '#' && s.hashComments,
+			c == '-' && next == '-' && (!s.hashComments || i+2 == len(q) || isSpaceByte(q[i+2])):
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+		case c == '/' && next == '*' && !(s.executableComments && i+2 < len(q) && q[i+2] == '!'):
+			depth := 1
+			for i += 2; i < len(q) && depth > 0; i++ {
+				if q[i] == '*' && i+1 < len(q) && q[i+1] == '/' {
+					depth--
+					i++
+				} else if s.nestedComments && q[i] == '/' && i+1 < len(q) && q[i+1] == '*' {
+					depth++
+					i++
+				}
+			}
+			i--
+			current.WriteByte(' ')
+		case c == ';':
+			endStatement()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	endStatement()
+	return statements
+}
+
+/*
+ * Returns the opening tag of the dollar-quoted string at the start of q
+ * (e.g. "$$" or "$body$"), or "" if there is none (e.g. a "$1" placeholder).
+ */
+func dollarQuoteTag(q string) string {
+	j := 1
+	for j < len(q) && isSQLIdentifierByte(q[j], j == 1) {
+		j++
+	}
+	if j < len(q) && q[j] == '$' {
+		return q[:j+1]
+	}
+	return ""
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+/*
+ * Counts the placeholders in the query, either positional ("?") or
+ * numbered ("$1"), ignoring those inside string literals or quoted
+ * identifiers. Returns false if no placeholders were found, since the query
+ * may use a syntax we do not recognize (e.g. "@p1").
+ */
+func countSQLPlaceholders(q string) (int, bool) {
+	var positional, numbered int
+	var quote byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			positional++
+		case c == '$':
+			j := i + 1
+			for j < len(q) && q[j] >= '0' && q[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(q[i+1 : j]); err == nil && n > numbered {
+				numbered = n
+			}
+			i = j - 1
+		}
+	}
+
+	if numbered > 0 {
+		return numbered, true
+	}
+	return positional, positional > 0
+}
+
+func isSQLIdentifierByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(!first && c >= '0' && c <= '9')
+}
+
+/*
+ * Replaces each named placeholder (":name") in the query with the result
+ * of placeholder(n), where n is the 1-based position of the placeholder.
+ * Ignores those inside string literals or quoted identifiers as well as
+ * casts (e.g. "a::int"). Returns the rewritten query and the placeholder
+ * names in order.
+ */
+func bindNamedSQLPlaceholders(q string, placeholder func(n int) string) (string, []string) {
+	var out strings.Builder
+	var names []string
+	var quote byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' && i+1 < len(q) {
+				out.WriteByte(c)
+				i++
+				c = q[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == ':' && i+1 < len(q) && q[i+1] == ':':
+			out.WriteString("::")
+			i++
+			continue
+		case c == ':' && i+1 < len(q) && isSQLIdentifierByte(q[i+1], true):
+			j := i + 1
+			for j < len(q) && isSQLIdentifierByte(q[j], false) {
+				j++
+			}
+			names = append(names, q[i+1:j])
+			out.WriteString(placeholder(len(names)))
+			i = j - 1
+			continue
+		}
+		out.WriteByte(c)
+	}
+	return out.String(), names
+}
+
+func questionPlaceholder(n int) string {
+	return "?"
+}
+
+func dollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func sqlServerPlaceholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+// The connection params used when -params is not given.
+const mySQLDefaultParams = "allowAllFiles=true&interpolateParams=true&allowCleartextPasswords=true&tls=preferred"
+const postgresDefaultParams = "sslmode=disable"
+
 func mySQLDataSourceName(cc *ConnectionConfig) string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?%s",
 		firstString(cc.Username, "root"),
@@ -222,7 +715,7 @@ func mySQLDataSourceName(cc *ConnectionConfig) string {
 		firstString(cc.Host, "localhost"),
 		firstInt(cc.Port, 3306),
 		firstString(cc.Database, ""),
-		firstString(cc.Params, "allowAllFiles=true&interpolateParams=true&allowCleartextPasswords=true&tls=preferred"))
+		firstString(cc.Params, mySQLDefaultParams))
 }
 
 func postgresDataSourceName(cc *ConnectionConfig) string {
@@ -232,7 +725,7 @@ func postgresDataSourceName(cc *ConnectionConfig) string {
 		firstString(cc.Host, "localhost"),
 		firstInt(cc.Port, 5432),
 		firstString(cc.Database, ""),
-		firstString(cc.Params, "sslmode=disable"))
+		firstString(cc.Params, postgresDefaultParams))
 }
 
 func sqlServerDataSourceName(cc *ConnectionConfig) string {
@@ -255,24 +748,6 @@ func verticaDataSourceName(cc *ConnectionConfig) string {
 		firstString(cc.Params, ""))
 }
 
-func mySQLErrorCodeParser(e error) (string, error) {
-	err, ok := e.(*mysql.MySQLError)
-	if !ok {
-		return "", fmt.Errorf("Unrecognized MySQL error: %v", e)
-	}
-	return fmt.Sprint(err.Number), nil
-}
-
-func postgresErrorCodeParser(e error) (string, error) {
-	err, ok := e.(*pq.Error)
-	if !ok {
-		return "", fmt.Errorf("Unrecognized Postgres error: %v", e)
-	}
-	// err.Code is a pq.ErrorCode type, which is just an alias of string:
-	// https://github.com/lib/pq/blob/cb2b4276bb62435f140cb330f14dea6feeccfe71/error.go#L46
-	return string(err.Code), nil
-}
-
 func unimplementedErrorCodeParser(e error) (string, error) {
 	return "", errors.New("Database flavor currently does not support parsing errors")
 }
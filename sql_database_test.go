@@ -17,36 +17,102 @@
 package main
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 )
 
 func TestSQLCheck(t *testing.T) {
 	var successCases = []struct {
-		in string
+		syntax sqlSyntax
+		in     string
 	}{
-		{"select * from t"},
-		{"   select * from t\n"},
-		{"/*!90620 set interpreter_mode=llvm*/"},
+		{mySQLSyntax, "select * from t"},
+		{mySQLSyntax, "   select * from t\n"},
+		{mySQLSyntax, "/*!90620 set interpreter_mode=llvm*/"},
+		{mySQLSyntax, "select * from t;"},
+		{mySQLSyntax, "select * from t; -- trailing; comment\n"},
+		{mySQLSyntax, "/* a; b */ select 1 # c; d"},
+		{mySQLSyntax, "select ';', \"a;b\", `c;d`, 'it\\'s; x' from t;"},
+		{mySQLSyntax, "select 1--1"},
+		{postgresSyntax, "select $$a; b$$, $body$ c; $$ d $body$ from t;"},
+		{postgresSyntax, "select * from t where a = $1; /* x /* y; */ z; */"},
+		{postgresSyntax, "select 'it''s; x', E'it\\'s; x'"},
+		{sqlServerSyntax, "select 1 -- a; b\n;"},
+		{verticaSyntax, "select 1; /* a; b */"},
 	}
 
 	for _, c := range successCases {
-		if err := checkSQLQuery(c.in); err != nil {
+		if err := c.syntax.checkQuery(c.in); err != nil {
 			t.Errorf("Unexpected error checking query %s: %v",
 				strconv.Quote(c.in), err)
 		}
 	}
 
-	var failCases = []string{
-		"select * from t; select 1",
-		"use db",
-		"begin",
+	var failCases = []struct {
+		syntax sqlSyntax
+		in     string
+	}{
+		{mySQLSyntax, "select * from t; select 1"},
+		{mySQLSyntax, "use db"},
+		{mySQLSyntax, "begin"},
+		{mySQLSyntax, "-- a comment\nbegin"},
+		{mySQLSyntax, "select 1 #; \n; select 2"},
+		{mySQLSyntax, "select 1;--; \nselect 2"},
+		{mySQLSyntax, "-- only a comment"},
+		{postgresSyntax, "select '$$'; select '$$'"},
+		{postgresSyntax, "select 'a\\'; select 1"},
+		{postgresSyntax, "select 1 # not a comment; select 2"},
+		{sqlServerSyntax, "/* /* */ ; */ select 1; select 2"},
+		{verticaSyntax, ";;"},
 	}
 
 	for _, c := range failCases {
-		if err := checkSQLQuery(c); err == nil {
+		if err := c.syntax.checkQuery(c.in); err == nil {
 			t.Errorf("Unexpected success checking query %s",
-				strconv.Quote(c))
+				strconv.Quote(c.in))
+		}
+	}
+}
+
+func TestCountSQLPlaceholders(t *testing.T) {
+	var cases = []struct {
+		in string
+		n  int
+		ok bool
+	}{
+		{"select * from t where a = ? and b = ?", 2, true},
+		{"select * from t where a = $1 and b = $2 or c = $1", 2, true},
+		{"select '?', \"?\", `?`, 'it\\'s ?' from t where a = ?", 1, true},
+		{"select * from t", 0, false},
+		{"select * from t where a = @p1", 0, false},
+	}
+
+	for _, c := range cases {
+		if n, ok := countSQLPlaceholders(c.in); n != c.n || ok != c.ok {
+			t.Errorf("Counting placeholders in %s: expected %d, %v but got %d, %v",
+				strconv.Quote(c.in), c.n, c.ok, n, ok)
+		}
+	}
+}
+
+func TestBindNamedSQLPlaceholders(t *testing.T) {
+	var cases = []struct {
+		in    string
+		out   string
+		names []string
+	}{
+		{"select * from t where a = :a and b = :b_2", "select * from t where a = $1 and b = $2", []string{"a", "b_2"}},
+		{"select ':a', `:a`, 'it\\'s :a' from t where a = :a", "select ':a', `:a`, 'it\\'s :a' from t where a = $1", []string{"a"}},
+		{"select a::int from t where b = :b", "select a::int from t where b = $1", []string{"b"}},
+		{"select * from t", "select * from t", nil},
+	}
+
+	for _, c := range cases {
+		out, names := bindNamedSQLPlaceholders(c.in, dollarPlaceholder)
+		if out != c.out || !reflect.DeepEqual(names, c.names) {
+			t.Errorf("Binding placeholders in %s: expected %s, %v but got %s, %v",
+				strconv.Quote(c.in), strconv.Quote(c.out), c.names, strconv.Quote(out), names)
 		}
 	}
 }
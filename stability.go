@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"sort"
+	"time"
+)
+
+var runUntilStable = flag.Bool("run-until-stable", false,
+	"Stop the test once the p99 latency of every job has stabilized, i.e. "+
+		"changed by at most -stable-tolerance over -stable-windows "+
+		"consecutive intermediate stats intervals, or after "+
+		"-stable-max-duration.")
+var stableTolerance = flag.Float64("stable-tolerance", 0.05,
+	"With -run-until-stable, the largest relative change of the p99 "+
+		"latency between intervals that counts as stable.")
+var stableWindows = flag.Int("stable-windows", 3,
+	"With -run-until-stable, the number of consecutive intervals whose "+
+		"p99 latencies must be stable.")
+var stableMaxDuration = flag.Duration("stable-max-duration", 10*time.Minute,
+	"With -run-until-stable, stop the test after this long even if the "+
+		"latencies have not stabilized.")
+
+func checkStabilityFlags() error {
+	if !(*stableTolerance > 0) {
+		return errors.New("-stable-tolerance must be positive")
+	} else if *stableWindows < 2 {
+		return errors.New("-stable-windows must be at least 2")
+	} else if *stableMaxDuration <= 0 {
+		return errors.New("-stable-max-duration must be positive")
+	} else if *runUntilStable && *updateInterval <= 0 {
+		return errors.New("-run-until-stable requires a positive -intermediate-stats-interval")
+	}
+	return nil
+}
+
+/*
+ * Tracks the p99 latency of each job over the intervals of the test, and
+ * cancels the test once all of them are stable.
+ */
+type stabilityTracker struct {
+	tolerance float64
+	windows   int
+	cancel    context.CancelFunc
+	start     time.Time
+	// The p99 of the last interval of each job, and how many intervals in
+	// a row it changed by at most the tolerance.
+	lastP99 map[string]time.Duration
+	stable  map[string]int
+	// How long the test ran until it stabilized, if it did.
+	converged time.Duration
+}
+
+func newStabilityTracker(tolerance float64, windows int, cancel context.CancelFunc) *stabilityTracker {
+	return &stabilityTracker{
+		tolerance: tolerance,
+		windows:   windows,
+		cancel:    cancel,
+		start:     time.Now(),
+		lastP99:   make(map[string]time.Duration),
+		stable:    make(map[string]int),
+	}
+}
+
+/*
+ * Records the latencies of the interval ending at now, cancelling the test
+ * if the p99 of every job has been stable for the last windows intervals.
+ * Jobs with no transactions in the interval keep their state.
+ */
+func (st *stabilityTracker) Observe(now time.Time, latencies map[string]*queryStats) {
+	if st.converged > 0 {
+		return
+	}
+	for name, qs := range latencies {
+		if qs.Latency.Count() == 0 {
+			continue
+		}
+		p99 := qs.Percentile(0.99)
+		if last, ok := st.lastP99[name]; ok && withinTolerance(last, p99, st.tolerance) {
+			st.stable[name]++
+		} else {
+			st.stable[name] = 0
+		}
+		st.lastP99[name] = p99
+	}
+	if len(st.lastP99) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(st.lastP99))
+	for name := range st.lastP99 {
+		// N stable intervals are N-1 stable changes.
+		if st.stable[name] < st.windows-1 {
+			return
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	st.converged = now.Sub(st.start)
+	for _, name := range names {
+		log.Printf("%s: p99 latency stable at %v", name, st.lastP99[name])
+	}
+	log.Printf("p99 latencies stabilized within %.1f%% over %d intervals after %v; stopping the test",
+		100*st.tolerance, st.windows, st.converged)
+	st.cancel()
+}
+
+func withinTolerance(last, current time.Duration, tolerance float64) bool {
+	if last == 0 {
+		return current == 0
+	}
+	change := float64(current-last) / float64(last)
+	return change <= tolerance && change >= -tolerance
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func latenciesOf(p99s map[string]time.Duration) map[string]*queryStats {
+	latencies := make(map[string]*queryStats)
+	for name, p99 := range p99s {
+		latencies[name] = new(queryStats)
+		latencies[name].Update(&QueryResult{Elapsed: p99})
+	}
+	return latencies
+}
+
+func TestStabilityTracker(t *testing.T) {
+	cancelled := false
+	st := newStabilityTracker(0.05, 3, func() { cancelled = true })
+	ms := func(f float64) time.Duration { return time.Duration(f * float64(time.Millisecond)) }
+
+	for i, interval := range []map[string]time.Duration{
+		{"a": ms(10), "b": ms(5)},
+		{"a": ms(20), "b": ms(5)},
+		{"a": ms(10.2), "b": ms(5.1)},
+		// b had no transactions in this interval.
+		{"a": ms(10)},
+		{"a": ms(10.3), "b": ms(5)},
+	} {
+		if cancelled {
+			t.Fatalf("Expected the test to go on until the 5th interval but it stopped after %d", i)
+		}
+		st.Observe(st.start.Add(time.Duration(i+1)*time.Second), latenciesOf(interval))
+	}
+	if !cancelled {
+		t.Fatal("Expected the test to stop once the p99 of every job was stable for 3 intervals")
+	}
+	if st.converged != 5*time.Second {
+		t.Errorf("Expected the test to converge after 5s but got %v", st.converged)
+	}
+}
+
+func TestRunUntilStable(t *testing.T) {
+	defer func(interval time.Duration, updates bool) {
+		*runUntilStable = false
+		*updateInterval = interval
+		*intermediateUpdates = updates
+	}(*updateInterval, *intermediateUpdates)
+	*runUntilStable = true
+	*updateInterval = 20 * time.Millisecond
+	*intermediateUpdates = false
+
+	config := &Config{
+		Flavor: testFlavor(t, "mysql"),
+		Jobs: map[string]*Job{
+			"steady": &Job{
+				Name: "steady", QueueDepth: 1,
+				Queries: []string{"select 1"},
+			},
+		},
+	}
+
+	start := time.Now()
+	stats := runIterations(&counterDb{delay: time.Millisecond}, config.Flavor, config, 1)[0]["steady"]
+	if elapsed := time.Since(start); elapsed > *stableMaxDuration/2 {
+		t.Errorf("Expected a steady job to stop once stable but it ran for %v", elapsed)
+	}
+	if stats.Queries == 0 {
+		t.Error("Expected the job to run until it was stable")
+	}
+}
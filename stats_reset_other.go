@@ -0,0 +1,30 @@
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "os"
+
+/*
+ * There is no SIGHUP on this platform, so the stats are never reset (a nil
+ * channel never receives).
+ */
+func notifyStatsReset() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var summaryStyle = flag.String("summary-style", "default",
+	"How to print the results of the jobs at the end of the test: 'default' "+
+		"or 'wrk' (laid out like the output of wrk, for comparison with HTTP "+
+		"load testing tools). Does not affect output files.")
+
+func checkSummaryStyle(style string) error {
+	switch style {
+	case "default", "wrk":
+		return nil
+	}
+	return fmt.Errorf("invalid -summary-style %q (expected 'default' or 'wrk')", style)
+}
+
+/*
+ * Formats a duration like wrk does, e.g. "635.91us" or "12.92ms".
+ */
+func formatWrkDuration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return fmt.Sprintf("%.2fus", float64(d)/float64(time.Microsecond))
+	case d < time.Second:
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	case d < time.Minute:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	default:
+		return fmt.Sprintf("%.2fm", d.Minutes())
+	}
+}
+
+/*
+ * Formats a count like wrk does, e.g. "812.40" or "56.20k".
+ */
+func formatWrkCount(f float64) string {
+	switch {
+	case f < 1e3:
+		return fmt.Sprintf("%.2f", f)
+	case f < 1e6:
+		return fmt.Sprintf("%.2fk", f/1e3)
+	default:
+		return fmt.Sprintf("%.2fM", f/1e6)
+	}
+}
+
+/*
+ * Writes the summary of each job laid out like the output of wrk, where a
+ * request is a transaction of the job.
+ */
+func writeWrkSummary(w io.Writer, summaries map[string]*JobStatsSummary) error {
+	names := make([]string, 0, len(summaries))
+	for name := range summaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var str strings.Builder
+	for _, name := range names {
+		s := summaries[name]
+		fmt.Fprintf(&str, "Job %s\n", name)
+		fmt.Fprintf(&str, "  %-12s %9s %9s %9s\n", "Job Stats", "Avg", "Stdev", "Max")
+		fmt.Fprintf(&str, "    %-10s %9s %9s %9s\n", "Latency",
+			formatWrkDuration(s.TransactionLatency), formatWrkDuration(s.TransactionLatencyDev),
+			formatWrkDuration(s.TransactionLatencyMax))
+		fmt.Fprintf(&str, "    %-10s %9s %9s %9s\n", "Req/Sec",
+			formatWrkCount(s.TPS), formatWrkCount(s.TPSDev), formatWrkCount(s.TPSMax))
+		if len(s.Percentiles) > 0 {
+			str.WriteString("  Latency Distribution\n")
+			for _, p := range summaryPercentiles {
+				fmt.Fprintf(&str, "  %5s%% %9s\n", strconv.FormatFloat(p.p*100, 'f', -1, 64),
+					formatWrkDuration(s.Percentiles[p.name]))
+			}
+		}
+		fmt.Fprintf(&str, "  %d requests in %s, %d rows read\n",
+			s.Transactions, formatWrkDuration(s.Stop-s.Start), s.Rows)
+		if s.TotalErrors > 0 {
+			fmt.Fprintf(&str, "  Errors: %d (%d accepted, %d tolerated, %d failing)\n",
+				s.TotalErrors, s.AcceptedErrors, s.ToleratedErrors, s.FailingErrors)
+		}
+		fmt.Fprintf(&str, "Requests/sec: %10.2f\n", s.TPS)
+		fmt.Fprintf(&str, "Rows/sec:     %10.2f\n", s.RPS)
+	}
+	_, err := io.WriteString(w, str.String())
+	return err
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWrkSummary(t *testing.T) {
+	summaries := map[string]*JobStatsSummary{
+		"lookups": &JobStatsSummary{
+			Transactions: 1122373, TPS: 112077.54, TPSDev: 8070, TPSMax: 120000,
+			TransactionLatency:    635910 * time.Nanosecond,
+			TransactionLatencyDev: 890 * time.Microsecond,
+			TransactionLatencyMax: 12920 * time.Microsecond,
+			Percentiles: map[string]time.Duration{
+				"p50": 250 * time.Microsecond, "p75": 491 * time.Microsecond,
+				"p90": 700 * time.Microsecond, "p95": 1200 * time.Microsecond,
+				"p99": 5800 * time.Microsecond, "p999": 11 * time.Millisecond,
+			},
+			Rows: 1122373, RPS: 112077.54,
+			TotalErrors: 10, FailingErrors: 10,
+			Start: 0, Stop: 10010 * time.Millisecond,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeWrkSummary(&buf, summaries); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `Job lookups
+  Job Stats          Avg     Stdev       Max
+    Latency     635.91us  890.00us   12.92ms
+    Req/Sec      112.08k     8.07k   120.00k
+  Latency Distribution
+     50%  250.00us
+     75%  491.00us
+     90%  700.00us
+     95%    1.20ms
+     99%    5.80ms
+   99.9%   11.00ms
+  1122373 requests in 10.01s, 1122373 rows read
+  Errors: 10 (0 accepted, 0 tolerated, 10 failing)
+Requests/sec:  112077.54
+Rows/sec:      112077.54
+`
+	if buf.String() != expected {
+		t.Errorf("Expected summary\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestSummaryPerSecond(t *testing.T) {
+	config := &Config{Flavor: testFlavor(t, "mysql")}
+	stats := new(JobStats)
+	for i := 0; i < 90; i++ {
+		// 10 transactions in the 3rd second, 30 in the 4th and 50 in the
+		// 5th, with latencies from 1ms to 90ms.
+		start := 2*time.Second + time.Duration(i)*time.Millisecond
+		if i >= 10 {
+			start += time.Second
+		}
+		if i >= 40 {
+			start += time.Second
+		}
+		stats.Update(config, &JobResult{
+			Name: "test", Start: start, Elapsed: time.Duration(i+1) * time.Millisecond,
+			Errors: ErrorCounts{},
+		})
+	}
+
+	summary := getJobsSummary(map[string]*JobStats{"test": stats})["test"]
+	if summary.TPSMax != 50 || summary.TPSDev != 20 {
+		t.Errorf("Expected a max of 50 and a stdev of 20 TPS but got %v and %v",
+			summary.TPSMax, summary.TPSDev)
+	}
+	if summary.TransactionLatencyMax != 90*time.Millisecond ||
+		summary.Percentiles["p50"] != 45*time.Millisecond ||
+		summary.Percentiles["p95"] != 86*time.Millisecond ||
+		summary.Percentiles["p99"] != 90*time.Millisecond ||
+		summary.Percentiles["p999"] != 90*time.Millisecond {
+		t.Errorf("Unexpected latencies max %v, percentiles %v",
+			summary.TransactionLatencyMax, summary.Percentiles)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var timeSeriesInterval = flag.Duration("time-series-interval", time.Second,
+	"Width of the windows of the timeSeries of each job in the JSON output "+
+		"(0 to leave it out).")
+
+// The most latencies kept per window of a time series, for its p99.
+const timeSeriesSampleCount = 1000
+
+/*
+ * The transactions of a job that started in a window of the test.
+ */
+type timeSeriesWindow struct {
+	transactions uint64
+	errors       uint64
+	latency      StreamingStats
+	// A uniform sample of the latencies of the successful transactions.
+	latencies []time.Duration
+}
+
+/*
+ * The throughput and latency of a job in a window of its time series, as
+ * reported in the JSON output.
+ */
+type TimeSeriesWindow struct {
+	Time         time.Duration `json:"time"`
+	Transactions uint64        `json:"transactions"`
+	TPS          float64       `json:"transactionsPerSecond"`
+	Errors       uint64        `json:"errors"`
+	Latency      time.Duration `json:"latency"`
+	P99          time.Duration `json:"p99"`
+}
+
+/*
+ * Counts the result in the window it started in.
+ */
+func (js *JobStats) updateTimeSeries(jr *JobResult) {
+	if *timeSeriesInterval <= 0 {
+		return
+	}
+	i := int(jr.Start / *timeSeriesInterval)
+	for len(js.timeSeries) <= i {
+		js.timeSeries = append(js.timeSeries, timeSeriesWindow{})
+	}
+	w := &js.timeSeries[i]
+	if jr.Errors.TotalErrors() > 0 {
+		w.errors++
+		return
+	}
+	w.transactions++
+	w.latency.Add(float64(jr.Elapsed))
+	if len(w.latencies) < timeSeriesSampleCount {
+		w.latencies = append(w.latencies, jr.Elapsed)
+	} else if j := rand.Int63n(int64(w.transactions)); j < timeSeriesSampleCount {
+		w.latencies[j] = jr.Elapsed
+	}
+}
+
+/*
+ * The windows of the time series of the job, from the first in which it
+ * ran.
+ */
+func (js *JobStats) TimeSeries() []TimeSeriesWindow {
+	var series []TimeSeriesWindow
+	for i, w := range js.timeSeries {
+		if series == nil && w.transactions == 0 && w.errors == 0 {
+			continue
+		}
+		window := TimeSeriesWindow{
+			Time:         time.Duration(i) * *timeSeriesInterval,
+			Transactions: w.transactions,
+			TPS:          float64(w.transactions) / timeSeriesInterval.Seconds(),
+			Errors:       w.errors,
+		}
+		if len(w.latencies) > 0 {
+			window.Latency = time.Duration(w.latency.Mean())
+			window.P99 = durationPercentile(append([]time.Duration(nil), w.latencies...), 0.99)
+		}
+		series = append(series, window)
+	}
+	return series
+}
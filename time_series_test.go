@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeSeries(t *testing.T) {
+	defer func(interval time.Duration) { *timeSeriesInterval = interval }(*timeSeriesInterval)
+	*timeSeriesInterval = 500 * time.Millisecond
+
+	var js JobStats
+	for _, jr := range []*JobResult{
+		{Start: 600 * time.Millisecond, Elapsed: time.Millisecond},
+		{Start: 700 * time.Millisecond, Elapsed: 3 * time.Millisecond},
+		{Start: 800 * time.Millisecond, Elapsed: time.Second, Errors: ErrorCounts{"1205": errorCounts{errorsPerQuery{"q": 1}, nil, nil}}},
+		{Start: 1600 * time.Millisecond, Elapsed: 2 * time.Millisecond},
+	} {
+		js.updateTimeSeries(jr)
+	}
+
+	// The windows start at the first in which the job ran, and include
+	// those in which it stalled.
+	expected := []TimeSeriesWindow{
+		{Time: 500 * time.Millisecond, Transactions: 2, TPS: 4, Errors: 1,
+			Latency: 2 * time.Millisecond, P99: 3 * time.Millisecond},
+		{Time: time.Second},
+		{Time: 1500 * time.Millisecond, Transactions: 1, TPS: 2,
+			Latency: 2 * time.Millisecond, P99: 2 * time.Millisecond},
+	}
+	if series := js.TimeSeries(); !reflect.DeepEqual(series, expected) {
+		t.Errorf("Expected %+v but got %+v", expected, series)
+	}
+
+	*timeSeriesInterval = 0
+	js = JobStats{}
+	js.updateTimeSeries(&JobResult{Start: time.Second, Elapsed: time.Millisecond})
+	if series := js.TimeSeries(); series != nil {
+		t.Errorf("Expected no time series but got %+v", series)
+	}
+}
+
+func TestTimeSeriesSample(t *testing.T) {
+	var js JobStats
+	for i := 0; i < 10*timeSeriesSampleCount; i++ {
+		js.updateTimeSeries(&JobResult{Elapsed: time.Duration(i)})
+	}
+	if n := len(js.timeSeries[0].latencies); n != timeSeriesSampleCount {
+		t.Errorf("Expected %d latencies to be kept but got %d", timeSeriesSampleCount, n)
+	}
+	if w := js.TimeSeries()[0]; w.Transactions != uint64(10*timeSeriesSampleCount) || w.P99 < 9*timeSeriesSampleCount {
+		t.Errorf("Expected a p99 near %d over %d transactions but got %+v",
+			10*timeSeriesSampleCount, 10*timeSeriesSampleCount, w)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"time"
+)
+
+/*
+ * Like the query-stats-file, the timing file is opened when we first parse
+ * the flags (i.e. before we change our base directory).
+ */
+var timingFile WriteFileFlagValue
+
+func init() {
+	flag.Var(&timingFile, "timing-file",
+		"Write the start and duration of the setup, the measured run, the "+
+			"cooldown (writing the results) and the teardown of the test to "+
+			"this file as JSON.")
+}
+
+type PhaseTiming struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+}
+
+/*
+ * Where the wall-clock time of a test went. The phases are consecutive, so
+ * their durations add up to the total.
+ */
+type RunTiming struct {
+	Start  time.Time     `json:"start"`
+	Total  time.Duration `json:"total"`
+	Phases []PhaseTiming `json:"phases"`
+}
+
+func newRunTiming(start time.Time) *RunTiming {
+	return &RunTiming{Start: start}
+}
+
+/*
+ * Ends the current phase, which started when the previous one ended, at the
+ * given time.
+ */
+func (rt *RunTiming) Mark(name string, now time.Time) {
+	start := rt.Start.Add(rt.Total)
+	rt.Phases = append(rt.Phases, PhaseTiming{name, start, now.Sub(start)})
+	rt.Total = now.Sub(rt.Start)
+}
+
+func (rt *RunTiming) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(rt)
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRunTiming(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	timing := newRunTiming(start)
+	timing.Mark("setup", start.Add(3*time.Minute))
+	timing.Mark("run", start.Add(8*time.Minute))
+	timing.Mark("cooldown", start.Add(8*time.Minute+time.Second))
+	timing.Mark("teardown", start.Add(10*time.Minute))
+
+	var buf bytes.Buffer
+	if err := timing.Write(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var parsed RunTiming
+	if err := json.Unmarshal(buf.Bytes(), &parsed); err != nil {
+		t.Fatalf("Error parsing timing %s: %v", buf.String(), err)
+	}
+
+	if parsed.Total != 10*time.Minute {
+		t.Errorf("Expected a total of 10m but got %v", parsed.Total)
+	}
+	var sum time.Duration
+	for i, phase := range parsed.Phases {
+		if expected := start.Add(sum); !phase.Start.Equal(expected) {
+			t.Errorf("Expected %s to start at %v but got %v", phase.Name, expected, phase.Start)
+		}
+		sum += phase.Duration
+		if i == 1 && (phase.Name != "run" || phase.Duration != 5*time.Minute) {
+			t.Errorf("Unexpected run phase %+v", phase)
+		}
+	}
+	if len(parsed.Phases) != 4 || sum != parsed.Total {
+		t.Errorf("Expected 4 phases adding up to %v but got %+v", parsed.Total, parsed.Phases)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// The values of -tls-mode, named as the sslmode of Postgres.
+const (
+	tlsModeDisable    = "disable"
+	tlsModeRequire    = "require"
+	tlsModeVerifyCA   = "verify-ca"
+	tlsModeVerifyFull = "verify-full"
+)
+
+/*
+ * Configures the connection of a flavor to use the TLS mode and
+ * certificates of the connection config, returning a function that cleans
+ * up once the connections are closed. Registered by the flavors that
+ * support -tls-mode.
+ */
+type tlsConfigFunc func(cc *ConnectionConfig) (func(), error)
+
+var tlsConfigFuncs = make(map[string]tlsConfigFunc)
+
+/*
+ * Checks that the TLS mode is known and that the certificates make sense
+ * with it.
+ */
+func checkTLSConfig(cc *ConnectionConfig) error {
+	switch cc.TLSMode {
+	case "", tlsModeDisable, tlsModeRequire, tlsModeVerifyCA, tlsModeVerifyFull:
+	default:
+		return fmt.Errorf("-tls-mode must be disable, require, verify-ca or verify-full, not %q", cc.TLSMode)
+	}
+	if (cc.TLSClientCert == "") != (cc.TLSClientKey == "") {
+		return errors.New("-tls-client-cert and -tls-client-key must be given together")
+	}
+	hasFiles := cc.TLSCACert != "" || cc.TLSClientCert != ""
+	if hasFiles && cc.TLSMode == "" {
+		return errors.New("-tls-ca-cert and -tls-client-cert require -tls-mode")
+	}
+	if hasFiles && cc.TLSMode == tlsModeDisable {
+		return errors.New("cannot use -tls-ca-cert or -tls-client-cert with -tls-mode=disable")
+	}
+	if cc.TLSMode != "" && *tlsPKCS12File != "" {
+		return errors.New("cannot use -tls-pkcs12 with -tls-mode (use -tls-client-cert and -tls-client-key instead)")
+	}
+	return nil
+}
+
+/*
+ * Configures the connection to use the TLS mode of -tls-mode, if given.
+ * Returns a function to call once the connections are closed.
+ */
+func applyTLSConfig(flavor DatabaseFlavor, cc *ConnectionConfig) (func(), error) {
+	if err := checkTLSConfig(cc); err != nil {
+		return nil, err
+	}
+	if cc.TLSMode == "" {
+		return func() {}, nil
+	}
+	name := flavorName(flavor)
+	apply, ok := tlsConfigFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("-tls-mode is not supported with the %s driver", name)
+	}
+	return apply(cc)
+}
+
+/*
+ * Builds the TLS config for connecting to the host, for the drivers that
+ * take a tls.Config. Only verify-full checks that the server certificate
+ * is for the host; verify-ca checks its chain, and require nothing.
+ */
+func newTLSConfig(cc *ConnectionConfig, host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host}
+	if cc.TLSClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cc.TLSClientCert, cc.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading -tls-client-cert: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if cc.TLSCACert != "" {
+		data, err := ioutil.ReadFile(cc.TLSCACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate in -tls-ca-cert %s", cc.TLSCACert)
+		}
+	}
+
+	switch cc.TLSMode {
+	case tlsModeRequire:
+		config.InsecureSkipVerify = true
+	case tlsModeVerifyCA:
+		// The default verification also checks the host, so skip it and
+		// verify the chain ourselves.
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = verifyCertificateChain(config.RootCAs)
+	}
+	return config, nil
+}
+
+/*
+ * Returns a function that verifies that the certificates sent by the
+ * server chain up to one of the roots (or of the system, if nil), whatever
+ * host they are for.
+ */
+func verifyCertificateChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("the server sent no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}
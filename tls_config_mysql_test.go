@@ -0,0 +1,47 @@
+//go:build mysql || !(mysql || postgres || mssql || vertica)
+// +build mysql !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMySQLTLSConfigParams(t *testing.T) {
+	cc := ConnectionConfig{TLSMode: "verify-full", TLSCACert: "testdata/ca.pem",
+		TLSClientCert: "testdata/client.pem", TLSClientKey: "testdata/client-key.pem",
+		Params: "parseTime=true"}
+	cleanup, err := mySQLTLSConfig(&cc)
+	if err != nil {
+		t.Fatalf("Error configuring mysql: %v", err)
+	}
+	defer cleanup()
+	if expected := "parseTime=true&tls=" + mySQLTLSConfigName; cc.Params != expected {
+		t.Errorf("Expected params %s but got %s", expected, cc.Params)
+	}
+
+	cc = ConnectionConfig{TLSMode: "disable"}
+	if _, err := mySQLTLSConfig(&cc); err != nil {
+		t.Fatalf("Error configuring mysql: %v", err)
+	}
+	if params, _ := url.ParseQuery(cc.Params); params.Get("tls") != "false" {
+		t.Errorf("Expected tls=false but got %s", cc.Params)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build postgres || !(mysql || postgres || mssql || vertica)
+// +build postgres !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPostgresTLSConfigParams(t *testing.T) {
+	cc := ConnectionConfig{TLSMode: "verify-full", TLSCACert: "testdata/ca.pem",
+		TLSClientCert: "testdata/client.pem", TLSClientKey: "testdata/client-key.pem"}
+	if _, err := postgresTLSConfig(&cc); err != nil {
+		t.Fatalf("Error configuring postgres: %v", err)
+	}
+	params, _ := url.ParseQuery(cc.Params)
+	if params.Get("sslmode") != "verify-full" || params.Get("sslrootcert") != "testdata/ca.pem" ||
+		params.Get("sslkey") != "testdata/client-key.pem" {
+		t.Errorf("Expected the TLS params but got %s", cc.Params)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckTLSConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cc  ConnectionConfig
+		err string
+	}{
+		{ConnectionConfig{}, ""},
+		{ConnectionConfig{TLSMode: "verify-full", TLSCACert: "ca.pem"}, ""},
+		{ConnectionConfig{TLSMode: "prefer"}, "-tls-mode must be"},
+		{ConnectionConfig{TLSMode: "require", TLSClientCert: "client.pem"}, "given together"},
+		{ConnectionConfig{TLSCACert: "ca.pem"}, "require -tls-mode"},
+		{ConnectionConfig{TLSMode: "disable", TLSCACert: "ca.pem"}, "-tls-mode=disable"},
+	} {
+		err := checkTLSConfig(&tc.cc)
+		if tc.err == "" && err != nil {
+			t.Errorf("Expected %+v to be valid but got %v", tc.cc, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("Expected %+v to fail with %q but got %v", tc.cc, tc.err, err)
+		}
+	}
+}
+
+/*
+ * Runs a TLS handshake with a server for localhost, signed by the test CA,
+ * as the client of the connection config connecting to the host.
+ */
+func tlsHandshake(t *testing.T, cc *ConnectionConfig, host string) error {
+	config, err := newTLSConfig(cc, host)
+	if err != nil {
+		t.Fatalf("Error building TLS config: %v", err)
+	}
+	cert, err := tls.LoadX509KeyPair("testdata/server.pem", "testdata/server-key.pem")
+	if err != nil {
+		t.Fatalf("Error loading server certificate: %v", err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	go func() {
+		server.Handshake()
+		serverConn.Close()
+	}()
+	return tls.Client(clientConn, config).Handshake()
+}
+
+func TestTLSModeVerification(t *testing.T) {
+	for _, tc := range []struct {
+		mode, ca, host string
+		ok             bool
+	}{
+		{"require", "", "db.example.com", true},
+		{"verify-ca", "testdata/ca.pem", "db.example.com", true},
+		{"verify-ca", "", "localhost", false},
+		{"verify-full", "testdata/ca.pem", "localhost", true},
+		{"verify-full", "testdata/ca.pem", "db.example.com", false},
+	} {
+		cc := ConnectionConfig{TLSMode: tc.mode, TLSCACert: tc.ca}
+		if err := tlsHandshake(t, &cc, tc.host); (err == nil) != tc.ok {
+			t.Errorf("Expected -tls-mode=%s -tls-ca-cert=%q with host %s to succeed: %v but got %v",
+				tc.mode, tc.ca, tc.host, tc.ok, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+var tlsPKCS12File = flag.String("tls-pkcs12", "",
+	"Authenticate to the database with the client certificate and key in "+
+		"this PKCS#12 (.p12 or .pfx) bundle. Supported with the mysql and "+
+		"postgres drivers.")
+var tlsPKCS12Password = flag.String("tls-pkcs12-password", "",
+	"The passphrase of the -tls-pkcs12 bundle.")
+
+/*
+ * A client certificate (with the certificates of its chain, if any) and
+ * its private key, both as PEM.
+ */
+type clientCertificate struct {
+	Certificate tls.Certificate
+	CertPEM     []byte
+	KeyPEM      []byte
+}
+
+/*
+ * Configures the connection of a flavor to use a client certificate,
+ * returning a function that cleans up once the connections are closed.
+ * Registered by the flavors that support client certificates.
+ */
+type clientCertificateFunc func(cc *ConnectionConfig, cert *clientCertificate) (func(), error)
+
+var clientCertificateFuncs = make(map[string]clientCertificateFunc)
+
+/*
+ * Decodes the client certificate and key of a PKCS#12 bundle. The bundle
+ * must have a single private key, and a certificate that matches it; other
+ * certificates are added to its chain.
+ */
+func decodePKCS12(data []byte, password string) (*clientCertificate, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err == pkcs12.ErrIncorrectPassword {
+		return nil, errors.New("wrong passphrase (see -tls-pkcs12-password)")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var keyPEM []byte
+	var certs [][]byte
+	for _, block := range blocks {
+		// Drop the attributes of the bags (e.g. friendlyName).
+		encoded := pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})
+		switch block.Type {
+		case "PRIVATE KEY":
+			if keyPEM != nil {
+				return nil, errors.New("bundle has more than one private key")
+			}
+			keyPEM = encoded
+		case "CERTIFICATE":
+			certs = append(certs, encoded)
+		}
+	}
+	if keyPEM == nil {
+		return nil, errors.New("bundle has no private key")
+	}
+
+	// The leaf certificate comes first, followed by the rest of the chain.
+	for i, leaf := range certs {
+		chain := append([][]byte{leaf}, certs[:i]...)
+		chain = append(chain, certs[i+1:]...)
+		certPEM := bytes.Join(chain, nil)
+		if cert, err := tls.X509KeyPair(certPEM, keyPEM); err == nil {
+			return &clientCertificate{cert, certPEM, keyPEM}, nil
+		}
+	}
+	return nil, errors.New("bundle has no certificate matching its private key")
+}
+
+/*
+ * Configures the connection to use the client certificate of -tls-pkcs12,
+ * if given. Returns a function to call once the connections are closed.
+ */
+func applyTLSPKCS12(flavor DatabaseFlavor, cc *ConnectionConfig) (func(), error) {
+	if *tlsPKCS12File == "" {
+		return func() {}, nil
+	}
+	name := flavorName(flavor)
+	apply, ok := clientCertificateFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("-tls-pkcs12 is not supported with the %s driver", name)
+	}
+	data, err := ioutil.ReadFile(*tlsPKCS12File)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := decodePKCS12(data, *tlsPKCS12Password)
+	if err != nil {
+		return nil, fmt.Errorf("decoding -tls-pkcs12 bundle %s: %v", *tlsPKCS12File, err)
+	}
+	return apply(cc, cert)
+}
@@ -0,0 +1,41 @@
+//go:build mysql || !(mysql || postgres || mssql || vertica)
+// +build mysql !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMySQLClientCertificateParams(t *testing.T) {
+	cert, err := readTestPKCS12(t, "secret")
+	if err != nil {
+		t.Fatalf("Error decoding bundle: %v", err)
+	}
+
+	cc := ConnectionConfig{Params: "tls=true&parseTime=true"}
+	cleanup, err := mySQLClientCertificate(&cc, cert)
+	if err != nil {
+		t.Fatalf("Error configuring mysql: %v", err)
+	}
+	defer cleanup()
+	if expected := "parseTime=true&tls=" + mySQLClientCertificateTLS; cc.Params != expected {
+		t.Errorf("Expected params %s but got %s", expected, cc.Params)
+	}
+}
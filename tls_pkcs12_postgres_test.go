@@ -0,0 +1,53 @@
+//go:build postgres || !(mysql || postgres || mssql || vertica)
+// +build postgres !mysql,!postgres,!mssql,!vertica
+
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestPostgresClientCertificateParams(t *testing.T) {
+	cert, err := readTestPKCS12(t, "secret")
+	if err != nil {
+		t.Fatalf("Error decoding bundle: %v", err)
+	}
+
+	cc := ConnectionConfig{}
+	cleanup, err := postgresClientCertificate(&cc, cert)
+	if err != nil {
+		t.Fatalf("Error configuring postgres: %v", err)
+	}
+	params, _ := url.ParseQuery(cc.Params)
+	if params.Get("sslmode") != "require" {
+		t.Errorf("Expected sslmode=require but got params %s", cc.Params)
+	}
+	keyFile := params.Get("sslkey")
+	if key, err := ioutil.ReadFile(keyFile); err != nil || !bytes.Equal(key, cert.KeyPEM) {
+		t.Errorf("Expected the key in sslkey %s but got %v", keyFile, err)
+	}
+	cleanup()
+	if _, err := os.Stat(keyFile); !os.IsNotExist(err) {
+		t.Errorf("Expected sslkey %s to be removed but got %v", keyFile, err)
+	}
+}
@@ -85,6 +85,14 @@ func firstInt(c, d int) int {
 	}
 }
 
+func firstFloat64(c, d float64) float64 {
+	if c != 0 {
+		return c
+	} else {
+		return d
+	}
+}
+
 func quotedValue(i interface{}) string {
 	switch v := i.(type) {
 	default:
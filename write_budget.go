@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * Caps the estimated number of bytes written by one or more jobs, calling
+ * cancel once the cap is reached.
+ */
+type WriteBudget struct {
+	name    string
+	max     int64
+	written int64
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+func NewWriteBudget(name string, max int64, cancel context.CancelFunc) *WriteBudget {
+	return &WriteBudget{name: name, max: max, cancel: cancel}
+}
+
+func (wb *WriteBudget) Add(n int64) {
+	if n == 0 {
+		return
+	}
+	if written := atomic.AddInt64(&wb.written, n); written >= wb.max {
+		wb.once.Do(func() {
+			log.Printf("%s: wrote an estimated %d bytes, reaching max-write-bytes %d",
+				wb.name, written, wb.max)
+			wb.cancel()
+		})
+	}
+}
+
+func (wb *WriteBudget) Written() int64 {
+	return atomic.LoadInt64(&wb.written)
+}
+
+/*
+ * Whether the query writes data, i.e. it sends a payload that counts
+ * towards max-write-bytes.
+ */
+func isWriteQuery(q string) bool {
+	fields := strings.Fields(q)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "insert", "update", "replace", "upsert", "merge":
+		return true
+	}
+	return false
+}
+
+/*
+ * Estimates the bytes sent to the server by a write query: the text of the
+ * query and of its args. Returns 0 for queries that do not write.
+ */
+func estimateWriteBytes(q string, args []interface{}) int64 {
+	if !isWriteQuery(q) {
+		return 0
+	}
+	n := int64(len(q))
+	for _, arg := range args {
+		n += int64(len(fmt.Sprint(arg)))
+	}
+	return n
+}
+
+/*
+ * Parses a number of bytes with an optional binary unit suffix (e.g. "10MB"
+ * or "1.5G").
+ */
+func parseByteSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = int64(1) << (10 * uint(i+1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %s", strconv.Quote(v))
+	} else if f <= 0 {
+		return 0, errors.New("byte size must be positive")
+	}
+	return int64(f * float64(multiplier)), nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2020 by MemSQL. All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	var cases = []struct {
+		in  string
+		out int64
+	}{
+		{"100", 100},
+		{"1k", 1024},
+		{"10MB", 10 << 20},
+		{"1.5G", 3 << 29},
+		{" 2 TB ", 2 << 40},
+	}
+	for _, c := range cases {
+		if out, err := parseByteSize(c.in); err != nil || out != c.out {
+			t.Errorf("Parsing %s: expected %d but got %d, %v", strconv.Quote(c.in), c.out, out, err)
+		}
+	}
+
+	for _, c := range []string{"", "MB", "-1", "0", "10 PB"} {
+		if _, err := parseByteSize(c); err == nil {
+			t.Errorf("Unexpected success parsing %s", strconv.Quote(c))
+		}
+	}
+}
+
+func TestWriteBudget(t *testing.T) {
+	if n := estimateWriteBytes("select ?", []interface{}{"abc"}); n != 0 {
+		t.Errorf("Expected no bytes written by a select but got %d", n)
+	}
+	if n := estimateWriteBytes("insert into t values (?)", []interface{}{"abc"}); n != 27 {
+		t.Errorf("Expected 27 bytes written by an insert but got %d", n)
+	}
+
+	cancelled := 0
+	wb := NewWriteBudget("test", 10, func() { cancelled++ })
+	wb.Add(6)
+	if cancelled != 0 {
+		t.Errorf("Unexpected cancel under the budget")
+	}
+	wb.Add(6)
+	wb.Add(6)
+	if cancelled != 1 || wb.Written() != 18 {
+		t.Errorf("Expected a single cancel after 18 bytes but got %d after %d", cancelled, wb.Written())
+	}
+}